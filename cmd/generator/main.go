@@ -4,218 +4,124 @@ import (
 	"flag"
 	"fmt"
 	"os"
-	"path/filepath"
 	"strings"
 
 	"github.com/matinhimself/singbox-web-config/internal/generator"
 )
 
-// ConfigCategory represents a category of config types to generate
-type ConfigCategory struct {
-	Name       string
-	FileFilter func(string) bool
-	OutputFile string
-}
-
-var configCategories = []ConfigCategory{
-	{
-		Name: "Main",
-		FileFilter: generator.FileFilterByNames("options.go"),
-		OutputFile: "config.go",
-	},
-	{
-		Name:       "Rules",
-		FileFilter: generator.FileFilterByPrefix("rule"),
-		OutputFile: "rules.go",
-	},
-	{
-		Name: "DNS",
-		FileFilter: generator.FileFilterByNames("dns.go"),
-		OutputFile: "dns.go",
-	},
-	{
-		Name: "Inbounds",
-		FileFilter: generator.FileFilterByPrefix("inbound"),
-		OutputFile: "inbounds.go",
-	},
-	{
-		Name: "Outbounds",
-		FileFilter: generator.FileFilterByPrefix("outbound"),
-		OutputFile: "outbounds.go",
-	},
-	{
-		Name: "Route",
-		FileFilter: generator.FileFilterByNames("route.go", "route_action.go"),
-		OutputFile: "route.go",
-	},
-	{
-		Name: "NTP",
-		FileFilter: generator.FileFilterByNames("ntp.go"),
-		OutputFile: "ntp.go",
-	},
-	{
-		Name: "Experimental",
-		FileFilter: generator.FileFilterByNames("experimental.go"),
-		OutputFile: "experimental.go",
-	},
-}
-
 func main() {
 	var (
 		repoURL    = flag.String("repo", generator.DefaultRepoURL, "Sing-box repository URL")
 		branch     = flag.String("branch", generator.DefaultBranch, "Branch to use")
+		commitHash = flag.String("commit", "", "Pin generation to a specific sing-box commit")
+		tag        = flag.String("tag", "", "Pin generation to a specific sing-box tag")
 		localPath  = flag.String("local", "", "Use local repository path instead of cloning")
 		outputDir  = flag.String("output", "internal/types", "Output directory for generated types")
 		skipUpdate = flag.Bool("skip-update", false, "Skip repository update")
-		categories = flag.String("categories", "all", "Comma-separated list of categories to generate (all, main, rules, dns, inbounds, outbounds, route, ntp, experimental)")
+		offline    = flag.Bool("offline", false, "Use the cached repository without any network access")
+		maxAge     = flag.Duration("max-age", generator.DefaultMaxAge, "Skip fetching when the cached repository was updated more recently than this")
+		categories = flag.String("categories", "all", "Comma-separated list of categories to generate (all, main, rules, dns, inbounds, outbounds, route, ntp, experimental); name=glob or name=/regex/ selects a category's files")
+		force      = flag.Bool("force", false, "Regenerate all categories even if their source is unchanged")
+		strict     = flag.Bool("strict", false, "Exit with an error on any warning")
+		dryRun     = flag.Bool("dry-run", false, "Parse and extract types and list the files that would be written, without writing anything")
+		showDiff   = flag.Bool("diff", false, "With --dry-run, print a diff of each file against the existing one")
+		check      = flag.Bool("check", false, "With --dry-run, exit with an error if any file would change")
 	)
 
 	flag.Parse()
 
-	fmt.Println("Sing-Box Type Generator")
-	fmt.Println("=======================")
-	fmt.Println()
-
-	// Setup repository manager
-	repoManager := generator.NewRepositoryManager().
-		WithRepoURL(*repoURL).
-		WithBranch(*branch)
-
-	if *localPath != "" {
-		repoManager.WithLocalPath(*localPath)
-		fmt.Printf("Using local repository: %s\n", *localPath)
-	} else {
-		fmt.Printf("Repository: %s\n", *repoURL)
-		fmt.Printf("Branch: %s\n", *branch)
+	if (*showDiff || *check) && !*dryRun {
+		fmt.Fprintln(os.Stderr, "Error: --diff and --check require --dry-run")
+		os.Exit(2)
 	}
 
-	// Update repository
-	if !*skipUpdate {
-		if err := repoManager.Update(); err != nil {
-			fmt.Fprintf(os.Stderr, "Error updating repository: %v\n", err)
-			os.Exit(1)
-		}
-	}
-
-	// Get repository info
-	commit, err := repoManager.GetCommitHash()
+	selected, err := generator.ParseCategories(*categories)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Warning: failed to get commit hash: %v\n", err)
-		commit = "unknown"
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
 	}
 
-	fmt.Printf("Commit: %s\n", commit)
+	fmt.Println("Sing-Box Type Generator")
+	fmt.Println("=======================")
 	fmt.Println()
 
-	// Parse requested categories
-	requestedCategories := parseCategories(*categories)
-
-	optionPath := repoManager.GetRulePath()
-	if _, err := os.Stat(optionPath); os.IsNotExist(err) {
-		fmt.Fprintf(os.Stderr, "Error: option directory not found at %s\n", optionPath)
-		fmt.Fprintf(os.Stderr, "Please ensure the sing-box repository is cloned correctly\n")
-		os.Exit(1)
-	}
-
-	// Generate code
-	absOutputDir, err := filepath.Abs(*outputDir)
+	result, err := generator.Generate(generator.GenerateOptions{
+		RepoURL:    *repoURL,
+		Branch:     *branch,
+		Commit:     *commitHash,
+		Tag:        *tag,
+		LocalPath:  *localPath,
+		SkipUpdate: *skipUpdate,
+		Offline:    *offline,
+		MaxAge:     *maxAge,
+		OutputDir:  *outputDir,
+		Categories: selected,
+		Force:      *force,
+		DryRun:     *dryRun,
+		Log:        os.Stdout,
+	})
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error resolving output directory: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 
-	codeGen := generator.NewCodeGenerator(absOutputDir)
-	codeGen.Metadata.SingBoxCommit = commit
-	codeGen.Metadata.SingBoxBranch = *branch
-
-	totalTypes := 0
-	totalFiles := 0
-
-	// Process each category
-	for _, category := range requestedCategories {
-		fmt.Printf("\n=== Processing %s ===\n", category.Name)
-		fmt.Printf("Parsing files from: %s\n", optionPath)
-
-		parser := generator.NewParser(optionPath).WithFileFilter(category.FileFilter)
-		files, err := parser.ParseDirectory()
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error parsing files for %s: %v\n", category.Name, err)
-			continue
-		}
-
-		if len(files) == 0 {
-			fmt.Printf("No files found for %s, skipping...\n", category.Name)
-			continue
-		}
-
-		// Extract types
-		extractor := generator.NewTypeExtractor(files)
-		types, err := extractor.ExtractRuleTypes()
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error extracting types for %s: %v\n", category.Name, err)
-			continue
-		}
-
-		if len(types) == 0 {
-			fmt.Printf("No types extracted for %s, skipping...\n", category.Name)
-			continue
-		}
-
-		// Print extracted types
-		fmt.Printf("\nExtracted types for %s:\n", category.Name)
-		for _, t := range types {
-			if t.IsInterface {
-				fmt.Printf("  - %s (interface)\n", t.Name)
-			} else {
-				fmt.Printf("  - %s (%d fields)\n", t.Name, len(t.Fields))
-			}
-		}
+	outOfDate := 0
+	if *dryRun {
+		outOfDate = reportDryRun(result, *showDiff)
+	} else {
+		fmt.Println()
+		fmt.Println("✓ Generation complete!")
+		fmt.Printf("  Output: %s\n", result.OutputDir)
+		fmt.Printf("  Categories: %d\n", result.Categories)
+		fmt.Printf("  Types: %d\n", result.Types)
+	}
 
-		// Generate to specific file
-		if err := codeGen.GenerateToFile(types, category.OutputFile); err != nil {
-			fmt.Fprintf(os.Stderr, "Error generating code for %s: %v\n", category.Name, err)
-			continue
-		}
+	if len(result.Failed) > 0 {
+		fmt.Fprintf(os.Stderr, "\nError: no types generated because of parse errors in: %s\n", strings.Join(result.Failed, ", "))
+		os.Exit(1)
+	}
 
-		totalTypes += len(types)
-		totalFiles += len(files)
+	if *strict && len(result.Warnings) > 0 {
+		fmt.Fprintf(os.Stderr, "\nError: %d warning(s) reported in strict mode\n", len(result.Warnings))
+		os.Exit(1)
 	}
 
-	// Generate metadata
-	codeGen.Metadata.TypesGenerated = totalTypes
-	codeGen.Metadata.FilesProcessed = totalFiles
-	if err := codeGen.GenerateMetadata(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error generating metadata: %v\n", err)
+	if *check && outOfDate > 0 {
+		fmt.Fprintf(os.Stderr, "\nError: generated code is out of date in %d file(s); run the generator to update it\n", outOfDate)
+		os.Exit(1)
 	}
+}
 
+// reportDryRun lists the files a dry run would have written, with their
+// diffs if asked, and returns how many would change
+func reportDryRun(result generator.GenerateResult, showDiff bool) int {
 	fmt.Println()
-	fmt.Println("✓ Generation complete!")
-	fmt.Printf("  Output: %s\n", absOutputDir)
-	fmt.Printf("  Categories: %d\n", len(requestedCategories))
-	fmt.Printf("  Types: %d\n", totalTypes)
-}
+	fmt.Println("Dry run: no files were written")
+	fmt.Printf("  Types: %d\n", result.Types)
+
+	changed := 0
+	for _, change := range result.Changes {
+		status := "unchanged"
+		if change.Existing == nil {
+			status = "new"
+		} else if change.Changed() {
+			status = "changed"
+		}
+		fmt.Printf("  %-9s %s\n", status, change.Path)
 
-func parseCategories(input string) []ConfigCategory {
-	if input == "all" {
-		return configCategories
+		if change.Changed() {
+			changed++
+		}
 	}
 
-	names := strings.Split(input, ",")
-	var result []ConfigCategory
-
-	for _, name := range names {
-		name = strings.TrimSpace(strings.ToLower(name))
-		for _, cat := range configCategories {
-			if strings.ToLower(cat.Name) == name {
-				result = append(result, cat)
-				break
+	if showDiff {
+		for _, change := range result.Changes {
+			if change.Changed() {
+				fmt.Println()
+				fmt.Print(generator.UnifiedDiff(change.Path, change.Path+" (generated)", change.Existing, change.Generated))
 			}
 		}
 	}
 
-	if len(result) == 0 {
-		return configCategories
-	}
-
-	return result
+	return changed
 }
@@ -1,36 +1,112 @@
 package main
 
 import (
+	"errors"
 	"flag"
-	"log"
+	"fmt"
+	"log/slog"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 
+	"github.com/matinhimself/singbox-web-config/internal/config"
 	"github.com/matinhimself/singbox-web-config/internal/handlers"
+	"github.com/matinhimself/singbox-web-config/internal/service"
 	"github.com/matinhimself/singbox-web-config/webassets"
 )
 
+// devAssetsDir holds web/templates in the repository, read with -dev
+const devAssetsDir = "webassets"
+
 func main() {
-	addr := flag.String("addr", "localhost:8080", "HTTP server address")
+	addr := flag.String("addr", "localhost:8080", "HTTP server address, or unix:PATH to listen on a Unix domain socket")
 	configPath := flag.String("config", "/etc/sing-box/config.json", "Path to sing-box config file")
+	configDir := flag.String("config-dir", "", "Directory of sing-box config fragments merged in name order, used instead of -config")
+	configOverrides := flag.String("config-overrides", config.DefaultOverridesFragment, "Fragment in -config-dir that receives edited sections not owned by a single fragment")
+	backupDir := flag.String("backup-dir", "", "Directory for config backups, \"backups\" next to the config if empty")
 	serviceName := flag.String("service", "sing-box", "Name of sing-box systemd service")
-	clashURL := flag.String("clash", "", "Clash API URL (e.g., http://127.0.0.1:9090 or 127.0.0.1:9090)")
+	clashURL := flag.String("clash", "", "Clash API URL, optionally with a path prefix (e.g., http://127.0.0.1:9090, 127.0.0.1:9090 or https://host/clash/)")
 	clashSecret := flag.String("clash-secret", "", "Clash API secret (optional)")
+	delayTestConcurrency := flag.Int("delay-test-concurrency", handlers.DefaultDelayTestConcurrency, "Maximum number of proxies delay-tested at once in a group test")
+	delayTestRateLimit := flag.Int("delay-test-rate-limit", handlers.DefaultDelayTestRateLimit, "Maximum delay tests per proxy per minute, counting group tests (0 disables)")
+	maxBodySize := flag.Int64("max-body-size", handlers.DefaultMaxBodyBytes, "Maximum request body size in bytes")
+	maxConfigBodySize := flag.Int64("max-config-body-size", handlers.DefaultMaxConfigBodyBytes, "Maximum request body size in bytes for full-config endpoints")
+	requestTimeout := flag.Duration("request-timeout", handlers.DefaultRequestTimeout, "How long a request may take before it is cancelled with a 503, except WebSocket and event streams (0 disables)")
+	fallbackOutbounds := flag.String("fallback-outbounds", strings.Join(handlers.DefaultFallbackOutbounds, ","), "Comma-separated outbound tags offered as rule targets while the config has no outbounds")
+	readOnly := flag.Bool("read-only", false, "Disable every endpoint that changes the config or service")
+	deferReload := flag.Bool("defer-reload", false, "Save changes without reloading sing-box until they are applied")
+	auditUserHeader := flag.String("audit-user-header", "", "Request header an authenticating reverse proxy sets to the user, recorded with each change in changes.log (e.g., Remote-User)")
+	binaryPath := flag.String("binary-path", "", "Path of the sing-box binary, searched for on PATH and in common install locations if empty")
+	tlsCert := flag.String("tls-cert", "", "TLS certificate file; with -tls-key, serves HTTPS instead of HTTP")
+	tlsKey := flag.String("tls-key", "", "TLS private key file for -tls-cert")
+	tlsAuto := flag.Bool("tls-auto", false, "Serve HTTPS with a self-signed certificate generated on first run and kept next to the config")
+	reloadCmd := flag.String("reload-cmd", "", "Shell command run to apply config changes instead of systemctl reload-or-restart; {{.ConfigPath}} expands to the config path")
+	ruleHitWindow := flag.Duration("rule-hit-window", handlers.DefaultRuleHitWindow, "How long rule hit counts from Clash connections accumulate before resetting (0 disables)")
+	uiSessions := flag.Int("ui-sessions", handlers.DefaultUISessions, "Maximum browser sessions whose last filters and sort orders are remembered (0 disables)")
+	dev := flag.Bool("dev", false, "Parse templates from webassets/web/templates on every request instead of the embedded copy, for working on the UI from the repository root")
+	logFormat := flag.String("log-format", "text", "Log output format (text or json)")
 	flag.Parse()
 
-	log.Printf("Sing-Box Config Manager")
-	log.Printf("=======================")
-	log.Printf("Config path: %s", *configPath)
-	log.Printf("Service name: %s", *serviceName)
-	if *clashURL != "" {
-		log.Printf("Clash API: %s", *clashURL)
+	logger, err := handlers.NewLogger(*logFormat, os.Stderr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
 	}
-	log.Printf("")
+	slog.SetDefault(logger)
+
+	if *configDir != "" {
+		info, err := os.Stat(*configDir)
+		if err != nil || !info.IsDir() {
+			slog.Error("config directory not found", "path", *configDir)
+			os.Exit(1)
+		}
+		*configPath = *configDir
+	}
+
+	slog.Info("Sing-Box Config Manager",
+		"config", *configPath,
+		"service", *serviceName,
+		"clash", *clashURL,
+		"read_only", *readOnly,
+	)
 
-	server, err := handlers.NewServer(*addr, *configPath, *serviceName, *clashURL, *clashSecret, webassets.TemplatesFS, webassets.StaticFS)
+	service.SetBinaryPath(*binaryPath)
+
+	server, err := handlers.NewServer(*addr, *configPath, *backupDir, *serviceName, *clashURL, *clashSecret, webassets.TemplatesFS, webassets.StaticFS)
 	if err != nil {
-		log.Fatalf("Failed to create server: %v", err)
+		if errors.Is(err, config.ErrInsufficientPermissions) {
+			slog.Error("failed to create server: insufficient permissions; run the manager as root or via sudo, or use -backup-dir", "error", err)
+		} else {
+			slog.Error("failed to create server", "error", err)
+		}
+		os.Exit(1)
+	}
+	server.SetConfigOverrides(*configOverrides)
+	server.SetDelayTestConcurrency(*delayTestConcurrency)
+	server.SetDelayTestRateLimit(*delayTestRateLimit)
+	server.SetMaxBodyBytes(*maxBodySize, *maxConfigBodySize)
+	server.SetRequestTimeout(*requestTimeout)
+	server.SetFallbackOutbounds(strings.Split(*fallbackOutbounds, ","))
+	server.SetReadOnly(*readOnly)
+	server.SetDeferReload(*deferReload)
+	server.SetAuditUserHeader(*auditUserHeader)
+	if err := server.SetReloadCommand(*reloadCmd); err != nil {
+		slog.Error("invalid reload command", "error", err)
+		os.Exit(2)
+	}
+	if err := server.SetTLS(*tlsCert, *tlsKey, *tlsAuto); err != nil {
+		slog.Error("invalid TLS settings", "error", err)
+		os.Exit(2)
+	}
+	server.SetRuleHitWindow(*ruleHitWindow)
+	server.SetUISessions(*uiSessions)
+	if *dev {
+		if err := server.SetDevTemplates(devAssetsDir); err != nil {
+			slog.Error("failed to load templates from disk", "dir", devAssetsDir, "error", err)
+			os.Exit(2)
+		}
+		slog.Warn("dev mode: templates are parsed from disk on every request", "dir", devAssetsDir)
 	}
 
 	// Handle graceful shutdown
@@ -39,12 +115,13 @@ func main() {
 
 	go func() {
 		<-sigChan
-		log.Println("\nShutting down gracefully...")
+		slog.Info("shutting down gracefully")
 		server.Stop()
 		os.Exit(0)
 	}()
 
 	if err := server.Start(); err != nil {
-		log.Fatalf("Server error: %v", err)
+		slog.Error("server error", "error", err)
+		os.Exit(1)
 	}
 }
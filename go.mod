@@ -2,9 +2,9 @@ module github.com/matinhimself/singbox-web-config
 
 go 1.24
 
-require github.com/fsnotify/fsnotify v1.7.0
-
 require (
-	github.com/gorilla/websocket v1.5.3 // indirect
-	golang.org/x/sys v0.13.0 // indirect
+	github.com/fsnotify/fsnotify v1.7.0
+	github.com/gorilla/websocket v1.5.3
 )
+
+require golang.org/x/sys v0.13.0 // indirect
@@ -2,11 +2,19 @@ package clash
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
 	"time"
+
+	"github.com/matinhimself/singbox-web-config/internal/types"
 )
 
 // Client represents a Clash API client
@@ -52,19 +60,56 @@ type DelayTestResponse struct {
 	Delay int `json:"delay"`
 }
 
+// DefaultRequestTimeout bounds a request whose context carries no deadline
+const DefaultRequestTimeout = 10 * time.Second
+
 // NewClient creates a new Clash API client
 func NewClient(baseURL, secret string) *Client {
 	return &Client{
-		baseURL: baseURL,
-		secret:  secret,
-		httpClient: &http.Client{
-			Timeout: 10 * time.Second,
-		},
+		baseURL:    baseURL,
+		secret:     secret,
+		httpClient: &http.Client{},
+	}
+}
+
+// apiURL joins an API path, which may carry a query, onto a base URL. The
+// base URL may include a path prefix when the controller is served behind a
+// reverse proxy, e.g. https://host/clash/, with or without a trailing slash.
+func apiURL(baseURL, path string) string {
+	return strings.TrimRight(baseURL, "/") + "/" + strings.TrimLeft(path, "/")
+}
+
+// WebSocketURL returns the ws:// or wss:// URL of an API path, keeping any
+// path prefix of baseURL
+func WebSocketURL(baseURL, path string) (string, error) {
+	u, err := url.Parse(apiURL(baseURL, path))
+	if err != nil {
+		return "", err
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("missing host in %q", baseURL)
 	}
+
+	switch u.Scheme {
+	case "https", "wss":
+		u.Scheme = "wss"
+	default:
+		u.Scheme = "ws"
+	}
+	return u.String(), nil
+}
+
+// withDefaultTimeout applies DefaultRequestTimeout unless the caller already
+// set a deadline, so a cancelled or expired context always ends the request
+func withDefaultTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, DefaultRequestTimeout)
 }
 
 // doRequest performs an HTTP request with auth headers
-func (c *Client) doRequest(method, path string, body interface{}) (*http.Response, error) {
+func (c *Client) doRequest(ctx context.Context, method, path string, body interface{}) (*http.Response, error) {
 	var reqBody io.Reader
 	if body != nil {
 		jsonData, err := json.Marshal(body)
@@ -74,7 +119,7 @@ func (c *Client) doRequest(method, path string, body interface{}) (*http.Respons
 		reqBody = bytes.NewReader(jsonData)
 	}
 
-	req, err := http.NewRequest(method, c.baseURL+path, reqBody)
+	req, err := http.NewRequestWithContext(ctx, method, apiURL(c.baseURL, path), reqBody)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -93,8 +138,11 @@ func (c *Client) doRequest(method, path string, body interface{}) (*http.Respons
 }
 
 // GetProxies fetches all proxies from the Clash API
-func (c *Client) GetProxies() (map[string]Proxy, error) {
-	resp, err := c.doRequest("GET", "/proxies", nil)
+func (c *Client) GetProxies(ctx context.Context) (map[string]Proxy, error) {
+	ctx, cancel := withDefaultTimeout(ctx)
+	defer cancel()
+
+	resp, err := c.doRequest(ctx, "GET", "/proxies", nil)
 	if err != nil {
 		return nil, err
 	}
@@ -114,8 +162,11 @@ func (c *Client) GetProxies() (map[string]Proxy, error) {
 }
 
 // GetProxy fetches a specific proxy by name
-func (c *Client) GetProxy(name string) (*Proxy, error) {
-	resp, err := c.doRequest("GET", "/proxies/"+name, nil)
+func (c *Client) GetProxy(ctx context.Context, name string) (*Proxy, error) {
+	ctx, cancel := withDefaultTimeout(ctx)
+	defer cancel()
+
+	resp, err := c.doRequest(ctx, "GET", "/proxies/"+name, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -135,10 +186,13 @@ func (c *Client) GetProxy(name string) (*Proxy, error) {
 }
 
 // SwitchProxy switches the active proxy in a group
-func (c *Client) SwitchProxy(groupName, proxyName string) error {
+func (c *Client) SwitchProxy(ctx context.Context, groupName, proxyName string) error {
+	ctx, cancel := withDefaultTimeout(ctx)
+	defer cancel()
+
 	body := map[string]string{"name": proxyName}
 
-	resp, err := c.doRequest("PUT", "/proxies/"+groupName, body)
+	resp, err := c.doRequest(ctx, "PUT", "/proxies/"+groupName, body)
 	if err != nil {
 		return err
 	}
@@ -152,8 +206,16 @@ func (c *Client) SwitchProxy(groupName, proxyName string) error {
 	return nil
 }
 
-// TestProxyDelay tests the latency of a proxy
-func (c *Client) TestProxyDelay(proxyName string, testURL string, timeout int) (int, error) {
+// Delay tests are retried on transient connection errors with a doubling backoff
+const (
+	delayTestAttempts = 3
+	delayTestBackoff  = 200 * time.Millisecond
+)
+
+// TestProxyDelay tests the latency of a proxy. The timeout (in milliseconds) is
+// passed to Clash; callers bound the HTTP call itself through ctx. Transient
+// connection failures are retried, while timeouts and error responses are not.
+func (c *Client) TestProxyDelay(ctx context.Context, proxyName string, testURL string, timeout int) (int, error) {
 	if testURL == "" {
 		testURL = "http://www.gstatic.com/generate_204"
 	}
@@ -161,8 +223,37 @@ func (c *Client) TestProxyDelay(proxyName string, testURL string, timeout int) (
 		timeout = 5000
 	}
 
+	ctx, cancel := withDefaultTimeout(ctx)
+	defer cancel()
+
 	path := fmt.Sprintf("/proxies/%s/delay?timeout=%d&url=%s", proxyName, timeout, testURL)
-	resp, err := c.doRequest("GET", path, nil)
+
+	var lastErr error
+	for attempt := 0; attempt < delayTestAttempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return 0, lastErr
+			case <-time.After(delayTestBackoff << (attempt - 1)):
+			}
+		}
+
+		delay, err := c.testProxyDelayOnce(ctx, path)
+		if err == nil {
+			return delay, nil
+		}
+		lastErr = err
+		if !isTransient(err) {
+			break
+		}
+	}
+
+	return 0, lastErr
+}
+
+// testProxyDelayOnce performs a single delay test request
+func (c *Client) testProxyDelayOnce(ctx context.Context, path string) (int, error) {
+	resp, err := c.doRequest(ctx, "GET", path, nil)
 	if err != nil {
 		return 0, err
 	}
@@ -181,19 +272,144 @@ func (c *Client) TestProxyDelay(proxyName string, testURL string, timeout int) (
 	return result.Delay, nil
 }
 
-// GetProxyGroups returns only proxies that are groups (have "all" field)
-func (c *Client) GetProxyGroups() (map[string]Proxy, error) {
-	proxies, err := c.GetProxies()
+// isTransient reports whether a request error is worth retrying: refused or
+// reset connections are, while cancellations and timeouts are not
+func isTransient(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return false
+	}
+
+	return errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.EOF)
+}
+
+// groupTypes are the proxy types of groups that pick among their members,
+// lowercased since backends differ in case
+var groupTypes = map[string]bool{
+	"selector":    true,
+	"urltest":     true,
+	"fallback":    true,
+	"loadbalance": true,
+}
+
+// IsGroup reports whether a proxy is a group that picks among its members.
+// Some backends also list proxy providers, relays or nodes with an "all"
+// list; their type tells them apart.
+func (p Proxy) IsGroup() bool {
+	return len(p.All) > 0 && groupTypes[strings.ToLower(p.Type)]
+}
+
+// GetProxyGroups returns only proxies that are groups, see Proxy.IsGroup
+func (c *Client) GetProxyGroups(ctx context.Context) (map[string]Proxy, error) {
+	proxies, err := c.GetProxies(ctx)
 	if err != nil {
 		return nil, err
 	}
 
 	groups := make(map[string]Proxy)
 	for name, proxy := range proxies {
-		if len(proxy.All) > 0 {
+		if proxy.IsGroup() {
 			groups[name] = proxy
 		}
 	}
 
 	return groups, nil
 }
+
+// Modes accepted by the Clash API's global mode setting
+var Modes = []string{"rule", "global", "direct"}
+
+// ErrInvalidMode is returned by SetMode for a mode outside Modes
+var ErrInvalidMode = errors.New("invalid mode")
+
+// ValidMode reports whether mode is one of Modes
+func ValidMode(mode string) bool {
+	for _, m := range Modes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// GetMode returns the running instance's global mode
+func (c *Client) GetMode(ctx context.Context) (string, error) {
+	ctx, cancel := withDefaultTimeout(ctx)
+	defer cancel()
+
+	resp, err := c.doRequest(ctx, "GET", "/configs", nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, string(body))
+	}
+
+	var result struct {
+		Mode string `json:"mode"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	// sing-box reports the mode name as configured, e.g. "Rule"
+	return strings.ToLower(result.Mode), nil
+}
+
+// SetMode switches the running instance's global mode. It only changes the
+// live setting; the config file is left untouched.
+func (c *Client) SetMode(ctx context.Context, mode string) error {
+	if !ValidMode(mode) {
+		return fmt.Errorf("%w %q: expected one of %s", ErrInvalidMode, mode, strings.Join(Modes, ", "))
+	}
+
+	ctx, cancel := withDefaultTimeout(ctx)
+	defer cancel()
+
+	resp, err := c.doRequest(ctx, "PATCH", "/configs", map[string]string{"mode": mode})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("failed to set mode: status %d, body: %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	return nil
+}
+
+// GetConnections fetches a snapshot of the active connections
+func (c *Client) GetConnections(ctx context.Context) (*types.ClashConnectionsMessage, error) {
+	ctx, cancel := withDefaultTimeout(ctx)
+	defer cancel()
+
+	resp, err := c.doRequest(ctx, "GET", "/connections", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, string(body))
+	}
+
+	var result types.ClashConnectionsMessage
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &result, nil
+}
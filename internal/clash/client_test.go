@@ -0,0 +1,100 @@
+package clash
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestAPIURL(t *testing.T) {
+	tests := []struct {
+		baseURL string
+		path    string
+		want    string
+	}{
+		{"http://127.0.0.1:9090", "/proxies", "http://127.0.0.1:9090/proxies"},
+		{"http://127.0.0.1:9090/", "/proxies", "http://127.0.0.1:9090/proxies"},
+		{"http://127.0.0.1:9090", "proxies", "http://127.0.0.1:9090/proxies"},
+		{"https://example.com/clash", "/proxies/GLOBAL/delay?timeout=5000", "https://example.com/clash/proxies/GLOBAL/delay?timeout=5000"},
+		{"https://example.com/clash/", "/version", "https://example.com/clash/version"},
+	}
+
+	for _, tt := range tests {
+		if got := apiURL(tt.baseURL, tt.path); got != tt.want {
+			t.Errorf("apiURL(%q, %q) = %q, want %q", tt.baseURL, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestWebSocketURL(t *testing.T) {
+	tests := []struct {
+		baseURL string
+		want    string
+		wantErr bool
+	}{
+		{baseURL: "http://127.0.0.1:9090", want: "ws://127.0.0.1:9090/connections"},
+		{baseURL: "http://127.0.0.1:9090/", want: "ws://127.0.0.1:9090/connections"},
+		{baseURL: "https://example.com/clash", want: "wss://example.com/clash/connections"},
+		{baseURL: "https://example.com/clash/", want: "wss://example.com/clash/connections"},
+		{baseURL: "/clash", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := WebSocketURL(tt.baseURL, "/connections")
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("WebSocketURL(%q) = %q, want an error", tt.baseURL, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("WebSocketURL(%q) error = %v", tt.baseURL, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("WebSocketURL(%q) = %q, want %q", tt.baseURL, got, tt.want)
+		}
+	}
+}
+
+// proxiesPayload is a /proxies response with the GLOBAL group, nodes and
+// entries some backends add for providers and relays
+const proxiesPayload = `{"proxies": {
+	"GLOBAL": {"name": "GLOBAL", "type": "Fallback", "all": ["proxy", "auto", "direct"], "now": "proxy", "history": [], "udp": true},
+	"proxy": {"name": "proxy", "type": "Selector", "all": ["hk-1", "jp-1"], "now": "hk-1", "history": []},
+	"auto": {"name": "auto", "type": "URLTest", "all": ["hk-1", "jp-1"], "now": "jp-1", "history": [{"delay": 120, "time": "2025-01-01T00:00:00Z"}]},
+	"balance": {"name": "balance", "type": "LoadBalance", "all": ["hk-1", "jp-1"], "history": []},
+	"hk-1": {"name": "hk-1", "type": "Shadowsocks", "history": [], "udp": true},
+	"jp-1": {"name": "jp-1", "type": "VLESS", "history": []},
+	"direct": {"name": "direct", "type": "Direct", "history": [], "udp": true},
+	"empty": {"name": "empty", "type": "Selector", "all": [], "history": []},
+	"subscription": {"name": "subscription", "type": "Compatible", "all": ["hk-1", "jp-1"], "history": []},
+	"chain": {"name": "chain", "type": "Relay", "all": ["hk-1", "jp-1"], "history": []}
+}}`
+
+func TestProxyIsGroup(t *testing.T) {
+	var response ProxiesResponse
+	if err := json.Unmarshal([]byte(proxiesPayload), &response); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]bool{
+		"GLOBAL":       true,
+		"proxy":        true,
+		"auto":         true,
+		"balance":      true,
+		"hk-1":         false,
+		"jp-1":         false,
+		"direct":       false,
+		"empty":        false,
+		"subscription": false,
+		"chain":        false,
+	}
+	for name, proxy := range response.Proxies {
+		if got := proxy.IsGroup(); got != want[name] {
+			t.Errorf("%s (%s).IsGroup() = %v, want %v", name, proxy.Type, got, want[name])
+		}
+	}
+	if len(response.Proxies) != len(want) {
+		t.Errorf("decoded %d proxies, want %d", len(response.Proxies), len(want))
+	}
+}
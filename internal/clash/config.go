@@ -1,8 +1,11 @@
 package clash
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -15,6 +18,14 @@ type Config struct {
 	Secret string `json:"secret"`
 }
 
+// storedConfig is the saved form of Config. Secret is only set in files
+// written before secrets were encrypted, or where no key could be derived.
+type storedConfig struct {
+	URL             string `json:"url"`
+	Secret          string `json:"secret,omitempty"`
+	EncryptedSecret string `json:"encrypted_secret,omitempty"`
+}
+
 // ConfigManager handles Clash configuration persistence
 type ConfigManager struct {
 	configPath string
@@ -22,22 +33,32 @@ type ConfigManager struct {
 
 // NewConfigManager creates a new config manager
 func NewConfigManager() (*ConfigManager, error) {
+	configDir, err := stateDir()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ConfigManager{
+		configPath: filepath.Join(configDir, "clash.json"),
+	}, nil
+}
+
+// stateDir returns ~/.config/singbox-web-config, creating it if needed
+func stateDir() (string, error) {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get home directory: %w", err)
+		return "", fmt.Errorf("failed to get home directory: %w", err)
 	}
 
 	configDir := filepath.Join(homeDir, ".config", "singbox-web-config")
 	if err := os.MkdirAll(configDir, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create config directory: %w", err)
+		return "", fmt.Errorf("failed to create config directory: %w", err)
 	}
-
-	return &ConfigManager{
-		configPath: filepath.Join(configDir, "clash.json"),
-	}, nil
+	return configDir, nil
 }
 
-// Load loads the Clash configuration from file
+// Load loads the Clash configuration from file, decrypting the secret.
+// Files with a plaintext secret still load; the next Save encrypts it.
 func (cm *ConfigManager) Load() (*Config, error) {
 	data, err := os.ReadFile(cm.configPath)
 	if err != nil {
@@ -47,35 +68,93 @@ func (cm *ConfigManager) Load() (*Config, error) {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
 
-	var config Config
-	if err := json.Unmarshal(data, &config); err != nil {
+	var stored storedConfig
+	if err := json.Unmarshal(data, &stored); err != nil {
 		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
 
-	return &config, nil
+	config := &Config{URL: stored.URL, Secret: stored.Secret}
+	if stored.EncryptedSecret != "" {
+		secret, err := decryptSecret(stored.EncryptedSecret)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt Clash secret: %w", err)
+		}
+		config.Secret = secret
+	}
+
+	return config, nil
 }
 
-// Save saves the Clash configuration to file
+// Save saves the Clash configuration to file, readable only by its owner.
+// The secret is encrypted with the key from secretKey; when no key can be
+// derived it is saved as is, with a warning.
 func (cm *ConfigManager) Save(config *Config) error {
-	data, err := json.MarshalIndent(config, "", "  ")
+	stored := storedConfig{URL: config.URL}
+	if config.Secret != "" {
+		encrypted, err := encryptSecret(config.Secret)
+		switch {
+		case errors.Is(err, errNoSecretKey):
+			slog.Warn("saving Clash secret unencrypted", "reason", err)
+			stored.Secret = config.Secret
+		case err != nil:
+			return fmt.Errorf("failed to encrypt Clash secret: %w", err)
+		default:
+			stored.EncryptedSecret = encrypted
+		}
+	}
+
+	data, err := json.MarshalIndent(stored, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal config: %w", err)
 	}
 
-	if err := os.WriteFile(cm.configPath, data, 0644); err != nil {
+	if err := os.WriteFile(cm.configPath, data, 0600); err != nil {
 		return fmt.Errorf("failed to write config file: %w", err)
 	}
+	// WriteFile keeps the mode of an existing file, such as one written
+	// world-readable by an earlier version
+	if err := os.Chmod(cm.configPath, 0600); err != nil {
+		return fmt.Errorf("failed to restrict config file: %w", err)
+	}
 
 	return nil
 }
 
-// TestConnection tests if a Clash API endpoint is accessible
-func TestConnection(baseURL, secret string) error {
+// TestConnection checks that a Clash API answers at baseURL. Both /version
+// and /proxies must return what a Clash API returns, so another server that
+// happens to answer with 200 isn't taken for one.
+func TestConnection(ctx context.Context, baseURL, secret string) error {
 	client := &http.Client{
 		Timeout: 3 * time.Second,
 	}
 
-	req, err := http.NewRequest("GET", baseURL+"/proxies", nil)
+	var version struct {
+		Version string `json:"version"`
+	}
+	if err := getAPIJSON(ctx, client, baseURL, "/version", secret, &version); err != nil {
+		return err
+	}
+	if version.Version == "" {
+		return fmt.Errorf("not a Clash API: /version did not report a version")
+	}
+
+	var proxies struct {
+		Proxies map[string]json.RawMessage `json:"proxies"`
+	}
+	if err := getAPIJSON(ctx, client, baseURL, "/proxies", secret, &proxies); err != nil {
+		return err
+	}
+	if proxies.Proxies == nil {
+		return fmt.Errorf("not a Clash API: /proxies did not list any proxies")
+	}
+
+	return nil
+}
+
+// getAPIJSON fetches an API path for TestConnection and decodes its JSON
+// response into v
+func getAPIJSON(ctx context.Context, client *http.Client, baseURL, path, secret string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", apiURL(baseURL, path), nil)
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
@@ -90,14 +169,19 @@ func TestConnection(baseURL, secret string) error {
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusUnauthorized {
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized:
 		return fmt.Errorf("authentication failed: invalid secret")
+	case http.StatusNotFound:
+		return fmt.Errorf("not a Clash API: %s was not found, check the URL and its path", path)
+	default:
+		return fmt.Errorf("unexpected status code %d from %s", resp.StatusCode, path)
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("not a Clash API: %s did not return JSON", path)
 	}
-
 	return nil
 }
 
@@ -109,7 +193,7 @@ func AutoDetect() *Config {
 	}
 
 	for _, url := range defaultURLs {
-		if err := TestConnection(url, ""); err == nil {
+		if err := TestConnection(context.Background(), url, ""); err == nil {
 			return &Config{
 				URL:    url,
 				Secret: "",
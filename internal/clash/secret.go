@@ -0,0 +1,112 @@
+package clash
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// SecretKeyEnv names the environment variable whose passphrase encrypts the
+// saved Clash secret. Without it the machine id is used.
+const SecretKeyEnv = "SINGBOX_WEB_CONFIG_KEY"
+
+// encryptedSecretPrefix marks the format of an encrypted secret: AES-256-GCM
+// with the nonce in front, base64 encoded
+const encryptedSecretPrefix = "v1:"
+
+// machineIDFiles are where systemd and D-Bus keep the machine id
+var machineIDFiles = []string{"/etc/machine-id", "/var/lib/dbus/machine-id"}
+
+// errNoSecretKey is returned when there is neither a passphrase nor a
+// machine id to derive the key from
+var errNoSecretKey = errors.New("no " + SecretKeyEnv + " or machine id to derive a key from")
+
+// secretKey derives the key for the saved secret from the SecretKeyEnv
+// passphrase, or the machine id without one. This keeps the secret out of
+// plain sight, but anyone who can read the machine id can recover it.
+func secretKey() ([]byte, error) {
+	material := os.Getenv(SecretKeyEnv)
+	if material == "" {
+		for _, path := range machineIDFiles {
+			if data, err := os.ReadFile(path); err == nil {
+				if id := string(bytes.TrimSpace(data)); id != "" {
+					material = "machine-id:" + id
+					break
+				}
+			}
+		}
+	}
+	if material == "" {
+		return nil, errNoSecretKey
+	}
+
+	key := sha256.Sum256([]byte("singbox-web-config clash secret\x00" + material))
+	return key[:], nil
+}
+
+// encryptSecret encrypts a Clash secret for saving
+func encryptSecret(secret string) (string, error) {
+	key, err := secretKey()
+	if err != nil {
+		return "", err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(secret), nil)
+	return encryptedSecretPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decryptSecret reverses encryptSecret. It fails when the passphrase or
+// machine id changed since the secret was saved.
+func decryptSecret(encrypted string) (string, error) {
+	encoded, ok := strings.CutPrefix(encrypted, encryptedSecretPrefix)
+	if !ok {
+		return "", fmt.Errorf("unknown encrypted secret format")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("invalid encrypted secret: %w", err)
+	}
+
+	key, err := secretKey()
+	if err != nil {
+		return "", err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", fmt.Errorf("invalid encrypted secret: too short")
+	}
+
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	secret, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", fmt.Errorf("the %s or machine id changed since the secret was saved; save the Clash API settings again", SecretKeyEnv)
+	}
+	return string(secret), nil
+}
+
+// newGCM returns AES-GCM with key
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
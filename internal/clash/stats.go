@@ -0,0 +1,147 @@
+package clash
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ProxyStat is the outcome of the last delay test run on a proxy
+type ProxyStat struct {
+	Name string `json:"name"`
+	// LastDelay is the delay of the last successful test, kept when a later
+	// test fails
+	LastDelay    int       `json:"lastDelay"`
+	LastTestedAt time.Time `json:"lastTestedAt"`
+	LastOK       bool      `json:"lastOK"`
+}
+
+// StatsStore persists the last delay test of each proxy, so results survive
+// page reloads and restarts of sing-box, which clear Clash's own history
+type StatsStore struct {
+	mu    sync.Mutex
+	path  string
+	stats map[string]ProxyStat
+
+	// saveMu orders saves, so an older snapshot can't overwrite a newer one
+	saveMu sync.Mutex
+}
+
+// NewStatsStore loads the proxy stats from
+// ~/.config/singbox-web-config/proxy-stats.json
+func NewStatsStore() (*StatsStore, error) {
+	dir, err := stateDir()
+	if err != nil {
+		return nil, err
+	}
+
+	store := &StatsStore{
+		path:  filepath.Join(dir, "proxy-stats.json"),
+		stats: make(map[string]ProxyStat),
+	}
+
+	data, err := os.ReadFile(store.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return store, nil
+		}
+		return nil, fmt.Errorf("failed to read proxy stats: %w", err)
+	}
+
+	var stats []ProxyStat
+	if err := json.Unmarshal(data, &stats); err != nil {
+		return nil, fmt.Errorf("failed to parse proxy stats: %w", err)
+	}
+	for _, stat := range stats {
+		store.stats[stat.Name] = stat
+	}
+	return store, nil
+}
+
+// Record updates a proxy's stats with a delay test result. A delay of zero
+// or less marks a failed test. Call Save to persist it.
+func (s *StatsStore) Record(name string, delay int, testedAt time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stat := s.stats[name]
+	stat.Name = name
+	stat.LastTestedAt = testedAt
+	stat.LastOK = delay > 0
+	if stat.LastOK {
+		stat.LastDelay = delay
+	}
+	s.stats[name] = stat
+}
+
+// Get returns the stats of a proxy
+func (s *StatsStore) Get(name string) (ProxyStat, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stat, ok := s.stats[name]
+	return stat, ok
+}
+
+// Prune drops the stats of proxies not in existing and reports whether any
+// were dropped. Call Save to persist it.
+func (s *StatsStore) Prune(existing map[string]bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pruned := false
+	for name := range s.stats {
+		if !existing[name] {
+			delete(s.stats, name)
+			pruned = true
+		}
+	}
+	return pruned
+}
+
+// Save writes the stats to disk
+func (s *StatsStore) Save() error {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
+	s.mu.Lock()
+	stats := make([]ProxyStat, 0, len(s.stats))
+	for _, stat := range s.stats {
+		stats = append(stats, stat)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+
+	data, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal proxy stats: %w", err)
+	}
+
+	// Write a temporary file and rename it over the stats, so a crash
+	// mid-write can't leave them truncated
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write proxy stats: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write proxy stats: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("failed to set file permissions: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to replace proxy stats: %w", err)
+	}
+	return nil
+}
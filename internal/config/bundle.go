@@ -0,0 +1,209 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Names of the manager's files in a bundle archive. Backups keep their file
+// names under BundleBackupDir.
+const (
+	BundleConfigFile   = "config.json"
+	BundleDisabledFile = "disabled-outbounds.json"
+	BundleBackupDir    = "backups/"
+)
+
+// BundleFile is one file of a bundle archive, named by its path in the
+// archive
+type BundleFile struct {
+	Name string
+	Data []byte
+}
+
+// BundleFiles returns the files the manager keeps, named as they are stored
+// in a bundle: the config, merged in directory mode, every backup with its
+// metadata, and the disabled outbounds store. Files that don't exist yet are
+// left out.
+func (m *Manager) BundleFiles() ([]BundleFile, error) {
+	var files []BundleFile
+
+	data, err := m.readRaw()
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	if err == nil {
+		files = append(files, BundleFile{Name: BundleConfigFile, Data: data})
+	}
+
+	if m.backupDir == "" {
+		return files, nil // The store keeps nothing else
+	}
+
+	entries, err := os.ReadDir(m.backupDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup directory: %w", err)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(m.backupDir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read backup: %w", err)
+		}
+		files = append(files, BundleFile{Name: BundleBackupDir + entry.Name(), Data: data})
+	}
+
+	data, err = os.ReadFile(m.disabledPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read disabled outbounds: %w", err)
+	}
+	if err == nil {
+		files = append(files, BundleFile{Name: BundleDisabledFile, Data: data})
+	}
+
+	return files, nil
+}
+
+// ValidateBundleFile checks that a bundle file is one the manager keeps and
+// that it holds what that file should: a sing-box config, backup metadata or
+// the disabled outbounds store
+func (m *Manager) ValidateBundleFile(file BundleFile) error {
+	switch {
+	case file.Name == BundleConfigFile:
+		var config Config
+		if err := json.Unmarshal(file.Data, &config); err != nil {
+			return fmt.Errorf("%s is not a valid config: %w", file.Name, err)
+		}
+	case file.Name == BundleDisabledFile:
+		var disabled disabledOutboundsFile
+		if err := json.Unmarshal(file.Data, &disabled); err != nil {
+			return fmt.Errorf("%s is not a valid disabled outbounds store: %w", file.Name, err)
+		}
+	case strings.HasPrefix(file.Name, BundleBackupDir):
+		backupName := strings.TrimPrefix(file.Name, BundleBackupDir)
+		if _, err := m.resolveBackupPath(backupName); err != nil {
+			return err
+		}
+		if strings.HasSuffix(backupName, ".meta") {
+			var metadata BackupMetadata
+			if err := json.Unmarshal(file.Data, &metadata); err != nil {
+				return fmt.Errorf("%s is not valid backup metadata: %w", file.Name, err)
+			}
+			return nil
+		}
+		if err := validateBackupData(file.Data); err != nil {
+			return fmt.Errorf("%s is not a valid backup: %w", file.Name, err)
+		}
+	default:
+		return fmt.Errorf("unexpected file %s", file.Name)
+	}
+	return nil
+}
+
+// validateBackupData checks that a backup holds a config, decompressing it
+// first if it is stored gzipped
+func validateBackupData(data []byte) error {
+	data, err := decompressBackup(data)
+	if err != nil {
+		return err
+	}
+
+	var config Config
+	return json.Unmarshal(data, &config)
+}
+
+// RestoreBundle writes bundle files back in place and returns the names of
+// those it restored. Every file is validated and the backups and disabled
+// outbounds store are staged in temporary files before anything is replaced.
+// The config then replaces the current one, which is backed up first, and
+// only once that succeeds are the staged files moved into place. If a move
+// fails, the files restored before it are returned with the error.
+func (m *Manager) RestoreBundle(files []BundleFile) ([]string, error) {
+	for _, file := range files {
+		if err := m.ValidateBundleFile(file); err != nil {
+			return nil, err
+		}
+	}
+
+	type stagedFile struct {
+		name, tmp, path string
+	}
+	var staged []stagedFile
+	defer func() {
+		for _, file := range staged {
+			os.Remove(file.tmp) // Gone once moved into place
+		}
+	}()
+
+	var config []byte
+	for _, file := range files {
+		var path string
+		switch {
+		case file.Name == BundleConfigFile:
+			config = file.Data
+			continue
+		case file.Name == BundleDisabledFile:
+			if m.disabledPath == "" {
+				return nil, errNoState
+			}
+			path = m.disabledPath
+		default:
+			backupPath, err := m.resolveBackupPath(strings.TrimPrefix(file.Name, BundleBackupDir))
+			if err != nil {
+				return nil, err
+			}
+			path = backupPath
+		}
+
+		tmp, err := stageFile(path, file.Data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to stage %s: %w", file.Name, checkPermission(err))
+		}
+		staged = append(staged, stagedFile{name: file.Name, tmp: tmp, path: path})
+	}
+
+	var restored []string
+	if config != nil {
+		if err := m.replaceConfig(config); err != nil {
+			return nil, err
+		}
+		restored = append(restored, BundleConfigFile)
+	}
+
+	for _, file := range staged {
+		if err := os.Rename(file.tmp, file.path); err != nil {
+			return restored, fmt.Errorf("failed to restore %s: %w", file.name, checkPermission(err))
+		}
+		restored = append(restored, file.name)
+	}
+	return restored, nil
+}
+
+// stageFile writes data to a temporary file beside path, for renaming over
+// it later, and returns the temporary file's name
+func stageFile(path string, data []byte) (string, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return "", err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
@@ -0,0 +1,88 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const bundleTestConfig = `{"outbounds":[{"type":"direct","tag":"direct"}]}`
+
+// testBundle holds a config, a backup and a disabled outbounds store
+var testBundle = []BundleFile{
+	{Name: BundleConfigFile, Data: []byte(`{"outbounds":[{"type":"direct","tag":"restored"}]}`)},
+	{Name: BundleBackupDir + "config_20240101-000000.json", Data: []byte(bundleTestConfig)},
+	{Name: BundleDisabledFile, Data: []byte(`{"outbounds":[]}`)},
+}
+
+func TestRestoreBundle(t *testing.T) {
+	m := newTestManager(t, bundleTestConfig)
+
+	restored, err := m.RestoreBundle(testBundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{BundleConfigFile, BundleBackupDir + "config_20240101-000000.json", BundleDisabledFile}
+	if !reflect.DeepEqual(restored, want) {
+		t.Errorf("restored = %v, want %v", restored, want)
+	}
+
+	tags, err := m.GetOutboundTags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(tags, []string{"restored"}) {
+		t.Errorf("outbound tags = %v, want the bundled config", tags)
+	}
+	for _, path := range []string{m.disabledPath, filepath.Join(m.backupDir, "config_20240101-000000.json")} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("%s not restored: %v", path, err)
+		}
+	}
+	assertNoStagedFiles(t, m)
+}
+
+func TestRestoreBundleWritesNothingWhenTheConfigFails(t *testing.T) {
+	m := newTestManager(t, bundleTestConfig)
+
+	// A directory where the config file was can be neither backed up nor
+	// replaced
+	if err := os.Remove(m.configPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(m.configPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := m.RestoreBundle(testBundle)
+	if err == nil {
+		t.Fatal("RestoreBundle succeeded without a config to replace")
+	}
+	if len(restored) != 0 {
+		t.Errorf("restored = %v, want nothing", restored)
+	}
+	for _, path := range []string{m.disabledPath, filepath.Join(m.backupDir, "config_20240101-000000.json")} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s written although the config failed", path)
+		}
+	}
+	assertNoStagedFiles(t, m)
+}
+
+// assertNoStagedFiles fails if RestoreBundle left temporary files behind
+func assertNoStagedFiles(t *testing.T, m *Manager) {
+	t.Helper()
+	for _, dir := range []string{filepath.Dir(m.configPath), m.backupDir} {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, entry := range entries {
+			if strings.HasSuffix(entry.Name(), ".tmp") {
+				t.Errorf("staged file %s left in %s", entry.Name(), dir)
+			}
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package config
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// ChangeEntry is one line of the change log, recording an edit made
+// through the manager
+type ChangeEntry struct {
+	Time time.Time `json:"time"`
+	// Action is the request that made the change, such as
+	// "POST /api/outbounds/create"
+	Action  string `json:"action"`
+	Summary string `json:"summary,omitempty"`
+	// User is who made the change, when the server knows
+	User      string `json:"user,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// RecordChange appends an entry to changes.log next to the config. The log
+// is JSON Lines and only ever appended to, so it keeps the intent of edits
+// that backups only hold snapshots of. Without a change log, as over a
+// ConfigStore, nothing is recorded.
+func (m *Manager) RecordChange(entry ChangeEntry) error {
+	if m.changeLogPath == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal change: %w", err)
+	}
+	data = append(data, '\n')
+
+	m.changeLogMu.Lock()
+	defer m.changeLogMu.Unlock()
+
+	f, err := os.OpenFile(m.changeLogPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open change log: %w", checkPermission(err))
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write change log: %w", err)
+	}
+	return f.Close()
+}
+
+// RecentChanges returns up to limit entries of the change log, newest first.
+// Lines that don't parse, such as one cut short by a crash, are skipped.
+func (m *Manager) RecentChanges(limit int) ([]ChangeEntry, error) {
+	if m.changeLogPath == "" {
+		return []ChangeEntry{}, nil
+	}
+
+	m.changeLogMu.Lock()
+	defer m.changeLogMu.Unlock()
+
+	f, err := os.Open(m.changeLogPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return []ChangeEntry{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open change log: %w", checkPermission(err))
+	}
+	defer f.Close()
+
+	// Keep the last limit entries in a ring while reading
+	ring := make([]ChangeEntry, 0, limit)
+	next := 0
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry ChangeEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		if len(ring) < limit {
+			ring = append(ring, entry)
+		} else if limit > 0 {
+			ring[next] = entry
+		}
+		if limit > 0 {
+			next = (next + 1) % limit
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read change log: %w", err)
+	}
+
+	changes := make([]ChangeEntry, 0, len(ring))
+	for i := range ring {
+		changes = append(changes, ring[(next-1-i+2*len(ring))%len(ring)])
+	}
+	return changes, nil
+}
@@ -0,0 +1,234 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/matinhimself/singbox-web-config/internal/types"
+)
+
+// DNSStrategies are the values sing-box accepts for the DNS strategy. The
+// empty strategy leaves the choice to sing-box.
+var DNSStrategies = []string{"prefer_ipv4", "prefer_ipv6", "ipv4_only", "ipv6_only"}
+
+// DNSSettings are the top-level DNS fields that apply to every query, as
+// opposed to the servers and rules lists
+type DNSSettings struct {
+	Final            string
+	Strategy         string
+	DisableCache     bool
+	DisableExpire    bool
+	IndependentCache bool
+	FakeIP           FakeIPSettings
+}
+
+// FakeIPSettings is the dns.fakeip object, which hands out addresses from
+// the ranges instead of resolving domains
+type FakeIPSettings struct {
+	Enabled    bool
+	Inet4Range string
+	Inet6Range string
+}
+
+// dnsSettingsFields decodes the fields of the dns object DNSSettings covers.
+// The generated RawDNSOptions leaves out the client and fakeip options, so
+// they are read from the raw config.
+type dnsSettingsFields struct {
+	Final string `json:"final"`
+	types.DNSClientOptions
+	FakeIP *types.LegacyDNSFakeIPOptions `json:"fakeip"`
+}
+
+// Validate checks the strategy and that the fakeip ranges are CIDRs of the
+// right address family. Whether Final names a DNS server is left to the
+// caller, which knows the servers.
+func (s DNSSettings) Validate() error {
+	if s.Strategy != "" && !containsString(DNSStrategies, s.Strategy) {
+		return fmt.Errorf("unknown DNS strategy %q", s.Strategy)
+	}
+	if err := validateFakeIPRange("inet4_range", s.FakeIP.Inet4Range, false); err != nil {
+		return err
+	}
+	if err := validateFakeIPRange("inet6_range", s.FakeIP.Inet6Range, true); err != nil {
+		return err
+	}
+	if s.FakeIP.Enabled && s.FakeIP.Inet4Range == "" && s.FakeIP.Inet6Range == "" {
+		return fmt.Errorf("fakeip needs an inet4_range or inet6_range")
+	}
+	return nil
+}
+
+// validateFakeIPRange checks that a fakeip range is an IPv4 or, with ipv6,
+// an IPv6 CIDR. An empty range is allowed.
+func validateFakeIPRange(field, value string, ipv6 bool) error {
+	if value == "" {
+		return nil
+	}
+	family, example := "IPv4", "198.18.0.0/15"
+	if ipv6 {
+		family, example = "IPv6", "fc00::/18"
+	}
+	ip, _, err := net.ParseCIDR(value)
+	if err != nil {
+		return fmt.Errorf("fakeip %s %q is not a CIDR such as %s", field, value, example)
+	}
+	if isIPv4 := ip.To4() != nil; isIPv4 == ipv6 {
+		return fmt.Errorf("fakeip %s %q must be an %s range", field, value, family)
+	}
+	return nil
+}
+
+// GetDNSSettings returns the DNS settings of the current config
+func (m *Manager) GetDNSSettings() (*DNSSettings, error) {
+	settings := &DNSSettings{}
+
+	root, err := m.rawConfigObject()
+	if err != nil {
+		return nil, err
+	}
+	dns, err := rawDNSObject(root)
+	if err != nil {
+		return nil, err
+	}
+	data, err := dns.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	var fields dnsSettingsFields
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("failed to parse DNS settings: %w", err)
+	}
+
+	settings.Final = fields.Final
+	settings.Strategy = fields.Strategy
+	settings.DisableCache = fields.DisableCache
+	settings.DisableExpire = fields.DisableExpire
+	settings.IndependentCache = fields.IndependentCache
+	if fields.FakeIP != nil {
+		settings.FakeIP.Enabled = fields.FakeIP.Enabled
+		if fields.FakeIP.Inet4Range != nil {
+			settings.FakeIP.Inet4Range = *fields.FakeIP.Inet4Range
+		}
+		if fields.FakeIP.Inet6Range != nil {
+			settings.FakeIP.Inet6Range = *fields.FakeIP.Inet6Range
+		}
+	}
+
+	return settings, nil
+}
+
+// UpdateDNSSettings saves the DNS settings, leaving the servers, rules and
+// every other DNS field untouched. Fields at their zero value are removed,
+// as is a fakeip object left empty.
+func (m *Manager) UpdateDNSSettings(settings DNSSettings) error {
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+
+	root, err := m.rawConfigObject()
+	if err != nil {
+		return err
+	}
+	dns, err := rawDNSObject(root)
+	if err != nil {
+		return err
+	}
+
+	setRawField(dns, "final", settings.Final)
+	setRawField(dns, "strategy", settings.Strategy)
+	setRawField(dns, "disable_cache", settings.DisableCache)
+	setRawField(dns, "disable_expire", settings.DisableExpire)
+	setRawField(dns, "independent_cache", settings.IndependentCache)
+
+	fakeIP, ok := parseRawObject(dns.values["fakeip"])
+	if !ok {
+		fakeIP = &rawObject{values: make(map[string]json.RawMessage)}
+	}
+	setRawField(fakeIP, "enabled", settings.FakeIP.Enabled)
+	setRawField(fakeIP, "inet4_range", settings.FakeIP.Inet4Range)
+	setRawField(fakeIP, "inet6_range", settings.FakeIP.Inet6Range)
+	if len(fakeIP.keys) == 0 {
+		dns.delete("fakeip")
+	} else if err := setRawObject(dns, "fakeip", fakeIP); err != nil {
+		return err
+	}
+
+	if len(dns.keys) == 0 {
+		root.delete("dns")
+	} else if err := setRawObject(root, "dns", dns); err != nil {
+		return err
+	}
+
+	data, err := root.MarshalJSON()
+	if err != nil {
+		return fmt.Errorf("failed to marshal config: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, data, "", "  "); err != nil {
+		return fmt.Errorf("failed to format config: %w", err)
+	}
+
+	return m.replaceConfig(buf.Bytes())
+}
+
+// rawConfigObject returns the config as a raw object, empty if there is no
+// config yet
+func (m *Manager) rawConfigObject() (*rawObject, error) {
+	data, err := m.readRaw()
+	if os.IsNotExist(err) {
+		return &rawObject{values: make(map[string]json.RawMessage)}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	root, ok := parseRawObject(data)
+	if !ok {
+		return nil, fmt.Errorf("failed to parse config: not a JSON object")
+	}
+	return root, nil
+}
+
+// rawDNSObject returns the dns object of a config, empty if it has none
+func rawDNSObject(root *rawObject) (*rawObject, error) {
+	value, ok := root.values["dns"]
+	if !ok || string(bytes.TrimSpace(value)) == "null" {
+		return &rawObject{values: make(map[string]json.RawMessage)}, nil
+	}
+	dns, ok := parseRawObject(value)
+	if !ok {
+		return nil, fmt.Errorf("failed to parse config: dns is not a JSON object")
+	}
+	return dns, nil
+}
+
+// setRawField sets key to value, or removes it when value is the zero
+// string or false, matching the omitempty fields of the generated types
+func setRawField(object *rawObject, key string, value interface{}) {
+	switch v := value.(type) {
+	case string:
+		if v == "" {
+			object.delete(key)
+			return
+		}
+	case bool:
+		if !v {
+			object.delete(key)
+			return
+		}
+	}
+	data, _ := json.Marshal(value)
+	object.set(key, data)
+}
+
+// setRawObject sets key to a nested raw object
+func setRawObject(object *rawObject, key string, value *rawObject) error {
+	data, err := value.MarshalJSON()
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", key, err)
+	}
+	object.set(key, data)
+	return nil
+}
@@ -0,0 +1,269 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// DefaultOverridesFragment is the fragment that receives edited sections in
+// directory mode when no single fragment owns them. Its name sorts last so
+// sing-box merges it over the others.
+const DefaultOverridesFragment = "zz-overrides.json"
+
+// SetOverridesFragment sets the file name, relative to the config directory,
+// of the fragment that receives sections no single fragment owns. It has no
+// effect outside directory mode.
+func (m *Manager) SetOverridesFragment(name string) {
+	if s, ok := m.store.(*fragmentStore); ok && name != "" {
+		s.overrides = name
+	}
+}
+
+// Path returns the config file, or the fragment directory in directory mode.
+// It is empty for a manager over a ConfigStore.
+func (m *Manager) Path() string {
+	return m.configPath
+}
+
+// IsDirMode reports whether the config is a directory of fragments
+func (m *Manager) IsDirMode() bool {
+	return m.dirMode
+}
+
+// fragment is one JSON file of a config directory
+type fragment struct {
+	path   string
+	object *rawObject
+}
+
+// fragmentStore keeps the config in a directory of fragments. overrides
+// names the fragment that receives edits no single fragment owns.
+type fragmentStore struct {
+	dir       string
+	overrides string
+}
+
+// Read returns every fragment merged in name order the way sing-box merges
+// them. An empty directory satisfies os.IsNotExist.
+func (s *fragmentStore) Read() ([]byte, error) {
+	fragments, err := s.loadFragments()
+	if err != nil {
+		return nil, err
+	}
+	if len(fragments) == 0 {
+		return nil, &os.PathError{Op: "read", Path: s.dir, Err: os.ErrNotExist}
+	}
+
+	merged := &rawObject{values: make(map[string]json.RawMessage)}
+	for _, f := range fragments {
+		for _, key := range f.object.keys {
+			value := f.object.values[key]
+			if existing, ok := merged.values[key]; ok {
+				value = mergeFragmentValues(existing, value)
+			}
+			merged.set(key, value)
+		}
+	}
+
+	data, err := merged.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, data, "", "  "); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Write replaces the config with data. Each top-level section that changed
+// is written back to the one fragment defining it. Sections that are new, or
+// that were split across several fragments, are moved to the overrides
+// fragment; removed sections are deleted from every fragment. Unchanged
+// fragments are left untouched.
+func (s *fragmentStore) Write(data []byte) error {
+	updated, ok := parseRawObject(data)
+	if !ok {
+		return fmt.Errorf("config must be a JSON object")
+	}
+
+	fragments, err := s.loadFragments()
+	if err != nil {
+		return err
+	}
+
+	current := make(map[string]json.RawMessage)
+	if len(fragments) > 0 {
+		merged, err := s.Read()
+		if err != nil {
+			return err
+		}
+		if object, ok := parseRawObject(merged); ok {
+			current = object.values
+		}
+	}
+
+	overridesPath := filepath.Join(s.dir, s.overrides)
+	var overrides *fragment
+	for _, f := range fragments {
+		if f.path == overridesPath {
+			overrides = f
+		}
+	}
+	if overrides == nil {
+		overrides = &fragment{path: overridesPath, object: &rawObject{values: make(map[string]json.RawMessage)}}
+	}
+
+	changed := make(map[*fragment]bool)
+	keys := append([]string{}, updated.keys...)
+	for key := range current {
+		if _, ok := updated.values[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+
+	for _, key := range keys {
+		value, inUpdated := updated.values[key]
+		if old, ok := current[key]; ok && inUpdated && jsonEqual(old, value) {
+			continue
+		}
+
+		var owners []*fragment
+		for _, f := range fragments {
+			if _, ok := f.object.values[key]; ok {
+				owners = append(owners, f)
+			}
+		}
+
+		target := overrides
+		if len(owners) == 1 {
+			target = owners[0]
+		}
+		for _, f := range owners {
+			if f != target || !inUpdated {
+				f.object.delete(key)
+				changed[f] = true
+			}
+		}
+		if inUpdated {
+			target.object.set(key, value)
+			changed[target] = true
+		}
+	}
+
+	for f := range changed {
+		if err := writeFragment(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadFragments reads every *.json file of the config directory in name
+// order
+func (s *fragmentStore) loadFragments() ([]*fragment, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read config directory: %w", checkPermission(err))
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && strings.HasSuffix(entry.Name(), ".json") {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+
+	var fragments []*fragment
+	for _, name := range names {
+		path := filepath.Join(s.dir, name)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, checkPermission(err))
+		}
+
+		object := &rawObject{values: make(map[string]json.RawMessage)}
+		if len(bytes.TrimSpace(data)) > 0 {
+			var ok bool
+			object, ok = parseRawObject(data)
+			if !ok {
+				return nil, fmt.Errorf("failed to parse %s: not a JSON object", name)
+			}
+		}
+		fragments = append(fragments, &fragment{path: path, object: object})
+	}
+	return fragments, nil
+}
+
+// writeFragment writes a fragment as indented JSON
+func writeFragment(f *fragment) error {
+	data, err := f.object.MarshalJSON()
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, data, "", "  "); err != nil {
+		return fmt.Errorf("failed to format %s: %w", filepath.Base(f.path), err)
+	}
+	buf.WriteByte('\n')
+
+	if err := os.WriteFile(f.path, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", filepath.Base(f.path), checkPermission(err))
+	}
+	return nil
+}
+
+// mergeFragmentValues merges a later fragment's value into an earlier one
+// like sing-box does: objects are merged key by key, lists are concatenated
+// and anything else is replaced
+func mergeFragmentValues(earlier, later json.RawMessage) json.RawMessage {
+	if earlierObject, ok := parseRawObject(earlier); ok {
+		if laterObject, ok := parseRawObject(later); ok {
+			for _, key := range laterObject.keys {
+				value := laterObject.values[key]
+				if existing, ok := earlierObject.values[key]; ok {
+					value = mergeFragmentValues(existing, value)
+				}
+				earlierObject.set(key, value)
+			}
+			if data, err := earlierObject.MarshalJSON(); err == nil {
+				return data
+			}
+			return later
+		}
+	}
+
+	var earlierList, laterList []json.RawMessage
+	if json.Unmarshal(earlier, &earlierList) == nil && json.Unmarshal(later, &laterList) == nil &&
+		earlierList != nil && laterList != nil {
+		if data, err := json.Marshal(append(earlierList, laterList...)); err == nil {
+			return data
+		}
+	}
+	return later
+}
+
+// jsonEqual reports whether two JSON values are equal, ignoring formatting
+// and key order
+func jsonEqual(a, b json.RawMessage) bool {
+	var va, vb interface{}
+	decoderA := json.NewDecoder(bytes.NewReader(a))
+	decoderA.UseNumber()
+	decoderB := json.NewDecoder(bytes.NewReader(b))
+	decoderB.UseNumber()
+	if decoderA.Decode(&va) != nil || decoderB.Decode(&vb) != nil {
+		return false
+	}
+	return reflect.DeepEqual(va, vb)
+}
@@ -0,0 +1,373 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Default database locations used by sing-box when route.geoip or
+// route.geosite leave them empty
+const (
+	DefaultGeoIPPath          = "geoip.db"
+	DefaultGeositePath        = "geosite.db"
+	DefaultGeoIPDownloadURL   = "https://github.com/SagerNet/sing-geoip/releases/latest/download/geoip.db"
+	DefaultGeositeDownloadURL = "https://github.com/SagerNet/sing-geosite/releases/latest/download/geosite.db"
+)
+
+// ErrGeoNotConfigured is returned when downloading a database that the
+// config doesn't set up under route
+var ErrGeoNotConfigured = errors.New("geo database is not configured")
+
+// GeoDownloadTimeout bounds a single database download
+const GeoDownloadTimeout = 2 * time.Minute
+
+// Geo resource kinds
+const (
+	GeoKindGeoIP   = "geoip"
+	GeoKindGeosite = "geosite"
+	GeoKindRuleSet = "rule_set"
+)
+
+// GeoResource describes a geo database or rule set referenced by the config
+// and the state of its file on disk
+type GeoResource struct {
+	Kind        string
+	Tag         string // rule set tag, empty for geoip/geosite
+	Type        string // rule set type: local or remote
+	Path        string
+	DownloadURL string
+	Exists      bool
+	Size        int64
+	ModTime     time.Time
+	// Downloadable reports whether DownloadGeoDatabase can fetch it
+	Downloadable bool
+	// DownloadDetour and UpdateInterval are set for remote rule sets that
+	// configure them
+	DownloadDetour string
+	UpdateInterval string
+}
+
+// GeoResources lists the configured geoip/geosite databases and rule sets.
+// Relative paths are resolved against the config file's directory.
+func (m *Manager) GeoResources() ([]GeoResource, error) {
+	config, err := m.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	var resources []GeoResource
+	if config.Route == nil {
+		return resources, nil
+	}
+
+	if config.Route.GeoIP != nil {
+		resources = append(resources, m.geoDatabase(GeoKindGeoIP,
+			config.Route.GeoIP.Path, DefaultGeoIPPath,
+			config.Route.GeoIP.DownloadURL, DefaultGeoIPDownloadURL))
+	}
+	if config.Route.Geosite != nil {
+		resources = append(resources, m.geoDatabase(GeoKindGeosite,
+			config.Route.Geosite.Path, DefaultGeositePath,
+			config.Route.Geosite.DownloadURL, DefaultGeositeDownloadURL))
+	}
+
+	for _, item := range config.Route.RuleSet {
+		ruleSet, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		resource := GeoResource{Kind: GeoKindRuleSet}
+		resource.Tag, _ = ruleSet["tag"].(string)
+		resource.Type, _ = ruleSet["type"].(string)
+		resource.DownloadURL, _ = ruleSet["url"].(string)
+		resource.DownloadDetour, _ = ruleSet["download_detour"].(string)
+		if interval, ok := ruleSet["update_interval"]; ok {
+			resource.UpdateInterval = fmt.Sprint(interval)
+		}
+		if path, _ := ruleSet["path"].(string); path != "" {
+			resource.Path = m.resolveDataPath(path)
+			statGeoResource(&resource)
+		}
+		resources = append(resources, resource)
+	}
+
+	return resources, nil
+}
+
+// geoDatabase builds the resource for a geoip or geosite database, applying
+// sing-box's defaults for an empty path or download URL
+func (m *Manager) geoDatabase(kind, path, defaultPath, downloadURL, defaultURL string) GeoResource {
+	if path == "" {
+		path = defaultPath
+	}
+	if downloadURL == "" {
+		downloadURL = defaultURL
+	}
+
+	resource := GeoResource{
+		Kind:         kind,
+		Path:         m.resolveDataPath(path),
+		DownloadURL:  downloadURL,
+		Downloadable: true,
+	}
+	statGeoResource(&resource)
+	return resource
+}
+
+// resolveDataPath makes a path from the config relative to its directory, or
+// to the config directory itself in directory mode
+func (m *Manager) resolveDataPath(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	if m.dirMode {
+		return filepath.Join(m.configPath, path)
+	}
+	return filepath.Join(filepath.Dir(m.configPath), path)
+}
+
+func statGeoResource(resource *GeoResource) {
+	info, err := os.Stat(resource.Path)
+	if err != nil {
+		return
+	}
+	resource.Exists = true
+	resource.Size = info.Size()
+	resource.ModTime = info.ModTime()
+}
+
+// DownloadGeoDatabase downloads the geoip or geosite database from its
+// configured URL. The file is written next to the target and renamed over it
+// once complete, so a failed download never leaves a truncated database.
+func (m *Manager) DownloadGeoDatabase(ctx context.Context, kind string) (*GeoResource, error) {
+	if kind != GeoKindGeoIP && kind != GeoKindGeosite {
+		return nil, fmt.Errorf("unknown geo database %q", kind)
+	}
+
+	resources, err := m.GeoResources()
+	if err != nil {
+		return nil, err
+	}
+
+	var resource *GeoResource
+	for i := range resources {
+		if resources[i].Kind == kind {
+			resource = &resources[i]
+			break
+		}
+	}
+	if resource == nil {
+		return nil, fmt.Errorf("%w: route.%s is missing", ErrGeoNotConfigured, kind)
+	}
+
+	if err := downloadFile(ctx, resource.DownloadURL, resource.Path); err != nil {
+		return nil, err
+	}
+
+	statGeoResource(resource)
+	return resource, nil
+}
+
+// downloadFile fetches url into path, replacing it atomically
+func downloadFile(ctx context.Context, url, path string) error {
+	ctx, cancel := context.WithTimeout(ctx, GeoDownloadTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("invalid download URL: %w", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to download %s: %s", url, resp.Status)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, resp.Body); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to download %s: %w", url, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write temporary file: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("failed to set file permissions: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	return nil
+}
+
+// GeoWarnings reports rules that reference geoip/geosite categories without
+// a database configured, rule sets that are not defined, and remote rule
+// sets that can't be downloaded as configured
+func (m *Manager) GeoWarnings() ([]string, error) {
+	config, err := m.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []interface{}
+	var warnings []string
+	ruleSetTags := make(map[string]bool)
+	hasGeoIP, hasGeosite := false, false
+	if config.Route != nil {
+		rules = append(rules, config.Route.Rules...)
+		hasGeoIP = config.Route.GeoIP != nil
+		hasGeosite = config.Route.Geosite != nil
+		for _, item := range config.Route.RuleSet {
+			if ruleSet, ok := item.(map[string]interface{}); ok {
+				if tag, ok := ruleSet["tag"].(string); ok {
+					ruleSetTags[tag] = true
+				}
+				warnings = append(warnings, ruleSetDownloadWarnings(config, ruleSet)...)
+			}
+		}
+	}
+	if config.DNS != nil {
+		rules = append(rules, config.DNS.Rules...)
+	}
+
+	refs := geoReferences{ruleSets: make(map[string]bool)}
+	for _, rule := range rules {
+		refs.collect(rule)
+	}
+
+	if refs.geoip && !hasGeoIP {
+		warnings = append(warnings, "Rules match geoip categories but route.geoip is not configured")
+	}
+	if refs.geosite && !hasGeosite {
+		warnings = append(warnings, "Rules match geosite categories but route.geosite is not configured")
+	}
+
+	var missing []string
+	for tag := range refs.ruleSets {
+		if !ruleSetTags[tag] {
+			missing = append(missing, tag)
+		}
+	}
+	sort.Strings(missing)
+	for _, tag := range missing {
+		warnings = append(warnings, fmt.Sprintf("Rules reference rule set %q, which is not defined in route.rule_set", tag))
+	}
+
+	return warnings, nil
+}
+
+// durationPattern matches the durations sing-box accepts, Go's units plus d
+// for days, such as 1d or 12h30m
+var durationPattern = regexp.MustCompile(`^([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h|d))+$`)
+
+// ValidateRuleSetDownload checks the download options of a remote rule set:
+// download_detour must name an outbound or endpoint of the config, or be
+// empty to download directly, and update_interval must be a duration
+func ValidateRuleSetDownload(config *Config, ruleSet map[string]interface{}) error {
+	if problems := ruleSetDownloadProblems(config, ruleSet); len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// ruleSetDownloadProblems lists what ValidateRuleSetDownload rejects
+func ruleSetDownloadProblems(config *Config, ruleSet map[string]interface{}) []string {
+	var problems []string
+	if detour, _ := ruleSet["download_detour"].(string); detour != "" && !tagInUse(config, detour) {
+		problems = append(problems, fmt.Sprintf("download_detour %q is not an outbound or endpoint", detour))
+	}
+	if interval, ok := ruleSet["update_interval"]; ok {
+		if value, isString := interval.(string); !isString || !durationPattern.MatchString(value) {
+			problems = append(problems, fmt.Sprintf("update_interval %v is not a duration such as 1d or 12h", interval))
+		}
+	}
+	return problems
+}
+
+// ruleSetDownloadWarnings reports why a remote rule set can't be downloaded
+// as configured
+func ruleSetDownloadWarnings(config *Config, ruleSet map[string]interface{}) []string {
+	if ruleSetType, _ := ruleSet["type"].(string); ruleSetType != "remote" {
+		return nil
+	}
+	tag, _ := ruleSet["tag"].(string)
+	var warnings []string
+	for _, problem := range ruleSetDownloadProblems(config, ruleSet) {
+		warnings = append(warnings, fmt.Sprintf("Rule set %q: %s", tag, problem))
+	}
+	return warnings
+}
+
+// geoReferences collects the geo data a set of rules depends on
+type geoReferences struct {
+	geoip    bool
+	geosite  bool
+	ruleSets map[string]bool
+}
+
+// collect records the references of a rule, descending into logical rules
+func (refs *geoReferences) collect(item interface{}) {
+	rule, ok := item.(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	if hasValues(rule["geoip"]) || hasValues(rule["source_geoip"]) {
+		refs.geoip = true
+	}
+	if hasValues(rule["geosite"]) {
+		refs.geosite = true
+	}
+	switch ruleSet := rule["rule_set"].(type) {
+	case string:
+		refs.ruleSets[ruleSet] = true
+	case []interface{}:
+		for _, tag := range ruleSet {
+			if tag, ok := tag.(string); ok {
+				refs.ruleSets[tag] = true
+			}
+		}
+	}
+
+	if nested, ok := rule["rules"].([]interface{}); ok {
+		for _, subRule := range nested {
+			refs.collect(subRule)
+		}
+	}
+}
+
+// hasValues reports whether a rule field holds a non-empty string or list
+func hasValues(value interface{}) bool {
+	switch v := value.(type) {
+	case string:
+		return v != ""
+	case []interface{}:
+		return len(v) > 0
+	}
+	return false
+}
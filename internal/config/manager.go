@@ -1,12 +1,19 @@
 package config
 
 import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/matinhimself/singbox-web-config/internal/types"
@@ -14,25 +21,66 @@ import (
 
 // Manager handles sing-box configuration management
 type Manager struct {
-	configPath string
-	backupDir  string
+	configPath    string
+	backupDir     string
+	disabledPath  string
+	changeLogPath string
+	changeLogMu   sync.Mutex
+
+	// store holds the config itself, see store.go. dirMode is set when
+	// configPath is a directory of config fragments, see fragments.go.
+	store   ConfigStore
+	dirMode bool
 }
 
-// NewManager creates a new config manager
-func NewManager(configPath string) (*Manager, error) {
-	backupDir := filepath.Join(filepath.Dir(configPath), "backups")
+// NewManager creates a new config manager. configPath is either a config
+// file or a directory of fragments that sing-box merges, as with
+// `sing-box run -C`. Backups go to backupDir, or a "backups" directory next
+// to the config if it is empty; other state is kept next to the config.
+func NewManager(configPath, backupDir string) (*Manager, error) {
+	// A fragment directory given with a trailing slash must still keep its
+	// state beside the directory, not in it
+	configPath = filepath.Clean(configPath)
+	if backupDir == "" {
+		backupDir = filepath.Join(filepath.Dir(configPath), "backups")
+	}
+	if err := ensureWritableDir(backupDir); err != nil {
+		return nil, fmt.Errorf("backup directory %s: %w", backupDir, err)
+	}
+
+	info, err := os.Stat(configPath)
+	dirMode := err == nil && info.IsDir()
 
-	// Create backup directory if it doesn't exist
-	if err := os.MkdirAll(backupDir, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create backup directory: %w", err)
+	var store ConfigStore = &fileStore{path: configPath}
+	if dirMode {
+		store = &fragmentStore{dir: configPath, overrides: DefaultOverridesFragment}
 	}
 
 	return &Manager{
-		configPath: configPath,
-		backupDir:  backupDir,
+		configPath:    configPath,
+		backupDir:     backupDir,
+		disabledPath:  filepath.Join(filepath.Dir(configPath), "disabled-outbounds.json"),
+		changeLogPath: filepath.Join(filepath.Dir(configPath), "changes.log"),
+		store:         store,
+		dirMode:       dirMode,
 	}, nil
 }
 
+// ensureWritableDir creates dir if it doesn't exist, readable only by its
+// owner since backups hold secrets, and checks that files can be written to
+// it so a bad location fails at start rather than on the first change
+func ensureWritableDir(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return checkPermission(err)
+	}
+	probe, err := os.CreateTemp(dir, ".write-check-*")
+	if err != nil {
+		return fmt.Errorf("not writable: %w", checkPermission(err))
+	}
+	probe.Close()
+	return os.Remove(probe.Name())
+}
+
 // Config is an alias to the generated type-safe Config type
 type Config = types.Config
 
@@ -43,6 +91,21 @@ type BackupMetadata struct {
 	Timestamp   time.Time `json:"timestamp"`
 	ConfigFile  string    `json:"config_file"`
 	Version     string    `json:"version,omitempty"`
+	Pinned      bool      `json:"pinned,omitempty"`
+	// Hash is the SHA-256 of the backed up config, see ConfigHash
+	Hash string `json:"hash,omitempty"`
+}
+
+// DisabledOutbound is an outbound taken out of the config along with the
+// groups it was a member of, so it can be restored later
+type DisabledOutbound struct {
+	Outbound map[string]interface{} `json:"outbound"`
+	Groups   []string               `json:"groups,omitempty"`
+}
+
+// disabledOutboundsFile is the on-disk format of the disabled outbounds store
+type disabledOutboundsFile struct {
+	DisabledOutbounds []DisabledOutbound `json:"_disabled_outbounds"`
 }
 
 // BackupInfo combines backup filename with its metadata
@@ -53,14 +116,13 @@ type BackupInfo struct {
 
 // LoadConfig loads the current configuration
 func (m *Manager) LoadConfig() (*Config, error) {
-	data, err := os.ReadFile(m.configPath)
+	data, err := m.readRaw()
 	if err != nil {
 		if os.IsNotExist(err) {
 			// Return default config if file doesn't exist
 			return &Config{
 				Route: &types.RouteOptions{
 					Rules: []interface{}{},
-					Final: "direct",
 				},
 			}, nil
 		}
@@ -75,6 +137,32 @@ func (m *Manager) LoadConfig() (*Config, error) {
 	return &config, nil
 }
 
+// ConfigHash returns the SHA-256 of the config file, or of an empty file
+// when it doesn't exist yet
+func (m *Manager) ConfigHash() (string, error) {
+	data, err := m.readRaw()
+	if err != nil && !os.IsNotExist(err) {
+		return "", fmt.Errorf("failed to read config: %w", err)
+	}
+
+	return contentHash(data), nil
+}
+
+// contentHash returns the hex SHA-256 of data
+func contentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// ReadConfig returns the config file exactly as it is on disk
+func (m *Manager) ReadConfig() ([]byte, error) {
+	data, err := m.readRaw()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	return data, nil
+}
+
 // SaveConfig saves the configuration with backup
 func (m *Manager) SaveConfig(config *Config) error {
 	// Create backup first
@@ -82,14 +170,14 @@ func (m *Manager) SaveConfig(config *Config) error {
 		return fmt.Errorf("failed to create backup: %w", err)
 	}
 
-	// Marshal config to JSON
-	data, err := json.MarshalIndent(config, "", "  ")
+	// Marshal config to JSON, keeping fields the generated types don't know
+	data, err := m.MarshalConfig(config)
 	if err != nil {
-		return fmt.Errorf("failed to marshal config: %w", err)
+		return err
 	}
 
 	// Write to file
-	if err := os.WriteFile(m.configPath, data, 0644); err != nil {
+	if err := m.writeRaw(data); err != nil {
 		return fmt.Errorf("failed to write config: %w", err)
 	}
 
@@ -98,27 +186,35 @@ func (m *Manager) SaveConfig(config *Config) error {
 
 // BackupConfig creates a backup of the current configuration
 func (m *Manager) BackupConfig() error {
-	// Check if config exists
-	if _, err := os.Stat(m.configPath); os.IsNotExist(err) {
-		return nil // No config to backup
-	}
-
 	timestamp := time.Now()
 	name := fmt.Sprintf("Auto backup %s", timestamp.Format("2006-01-02 15:04:05"))
-	return m.CreateBackupWithName(name, "Automatic backup")
+	_, err := m.CreateBackupWithName(name, "Automatic backup")
+	return err
 }
 
-// CreateBackupWithName creates a backup with a custom name and metadata
-func (m *Manager) CreateBackupWithName(name, description string) error {
-	// Check if config exists
-	if _, err := os.Stat(m.configPath); os.IsNotExist(err) {
-		return nil // No config to backup
+// CreateBackupWithName creates a backup with a custom name and metadata. It
+// reports false without creating one when there is no config yet or the
+// config is identical to the latest backup, so restarts and saves that change
+// nothing don't fill the list with copies.
+func (m *Manager) CreateBackupWithName(name, description string) (bool, error) {
+	if m.backupDir == "" {
+		return false, nil // The store keeps no backups
 	}
 
 	// Read current config
-	data, err := os.ReadFile(m.configPath)
+	data, err := m.readRaw()
+	if os.IsNotExist(err) {
+		return false, nil // No config to backup
+	}
 	if err != nil {
-		return fmt.Errorf("failed to read config: %w", err)
+		return false, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	hash := contentHash(data)
+	if latest, err := m.latestBackupHash(); err != nil {
+		return false, err
+	} else if latest == hash {
+		return false, nil
 	}
 
 	// Create backup filename with timestamp
@@ -133,7 +229,7 @@ func (m *Manager) CreateBackupWithName(name, description string) error {
 
 	// Write backup
 	if err := os.WriteFile(backupPath, data, 0644); err != nil {
-		return fmt.Errorf("failed to write backup: %w", err)
+		return false, fmt.Errorf("failed to write backup: %w", checkPermission(err))
 	}
 
 	// Create metadata
@@ -143,20 +239,43 @@ func (m *Manager) CreateBackupWithName(name, description string) error {
 		Timestamp:   timestamp,
 		ConfigFile:  backupFilename,
 		Version:     "1.0", // You can update this to track config version
+		Hash:        hash,
 	}
 
 	// Write metadata file
-	metadataPath := filepath.Join(m.backupDir, backupFilename+".meta")
-	metadataJSON, err := json.MarshalIndent(metadata, "", "  ")
+	if err := m.saveBackupMetadata(backupFilename, &metadata); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// latestBackupHash returns the hash of the newest backup, pinned or not, or
+// "" if there are none. Backups from before hashes were recorded are hashed
+// from their file.
+func (m *Manager) latestBackupHash() (string, error) {
+	backups, err := m.ListBackups()
 	if err != nil {
-		return fmt.Errorf("failed to marshal metadata: %w", err)
+		return "", err
 	}
 
-	if err := os.WriteFile(metadataPath, metadataJSON, 0644); err != nil {
-		return fmt.Errorf("failed to write metadata: %w", err)
+	var latest *BackupInfo
+	for i := range backups {
+		if latest == nil || backups[i].Metadata.Timestamp.After(latest.Metadata.Timestamp) {
+			latest = &backups[i]
+		}
+	}
+	if latest == nil {
+		return "", nil
+	}
+	if latest.Metadata.Hash != "" {
+		return latest.Metadata.Hash, nil
 	}
 
-	return nil
+	data, err := m.ReadBackup(latest.Filename)
+	if err != nil {
+		return "", err
+	}
+	return contentHash(data), nil
 }
 
 // sanitizeFilename removes invalid characters from filename
@@ -208,16 +327,70 @@ func (m *Manager) GetRules() ([]interface{}, error) {
 	return config.Route.Rules, nil
 }
 
+// UpdateDNSRules replaces the DNS rules
+func (m *Manager) UpdateDNSRules(rules []interface{}) error {
+	config, err := m.LoadConfig()
+	if err != nil {
+		return err
+	}
+
+	if config.DNS == nil {
+		config.DNS = &types.RawDNSOptions{}
+	}
+	config.DNS.Rules = rules
+
+	return m.SaveConfig(config)
+}
+
+// GetDNSRules returns the current DNS rules
+func (m *Manager) GetDNSRules() ([]interface{}, error) {
+	config, err := m.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if config.DNS == nil {
+		return []interface{}{}, nil
+	}
+
+	return config.DNS.Rules, nil
+}
+
+// GetDNSServerTags returns the tags of the DNS servers, which DNS rules
+// route queries to
+func (m *Manager) GetDNSServerTags() ([]string, error) {
+	config, err := m.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	var tags []string
+	if config.DNS != nil {
+		for _, server := range config.DNS.Servers {
+			if serverMap, ok := server.(map[string]interface{}); ok {
+				if tag, ok := serverMap["tag"].(string); ok && tag != "" {
+					tags = append(tags, tag)
+				}
+			}
+		}
+	}
+	return tags, nil
+}
+
 // ListBackups returns a list of available backups sorted by timestamp (newest first)
 func (m *Manager) ListBackups() ([]BackupInfo, error) {
+	if m.backupDir == "" {
+		return []BackupInfo{}, nil
+	}
+
 	entries, err := os.ReadDir(m.backupDir)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read backup directory: %w", err)
+		return nil, fmt.Errorf("failed to read backup directory: %w", checkPermission(err))
 	}
 
 	var backups []BackupInfo
 	for _, entry := range entries {
-		if !entry.IsDir() && filepath.Ext(entry.Name()) == ".json" {
+		if !entry.IsDir() && isBackupFile(entry.Name()) {
 			backupInfo := BackupInfo{
 				Filename: entry.Name(),
 			}
@@ -245,22 +418,192 @@ func (m *Manager) ListBackups() ([]BackupInfo, error) {
 		}
 	}
 
-	// Sort by timestamp (newest first)
+	// Sort pinned backups first, then by timestamp (newest first)
 	sort.Slice(backups, func(i, j int) bool {
+		if backups[i].Metadata.Pinned != backups[j].Metadata.Pinned {
+			return backups[i].Metadata.Pinned
+		}
 		return backups[i].Metadata.Timestamp.After(backups[j].Metadata.Timestamp)
 	})
 
 	return backups, nil
 }
 
-// RestoreBackup restores a configuration from a backup
-func (m *Manager) RestoreBackup(backupName string) error {
-	backupPath := filepath.Join(m.backupDir, backupName)
+// isBackupFile reports whether a file in the backup directory is a backup,
+// plain or gzipped, rather than its metadata or something else
+func isBackupFile(name string) bool {
+	return strings.HasSuffix(name, ".json") || strings.HasSuffix(name, ".json.gz")
+}
+
+// ListBackupsPaged returns up to limit backups starting at offset, in the
+// order of ListBackups, along with the total number of backups
+func (m *Manager) ListBackupsPaged(offset, limit int) ([]BackupInfo, int, error) {
+	backups, err := m.ListBackups()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	total := len(backups)
+	if offset < 0 || offset > total {
+		offset = total
+	}
+	end := total
+	if limit > 0 && offset+limit < total {
+		end = offset + limit
+	}
+	return backups[offset:end], total, nil
+}
+
+// ErrInvalidBackupName is returned for a backup name that is empty or
+// could escape the backup directory
+var ErrInvalidBackupName = errors.New("invalid backup name")
+
+// resolveBackupPath maps a user-supplied backup name to a path inside the
+// backup directory, rejecting anything that could escape it
+func (m *Manager) resolveBackupPath(backupName string) (string, error) {
+	if m.backupDir == "" {
+		return "", errNoState
+	}
+	if backupName == "" || strings.ContainsAny(backupName, `/\`) || strings.Contains(backupName, "..") {
+		return "", fmt.Errorf("%w: %q", ErrInvalidBackupName, backupName)
+	}
+
+	absDir, err := filepath.Abs(m.backupDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve backup directory: %w", err)
+	}
+
+	backupPath := filepath.Join(absDir, backupName)
+	if filepath.Dir(backupPath) != absDir {
+		return "", fmt.Errorf("%w: %q", ErrInvalidBackupName, backupName)
+	}
+
+	return backupPath, nil
+}
+
+// loadBackupMetadata reads the metadata of a backup, falling back to
+// defaults derived from the backup file when no metadata file exists
+func (m *Manager) loadBackupMetadata(backupName string) (*BackupMetadata, error) {
+	backupPath, err := m.resolveBackupPath(backupName)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(backupPath)
+	if err != nil {
+		return nil, fmt.Errorf("backup not found: %w", err)
+	}
+
+	metadata := &BackupMetadata{
+		Name:       backupName,
+		Timestamp:  info.ModTime(),
+		ConfigFile: backupName,
+	}
+
+	data, err := os.ReadFile(backupPath + ".meta")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return metadata, nil
+		}
+		return nil, fmt.Errorf("failed to read metadata: %w", err)
+	}
+
+	if err := json.Unmarshal(data, metadata); err != nil {
+		return nil, fmt.Errorf("failed to parse metadata: %w", err)
+	}
+
+	return metadata, nil
+}
+
+// saveBackupMetadata writes the metadata file of a backup
+func (m *Manager) saveBackupMetadata(backupName string, metadata *BackupMetadata) error {
+	metadataJSON, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+
+	metadataPath := filepath.Join(m.backupDir, backupName+".meta")
+	if err := os.WriteFile(metadataPath, metadataJSON, 0644); err != nil {
+		return fmt.Errorf("failed to write metadata: %w", checkPermission(err))
+	}
+
+	return nil
+}
+
+// PinBackup marks a backup as pinned so it is listed first
+func (m *Manager) PinBackup(backupName string) error {
+	return m.setBackupPinned(backupName, true)
+}
+
+// UnpinBackup removes the pinned mark from a backup
+func (m *Manager) UnpinBackup(backupName string) error {
+	return m.setBackupPinned(backupName, false)
+}
+
+// setBackupPinned updates the pinned flag in a backup's metadata
+func (m *Manager) setBackupPinned(backupName string, pinned bool) error {
+	metadata, err := m.loadBackupMetadata(backupName)
+	if err != nil {
+		return err
+	}
+
+	metadata.Pinned = pinned
+	return m.saveBackupMetadata(backupName, metadata)
+}
+
+// UpdateBackupDescription changes the description of an existing backup
+func (m *Manager) UpdateBackupDescription(backupName, description string) error {
+	metadata, err := m.loadBackupMetadata(backupName)
+	if err != nil {
+		return err
+	}
+
+	metadata.Description = description
+	return m.saveBackupMetadata(backupName, metadata)
+}
+
+// ReadBackup returns the contents of a backup file, decompressing it if it
+// is stored gzipped
+func (m *Manager) ReadBackup(backupName string) ([]byte, error) {
+	backupPath, err := m.resolveBackupPath(backupName)
+	if err != nil {
+		return nil, err
+	}
 
-	// Read backup
 	data, err := os.ReadFile(backupPath)
 	if err != nil {
-		return fmt.Errorf("failed to read backup: %w", err)
+		return nil, fmt.Errorf("failed to read backup: %w", err)
+	}
+
+	return decompressBackup(data)
+}
+
+// decompressBackup returns the config in a backup, decompressing it if it
+// is gzipped. Gzip is detected by its magic header rather than trusting
+// the extension.
+func decompressBackup(data []byte) ([]byte, error) {
+	if len(data) < 2 || data[0] != 0x1f || data[1] != 0x8b {
+		return data, nil
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open compressed backup: %w", err)
+	}
+	defer zr.Close()
+
+	data, err = io.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress backup: %w", err)
+	}
+	return data, nil
+}
+
+// RestoreBackup restores a configuration from a backup, plain or gzipped
+func (m *Manager) RestoreBackup(backupName string) error {
+	data, err := m.ReadBackup(backupName)
+	if err != nil {
+		return err
 	}
 
 	// Validate JSON
@@ -269,14 +612,30 @@ func (m *Manager) RestoreBackup(backupName string) error {
 		return fmt.Errorf("invalid backup file: %w", err)
 	}
 
-	// Create backup of current config before restoring
+	return m.replaceConfig(data)
+}
+
+// ImportConfig replaces the current config with an uploaded one. The data
+// must parse as a sing-box config; it is written as given so the uploaded
+// formatting is kept.
+func (m *Manager) ImportConfig(data []byte) error {
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+
+	return m.replaceConfig(data)
+}
+
+// replaceConfig backs up the current config and writes data in its place
+func (m *Manager) replaceConfig(data []byte) error {
+	// Create backup of current config before replacing it
 	if err := m.BackupConfig(); err != nil {
 		return fmt.Errorf("failed to backup current config: %w", err)
 	}
 
-	// Write restored config
-	if err := os.WriteFile(m.configPath, data, 0644); err != nil {
-		return fmt.Errorf("failed to restore config: %w", err)
+	if err := m.writeRaw(data); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
 	}
 
 	return nil
@@ -337,26 +696,318 @@ func (m *Manager) RenameOutbound(oldTag, newTag string) error {
 		return err
 	}
 
+	if oldTag != newTag && tagInUse(config, newTag) {
+		return fmt.Errorf("tag %q is already used by another outbound or endpoint", newTag)
+	}
+
 	// Update outbound tag
 	for _, outbound := range config.Outbounds {
 		if outboundMap, ok := outbound.(map[string]interface{}); ok {
 			if tag, ok := outboundMap["tag"].(string); ok && tag == oldTag {
 				outboundMap["tag"] = newTag
 			}
+		}
+	}
+
+	replaceTagReferences(config, oldTag, newTag)
+
+	return m.SaveConfig(config)
+}
+
+// UpdateEndpoints updates the endpoints in the config
+func (m *Manager) UpdateEndpoints(endpoints []interface{}) error {
+	// Load current config
+	config, err := m.LoadConfig()
+	if err != nil {
+		return err
+	}
+
+	// Update endpoints
+	config.Endpoints = endpoints
+
+	// Save config
+	return m.SaveConfig(config)
+}
+
+// GetEndpoints returns the current endpoints (WireGuard, Tailscale)
+func (m *Manager) GetEndpoints() ([]interface{}, error) {
+	config, err := m.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Endpoints == nil {
+		return []interface{}{}, nil
+	}
+
+	return config.Endpoints, nil
+}
 
-			// Update references in selector/urltest outbounds
-			if outbounds, ok := outboundMap["outbounds"].([]interface{}); ok {
-				for i, ob := range outbounds {
-					if obTag, ok := ob.(string); ok && obTag == oldTag {
-						outbounds[i] = newTag
-					}
+// GetRouteTargetTags returns the tags of all outbounds and endpoints, which
+// are the values that rules, groups and detours can refer to
+func (m *Manager) GetRouteTargetTags() ([]string, error) {
+	config, err := m.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	var tags []string
+	for _, item := range append(append([]interface{}{}, config.Outbounds...), config.Endpoints...) {
+		if itemMap, ok := item.(map[string]interface{}); ok {
+			if tag, ok := itemMap["tag"].(string); ok {
+				tags = append(tags, tag)
+			}
+		}
+	}
+
+	return tags, nil
+}
+
+// RenameEndpoint renames an endpoint and updates all references to it
+func (m *Manager) RenameEndpoint(oldTag, newTag string) error {
+	config, err := m.LoadConfig()
+	if err != nil {
+		return err
+	}
+
+	if oldTag != newTag && tagInUse(config, newTag) {
+		return fmt.Errorf("tag %q is already used by another outbound or endpoint", newTag)
+	}
+
+	found := false
+	for _, endpoint := range config.Endpoints {
+		if endpointMap, ok := endpoint.(map[string]interface{}); ok {
+			if tag, ok := endpointMap["tag"].(string); ok && tag == oldTag {
+				endpointMap["tag"] = newTag
+				found = true
+			}
+		}
+	}
+	if !found {
+		return fmt.Errorf("endpoint %q not found", oldTag)
+	}
+
+	replaceTagReferences(config, oldTag, newTag)
+
+	return m.SaveConfig(config)
+}
+
+// DeleteEndpoint removes an endpoint and drops it from any selector/urltest
+// groups. It refuses when routing still points at the endpoint or it is the
+// last member of a group, since sing-box would reject the config.
+func (m *Manager) DeleteEndpoint(tag string) error {
+	config, err := m.LoadConfig()
+	if err != nil {
+		return err
+	}
+
+	if reference := tagReference(config, tag); reference != "" {
+		return fmt.Errorf("endpoint %q is used by %s", tag, reference)
+	}
+
+	index := -1
+	for i, endpoint := range config.Endpoints {
+		if endpointMap, ok := endpoint.(map[string]interface{}); ok {
+			if t, ok := endpointMap["tag"].(string); ok && t == tag {
+				index = i
+				break
+			}
+		}
+	}
+	if index == -1 {
+		return fmt.Errorf("endpoint %q not found", tag)
+	}
+
+	for _, outbound := range config.Outbounds {
+		group, ok := outbound.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		members, ok := group["outbounds"].([]interface{})
+		if !ok {
+			continue
+		}
+
+		var remaining []interface{}
+		for _, member := range members {
+			if memberTag, ok := member.(string); !ok || memberTag != tag {
+				remaining = append(remaining, member)
+			}
+		}
+		if len(remaining) == len(members) {
+			continue
+		}
+		if len(remaining) == 0 {
+			return fmt.Errorf("endpoint %q is the only member of group %q", tag, group["tag"])
+		}
+		group["outbounds"] = remaining
+
+		if def, ok := group["default"].(string); ok && def == tag {
+			if next, ok := remaining[0].(string); ok {
+				group["default"] = next
+			}
+		}
+	}
+
+	config.Endpoints = append(config.Endpoints[:index], config.Endpoints[index+1:]...)
+
+	return m.SaveConfig(config)
+}
+
+// ReferenceCounts returns, for every tag something refers to, how many
+// places do: group members, detours of outbounds, endpoints and DNS
+// servers, route rules including nested ones, the route final outbound and
+// download detours. Tags missing from the map have no references.
+func (m *Manager) ReferenceCounts() (map[string]int, error) {
+	config, err := m.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int)
+	for _, ref := range tagReferences(config) {
+		counts[ref.tag]++
+	}
+	return counts, nil
+}
+
+// tagRef is one place in a config that refers to an outbound or endpoint
+type tagRef struct {
+	tag   string
+	where string // Describes the place, such as "the route final outbound"
+	// member marks membership of a selector/urltest group, which the tag
+	// can be dropped from instead of blocking its removal
+	member bool
+}
+
+// tagReferences collects every reference to an outbound or endpoint tag in
+// a config, for counting and for describing what still uses a tag
+func tagReferences(config *Config) []tagRef {
+	var refs []tagRef
+	for _, item := range append(append([]interface{}{}, config.Outbounds...), config.Endpoints...) {
+		itemMap, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if members, ok := itemMap["outbounds"].([]interface{}); ok {
+			for _, member := range members {
+				if memberTag, ok := member.(string); ok {
+					refs = append(refs, tagRef{tag: memberTag, where: fmt.Sprintf("group %q", itemMap["tag"]), member: true})
+				}
+			}
+		}
+		if detour, ok := itemMap["detour"].(string); ok && detour != "" {
+			refs = append(refs, tagRef{tag: detour, where: fmt.Sprintf("the detour of %q", itemMap["tag"])})
+		}
+	}
+
+	if config.DNS != nil {
+		for _, server := range config.DNS.Servers {
+			if serverMap, ok := server.(map[string]interface{}); ok {
+				if detour, ok := serverMap["detour"].(string); ok && detour != "" {
+					refs = append(refs, tagRef{tag: detour, where: fmt.Sprintf("the detour of DNS server %q", serverMap["tag"])})
+				}
+			}
+		}
+	}
+
+	if config.Route != nil {
+		if config.Route.Final != "" {
+			refs = append(refs, tagRef{tag: config.Route.Final, where: "the route final outbound"})
+		}
+		refs = appendRuleReferences(refs, config.Route.Rules)
+		for _, ruleSet := range config.Route.RuleSet {
+			if ruleSetMap, ok := ruleSet.(map[string]interface{}); ok {
+				if detour, ok := ruleSetMap["download_detour"].(string); ok && detour != "" {
+					refs = append(refs, tagRef{tag: detour, where: fmt.Sprintf("the download detour of rule set %q", ruleSetMap["tag"])})
+				}
+			}
+		}
+		if config.Route.GeoIP != nil && config.Route.GeoIP.DownloadDetour != "" {
+			refs = append(refs, tagRef{tag: config.Route.GeoIP.DownloadDetour, where: "the GeoIP download detour"})
+		}
+		if config.Route.Geosite != nil && config.Route.Geosite.DownloadDetour != "" {
+			refs = append(refs, tagRef{tag: config.Route.Geosite.DownloadDetour, where: "the Geosite download detour"})
+		}
+	}
+
+	return refs
+}
+
+// appendRuleReferences adds the outbounds of route rules, and of the rules
+// nested in logical rules, to refs
+func appendRuleReferences(refs []tagRef, rules []interface{}) []tagRef {
+	for _, rule := range rules {
+		ruleMap, ok := rule.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if outbound, ok := ruleMap["outbound"].(string); ok && outbound != "" {
+			refs = append(refs, tagRef{tag: outbound, where: "a route rule"})
+		}
+		if subRules, ok := ruleMap["rules"].([]interface{}); ok {
+			refs = appendRuleReferences(refs, subRules)
+		}
+	}
+	return refs
+}
+
+// tagReference describes what routing still points at tag, so it can't be
+// removed: the route final outbound, a route rule (including rules nested in
+// logical rules), the detour of another outbound, endpoint or DNS server, or
+// a download detour. It returns "" when nothing does. Group membership is
+// left to the caller, since a tag can be dropped from a group.
+func tagReference(config *Config, tag string) string {
+	for _, ref := range tagReferences(config) {
+		if ref.tag == tag && !ref.member {
+			return ref.where
+		}
+	}
+	return ""
+}
+
+// tagInUse reports whether an outbound or endpoint already uses the tag.
+// sing-box requires tags to be unique across both lists.
+func tagInUse(config *Config, tag string) bool {
+	for _, item := range append(append([]interface{}{}, config.Outbounds...), config.Endpoints...) {
+		if itemMap, ok := item.(map[string]interface{}); ok {
+			if t, ok := itemMap["tag"].(string); ok && t == tag {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// replaceTagReferences points every reference to oldTag at newTag: group
+// members and defaults, detours of outbounds and endpoints, route rules and
+// the route final outbound
+func replaceTagReferences(config *Config, oldTag, newTag string) {
+	for _, item := range append(append([]interface{}{}, config.Outbounds...), config.Endpoints...) {
+		itemMap, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		// Update references in selector/urltest outbounds
+		if members, ok := itemMap["outbounds"].([]interface{}); ok {
+			for i, member := range members {
+				if memberTag, ok := member.(string); ok && memberTag == oldTag {
+					members[i] = newTag
 				}
 			}
 		}
+		if def, ok := itemMap["default"].(string); ok && def == oldTag {
+			itemMap["default"] = newTag
+		}
+
+		if detour, ok := itemMap["detour"].(string); ok && detour == oldTag {
+			itemMap["detour"] = newTag
+		}
 	}
 
 	// Update references in route rules
-	if config.Route != nil && config.Route.Rules != nil {
+	if config.Route != nil {
 		for _, rule := range config.Route.Rules {
 			if ruleMap, ok := rule.(map[string]interface{}); ok {
 				// Update outbound field
@@ -371,6 +1022,231 @@ func (m *Manager) RenameOutbound(oldTag, newTag string) error {
 			config.Route.Final = newTag
 		}
 	}
+}
 
-	return m.SaveConfig(config)
+// GetDisabledOutbounds returns the outbounds that have been disabled.
+// sing-box rejects unknown config keys, so they are kept in a file next to the config.
+func (m *Manager) GetDisabledOutbounds() ([]DisabledOutbound, error) {
+	if m.disabledPath == "" {
+		return []DisabledOutbound{}, nil
+	}
+
+	data, err := os.ReadFile(m.disabledPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []DisabledOutbound{}, nil
+		}
+		return nil, fmt.Errorf("failed to read disabled outbounds: %w", err)
+	}
+
+	var file disabledOutboundsFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse disabled outbounds: %w", err)
+	}
+
+	if file.DisabledOutbounds == nil {
+		return []DisabledOutbound{}, nil
+	}
+	return file.DisabledOutbounds, nil
+}
+
+// saveDisabledOutbounds writes the disabled outbounds store
+func (m *Manager) saveDisabledOutbounds(disabled []DisabledOutbound) error {
+	if m.disabledPath == "" {
+		return errNoState
+	}
+
+	data, err := json.MarshalIndent(disabledOutboundsFile{DisabledOutbounds: disabled}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal disabled outbounds: %w", err)
+	}
+
+	if err := os.WriteFile(m.disabledPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write disabled outbounds: %w", checkPermission(err))
+	}
+
+	return nil
+}
+
+// IsOutboundDisabled reports whether an outbound with the given tag is disabled
+func (m *Manager) IsOutboundDisabled(tag string) (bool, error) {
+	disabled, err := m.GetDisabledOutbounds()
+	if err != nil {
+		return false, err
+	}
+
+	for _, d := range disabled {
+		if t, _ := d.Outbound["tag"].(string); t == tag {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// DisableOutbound moves an outbound out of the config, removing it from any
+// selector/urltest groups. It refuses when the outbound is still referenced by
+// routing or a detour, or is the last member of a group, since sing-box would
+// reject the config.
+func (m *Manager) DisableOutbound(tag string) error {
+	config, err := m.LoadConfig()
+	if err != nil {
+		return err
+	}
+
+	if reference := tagReference(config, tag); reference != "" {
+		return fmt.Errorf("outbound %q is used by %s", tag, reference)
+	}
+
+	index := -1
+	var groups []string
+	for i, outbound := range config.Outbounds {
+		outboundMap, ok := outbound.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if t, ok := outboundMap["tag"].(string); ok && t == tag {
+			index = i
+			continue
+		}
+
+		members, ok := outboundMap["outbounds"].([]interface{})
+		if !ok {
+			continue
+		}
+		for _, member := range members {
+			if memberTag, ok := member.(string); ok && memberTag == tag {
+				if len(members) == 1 {
+					return fmt.Errorf("outbound %q is the only member of group %q", tag, outboundMap["tag"])
+				}
+				groupTag, _ := outboundMap["tag"].(string)
+				groups = append(groups, groupTag)
+				break
+			}
+		}
+	}
+
+	if index == -1 {
+		return fmt.Errorf("outbound %q not found", tag)
+	}
+
+	outboundMap, ok := config.Outbounds[index].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("outbound %q has an unexpected format", tag)
+	}
+
+	// Drop the outbound from its groups, moving a selector default to the next member
+	for _, outbound := range config.Outbounds {
+		group, ok := outbound.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		members, ok := group["outbounds"].([]interface{})
+		if !ok {
+			continue
+		}
+
+		var remaining []interface{}
+		for _, member := range members {
+			if memberTag, ok := member.(string); !ok || memberTag != tag {
+				remaining = append(remaining, member)
+			}
+		}
+		if len(remaining) == len(members) {
+			continue
+		}
+		group["outbounds"] = remaining
+
+		if def, ok := group["default"].(string); ok && def == tag {
+			if next, ok := remaining[0].(string); ok {
+				group["default"] = next
+			}
+		}
+	}
+
+	config.Outbounds = append(config.Outbounds[:index], config.Outbounds[index+1:]...)
+
+	disabled, err := m.GetDisabledOutbounds()
+	if err != nil {
+		return err
+	}
+	previous := disabled
+	disabled = append(disabled[:len(disabled):len(disabled)], DisabledOutbound{Outbound: outboundMap, Groups: groups})
+
+	// Keep the outbound in the disabled store before it leaves the config, so
+	// a failed write can't lose it
+	if err := m.saveDisabledOutbounds(disabled); err != nil {
+		return err
+	}
+	if err := m.SaveConfig(config); err != nil {
+		if restoreErr := m.saveDisabledOutbounds(previous); restoreErr != nil {
+			return fmt.Errorf("%w (restoring disabled outbounds also failed: %v)", err, restoreErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// EnableOutbound restores a disabled outbound into the config and re-adds it
+// to the groups it belonged to that still exist
+func (m *Manager) EnableOutbound(tag string) error {
+	disabled, err := m.GetDisabledOutbounds()
+	if err != nil {
+		return err
+	}
+
+	index := -1
+	for i, d := range disabled {
+		if t, _ := d.Outbound["tag"].(string); t == tag {
+			index = i
+			break
+		}
+	}
+	if index == -1 {
+		return fmt.Errorf("disabled outbound %q not found", tag)
+	}
+	entry := disabled[index]
+
+	config, err := m.LoadConfig()
+	if err != nil {
+		return err
+	}
+
+	for _, outbound := range config.Outbounds {
+		if outboundMap, ok := outbound.(map[string]interface{}); ok {
+			if t, ok := outboundMap["tag"].(string); ok && t == tag {
+				return fmt.Errorf("an outbound tagged %q already exists", tag)
+			}
+		}
+	}
+
+	for _, outbound := range config.Outbounds {
+		group, ok := outbound.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		groupTag, _ := group["tag"].(string)
+		members, ok := group["outbounds"].([]interface{})
+		if !ok || !containsString(entry.Groups, groupTag) {
+			continue
+		}
+		group["outbounds"] = append(members, tag)
+	}
+
+	config.Outbounds = append(config.Outbounds, entry.Outbound)
+	disabled = append(disabled[:index], disabled[index+1:]...)
+
+	if err := m.SaveConfig(config); err != nil {
+		return err
+	}
+	return m.saveDisabledOutbounds(disabled)
+}
+
+// containsString reports whether a string slice contains a value
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,210 @@
+package config
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestManager(t *testing.T, config string) *Manager {
+	t.Helper()
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewManager(configPath, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestDisableOutboundReferences(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    string
+		reference string
+	}{
+		{
+			name:      "route final",
+			config:    `{"outbounds":[{"type":"direct","tag":"proxy"}],"route":{"final":"proxy"}}`,
+			reference: "route final",
+		},
+		{
+			name:      "nested logical rule",
+			config:    `{"outbounds":[{"type":"direct","tag":"proxy"}],"route":{"rules":[{"type":"logical","mode":"or","rules":[{"port":53},{"type":"logical","rules":[{"outbound":"proxy"}]}]}]}}`,
+			reference: "route rule",
+		},
+		{
+			name:      "outbound detour",
+			config:    `{"outbounds":[{"type":"direct","tag":"proxy"},{"type":"socks","tag":"chained","detour":"proxy"}]}`,
+			reference: `detour of "chained"`,
+		},
+		{
+			name:      "DNS server detour",
+			config:    `{"dns":{"servers":[{"type":"https","tag":"remote","detour":"proxy"}]},"outbounds":[{"type":"direct","tag":"proxy"}]}`,
+			reference: `DNS server "remote"`,
+		},
+		{
+			name:      "rule set download detour",
+			config:    `{"outbounds":[{"type":"direct","tag":"proxy"}],"route":{"rule_set":[{"type":"remote","tag":"geosite-cn","download_detour":"proxy"}]}}`,
+			reference: `rule set "geosite-cn"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestManager(t, tt.config)
+			err := m.DisableOutbound("proxy")
+			if err == nil || !strings.Contains(err.Error(), tt.reference) {
+				t.Fatalf("DisableOutbound() error = %v, want one naming %s", err, tt.reference)
+			}
+
+			disabled, err := m.GetDisabledOutbounds()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(disabled) != 0 {
+				t.Errorf("disabled outbounds = %v, want none", disabled)
+			}
+		})
+	}
+}
+
+func TestDisableOutboundKeepsItInTheStore(t *testing.T) {
+	m := newTestManager(t, `{"outbounds":[{"type":"direct","tag":"direct"},{"type":"direct","tag":"proxy"},{"type":"selector","tag":"select","outbounds":["direct","proxy"],"default":"proxy"}]}`)
+	if err := m.DisableOutbound("proxy"); err != nil {
+		t.Fatal(err)
+	}
+
+	disabled, err := m.GetDisabledOutbounds()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(disabled) != 1 || disabled[0].Outbound["tag"] != "proxy" || len(disabled[0].Groups) != 1 || disabled[0].Groups[0] != "select" {
+		t.Fatalf("disabled outbounds = %+v, want proxy from group select", disabled)
+	}
+
+	tags, err := m.GetOutboundTags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if containsString(tags, "proxy") {
+		t.Errorf("outbound tags = %v, want proxy removed", tags)
+	}
+
+	if err := m.EnableOutbound("proxy"); err != nil {
+		t.Fatal(err)
+	}
+	tags, err = m.GetOutboundTags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !containsString(tags, "proxy") {
+		t.Errorf("outbound tags = %v, want proxy restored", tags)
+	}
+}
+
+func TestNewManagerKeepsStateOutOfFragmentDir(t *testing.T) {
+	dir := t.TempDir()
+	fragments := filepath.Join(dir, "conf.d")
+	if err := os.Mkdir(fragments, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := NewManager(fragments+string(filepath.Separator), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{m.backupDir, m.disabledPath, m.changeLogPath} {
+		if filepath.Dir(path) != dir {
+			t.Errorf("state path %s is not beside %s", path, fragments)
+		}
+	}
+}
+
+func TestReferenceCounts(t *testing.T) {
+	m := newTestManager(t, `{
+		"dns": {"servers": [{"type": "https", "tag": "remote", "detour": "proxy"}]},
+		"outbounds": [
+			{"type": "direct", "tag": "proxy"},
+			{"type": "direct", "tag": "unused"},
+			{"type": "socks", "tag": "chained", "detour": "proxy"},
+			{"type": "selector", "tag": "select", "outbounds": ["proxy", "chained"]}
+		],
+		"route": {
+			"rules": [{"type": "logical", "mode": "or", "rules": [{"port": 53}, {"outbound": "proxy"}]}],
+			"rule_set": [{"type": "remote", "tag": "geosite-cn", "download_detour": "proxy"}],
+			"geoip": {"download_detour": "chained"},
+			"final": "select"
+		}
+	}`)
+
+	counts, err := m.ReferenceCounts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int{
+		"proxy":   5, // group member, outbound and DNS detours, nested rule, rule set
+		"chained": 2, // group member, GeoIP download detour
+		"select":  1, // route final
+	}
+	for tag, count := range want {
+		if counts[tag] != count {
+			t.Errorf("references to %s = %d, want %d", tag, counts[tag], count)
+		}
+	}
+	if counts["unused"] != 0 {
+		t.Errorf("references to unused = %d, want 0", counts["unused"])
+	}
+}
+
+func TestGzippedBackups(t *testing.T) {
+	m := newTestManager(t, bundleTestConfig)
+
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	zw.Write([]byte(`{"outbounds":[{"type":"direct","tag":"from-gzip"}]}`))
+	zw.Close()
+	if err := os.WriteFile(filepath.Join(m.backupDir, "old-20240101-000000.json.gz"), compressed.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	backups, err := m.ListBackups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 1 || backups[0].Filename != "old-20240101-000000.json.gz" {
+		t.Fatalf("backups = %v, want the gzipped backup", backups)
+	}
+
+	if err := m.RestoreBackup("old-20240101-000000.json.gz"); err != nil {
+		t.Fatal(err)
+	}
+	tags, err := m.GetOutboundTags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !containsString(tags, "from-gzip") {
+		t.Errorf("outbound tags = %v, want the gzipped backup restored", tags)
+	}
+}
+
+func TestReadBackupRejectsInvalidNames(t *testing.T) {
+	m := newTestManager(t, bundleTestConfig)
+
+	for _, name := range []string{"", "../config.json", `..\config.json`, "sub/backup.json"} {
+		if _, err := m.ReadBackup(name); !errors.Is(err, ErrInvalidBackupName) {
+			t.Errorf("ReadBackup(%q) error = %v, want ErrInvalidBackupName", name, err)
+		}
+	}
+	if _, err := m.ReadBackup("missing.json"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("ReadBackup(missing.json) error = %v, want one for a missing file", err)
+	}
+}
@@ -0,0 +1,323 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrPatchRejected is returned when a JSON Patch can't be applied to the
+// config or leaves it invalid
+var ErrPatchRejected = errors.New("patch rejected")
+
+// ErrPatchTestFailed is returned when a test operation of a JSON Patch finds
+// a different value than expected
+var ErrPatchTestFailed = errors.New("test failed")
+
+// PatchOperation is one RFC 6902 JSON Patch operation. Value is nil when the
+// operation has no value, and the JSON null literal when it is null.
+type PatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// ParsePatch decodes a JSON Patch document and checks that each operation
+// has the members its op needs
+func ParsePatch(data []byte) ([]PatchOperation, error) {
+	var ops []PatchOperation
+	if err := json.Unmarshal(data, &ops); err != nil {
+		return nil, fmt.Errorf("patch must be a JSON array of operations: %w", err)
+	}
+	if len(ops) == 0 {
+		return nil, fmt.Errorf("patch has no operations")
+	}
+
+	for i, op := range ops {
+		if _, err := parsePointer(op.Path); err != nil {
+			return nil, fmt.Errorf("operation %d: %w", i, err)
+		}
+		switch op.Op {
+		case "add", "replace", "test":
+			if op.Value == nil {
+				return nil, fmt.Errorf("operation %d: %s needs a value", i, op.Op)
+			}
+		case "remove":
+		case "move", "copy":
+			if _, err := parsePointer(op.From); err != nil {
+				return nil, fmt.Errorf("operation %d: from: %w", i, err)
+			}
+		default:
+			return nil, fmt.Errorf("operation %d: unknown op %q", i, op.Op)
+		}
+	}
+	return ops, nil
+}
+
+// PatchedConfig returns the config with a JSON Patch applied, without saving
+// it. The patch works on the raw JSON, so fields the generated types don't
+// know and the order of keys are kept. A patch that fails or doesn't leave a
+// config behind returns ErrPatchRejected.
+func (m *Manager) PatchedConfig(ops []PatchOperation) ([]byte, error) {
+	root, err := m.rawConfigObject()
+	if err != nil {
+		return nil, err
+	}
+	doc, err := root.MarshalJSON()
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal config: %w", err)
+	}
+
+	doc, err = ApplyPatch(doc, ops)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrPatchRejected, err)
+	}
+
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, doc, "", "  "); err != nil {
+		return nil, fmt.Errorf("failed to format config: %w", err)
+	}
+
+	var config Config
+	if err := json.Unmarshal(buf.Bytes(), &config); err != nil {
+		return nil, fmt.Errorf("%w: invalid config: %w", ErrPatchRejected, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// ApplyPatch applies JSON Patch operations to a JSON document in order. The
+// document is left as it was if any operation fails.
+func ApplyPatch(doc json.RawMessage, ops []PatchOperation) (json.RawMessage, error) {
+	for i, op := range ops {
+		patched, err := applyPatchOperation(doc, op)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d (%s %s): %w", i, op.Op, op.Path, err)
+		}
+		doc = patched
+	}
+	return doc, nil
+}
+
+// applyPatchOperation applies a single operation to doc
+func applyPatchOperation(doc json.RawMessage, op PatchOperation) (json.RawMessage, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add":
+		return addValue(doc, path, op.Value)
+	case "remove":
+		return removeValue(doc, path)
+	case "replace":
+		if len(path) == 0 {
+			return op.Value, nil
+		}
+		return updateContainer(doc, path, func(container json.RawMessage, token string) (json.RawMessage, error) {
+			if _, err := childValue(container, token); err != nil {
+				return nil, err
+			}
+			return setChild(container, token, op.Value)
+		})
+	case "move", "copy":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		value, err := getValue(doc, from)
+		if err != nil {
+			return nil, fmt.Errorf("from: %w", err)
+		}
+		if op.Op == "move" {
+			if op.From == op.Path {
+				return doc, nil
+			}
+			if strings.HasPrefix(op.Path, op.From+"/") {
+				return nil, fmt.Errorf("cannot move a value into one of its children")
+			}
+			if doc, err = removeValue(doc, from); err != nil {
+				return nil, err
+			}
+		}
+		return addValue(doc, path, value)
+	case "test":
+		value, err := getValue(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !jsonEqual(value, op.Value) {
+			return nil, ErrPatchTestFailed
+		}
+		return doc, nil
+	default:
+		return nil, fmt.Errorf("unknown op %q", op.Op)
+	}
+}
+
+// addValue adds value at path: a member of an object is set, while a value
+// is inserted into an array before the index, or appended for "-"
+func addValue(doc json.RawMessage, path []string, value json.RawMessage) (json.RawMessage, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	return updateContainer(doc, path, func(container json.RawMessage, token string) (json.RawMessage, error) {
+		if object, ok := parseRawObject(container); ok {
+			object.set(token, value)
+			return object.MarshalJSON()
+		}
+		items, ok := parseRawArray(container)
+		if !ok {
+			return nil, fmt.Errorf("cannot add %q to a value that is not an object or array", token)
+		}
+		index := len(items)
+		if token != "-" {
+			var err error
+			if index, err = arrayIndex(token, len(items)+1); err != nil {
+				return nil, err
+			}
+		}
+		items = append(items[:index], append([]json.RawMessage{value}, items[index:]...)...)
+		return json.Marshal(items)
+	})
+}
+
+// removeValue removes the value at path, which must exist
+func removeValue(doc json.RawMessage, path []string) (json.RawMessage, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("cannot remove the whole config")
+	}
+	return updateContainer(doc, path, func(container json.RawMessage, token string) (json.RawMessage, error) {
+		if object, ok := parseRawObject(container); ok {
+			if _, ok := object.values[token]; !ok {
+				return nil, fmt.Errorf("%q not found", token)
+			}
+			object.delete(token)
+			return object.MarshalJSON()
+		}
+		items, ok := parseRawArray(container)
+		if !ok {
+			return nil, fmt.Errorf("cannot remove %q from a value that is not an object or array", token)
+		}
+		index, err := arrayIndex(token, len(items))
+		if err != nil {
+			return nil, err
+		}
+		items = append(items[:index], items[index+1:]...)
+		return json.Marshal(items)
+	})
+}
+
+// updateContainer replaces the value holding the last token of path with
+// what edit returns for it, rebuilding every container above it
+func updateContainer(doc json.RawMessage, path []string, edit func(container json.RawMessage, token string) (json.RawMessage, error)) (json.RawMessage, error) {
+	if len(path) == 1 {
+		return edit(doc, path[0])
+	}
+	child, err := childValue(doc, path[0])
+	if err != nil {
+		return nil, err
+	}
+	child, err = updateContainer(child, path[1:], edit)
+	if err != nil {
+		return nil, err
+	}
+	return setChild(doc, path[0], child)
+}
+
+// getValue returns the value at path, which must exist
+func getValue(doc json.RawMessage, path []string) (json.RawMessage, error) {
+	for _, token := range path {
+		child, err := childValue(doc, token)
+		if err != nil {
+			return nil, err
+		}
+		doc = child
+	}
+	return doc, nil
+}
+
+// childValue returns the member or array item of container named by token
+func childValue(container json.RawMessage, token string) (json.RawMessage, error) {
+	if object, ok := parseRawObject(container); ok {
+		value, ok := object.values[token]
+		if !ok {
+			return nil, fmt.Errorf("%q not found", token)
+		}
+		return value, nil
+	}
+	items, ok := parseRawArray(container)
+	if !ok {
+		return nil, fmt.Errorf("cannot look up %q in a value that is not an object or array", token)
+	}
+	index, err := arrayIndex(token, len(items))
+	if err != nil {
+		return nil, err
+	}
+	return items[index], nil
+}
+
+// setChild replaces the existing member or array item of container named
+// by token
+func setChild(container json.RawMessage, token string, value json.RawMessage) (json.RawMessage, error) {
+	if object, ok := parseRawObject(container); ok {
+		object.set(token, value)
+		return object.MarshalJSON()
+	}
+	items, ok := parseRawArray(container)
+	if !ok {
+		return nil, fmt.Errorf("cannot set %q in a value that is not an object or array", token)
+	}
+	index, err := arrayIndex(token, len(items))
+	if err != nil {
+		return nil, err
+	}
+	items[index] = value
+	return json.Marshal(items)
+}
+
+// parseRawArray decodes a JSON array without decoding its items. It reports
+// false if data is not an array.
+func parseRawArray(data json.RawMessage) ([]json.RawMessage, bool) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 || trimmed[0] != '[' {
+		return nil, false
+	}
+	var items []json.RawMessage
+	if err := json.Unmarshal(trimmed, &items); err != nil {
+		return nil, false
+	}
+	return items, true
+}
+
+// arrayIndex parses an array index token, which must be below limit
+func arrayIndex(token string, limit int) (int, error) {
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("%q is not an array index", token)
+	}
+	if index >= limit {
+		return 0, fmt.Errorf("index %d is out of range", index)
+	}
+	return index, nil
+}
+
+// parsePointer splits an RFC 6901 JSON Pointer into its unescaped tokens.
+// The empty pointer refers to the whole document.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("path %q must be empty or start with /", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
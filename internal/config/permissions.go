@@ -0,0 +1,21 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+)
+
+// ErrInsufficientPermissions marks errors caused by the OS refusing access
+// to the config, its fragments, backups or state files, as when the config
+// lives in /etc/sing-box and the manager doesn't run as root
+var ErrInsufficientPermissions = errors.New("insufficient permissions")
+
+// checkPermission marks err with ErrInsufficientPermissions when it is a
+// permission error and returns any other error as is
+func checkPermission(err error) error {
+	if err == nil || !errors.Is(err, fs.ErrPermission) || errors.Is(err, ErrInsufficientPermissions) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrInsufficientPermissions, err)
+}
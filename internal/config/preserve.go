@@ -0,0 +1,184 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// MarshalConfig encodes config as indented JSON, keeping every field of the
+// config file on disk that the generated types don't know about. Without
+// this, options added in newer sing-box versions would be dropped on the
+// next save.
+func (m *Manager) MarshalConfig(config *Config) ([]byte, error) {
+	updated, err := json.Marshal(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal config: %w", err)
+	}
+
+	original, err := m.readRaw()
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	if len(bytes.TrimSpace(original)) > 0 {
+		updated = mergeUnknownFields(original, updated, reflect.TypeOf(config))
+	}
+
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, updated, "", "  "); err != nil {
+		return nil, fmt.Errorf("failed to format config: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// mergeUnknownFields returns updated with the fields of original that t has
+// no field for added back, recursing into nested option structs. Known fields
+// missing from updated were cleared and stay removed. Values that aren't
+// structs, such as the outbounds list, are already kept whole by the
+// generated types and are taken from updated as is.
+func mergeUnknownFields(original, updated json.RawMessage, t reflect.Type) json.RawMessage {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return updated
+	}
+
+	originalObject, ok := parseRawObject(original)
+	if !ok {
+		return updated
+	}
+	updatedObject, ok := parseRawObject(updated)
+	if !ok {
+		return updated
+	}
+
+	known := jsonFields(t)
+	merged := &rawObject{values: make(map[string]json.RawMessage)}
+	for _, key := range updatedObject.keys {
+		value := updatedObject.values[key]
+		if fieldType, ok := known[key]; ok {
+			if originalValue, ok := originalObject.values[key]; ok {
+				value = mergeUnknownFields(originalValue, value, fieldType)
+			}
+		}
+		merged.set(key, value)
+	}
+	for _, key := range originalObject.keys {
+		if _, ok := known[key]; ok {
+			continue
+		}
+		if _, ok := merged.values[key]; !ok {
+			merged.set(key, originalObject.values[key])
+		}
+	}
+
+	data, err := merged.MarshalJSON()
+	if err != nil {
+		return updated
+	}
+	return data
+}
+
+// jsonFields maps the JSON names of a struct's fields to their types,
+// including the fields of embedded structs
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if field.Anonymous && tag == "" && field.Type.Kind() == reflect.Struct {
+			for name, fieldType := range jsonFields(field.Type) {
+				fields[name] = fieldType
+			}
+			continue
+		}
+
+		name := strings.Split(tag, ",")[0]
+		if name == "-" || !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = field.Type
+	}
+	return fields
+}
+
+// rawObject is a JSON object that keeps the order of its keys
+type rawObject struct {
+	keys   []string
+	values map[string]json.RawMessage
+}
+
+func (o *rawObject) set(key string, value json.RawMessage) {
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+func (o *rawObject) delete(key string) {
+	if _, ok := o.values[key]; !ok {
+		return
+	}
+	delete(o.values, key)
+	for i, k := range o.keys {
+		if k == key {
+			o.keys = append(o.keys[:i], o.keys[i+1:]...)
+			break
+		}
+	}
+}
+
+// parseRawObject decodes a JSON object without decoding its values. It
+// reports false if data is not an object.
+func parseRawObject(data json.RawMessage) (*rawObject, bool) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return nil, false
+	}
+
+	object := &rawObject{values: make(map[string]json.RawMessage)}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, false
+		}
+		key, ok := token.(string)
+		if !ok {
+			return nil, false
+		}
+
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			return nil, false
+		}
+		object.set(key, value)
+	}
+	return object, true
+}
+
+// MarshalJSON encodes the object with its keys in order
+func (o *rawObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		encodedKey, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(encodedKey)
+		buf.WriteByte(':')
+		buf.Write(o.values[key])
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
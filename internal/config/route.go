@@ -0,0 +1,84 @@
+package config
+
+import (
+	"github.com/matinhimself/singbox-web-config/internal/types"
+)
+
+// RouteSettings are the top-level route fields that apply to every
+// connection, as opposed to the rules list
+type RouteSettings struct {
+	Final               string
+	AutoDetectInterface bool
+	DefaultMark         uint32
+	OverrideAndroidVPN  bool
+	// DefaultDomainResolver is the DNS server tag. sing-box also accepts an
+	// object with extra resolve options; only its server is edited here.
+	DefaultDomainResolver string
+}
+
+// GetRouteOptions returns the route settings of the current config
+func (m *Manager) GetRouteOptions() (*RouteSettings, error) {
+	config, err := m.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	settings := &RouteSettings{}
+	if config.Route == nil {
+		return settings, nil
+	}
+
+	settings.Final = config.Route.Final
+	settings.AutoDetectInterface = config.Route.AutoDetectInterface
+	settings.DefaultMark = config.Route.DefaultMark
+	settings.OverrideAndroidVPN = config.Route.OverrideAndroidVPN
+	if config.Route.DefaultDomainResolver != nil {
+		switch resolver := (*config.Route.DefaultDomainResolver).(type) {
+		case string:
+			settings.DefaultDomainResolver = resolver
+		case map[string]interface{}:
+			settings.DefaultDomainResolver, _ = resolver["server"].(string)
+		}
+	}
+
+	return settings, nil
+}
+
+// UpdateRouteOptions saves the route settings, leaving the rules, rule sets
+// and every other route field untouched
+func (m *Manager) UpdateRouteOptions(settings RouteSettings) error {
+	config, err := m.LoadConfig()
+	if err != nil {
+		return err
+	}
+
+	if config.Route == nil {
+		config.Route = &types.RouteOptions{}
+	}
+
+	config.Route.Final = settings.Final
+	config.Route.AutoDetectInterface = settings.AutoDetectInterface
+	config.Route.DefaultMark = settings.DefaultMark
+	config.Route.OverrideAndroidVPN = settings.OverrideAndroidVPN
+	config.Route.DefaultDomainResolver = updateDomainResolver(config.Route.DefaultDomainResolver, settings.DefaultDomainResolver)
+
+	return m.SaveConfig(config)
+}
+
+// updateDomainResolver sets the server of a domain resolver, keeping the
+// other options of the object form
+func updateDomainResolver(current *interface{}, server string) *interface{} {
+	if server == "" {
+		return nil
+	}
+
+	if current != nil {
+		if resolver, ok := (*current).(map[string]interface{}); ok {
+			resolver["server"] = server
+			return current
+		}
+	}
+
+	var resolver interface{} = server
+	return &resolver
+}
@@ -0,0 +1,386 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ShadowWarning reports a route rule that can never match because an earlier
+// rule already matches everything it does. sing-box stops at the first
+// matching rule, so the later rule's action is never taken.
+type ShadowWarning struct {
+	Earlier int    `json:"earlier"` // index of the covering rule
+	Later   int    `json:"later"`   // index of the shadowed rule
+	Message string `json:"message"`
+}
+
+// shadowCategories groups the rule fields FindShadowedRules understands the
+// way sing-box combines them: fields of one category are alternatives,
+// categories must all match. A rule with a condition outside these is never
+// treated as covering another.
+var shadowCategories = map[string]string{
+	"domain":        "domain",
+	"domain_suffix": "domain",
+	"port":          "port",
+	"port_range":    "port",
+}
+
+// finalActions stop sing-box from evaluating later rules. An empty action
+// means route.
+var finalActions = map[string]bool{
+	"":           true,
+	"route":      true,
+	"reject":     true,
+	"hijack-dns": true,
+	"bypass":     true,
+}
+
+// FindShadowedRules reports route rules that an earlier rule shadows
+func (m *Manager) FindShadowedRules() ([]ShadowWarning, error) {
+	rules, err := m.GetRules()
+	if err != nil {
+		return nil, err
+	}
+	return ShadowedRules(rules), nil
+}
+
+// ShadowedRules reports each rule an earlier rule fully covers. It is a
+// heuristic that only reasons about domain, domain_suffix, port and
+// port_range, so it misses overlaps through other conditions but never
+// reports one that isn't real. Logical and inverted rules are skipped.
+func ShadowedRules(rules []interface{}) []ShadowWarning {
+	var warnings []ShadowWarning
+	for later := range rules {
+		laterRule, ok := shadowCandidate(rules[later])
+		if !ok {
+			continue
+		}
+		for earlier := 0; earlier < later; earlier++ {
+			earlierRule, ok := shadowCandidate(rules[earlier])
+			if !ok || !finalActions[stringField(earlierRule, "action")] {
+				continue
+			}
+			if reason, covered := coversRule(earlierRule, laterRule); covered {
+				warnings = append(warnings, ShadowWarning{
+					Earlier: earlier,
+					Later:   later,
+					Message: fmt.Sprintf("Rule #%d never matches: rule #%d comes first and %s, so it %s", later+1, earlier+1, reason, shadowOutcome(earlierRule, laterRule)),
+				})
+				break
+			}
+		}
+	}
+	return warnings
+}
+
+// shadowCandidate returns a rule as a map if it is a plain, non-inverted
+// rule FindShadowedRules can compare
+func shadowCandidate(rule interface{}) (map[string]interface{}, bool) {
+	ruleMap, ok := rule.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	if ruleType := stringField(ruleMap, "type"); ruleType != "" && ruleType != "default" {
+		return nil, false
+	}
+	if invert, _ := ruleMap["invert"].(bool); invert {
+		return nil, false
+	}
+	return ruleMap, true
+}
+
+// shadowOutcome describes what happens to traffic the later rule was meant
+// for
+func shadowOutcome(earlier, later map[string]interface{}) string {
+	earlierTarget, laterTarget := ruleTarget(earlier), ruleTarget(later)
+	if earlierTarget == laterTarget {
+		return "is redundant"
+	}
+	return fmt.Sprintf("sends its traffic to %s instead of %s", earlierTarget, laterTarget)
+}
+
+// ruleTarget names where a rule sends its matches
+func ruleTarget(rule map[string]interface{}) string {
+	action := stringField(rule, "action")
+	if action == "" || action == "route" {
+		return fmt.Sprintf("outbound %q", stringField(rule, "outbound"))
+	}
+	return fmt.Sprintf("the %s action", action)
+}
+
+// coversRule reports whether every connection later matches is matched by
+// earlier, with the reason. earlier must only use conditions in
+// shadowCategories and constrain at least one.
+func coversRule(earlier, later map[string]interface{}) (string, bool) {
+	categories := make(map[string]bool)
+	for field := range earlier {
+		if isRuleOption(field) {
+			continue
+		}
+		category, ok := shadowCategories[field]
+		if !ok {
+			return "", false
+		}
+		categories[category] = true
+	}
+	if len(categories) == 0 {
+		return "", false
+	}
+
+	var reasons []string
+	if categories["domain"] {
+		reason, ok := coversDomains(earlier, later)
+		if !ok {
+			return "", false
+		}
+		reasons = append(reasons, reason)
+	}
+	if categories["port"] {
+		reason, ok := coversPorts(earlier, later)
+		if !ok {
+			return "", false
+		}
+		reasons = append(reasons, reason)
+	}
+	return strings.Join(reasons, " and "), true
+}
+
+// isRuleOption reports whether a rule field is its action or an action
+// option rather than a condition
+func isRuleOption(field string) bool {
+	switch field {
+	case "type", "action", "outbound", "override_address", "override_port", "network_strategy",
+		"fallback_delay", "udp_disable_domain_unmapping", "udp_connect", "udp_timeout",
+		"tls_fragment", "tls_fragment_fallback_delay", "tls_record_fragment", "method", "no_drop":
+		return true
+	}
+	return false
+}
+
+// destinationMatchers are the destination conditions besides domain and
+// domain_suffix. sing-box treats all destination conditions of a rule as
+// alternatives, so a rule with any of them also matches connections no
+// domain condition covers, such as ones to a bare IP.
+var destinationMatchers = []string{
+	"domain_keyword", "domain_regex", "geosite", "rule_set",
+	"ip_cidr", "ip_is_private", "ip_accept_any", "geoip", "ip_set",
+}
+
+// coversDomains reports whether earlier's domain conditions match every
+// destination later's do. later must only match destinations through domain
+// and domain_suffix.
+func coversDomains(earlier, later map[string]interface{}) (string, bool) {
+	for _, field := range destinationMatchers {
+		if _, ok := later[field]; ok {
+			return "", false
+		}
+	}
+
+	laterDomains := stringList(later["domain"])
+	laterSuffixes := stringList(later["domain_suffix"])
+	if len(laterDomains) == 0 && len(laterSuffixes) == 0 {
+		return "", false
+	}
+
+	earlierDomains := stringList(earlier["domain"])
+	earlierSuffixes := stringList(earlier["domain_suffix"])
+
+	var example string
+	for _, domain := range laterDomains {
+		reason, ok := domainCovered(domain, earlierDomains, earlierSuffixes)
+		if !ok {
+			return "", false
+		}
+		if example == "" {
+			example = reason
+		}
+	}
+	for _, suffix := range laterSuffixes {
+		covering, ok := suffixCovered(suffix, earlierSuffixes)
+		if !ok {
+			return "", false
+		}
+		if example == "" {
+			example = fmt.Sprintf("its domain_suffix %s covers domain_suffix %s", covering, suffix)
+		}
+	}
+	return example, true
+}
+
+// domainCovered reports whether an exact domain matches one of domains or
+// suffixes
+func domainCovered(domain string, domains, suffixes []string) (string, bool) {
+	domain = normalizeDomain(domain)
+	for _, candidate := range domains {
+		if normalizeDomain(candidate) == domain {
+			return fmt.Sprintf("its domain list also has %s", domain), true
+		}
+	}
+	for _, suffix := range suffixes {
+		if suffixMatches(suffix, domain) {
+			return fmt.Sprintf("its domain_suffix %s covers domain %s", suffix, domain), true
+		}
+	}
+	return "", false
+}
+
+// suffixCovered returns the suffix of suffixes that matches every domain
+// suffix does
+func suffixCovered(suffix string, suffixes []string) (string, bool) {
+	// A suffix with a leading dot matches only subdomains; without one it
+	// also matches the name itself
+	name := normalizeDomain(strings.TrimPrefix(suffix, "."))
+	subdomainsOnly := strings.HasPrefix(suffix, ".")
+
+	for _, candidate := range suffixes {
+		candidateName := normalizeDomain(strings.TrimPrefix(candidate, "."))
+		if name == candidateName {
+			if subdomainsOnly || !strings.HasPrefix(candidate, ".") {
+				return candidate, true
+			}
+			continue
+		}
+		if strings.HasSuffix(name, "."+candidateName) {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+// suffixMatches reports whether domain_suffix suffix matches domain
+func suffixMatches(suffix, domain string) bool {
+	if strings.HasPrefix(suffix, ".") {
+		return strings.HasSuffix(domain, normalizeDomain(suffix))
+	}
+	suffix = normalizeDomain(suffix)
+	return domain == suffix || strings.HasSuffix(domain, "."+suffix)
+}
+
+// normalizeDomain lowercases a domain and drops a trailing dot
+func normalizeDomain(domain string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(domain), "."))
+}
+
+// portSpan is an inclusive range of ports
+type portSpan struct {
+	from, to int
+}
+
+// coversPorts reports whether earlier's ports and port ranges include every
+// port later matches. A later rule without port conditions matches any port,
+// so it is never covered.
+func coversPorts(earlier, later map[string]interface{}) (string, bool) {
+	laterSpans, ok := portSpans(later)
+	if !ok || len(laterSpans) == 0 {
+		return "", false
+	}
+	earlierSpans, ok := portSpans(earlier)
+	if !ok {
+		return "", false
+	}
+
+	for _, span := range laterSpans {
+		covered := false
+		for _, candidate := range earlierSpans {
+			if candidate.from <= span.from && span.to <= candidate.to {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return "", false
+		}
+	}
+
+	if len(laterSpans) == 1 && laterSpans[0].from == laterSpans[0].to {
+		return fmt.Sprintf("its ports include %d", laterSpans[0].from), true
+	}
+	return "its ports include all of the later rule's ports", true
+}
+
+// portSpans reads the port and port_range conditions of a rule. Values that
+// don't parse make it give up, leaving validation to report them.
+func portSpans(rule map[string]interface{}) ([]portSpan, bool) {
+	var spans []portSpan
+	for _, value := range listValues(rule["port"]) {
+		port, ok := portNumber(value)
+		if !ok {
+			return nil, false
+		}
+		spans = append(spans, portSpan{port, port})
+	}
+	for _, value := range stringList(rule["port_range"]) {
+		from, to, found := strings.Cut(value, ":")
+		if !found {
+			return nil, false
+		}
+		span := portSpan{0, 65535}
+		if from != "" {
+			port, err := strconv.Atoi(from)
+			if err != nil {
+				return nil, false
+			}
+			span.from = port
+		}
+		if to != "" {
+			port, err := strconv.Atoi(to)
+			if err != nil {
+				return nil, false
+			}
+			span.to = port
+		}
+		spans = append(spans, span)
+	}
+	return spans, true
+}
+
+// portNumber reads a port given as a JSON number or a string
+func portNumber(value interface{}) (int, bool) {
+	switch v := value.(type) {
+	case float64:
+		return int(v), v == float64(int(v))
+	case int:
+		return v, true
+	case string:
+		port, err := strconv.Atoi(v)
+		return port, err == nil
+	}
+	return 0, false
+}
+
+// listValues returns the items of a listable field, which sing-box also
+// accepts as a single value
+func listValues(value interface{}) []interface{} {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		return v
+	case []string:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = item
+		}
+		return items
+	default:
+		return []interface{}{v}
+	}
+}
+
+// stringList returns the string items of a listable field
+func stringList(value interface{}) []string {
+	var items []string
+	for _, item := range listValues(value) {
+		if s, ok := item.(string); ok {
+			items = append(items, s)
+		}
+	}
+	return items
+}
+
+// stringField returns a string field of a rule, or "" if it isn't one
+func stringField(rule map[string]interface{}, field string) string {
+	value, _ := rule[field].(string)
+	return value
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestShadowedRules(t *testing.T) {
+	tests := []struct {
+		name     string
+		rules    string
+		shadowed bool
+	}{
+		{
+			name:     "domain under an earlier suffix",
+			rules:    `[{"domain_suffix":"cn","outbound":"direct"},{"domain":"example.cn","outbound":"proxy"}]`,
+			shadowed: true,
+		},
+		{
+			name:     "narrower suffix",
+			rules:    `[{"domain_suffix":"example.com","outbound":"direct"},{"domain_suffix":".cdn.example.com","outbound":"proxy"}]`,
+			shadowed: true,
+		},
+		{
+			name:     "ports inside an earlier range",
+			rules:    `[{"port_range":"1000:2000","outbound":"direct"},{"port":[1080,1443],"outbound":"proxy"}]`,
+			shadowed: true,
+		},
+		{
+			name:     "domain outside the suffix",
+			rules:    `[{"domain_suffix":"cn","outbound":"direct"},{"domain":"example.com","outbound":"proxy"}]`,
+			shadowed: false,
+		},
+		{
+			name:     "later rule also matches ip_cidr",
+			rules:    `[{"domain_suffix":"cn","outbound":"direct"},{"domain":"example.cn","ip_cidr":"1.2.3.0/24","outbound":"proxy"}]`,
+			shadowed: false,
+		},
+		{
+			name:     "later rule also matches geoip",
+			rules:    `[{"domain_suffix":"cn","outbound":"direct"},{"domain":"example.cn","geoip":"cn","outbound":"proxy"}]`,
+			shadowed: false,
+		},
+		{
+			name:     "later rule also matches private IPs",
+			rules:    `[{"domain_suffix":"cn","outbound":"direct"},{"domain_suffix":"example.cn","ip_is_private":true,"outbound":"proxy"}]`,
+			shadowed: false,
+		},
+		{
+			name:     "later rule also matches an IP set",
+			rules:    `[{"domain_suffix":"cn","outbound":"direct"},{"domain":"example.cn","ip_set":"blocked","outbound":"proxy"}]`,
+			shadowed: false,
+		},
+		{
+			name:     "later rule also matches a regex",
+			rules:    `[{"domain_suffix":"cn","outbound":"direct"},{"domain":"example.cn","domain_regex":"^ads\\.","outbound":"proxy"}]`,
+			shadowed: false,
+		},
+		{
+			name:     "earlier rule doesn't stop evaluation",
+			rules:    `[{"domain_suffix":"cn","action":"sniff"},{"domain":"example.cn","outbound":"proxy"}]`,
+			shadowed: false,
+		},
+		{
+			name:     "inverted earlier rule",
+			rules:    `[{"domain_suffix":"cn","invert":true,"outbound":"direct"},{"domain":"example.cn","outbound":"proxy"}]`,
+			shadowed: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rules []interface{}
+			if err := json.Unmarshal([]byte(tt.rules), &rules); err != nil {
+				t.Fatal(err)
+			}
+			warnings := ShadowedRules(rules)
+			if shadowed := len(warnings) > 0; shadowed != tt.shadowed {
+				t.Errorf("ShadowedRules() = %+v, want shadowed %v", warnings, tt.shadowed)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// ConfigStore holds the raw config JSON a Manager reads and edits. Read
+// returns an error satisfying os.IsNotExist while there is no config yet.
+type ConfigStore interface {
+	Read() ([]byte, error)
+	Write(data []byte) error
+}
+
+// errNoState is returned for changes to backups and other state that a
+// Manager over a ConfigStore doesn't keep
+var errNoState = errors.New("no backups or other state are kept for this config")
+
+// fileStore keeps the config in a single file
+type fileStore struct {
+	path string
+}
+
+func (s *fileStore) Read() ([]byte, error) {
+	data, err := os.ReadFile(s.path)
+	return data, checkPermission(err)
+}
+
+func (s *fileStore) Write(data []byte) error {
+	return checkPermission(os.WriteFile(s.path, data, 0644))
+}
+
+// MemoryStore keeps the config in memory, for tests and for configs piped in
+// that must not be written back to disk. It is safe for concurrent use.
+type MemoryStore struct {
+	mu   sync.Mutex
+	data []byte
+}
+
+// NewMemoryStore returns a store holding data, or no config yet if data is
+// nil
+func NewMemoryStore(data []byte) *MemoryStore {
+	s := &MemoryStore{}
+	if data != nil {
+		s.data = append([]byte{}, data...)
+	}
+	return s
+}
+
+// ReadStore returns a MemoryStore holding everything read from r, such as a
+// config piped to standard input
+func ReadStore(r io.Reader) (*MemoryStore, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	return NewMemoryStore(data), nil
+}
+
+func (s *MemoryStore) Read() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data == nil {
+		return nil, &os.PathError{Op: "read", Path: "memory", Err: os.ErrNotExist}
+	}
+	return append([]byte{}, s.data...), nil
+}
+
+func (s *MemoryStore) Write(data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data = append([]byte{}, data...)
+	return nil
+}
+
+// NewManagerWithStore creates a config manager over store instead of a file.
+// It keeps no state beside the config: there are no backups, outbounds
+// can't be disabled and changes aren't logged.
+func NewManagerWithStore(store ConfigStore) *Manager {
+	return &Manager{store: store}
+}
+
+// readRaw returns the config as JSON. A missing config satisfies
+// os.IsNotExist.
+func (m *Manager) readRaw() ([]byte, error) {
+	return m.store.Read()
+}
+
+// writeRaw replaces the config with data
+func (m *Manager) writeRaw(data []byte) error {
+	return m.store.Write(data)
+}
@@ -32,15 +32,30 @@ type FormField struct {
 	ArrayType   string // For array fields
 	Options     []string
 	Description string
+	Group       string      // One of the Group constants, see groups.go
 	Value       interface{} // Single value for non-array fields
 	Values      []string    // Multiple values for array fields
 }
 
-// FormDefinition represents a complete form
+// FormDefinition represents a complete form. Fields are sorted by group and
+// Groups lists the groups present, in render order.
 type FormDefinition struct {
 	Name   string
 	Title  string
 	Fields []FormField
+	Groups []string
+}
+
+// ArrayKeys returns the JSON tags of the fields backed by a slice in the
+// generated types, which sing-box also accepts as a single value
+func (f *FormDefinition) ArrayKeys() []string {
+	var keys []string
+	for _, field := range f.Fields {
+		if field.IsArray {
+			keys = append(keys, field.JSONTag)
+		}
+	}
+	return keys
 }
 
 // Builder builds forms from struct types
@@ -51,38 +66,89 @@ func NewBuilder() *Builder {
 	return &Builder{}
 }
 
-// BuildForm generates a form definition from a rule type
+// BuildForm generates a form definition from a rule type, or any other
+// generated type, looked up by name in the generated type registry
 func (b *Builder) BuildForm(ruleTypeName string) (*FormDefinition, error) {
-	var value interface{}
-
-	// Map rule type names to their structs
-	switch ruleTypeName {
-	case "RawDefaultRule":
-		value = types.RawDefaultRule{}
-	case "RawLogicalRule":
-		value = types.RawLogicalRule{}
-	case "RawDefaultDNSRule":
-		value = types.RawDefaultDNSRule{}
-	case "RawLogicalDNSRule":
-		value = types.RawLogicalDNSRule{}
-	case "LocalRuleSet":
-		value = types.LocalRuleSet{}
-	case "RemoteRuleSet":
-		value = types.RemoteRuleSet{}
-	default:
+	newType, ok := types.Registry[ruleTypeName]
+	if !ok {
 		return nil, fmt.Errorf("unsupported rule type: %s", ruleTypeName)
 	}
 
-	t := reflect.TypeOf(value)
+	fields := b.buildFields(reflect.TypeOf(newType()).Elem())
+	groups := groupFields(fields)
+
+	return &FormDefinition{
+		Name:   ruleTypeName,
+		Title:  b.typeNameToTitle(ruleTypeName),
+		Fields: fields,
+		Groups: groups,
+	}, nil
+}
+
+// actionOptionTypes maps each rule action to the generated option structs
+// that hold its fields. The grouping mirrors sing-box's rule_action.go, where
+// the route action embeds the route-options fields.
+var actionOptionTypes = map[string][]interface{}{
+	"route":         {types.RouteActionOptions{}, types.RawRouteOptionsActionOptions{}},
+	"route-options": {types.RawRouteOptionsActionOptions{}},
+	"sniff":         {types.RouteActionSniff{}},
+	"resolve":       {types.RouteActionResolve{}},
+	"reject":        {types.RejectActionOptions{}},
+	"hijack-dns":    {},
+}
+
+// BuildActionForm generates a form definition for a rule action type
+func (b *Builder) BuildActionForm(actionType string) (*FormDefinition, error) {
+	optionTypes, ok := actionOptionTypes[actionType]
+	if !ok {
+		return nil, fmt.Errorf("unsupported action type: %s", actionType)
+	}
+
+	fields := []FormField{}
+	seen := make(map[string]bool)
+	for _, value := range optionTypes {
+		for _, field := range b.buildFields(reflect.TypeOf(value)) {
+			if seen[field.JSONTag] {
+				continue
+			}
+			seen[field.JSONTag] = true
+			// Every field of an action form configures the action
+			field.Group = GroupAction
+			fields = append(fields, field)
+		}
+	}
+
+	return &FormDefinition{
+		Name:   actionType,
+		Title:  b.actionTypeToTitle(actionType),
+		Fields: fields,
+		Groups: groupFields(fields),
+	}, nil
+}
+
+// buildFields generates form fields for every JSON-tagged field of a struct type
+func (b *Builder) buildFields(t reflect.Type) []FormField {
 	fields := []FormField{}
 
 	for i := 0; i < t.NumField(); i++ {
 		field := t.Field(i)
 		jsonTag := field.Tag.Get("json")
+
+		// Flatten embedded option structs into the parent form
+		if field.Anonymous && jsonTag == "" && field.Type.Kind() == reflect.Struct {
+			fields = append(fields, b.buildFields(field.Type)...)
+			continue
+		}
+
 		if jsonTag == "" || jsonTag == "-" {
 			continue
 		}
 
+		// Deprecated aliases are kept for parsing old configs, not for editing
+		if strings.HasPrefix(field.Name, "Deprecated_") {
+			continue
+		}
+
 		// Parse JSON tag
 		jsonName := strings.Split(jsonTag, ",")[0]
 
@@ -96,33 +162,42 @@ func (b *Builder) BuildForm(ruleTypeName string) (*FormDefinition, error) {
 		b.determineFieldType(&formField, field.Type)
 
 		// Add description for common fields
-		formField.Description = b.getFieldDescription(field.Name)
+		formField.Description = b.getFieldDescription(t.Name(), field.Name, jsonName)
 
 		fields = append(fields, formField)
 	}
 
-	return &FormDefinition{
-		Name:   ruleTypeName,
-		Title:  b.typeNameToTitle(ruleTypeName),
-		Fields: fields,
-	}, nil
+	return fields
 }
 
-// determineFieldType determines the appropriate form field type
+// determineFieldType determines the appropriate form field type. Duration
+// fields are generated as uint32 but sing-box reads them as strings such as
+// 1d, so they are edited as text.
 func (b *Builder) determineFieldType(formField *FormField, t reflect.Type) {
+	if placeholder, ok := types.DurationField(formField.JSONTag); ok {
+		formField.Type = FieldTypeText
+		formField.Placeholder = placeholder
+		return
+	}
+
 	kind := t.Kind()
 
 	switch kind {
 	case reflect.Slice, reflect.Array:
 		formField.IsArray = true
 		elemType := t.Elem()
+		// Listable pointer elements (e.g. []*string) are edited like their base type
+		if elemType.Kind() == reflect.Ptr {
+			elemType = elemType.Elem()
+		}
 		formField.ArrayType = elemType.Kind().String()
 
 		// Determine the element type
 		switch elemType.Kind() {
 		case reflect.String:
 			formField.Type = FieldTypeArray
-		case reflect.Uint16, reflect.Int, reflect.Int32:
+			formField.Options = b.getSelectOptions(formField.Name)
+		case reflect.Uint16, reflect.Uint32, reflect.Int, reflect.Int32:
 			formField.Type = FieldTypeArray
 			formField.Placeholder = "e.g., 80, 443, 8080"
 		default:
@@ -153,9 +228,10 @@ func (b *Builder) determineFieldType(formField *FormField, t reflect.Type) {
 	}
 }
 
-// isSelectField checks if a field should be a select dropdown
+// isSelectField checks if a field should be a select dropdown. The options
+// of DownloadDetour are the config's outbound tags, filled in by the caller.
 func (b *Builder) isSelectField(fieldName string) bool {
-	selectFields := []string{"Mode", "ClashMode", "Strategy", "DNSStrategy", "Action", "Method"}
+	selectFields := []string{"Mode", "ClashMode", "Strategy", "DNSStrategy", "DomainStrategy", "Action", "Method", "DownloadDetour"}
 	for _, sf := range selectFields {
 		if fieldName == sf {
 			return true
@@ -171,12 +247,16 @@ func (b *Builder) getSelectOptions(fieldName string) []string {
 		return []string{"and", "or"}
 	case "ClashMode":
 		return []string{"direct", "global", "rule"}
-	case "Strategy", "DNSStrategy":
+	case "Strategy", "DNSStrategy", "DomainStrategy":
 		return []string{"prefer_ipv4", "prefer_ipv6", "ipv4_only", "ipv6_only"}
 	case "Action":
 		return []string{"route", "sniff", "resolve", "reject", "route-options", "hijack-dns"}
 	case "Method":
 		return []string{"default", "drop"}
+	case "Network":
+		return []string{"tcp", "udp"}
+	case "NetworkType":
+		return []string{"wifi", "cellular", "ethernet", "other"}
 	default:
 		return []string{}
 	}
@@ -219,8 +299,30 @@ func (b *Builder) typeNameToTitle(name string) string {
 	return string(result)
 }
 
-// getFieldDescription returns a description for common fields
-func (b *Builder) getFieldDescription(fieldName string) string {
+// actionTypeToTitle converts an action type such as "route-options" to a title
+func (b *Builder) actionTypeToTitle(actionType string) string {
+	words := strings.Split(actionType, "-")
+	for i, word := range words {
+		if word == "dns" {
+			words[i] = "DNS"
+		} else if word != "" {
+			words[i] = strings.ToUpper(word[:1]) + word[1:]
+		}
+	}
+	return strings.Join(words, " ") + " Action"
+}
+
+// getFieldDescription returns the doc comment captured from the sing-box
+// source, first for the field of this type and then for any field with the
+// same JSON tag, falling back to hand-written descriptions of common fields
+func (b *Builder) getFieldDescription(typeName, fieldName, jsonTag string) string {
+	if doc := types.FieldDoc(typeName, fieldName); doc != "" {
+		return doc
+	}
+	if description, ok := types.DescribeField(jsonTag); ok {
+		return description.Doc
+	}
+
 	descriptions := map[string]string{
 		// Action fields
 		"Action":   "Action type: 'route' (route to outbound), 'sniff' (protocol sniffing), 'resolve' (DNS resolution), 'reject' (block traffic), 'route-options' (advanced routing), 'hijack-dns' (DNS hijacking)",
@@ -255,36 +357,47 @@ func (b *Builder) getFieldDescription(fieldName string) string {
 		"TLSRecordFragment":         "Enable TLS record fragmentation",
 
 		// Rule matching fields
-		"Domain":            "Exact domain names to match (e.g., google.com)",
-		"DomainSuffix":      "Domain suffixes to match (e.g., .google.com matches google.com and all subdomains)",
-		"DomainKeyword":     "Keywords that must appear in the domain",
-		"DomainRegex":       "Regular expressions for domain matching",
-		"Geosite":           "Geosite categories (e.g., cn, google, facebook)",
-		"GeoIP":             "Country codes for destination IP (e.g., CN, US)",
-		"SourceGeoIP":       "Country codes for source IP",
-		"IPCIDR":            "IP CIDR ranges for destination (e.g., 192.168.0.0/16)",
-		"SourceIPCIDR":      "IP CIDR ranges for source",
-		"Port":              "Destination ports to match (e.g., 80, 443)",
-		"SourcePort":        "Source ports to match",
-		"PortRange":         "Destination port ranges (e.g., 1000:2000)",
-		"SourcePortRange":   "Source port ranges",
-		"Protocol":          "Network protocols (e.g., tcp, udp)",
-		"Network":           "Network types (e.g., tcp, udp)",
-		"Inbound":           "Inbound tags to match",
-		"ProcessName":       "Process names to match",
-		"ProcessPath":       "Process paths to match",
-		"User":              "User names to match",
-		"RuleSet":           "Rule set references",
-		"Mode":              "Logical mode: 'and' (all rules must match) or 'or' (any rule must match)",
-		"Invert":            "Invert the rule match result",
-		"IPIsPrivate":       "Match private IP addresses",
-		"SourceIPIsPrivate": "Match private source IP addresses",
+		"Domain":               "Exact domain names to match (e.g., google.com)",
+		"DomainSuffix":         "Domain suffixes to match (e.g., .google.com matches google.com and all subdomains)",
+		"DomainKeyword":        "Keywords that must appear in the domain",
+		"DomainRegex":          "Regular expressions for domain matching",
+		"Geosite":              "Geosite categories (e.g., cn, google, facebook)",
+		"GeoIP":                "Country codes for destination IP (e.g., CN, US)",
+		"SourceGeoIP":          "Country codes for source IP",
+		"IPCIDR":               "IP CIDR ranges for destination (e.g., 192.168.0.0/16)",
+		"SourceIPCIDR":         "IP CIDR ranges for source",
+		"Port":                 "Destination ports to match (e.g., 80, 443)",
+		"SourcePort":           "Source ports to match",
+		"PortRange":            "Destination port ranges (e.g., 1000:2000)",
+		"SourcePortRange":      "Source port ranges",
+		"Protocol":             "Network protocols (e.g., tcp, udp)",
+		"Network":              "Network types (e.g., tcp, udp)",
+		"Inbound":              "Inbound tags to match",
+		"ProcessName":          "Process names to match",
+		"ProcessPath":          "Process paths to match",
+		"ProcessPathRegex":     "Regular expressions for process path matching",
+		"PackageName":          "Android package names to match",
+		"UserID":               "User IDs to match",
+		"QueryType":            "DNS query types to match (e.g., A, AAAA, HTTPS)",
+		"NetworkType":          "Network interface types to match: wifi, cellular, ethernet, other",
+		"NetworkIsExpensive":   "Match if the network is considered expensive (e.g., cellular or metered Wi-Fi)",
+		"NetworkIsConstrained": "Match if the network is in Low Data Mode (Apple platforms only)",
+		"WIFISSID":             "Wi-Fi SSIDs to match",
+		"WIFIBSSID":            "Wi-Fi BSSIDs to match",
+		"User":                 "User names to match",
+		"RuleSet":              "Rule set references",
+		"Mode":                 "Logical mode: 'and' (all rules must match) or 'or' (any rule must match)",
+		"Invert":               "Invert the rule match result",
+		"IPIsPrivate":          "Match private IP addresses",
+		"SourceIPIsPrivate":    "Match private source IP addresses",
+
+		// Rule set fields. sing-box only reads source and binary rule sets,
+		// so there is no adguard format to choose.
+		"Path": "Path of a local rule set in source (.json) or binary (.srs) format. Convert AdGuard filter lists with `sing-box rule-set convert --type adguard` first.",
+		"URL":  "URL of a remote rule set in source (.json) or binary (.srs) format. Convert AdGuard filter lists with `sing-box rule-set convert --type adguard` first.",
 	}
 
-	if desc, ok := descriptions[fieldName]; ok {
-		return desc
-	}
-	return ""
+	return descriptions[fieldName]
 }
 
 // GetAvailableRuleTypes returns all rule types that can have forms
@@ -299,6 +412,34 @@ func (b *Builder) GetAvailableRuleTypes() []string {
 	}
 }
 
+// GetRouteRuleTypes returns the rule types that belong in route.rules
+func (b *Builder) GetRouteRuleTypes() []string {
+	return []string{
+		"RawDefaultRule",
+		"RawLogicalRule",
+	}
+}
+
+// GetDNSRuleTypes returns the rule types that belong in dns.rules
+func (b *Builder) GetDNSRuleTypes() []string {
+	return []string{
+		"RawDefaultDNSRule",
+		"RawLogicalDNSRule",
+	}
+}
+
+// GetAvailableActionTypes returns all rule action types that can have forms
+func (b *Builder) GetAvailableActionTypes() []string {
+	return []string{
+		"route",
+		"route-options",
+		"sniff",
+		"resolve",
+		"reject",
+		"hijack-dns",
+	}
+}
+
 // PopulateFormValues populates form fields with values from a rule
 func (b *Builder) PopulateFormValues(formDef *FormDefinition, ruleData map[string]interface{}) {
 	for i := range formDef.Fields {
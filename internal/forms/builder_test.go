@@ -0,0 +1,69 @@
+package forms
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuildFormNewerMatchers(t *testing.T) {
+	for _, ruleType := range []string{"RawDefaultRule", "RawDefaultDNSRule", "DefaultHeadlessRule"} {
+		t.Run(ruleType, func(t *testing.T) {
+			form, err := NewBuilder().BuildForm(ruleType)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			fields := make(map[string]FormField)
+			for _, field := range form.Fields {
+				fields[field.JSONTag] = field
+			}
+
+			for _, tag := range []string{"process_path_regex", "network_type", "wifi_ssid", "wifi_bssid"} {
+				field, ok := fields[tag]
+				if !ok {
+					t.Errorf("form has no %s field", tag)
+					continue
+				}
+				if !field.IsArray || field.Type != FieldTypeArray {
+					t.Errorf("%s is %s (array %v), want an array field", tag, field.Type, field.IsArray)
+				}
+				if field.Description == "" {
+					t.Errorf("%s has no description", tag)
+				}
+			}
+
+			if field := fields["network_is_expensive"]; field.Type != FieldTypeCheckbox {
+				t.Errorf("network_is_expensive is %q, want a checkbox", field.Type)
+			}
+		})
+	}
+}
+
+func TestBuildFormRuleSetDescribesAdGuard(t *testing.T) {
+	tests := []struct {
+		ruleType string
+		tag      string
+	}{
+		{ruleType: "LocalRuleSet", tag: "path"},
+		{ruleType: "RemoteRuleSet", tag: "url"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ruleType, func(t *testing.T) {
+			form, err := NewBuilder().BuildForm(tt.ruleType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, field := range form.Fields {
+				if field.JSONTag != tt.tag {
+					continue
+				}
+				if !strings.Contains(field.Description, "rule-set convert --type adguard") {
+					t.Errorf("%s description = %q, want it to say how to use AdGuard filter lists", tt.tag, field.Description)
+				}
+				return
+			}
+			t.Errorf("form has no %s field", tt.tag)
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package forms
+
+import "sort"
+
+// Field groups, in the order forms render them: what a rule matches first,
+// then modifiers of the match, and what happens on a match last
+const (
+	GroupMatchers = "Matchers"
+	GroupAdvanced = "Advanced"
+	GroupAction   = "Action"
+)
+
+var groupOrder = []string{GroupMatchers, GroupAdvanced, GroupAction}
+
+// fieldGroups assigns rule fields to groups by JSON tag. Fields not listed
+// are matchers.
+var fieldGroups = map[string]string{
+	// Action and its per-action options
+	"action":                       GroupAction,
+	"outbound":                     GroupAction,
+	"sniffer":                      GroupAction,
+	"timeout":                      GroupAction,
+	"server":                       GroupAction,
+	"strategy":                     GroupAction,
+	"disable_cache":                GroupAction,
+	"rewrite_ttl":                  GroupAction,
+	"client_subnet":                GroupAction,
+	"method":                       GroupAction,
+	"no_drop":                      GroupAction,
+	"override_address":             GroupAction,
+	"override_port":                GroupAction,
+	"network_strategy":             GroupAction,
+	"fallback_delay":               GroupAction,
+	"udp_disable_domain_unmapping": GroupAction,
+	"udp_connect":                  GroupAction,
+	"udp_timeout":                  GroupAction,
+	"tls_fragment":                 GroupAction,
+	"tls_fragment_fallback_delay":  GroupAction,
+	"tls_record_fragment":          GroupAction,
+
+	// Options that change how the matchers behave
+	"invert":                        GroupAdvanced,
+	"ip_accept_any":                 GroupAdvanced,
+	"rule_set_ip_cidr_match_source": GroupAdvanced,
+	"rule_set_ip_cidr_accept_empty": GroupAdvanced,
+}
+
+// fieldGroup returns the group of a field. DNS rules match on a list of
+// outbounds, so an array "outbound" is a matcher rather than the route target.
+func fieldGroup(field FormField) string {
+	if field.JSONTag == "outbound" && field.IsArray {
+		return GroupMatchers
+	}
+	if group, ok := fieldGroups[field.JSONTag]; ok {
+		return group
+	}
+	return GroupMatchers
+}
+
+// GroupOf returns the group of a rule field given its JSON tag
+func GroupOf(jsonTag string) string {
+	return fieldGroup(FormField{JSONTag: jsonTag})
+}
+
+// groupFields sets each field's group and stably sorts the fields into
+// groupOrder. It returns the groups that have at least one field.
+func groupFields(fields []FormField) []string {
+	rank := make(map[string]int, len(groupOrder))
+	for i, group := range groupOrder {
+		rank[group] = i
+	}
+
+	present := make(map[string]bool)
+	for i := range fields {
+		if fields[i].Group == "" {
+			fields[i].Group = fieldGroup(fields[i])
+		}
+		present[fields[i].Group] = true
+	}
+
+	sort.SliceStable(fields, func(i, j int) bool {
+		return rank[fields[i].Group] < rank[fields[j].Group]
+	})
+
+	var groups []string
+	for _, group := range groupOrder {
+		if present[group] {
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
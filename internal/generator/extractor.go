@@ -3,6 +3,7 @@ package generator
 import (
 	"fmt"
 	"go/ast"
+	"sort"
 	"strings"
 )
 
@@ -15,6 +16,16 @@ type RuleType struct {
 	IsInterface bool
 }
 
+// HasFieldDocs reports whether any field of the type has a doc comment
+func (t *RuleType) HasFieldDocs() bool {
+	for _, f := range t.Fields {
+		if f.Doc != "" {
+			return true
+		}
+	}
+	return false
+}
+
 // Field represents a struct field
 type Field struct {
 	Name     string
@@ -40,8 +51,15 @@ func NewTypeExtractor(files map[string]*ast.File) *TypeExtractor {
 func (e *TypeExtractor) ExtractRuleTypes() ([]*RuleType, error) {
 	var ruleTypes []*RuleType
 
-	for fileName, file := range e.files {
-		types := e.extractTypesFromFile(fileName, file)
+	// Walk files in name order so generated output is stable between runs
+	fileNames := make([]string, 0, len(e.files))
+	for fileName := range e.files {
+		fileNames = append(fileNames, fileName)
+	}
+	sort.Strings(fileNames)
+
+	for _, fileName := range fileNames {
+		types := e.extractTypesFromFile(fileName, e.files[fileName])
 		ruleTypes = append(ruleTypes, types...)
 	}
 
@@ -49,7 +67,6 @@ func (e *TypeExtractor) ExtractRuleTypes() ([]*RuleType, error) {
 		return nil, fmt.Errorf("no types found")
 	}
 
-	fmt.Printf("Extracted %d types\n", len(ruleTypes))
 	return ruleTypes, nil
 }
 
@@ -143,6 +160,11 @@ func (e *TypeExtractor) extractFields(structType *ast.StructType) []*Field {
 				Doc:  extractDoc(field.Doc),
 			}
 
+			// Fall back to a trailing line comment when there is no leading doc
+			if f.Doc == "" {
+				f.Doc = extractDoc(field.Comment)
+			}
+
 			// Extract JSON tag
 			if field.Tag != nil {
 				tag := field.Tag.Value
@@ -307,6 +329,13 @@ func (e *TypeExtractor) simplifyType(typeStr string) string {
 		return "interface{}"
 	}
 
+	// Types from other packages that have no mapping would not compile in the
+	// generated package, so keep the field (and its slice/pointer shape) as interface{}
+	if strings.Contains(typeStr, ".") {
+		prefix := typeStr[:len(typeStr)-len(strings.TrimLeft(typeStr, "[]*"))]
+		return prefix + "interface{}"
+	}
+
 	return typeStr
 }
 
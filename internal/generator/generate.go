@@ -0,0 +1,532 @@
+package generator
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go/ast"
+	goparser "go/parser"
+	"go/token"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Category is a group of sing-box option files generated into one file
+type Category struct {
+	Name       string
+	FileFilter func(string) bool
+	OutputFile string
+}
+
+// DefaultCategories are the categories generated when none are requested
+var DefaultCategories = []Category{
+	{
+		Name:       "Main",
+		FileFilter: FileFilterByNames("options.go"),
+		OutputFile: "config.go",
+	},
+	{
+		Name:       "Rules",
+		FileFilter: FileFilterByPrefix("rule"),
+		OutputFile: "rules.go",
+	},
+	{
+		Name:       "DNS",
+		FileFilter: FileFilterByNames("dns.go"),
+		OutputFile: "dns.go",
+	},
+	{
+		Name:       "Inbounds",
+		FileFilter: FileFilterByPrefix("inbound"),
+		OutputFile: "inbounds.go",
+	},
+	{
+		Name:       "Outbounds",
+		FileFilter: FileFilterByPrefix("outbound"),
+		OutputFile: "outbounds.go",
+	},
+	{
+		Name:       "Route",
+		FileFilter: FileFilterByNames("route.go", "route_action.go"),
+		OutputFile: "route.go",
+	},
+	{
+		Name:       "NTP",
+		FileFilter: FileFilterByNames("ntp.go"),
+		OutputFile: "ntp.go",
+	},
+	{
+		Name:       "Experimental",
+		FileFilter: FileFilterByNames("experimental.go"),
+		OutputFile: "experimental.go",
+	},
+}
+
+// ParseCategories selects categories from a comma-separated list of names,
+// case-insensitively. "all", or a list matching nothing, selects all of them.
+// An item of the form name=pattern selects the files matching a glob, or a
+// regular expression written as /pattern/: for a default category it
+// replaces the file filter, otherwise it adds a category generated into the
+// lowercased name plus ".go".
+func ParseCategories(input string) ([]Category, error) {
+	if input == "all" {
+		return DefaultCategories, nil
+	}
+
+	var result []Category
+	for _, item := range strings.Split(input, ",") {
+		item = strings.TrimSpace(item)
+		if name, pattern, ok := strings.Cut(item, "="); ok {
+			category, err := customCategory(strings.TrimSpace(name), strings.TrimSpace(pattern))
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, category)
+			continue
+		}
+
+		for _, cat := range DefaultCategories {
+			if strings.EqualFold(cat.Name, item) {
+				result = append(result, cat)
+				break
+			}
+		}
+	}
+
+	if len(result) == 0 {
+		return DefaultCategories, nil
+	}
+
+	return result, nil
+}
+
+// categoryNamePattern is what a category defined on the command line may be
+// called, since its name also names its output file
+var categoryNamePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]*$`)
+
+// sharedOutputFiles are generated from every category, so no category may
+// be generated into one of them
+var sharedOutputFiles = map[string]bool{
+	"descriptions.go": true,
+	"validators.go":   true,
+	"metadata.go":     true,
+	"registry.go":     true,
+}
+
+// customCategory builds the category of a name=pattern item
+func customCategory(name, pattern string) (Category, error) {
+	if !categoryNamePattern.MatchString(name) {
+		return Category{}, fmt.Errorf("invalid category name %q: use letters and digits", name)
+	}
+
+	var filter func(string) bool
+	var err error
+	if len(pattern) > 1 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		filter, err = FileFilterByRegex(pattern[1 : len(pattern)-1])
+	} else {
+		filter, err = FileFilterByGlob(pattern)
+	}
+	if err != nil {
+		return Category{}, fmt.Errorf("category %s: %w", name, err)
+	}
+
+	for _, cat := range DefaultCategories {
+		if strings.EqualFold(cat.Name, name) {
+			cat.FileFilter = filter
+			return cat, nil
+		}
+	}
+
+	outputFile := strings.ToLower(name) + ".go"
+	if sharedOutputFiles[outputFile] {
+		return Category{}, fmt.Errorf("category %s would overwrite %s", name, outputFile)
+	}
+	for _, cat := range DefaultCategories {
+		if cat.OutputFile == outputFile {
+			return Category{}, fmt.Errorf("category %s would overwrite %s, which the %s category generates", name, outputFile, cat.Name)
+		}
+	}
+	return Category{Name: name, FileFilter: filter, OutputFile: outputFile}, nil
+}
+
+// GenerateOptions configures a generation run. Zero values fall back to the
+// same defaults as the generator's command-line flags.
+type GenerateOptions struct {
+	RepoURL    string
+	Branch     string
+	Commit     string // pin to a sing-box commit
+	Tag        string // pin to a sing-box tag, exclusive with Commit
+	LocalPath  string // use this repository instead of the cached clone
+	SkipUpdate bool
+	Offline    bool // use the cached repository without any network access
+	MaxAge     time.Duration
+	OutputDir  string
+	Categories []Category // DefaultCategories if empty
+	Force      bool       // regenerate categories whose source is unchanged
+	DryRun     bool       // report the files that would be written without writing them
+	Log        io.Writer  // progress and warnings, discarded if nil
+}
+
+// GenerateResult summarizes a generation run
+type GenerateResult struct {
+	Commit      string // sing-box commit the types were generated from
+	OutputDir   string // absolute output directory
+	Categories  int    // categories requested
+	Regenerated int    // categories whose files were rewritten
+	Types       int    // types generated in this run
+	Files       int    // source files parsed in this run
+	Warnings    []string
+	Failed      []string     // categories that produced no types because of parse errors
+	Changes     []FileChange // files a dry run would have written
+
+	log io.Writer
+}
+
+// warn records a warning and writes it to the log
+func (r *GenerateResult) warn(format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	r.Warnings = append(r.Warnings, message)
+	fmt.Fprintf(r.log, "Warning: %s\n", message)
+}
+
+// Generate updates the sing-box repository and regenerates the requested
+// categories into the output directory, along with the descriptions,
+// validators and metadata that span them. Problems with single categories are
+// reported in the result; the error is set only when nothing could be
+// generated at all.
+func Generate(opts GenerateOptions) (GenerateResult, error) {
+	log := opts.Log
+	if log == nil {
+		log = io.Discard
+	}
+	result := GenerateResult{log: log}
+
+	if opts.Commit != "" && opts.Tag != "" {
+		return result, errors.New("commit and tag cannot be used together")
+	}
+	if opts.RepoURL == "" {
+		opts.RepoURL = DefaultRepoURL
+	}
+	if opts.Branch == "" {
+		opts.Branch = DefaultBranch
+	}
+	if opts.MaxAge == 0 {
+		opts.MaxAge = DefaultMaxAge
+	}
+	if opts.OutputDir == "" {
+		opts.OutputDir = "internal/types"
+	}
+	if len(opts.Categories) == 0 {
+		opts.Categories = DefaultCategories
+	}
+	result.Categories = len(opts.Categories)
+
+	// Setup repository manager
+	repoManager := NewRepositoryManager().
+		WithRepoURL(opts.RepoURL).
+		WithBranch(opts.Branch).
+		WithCommit(opts.Commit).
+		WithTag(opts.Tag).
+		WithOffline(opts.Offline).
+		WithMaxAge(opts.MaxAge).
+		WithLog(log)
+
+	if opts.LocalPath != "" {
+		repoManager.WithLocalPath(opts.LocalPath)
+		fmt.Fprintf(log, "Using local repository: %s\n", opts.LocalPath)
+	} else {
+		fmt.Fprintf(log, "Repository: %s\n", opts.RepoURL)
+		fmt.Fprintf(log, "Branch: %s\n", opts.Branch)
+	}
+	if opts.Commit != "" {
+		fmt.Fprintf(log, "Pinned commit: %s\n", opts.Commit)
+	} else if opts.Tag != "" {
+		fmt.Fprintf(log, "Pinned tag: %s\n", opts.Tag)
+	}
+
+	// Update repository; offline mode still runs Update to verify the cache exists
+	if !opts.SkipUpdate || opts.Offline {
+		if err := repoManager.Update(); err != nil {
+			return result, fmt.Errorf("failed to update repository: %w", err)
+		}
+	}
+
+	// Get repository info
+	commit, err := repoManager.GetCommitHash()
+	if err != nil {
+		result.warn("failed to get commit hash: %v", err)
+		commit = "unknown"
+	}
+	result.Commit = commit
+
+	fmt.Fprintf(log, "Commit: %s\n", commit)
+	fmt.Fprintln(log)
+
+	optionPath := repoManager.GetRulePath()
+	if _, err := os.Stat(optionPath); os.IsNotExist(err) {
+		return result, fmt.Errorf("option directory not found at %s, please ensure the sing-box repository is cloned correctly", optionPath)
+	}
+
+	// Generate code
+	absOutputDir, err := filepath.Abs(opts.OutputDir)
+	if err != nil {
+		return result, fmt.Errorf("failed to resolve output directory: %w", err)
+	}
+	result.OutputDir = absOutputDir
+
+	codeGen := NewCodeGenerator(absOutputDir)
+	codeGen.DryRun = opts.DryRun
+	codeGen.Log = log
+	codeGen.Metadata.SingBoxCommit = commit
+	codeGen.Metadata.SingBoxBranch = opts.Branch
+	if opts.Tag != "" {
+		// Source links in the generated files point at the tag rather than the branch
+		codeGen.Metadata.SingBoxBranch = opts.Tag
+	}
+
+	// Load hashes from the previous run so unchanged categories can be skipped
+	previous, err := LoadMetadata(absOutputDir)
+	if err != nil {
+		previous = nil
+	} else if previous.GeneratorVersion == codeGen.Metadata.GeneratorVersion {
+		for name, hash := range previous.CategoryHashes {
+			codeGen.Metadata.CategoryHashes[name] = hash
+		}
+		for name, count := range previous.CategoryTypes {
+			codeGen.Metadata.CategoryTypes[name] = count
+		}
+	}
+
+	// Types declared by hand next to the generated files must not be
+	// generated again
+	handWritten, err := handWrittenTypes(absOutputDir)
+	if err != nil {
+		result.warn("failed to read hand-written types: %v", err)
+	}
+
+	// Process each category
+	for _, category := range opts.Categories {
+		fmt.Fprintf(log, "\n=== Processing %s ===\n", category.Name)
+		fmt.Fprintf(log, "Parsing files from: %s\n", optionPath)
+
+		parser := NewParser(optionPath).WithFileFilter(category.FileFilter).WithLog(log)
+
+		// List the matched files, so a file renamed upstream shows up as
+		// a category matching nothing
+		matched, err := parser.MatchedFiles()
+		if err != nil {
+			result.warn("failed to list files for %s: %v", category.Name, err)
+			continue
+		}
+		if len(matched) == 0 {
+			result.warn("no files match the %s category; its source files may have been renamed upstream", category.Name)
+			continue
+		}
+		fmt.Fprintf(log, "Matched files: %s\n", strings.Join(matched, ", "))
+
+		hash, err := parser.HashFiles()
+		if err != nil {
+			result.warn("failed to hash files for %s: %v", category.Name, err)
+			continue
+		}
+		hash = categoryHash(hash)
+
+		if !opts.Force && codeGen.Metadata.CategoryHashes[category.Name] == hash && fileExists(filepath.Join(absOutputDir, category.OutputFile)) {
+			fmt.Fprintf(log, "Source unchanged for %s, skipping (use --force to regenerate)\n", category.Name)
+			continue
+		}
+
+		files, err := parser.ParseDirectory()
+		var parseErrs ParseErrors
+		if errors.As(err, &parseErrs) {
+			result.warn("%s: %v", category.Name, parseErrs)
+		} else if err != nil {
+			result.warn("failed to parse files for %s: %v", category.Name, err)
+			continue
+		}
+
+		if len(files) == 0 {
+			if len(parseErrs) > 0 {
+				result.Failed = append(result.Failed, category.Name)
+			}
+			fmt.Fprintf(log, "No files found for %s, skipping...\n", category.Name)
+			continue
+		}
+
+		// Extract types
+		types, err := NewTypeExtractor(files).ExtractRuleTypes()
+		if err != nil || len(types) == 0 {
+			if len(parseErrs) > 0 {
+				result.Failed = append(result.Failed, category.Name)
+			}
+			result.warn("no types extracted for %s: %v", category.Name, err)
+			continue
+		}
+
+		// Print extracted types
+		fmt.Fprintf(log, "\nExtracted types for %s:\n", category.Name)
+		for _, t := range types {
+			if t.IsInterface {
+				fmt.Fprintf(log, "  - %s (interface)\n", t.Name)
+			} else {
+				fmt.Fprintf(log, "  - %s (%d fields)\n", t.Name, len(t.Fields))
+			}
+		}
+
+		// Generate to specific file
+		if err := codeGen.GenerateToFile(withoutTypes(types, handWritten), category.OutputFile); err != nil {
+			result.warn("failed to generate code for %s: %v", category.Name, err)
+			continue
+		}
+
+		codeGen.Metadata.CategoryHashes[category.Name] = hash
+		codeGen.Metadata.CategoryTypes[category.Name] = len(types)
+
+		result.Types += len(types)
+		result.Files += len(files)
+		result.Regenerated++
+	}
+
+	// descriptions.go, validators.go and registry.go cover every category,
+	// so they are rebuilt from all of them
+	missingShared := false
+	for name := range sharedOutputFiles {
+		if name != "metadata.go" && !fileExists(filepath.Join(absOutputDir, name)) {
+			missingShared = true
+		}
+	}
+	if result.Regenerated > 0 || missingShared {
+		types := allTypes(optionPath, opts.Categories)
+		if err := codeGen.GenerateDescriptions(types); err != nil {
+			result.warn("failed to generate field descriptions: %v", err)
+		}
+		if err := codeGen.GenerateValidators(types); err != nil {
+			result.warn("failed to generate validators: %v", err)
+		}
+		if err := codeGen.GenerateRegistry(types); err != nil {
+			result.warn("failed to generate the type registry: %v", err)
+		}
+	}
+
+	// Generate metadata, leaving it untouched when nothing changed so runs without changes produce no diff
+	if result.Regenerated > 0 || previous == nil {
+		codeGen.Metadata.TypesGenerated = 0
+		for _, count := range codeGen.Metadata.CategoryTypes {
+			codeGen.Metadata.TypesGenerated += count
+		}
+		codeGen.Metadata.FilesProcessed = result.Files
+		if err := codeGen.GenerateMetadata(); err != nil {
+			result.warn("failed to generate metadata: %v", err)
+		}
+	} else {
+		fmt.Fprintln(log, "\nAll requested categories are up to date")
+	}
+
+	result.Changes = codeGen.Changes
+	return result, nil
+}
+
+// allTypes extracts the types of every default category and of the
+// requested ones, whose file filters take precedence. Categories that fail
+// to parse are left out; Generate already reports them.
+func allTypes(optionPath string, requested []Category) []*RuleType {
+	categories := make([]Category, 0, len(DefaultCategories)+len(requested))
+	for _, category := range DefaultCategories {
+		for _, req := range requested {
+			if req.Name == category.Name {
+				category = req
+				break
+			}
+		}
+		categories = append(categories, category)
+	}
+	for _, req := range requested {
+		if !isDefaultCategory(req.Name) {
+			categories = append(categories, req)
+		}
+	}
+
+	var result []*RuleType
+	for _, category := range categories {
+		parser := NewParser(optionPath).WithFileFilter(category.FileFilter)
+		files, _ := parser.ParseDirectory()
+		if len(files) == 0 {
+			continue
+		}
+		types, err := NewTypeExtractor(files).ExtractRuleTypes()
+		if err != nil {
+			continue
+		}
+		result = append(result, types...)
+	}
+	return result
+}
+
+// categoryHash combines the hash of a category's source files with that of
+// the templates, so either changing regenerates the category
+func categoryHash(sourceHash string) string {
+	sum := sha256.Sum256([]byte(sourceHash + "\x00" + templatesHash))
+	return hex.EncodeToString(sum[:])
+}
+
+// handWrittenTypes returns the names of the types declared in the files of
+// dir that weren't generated. A missing directory has none.
+func handWrittenTypes(dir string) (map[string]bool, error) {
+	names := make(map[string]bool)
+	paths, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return names, err
+	}
+	for _, path := range paths {
+		if strings.HasSuffix(path, "_test.go") {
+			continue
+		}
+		file, err := goparser.ParseFile(token.NewFileSet(), path, nil, goparser.ParseComments)
+		if err != nil {
+			return names, err
+		}
+		if ast.IsGenerated(file) {
+			continue
+		}
+		for _, decl := range file.Decls {
+			if genDecl, ok := decl.(*ast.GenDecl); ok && genDecl.Tok == token.TYPE {
+				for _, spec := range genDecl.Specs {
+					names[spec.(*ast.TypeSpec).Name.Name] = true
+				}
+			}
+		}
+	}
+	return names, nil
+}
+
+// withoutTypes returns types without those named in skip
+func withoutTypes(types []*RuleType, skip map[string]bool) []*RuleType {
+	var result []*RuleType
+	for _, t := range types {
+		if !skip[t.Name] {
+			result = append(result, t)
+		}
+	}
+	return result
+}
+
+// isDefaultCategory reports whether name is one of DefaultCategories
+func isDefaultCategory(name string) bool {
+	for _, category := range DefaultCategories {
+		if category.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// fileExists reports whether a file exists at path
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -2,10 +2,19 @@ package generator
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"go/ast"
 	"go/format"
+	"go/parser"
+	"go/token"
+	"io"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"text/template"
 	"time"
@@ -19,33 +28,74 @@ type GenerationMetadata struct {
 	GeneratorVersion string
 	FilesProcessed   int
 	TypesGenerated   int
+	CategoryHashes   map[string]string // Source hash per category, used to skip unchanged categories
+	CategoryTypes    map[string]int    // Types generated per category
 }
 
+// GeneratorVersion is recorded in metadata.go. Bump it whenever a change to
+// the generator changes its output, so the next run regenerates every
+// category instead of keeping files written by the old version.
+const GeneratorVersion = "0.2.0"
+
+// templatesHash hashes every template, so changing one changes the hash of
+// each category and regenerates it even if the version wasn't bumped
+var templatesHash = func() string {
+	h := sha256.New()
+	for _, tmpl := range []string{typesTemplate, descriptionsTemplate, validatorsTemplate, metadataTemplate, registryTemplate} {
+		fmt.Fprintf(h, "%d\x00%s", len(tmpl), tmpl)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}()
+
 // CodeGenerator generates Go source code from extracted types
 type CodeGenerator struct {
 	OutputDir string
 	Metadata  *GenerationMetadata
+	// DryRun records the files that would be written in Changes instead of
+	// writing them
+	DryRun  bool
+	Changes []FileChange
+	// Log receives progress and formatting warnings, discarded by default
+	Log io.Writer
+}
+
+// FileChange is a file a dry run would have written, with the content
+// already on disk, which is nil for a new file
+type FileChange struct {
+	Path      string
+	Existing  []byte
+	Generated []byte
+}
+
+// Changed reports whether writing the file would change it. The lines that
+// record when a file was generated differ on every run, so they are ignored.
+func (c FileChange) Changed() bool {
+	if c.Existing == nil {
+		return true
+	}
+	return !bytes.Equal(generatedAtLine.ReplaceAll(c.Existing, nil), generatedAtLine.ReplaceAll(c.Generated, nil))
 }
 
+// generatedAtLine matches the generation time in file headers and metadata.go
+var generatedAtLine = regexp.MustCompile(`(?m)^(// Generated at: .*|\s*Timestamp:\s+time\.Unix\(.*)$`)
+
 // NewCodeGenerator creates a new code generator
 func NewCodeGenerator(outputDir string) *CodeGenerator {
 	return &CodeGenerator{
 		OutputDir: outputDir,
 		Metadata: &GenerationMetadata{
 			Timestamp:        time.Now(),
-			GeneratorVersion: "0.1.0",
+			GeneratorVersion: GeneratorVersion,
+			CategoryHashes:   make(map[string]string),
+			CategoryTypes:    make(map[string]int),
 		},
+		Log: io.Discard,
 	}
 }
 
 // Generate generates Go source files from rule types
 func (g *CodeGenerator) Generate(types []*RuleType) error {
-	// Create output directory
-	if err := os.MkdirAll(g.OutputDir, 0755); err != nil {
-		return fmt.Errorf("failed to create output directory: %w", err)
-	}
-
-	fmt.Printf("Generating types in %s...\n", g.OutputDir)
+	fmt.Fprintf(g.Log, "Generating types in %s...\n", g.OutputDir)
 
 	// Generate types file
 	if err := g.generateTypesFile(types); err != nil {
@@ -58,18 +108,13 @@ func (g *CodeGenerator) Generate(types []*RuleType) error {
 		return fmt.Errorf("failed to generate metadata: %w", err)
 	}
 
-	fmt.Printf("Successfully generated %d types\n", len(types))
+	fmt.Fprintf(g.Log, "Successfully generated %d types\n", len(types))
 	return nil
 }
 
 // GenerateToFile generates types to a specific file
 func (g *CodeGenerator) GenerateToFile(types []*RuleType, filename string) error {
-	// Create output directory
-	if err := os.MkdirAll(g.OutputDir, 0755); err != nil {
-		return fmt.Errorf("failed to create output directory: %w", err)
-	}
-
-	fmt.Printf("Generating %d types to %s...\n", len(types), filename)
+	fmt.Fprintf(g.Log, "Generating %d types to %s...\n", len(types), filename)
 
 	tmpl := template.Must(template.New("types").Funcs(template.FuncMap{
 		"typeNameToUI": typeNameToUI,
@@ -81,6 +126,7 @@ func (g *CodeGenerator) GenerateToFile(types []*RuleType, filename string) error
 		"Commit":    g.Metadata.SingBoxCommit,
 		"Branch":    g.Metadata.SingBoxBranch,
 		"Types":     types,
+		"HasDocs":   hasFieldDocs(types),
 	}
 
 	if err := tmpl.Execute(&buf, data); err != nil {
@@ -91,13 +137,12 @@ func (g *CodeGenerator) GenerateToFile(types []*RuleType, filename string) error
 	formatted, err := format.Source(buf.Bytes())
 	if err != nil {
 		// If formatting fails, save unformatted code for debugging
-		fmt.Printf("Warning: failed to format code: %v\n", err)
+		fmt.Fprintf(g.Log, "Warning: failed to format code: %v\n", err)
 		formatted = buf.Bytes()
 	}
 
 	// Write to file
-	outputPath := filepath.Join(g.OutputDir, filename)
-	if err := os.WriteFile(outputPath, formatted, 0644); err != nil {
+	if err := g.writeFile(filename, formatted); err != nil {
 		return fmt.Errorf("failed to write file: %w", err)
 	}
 
@@ -116,6 +161,7 @@ func (g *CodeGenerator) generateTypesFile(types []*RuleType) error {
 		"Commit":    g.Metadata.SingBoxCommit,
 		"Branch":    g.Metadata.SingBoxBranch,
 		"Types":     types,
+		"HasDocs":   hasFieldDocs(types),
 	}
 
 	if err := tmpl.Execute(&buf, data); err != nil {
@@ -126,19 +172,38 @@ func (g *CodeGenerator) generateTypesFile(types []*RuleType) error {
 	formatted, err := format.Source(buf.Bytes())
 	if err != nil {
 		// If formatting fails, save unformatted code for debugging
-		fmt.Printf("Warning: failed to format code: %v\n", err)
+		fmt.Fprintf(g.Log, "Warning: failed to format code: %v\n", err)
 		formatted = buf.Bytes()
 	}
 
 	// Write to file
-	outputPath := filepath.Join(g.OutputDir, "rules.go")
-	if err := os.WriteFile(outputPath, formatted, 0644); err != nil {
+	if err := g.writeFile("rules.go", formatted); err != nil {
 		return fmt.Errorf("failed to write file: %w", err)
 	}
 
 	return nil
 }
 
+// writeFile writes a generated file to the output directory, creating it if
+// needed, or records it in Changes on a dry run
+func (g *CodeGenerator) writeFile(filename string, data []byte) error {
+	outputPath := filepath.Join(g.OutputDir, filename)
+
+	if g.DryRun {
+		existing, err := os.ReadFile(outputPath)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		g.Changes = append(g.Changes, FileChange{Path: outputPath, Existing: existing, Generated: data})
+		return nil
+	}
+
+	if err := os.MkdirAll(g.OutputDir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	return os.WriteFile(outputPath, data, 0644)
+}
+
 // GenerateMetadata generates a metadata file
 func (g *CodeGenerator) GenerateMetadata() error {
 	tmpl := template.Must(template.New("metadata").Parse(metadataTemplate))
@@ -148,14 +213,345 @@ func (g *CodeGenerator) GenerateMetadata() error {
 		return fmt.Errorf("failed to execute template: %w", err)
 	}
 
-	outputPath := filepath.Join(g.OutputDir, "metadata.go")
-	if err := os.WriteFile(outputPath, buf.Bytes(), 0644); err != nil {
+	formatted, err := format.Source(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("failed to format metadata: %w", err)
+	}
+
+	if err := g.writeFile("metadata.go", formatted); err != nil {
 		return fmt.Errorf("failed to write metadata: %w", err)
 	}
 
 	return nil
 }
 
+// GenerateDescriptions generates descriptions.go, which maps each JSON tag to
+// the doc comment, Go type and requiredness of the field it belongs to. When
+// types share a tag, the first documented field in type name order wins.
+func (g *CodeGenerator) GenerateDescriptions(types []*RuleType) error {
+	sorted := make([]*RuleType, len(types))
+	copy(sorted, types)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+
+	descriptions := make(map[string]*Field)
+	for _, t := range sorted {
+		for _, f := range t.Fields {
+			if f.JSONTag == "" || f.Doc == "" {
+				continue
+			}
+			if _, ok := descriptions[f.JSONTag]; !ok {
+				descriptions[f.JSONTag] = f
+			}
+		}
+	}
+
+	tmpl := template.Must(template.New("descriptions").Parse(descriptionsTemplate))
+
+	var buf bytes.Buffer
+	data := map[string]interface{}{
+		"Commit":       g.Metadata.SingBoxCommit,
+		"Descriptions": descriptions,
+	}
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return fmt.Errorf("failed to execute template: %w", err)
+	}
+
+	formatted, err := format.Source(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("failed to format descriptions: %w", err)
+	}
+
+	if err := g.writeFile("descriptions.go", formatted); err != nil {
+		return fmt.Errorf("failed to write descriptions: %w", err)
+	}
+
+	return nil
+}
+
+// GenerateRegistry generates registry.go, which maps the name of every
+// generated struct type to a constructor, so callers can look a type up by
+// name. When types share a name, the first one in type name order wins.
+func (g *CodeGenerator) GenerateRegistry(types []*RuleType) error {
+	seen := make(map[string]bool)
+	var names []string
+	for _, t := range types {
+		if t.IsInterface || seen[t.Name] {
+			continue
+		}
+		seen[t.Name] = true
+		names = append(names, t.Name)
+	}
+	sort.Strings(names)
+
+	tmpl := template.Must(template.New("registry").Parse(registryTemplate))
+
+	var buf bytes.Buffer
+	data := map[string]interface{}{
+		"Commit": g.Metadata.SingBoxCommit,
+		"Names":  names,
+	}
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return fmt.Errorf("failed to execute template: %w", err)
+	}
+
+	formatted, err := format.Source(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("failed to format registry: %w", err)
+	}
+
+	if err := g.writeFile("registry.go", formatted); err != nil {
+		return fmt.Errorf("failed to write registry: %w", err)
+	}
+
+	return nil
+}
+
+// validatorType is a generated type whose Validate method checks fields
+type validatorType struct {
+	Name   string
+	Checks []validatorCheck
+}
+
+// validatorCheck is one line of a generated Validate method
+type validatorCheck struct {
+	Field    string // Go field name
+	Path     string // JSON tag, used as the error path
+	Required bool   // check the field is non-zero
+	Nested   bool   // validate the field's own type
+	List     bool   // the nested field is a slice, validated element by element
+}
+
+// outboundType maps an outbound type name to its generated type
+type outboundType struct {
+	Name     string
+	TypeName string
+}
+
+// GenerateValidators generates validators.go, which gives every type with
+// required fields, directly or in a nested option struct, a Validate method
+// reporting the fields left at their zero value. It also registers the
+// generated type of each outbound type so raw outbound maps can be checked.
+// When types share a name, the first one in type name order wins.
+func (g *CodeGenerator) GenerateValidators(types []*RuleType) error {
+	byName := make(map[string]*RuleType)
+	var names []string
+	for _, t := range types {
+		if t.IsInterface {
+			continue
+		}
+		if _, ok := byName[t.Name]; !ok {
+			byName[t.Name] = t
+			names = append(names, t.Name)
+		}
+	}
+	sort.Strings(names)
+
+	// A type needs a Validate method if it has a required field or a nested
+	// field whose type needs one, so repeat until nothing changes
+	validated := make(map[string]bool)
+	for changed := true; changed; {
+		changed = false
+		for _, name := range names {
+			if validated[name] {
+				continue
+			}
+			for _, f := range byName[name].Fields {
+				if isValidatedField(f) && (f.Required || validated[elementType(f.Type)]) {
+					validated[name] = true
+					changed = true
+					break
+				}
+			}
+		}
+	}
+
+	var validators []validatorType
+	var outbounds []outboundType
+	for _, name := range names {
+		t := byName[name]
+		if strings.HasSuffix(name, "Outbound") && hasJSONField(t, "type") {
+			outbounds = append(outbounds, outboundType{
+				Name:     strings.ToLower(strings.TrimSuffix(name, "Outbound")),
+				TypeName: name,
+			})
+		}
+		if !validated[name] {
+			continue
+		}
+
+		v := validatorType{Name: name}
+		for _, f := range t.Fields {
+			if !isValidatedField(f) {
+				continue
+			}
+			if f.Required {
+				v.Checks = append(v.Checks, validatorCheck{Field: f.Name, Path: f.JSONTag, Required: true})
+			}
+			if validated[elementType(f.Type)] && !strings.HasPrefix(f.Type, "map[") {
+				v.Checks = append(v.Checks, validatorCheck{
+					Field:  f.Name,
+					Path:   f.JSONTag,
+					Nested: true,
+					List:   strings.HasPrefix(f.Type, "[]"),
+				})
+			}
+		}
+		validators = append(validators, v)
+	}
+
+	tmpl := template.Must(template.New("validators").Parse(validatorsTemplate))
+
+	var buf bytes.Buffer
+	data := map[string]interface{}{
+		"Commit":     g.Metadata.SingBoxCommit,
+		"Validators": validators,
+		"Outbounds":  outbounds,
+	}
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return fmt.Errorf("failed to execute template: %w", err)
+	}
+
+	formatted, err := format.Source(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("failed to format validators: %w", err)
+	}
+
+	if err := g.writeFile("validators.go", formatted); err != nil {
+		return fmt.Errorf("failed to write validators: %w", err)
+	}
+
+	return nil
+}
+
+// isValidatedField reports whether a field appears in the config JSON and can
+// be checked
+func isValidatedField(f *Field) bool {
+	return f.JSONTag != "" && f.JSONTag != "-"
+}
+
+// elementType strips the slice and pointer prefixes from a type
+func elementType(typeStr string) string {
+	return strings.TrimLeft(typeStr, "[]*")
+}
+
+// hasJSONField reports whether a type has a field with the given JSON tag
+func hasJSONField(t *RuleType, jsonTag string) bool {
+	for _, f := range t.Fields {
+		if f.JSONTag == jsonTag {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadMetadata reads the metadata file previously generated in outputDir
+func LoadMetadata(outputDir string) (*GenerationMetadata, error) {
+	path := filepath.Join(outputDir, "metadata.go")
+	file, err := parser.ParseFile(token.NewFileSet(), path, nil, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse metadata: %w", err)
+	}
+
+	metadata := &GenerationMetadata{
+		CategoryHashes: make(map[string]string),
+		CategoryTypes:  make(map[string]int),
+	}
+
+	lit := findMetadataLiteral(file)
+	if lit == nil {
+		return nil, fmt.Errorf("metadata variable not found in %s", path)
+	}
+
+	for _, elt := range lit.Elts {
+		kv, ok := elt.(*ast.KeyValueExpr)
+		if !ok {
+			continue
+		}
+		key, ok := kv.Key.(*ast.Ident)
+		if !ok {
+			continue
+		}
+
+		switch key.Name {
+		case "SingBoxCommit":
+			metadata.SingBoxCommit = stringLiteral(kv.Value)
+		case "SingBoxBranch":
+			metadata.SingBoxBranch = stringLiteral(kv.Value)
+		case "GeneratorVersion":
+			metadata.GeneratorVersion = stringLiteral(kv.Value)
+		case "TypesGenerated":
+			metadata.TypesGenerated, _ = strconv.Atoi(basicLiteral(kv.Value))
+		case "CategoryHashes", "CategoryTypes":
+			entries, ok := kv.Value.(*ast.CompositeLit)
+			if !ok {
+				continue
+			}
+			for _, entry := range entries.Elts {
+				pair, ok := entry.(*ast.KeyValueExpr)
+				if !ok {
+					continue
+				}
+				name := stringLiteral(pair.Key)
+				if key.Name == "CategoryHashes" {
+					metadata.CategoryHashes[name] = stringLiteral(pair.Value)
+				} else {
+					metadata.CategoryTypes[name], _ = strconv.Atoi(basicLiteral(pair.Value))
+				}
+			}
+		}
+	}
+
+	return metadata, nil
+}
+
+// findMetadataLiteral finds the composite literal assigned to the Metadata variable
+func findMetadataLiteral(file *ast.File) *ast.CompositeLit {
+	for _, decl := range file.Decls {
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.VAR {
+			continue
+		}
+		for _, spec := range genDecl.Specs {
+			valueSpec, ok := spec.(*ast.ValueSpec)
+			if !ok || len(valueSpec.Names) != 1 || valueSpec.Names[0].Name != "Metadata" || len(valueSpec.Values) != 1 {
+				continue
+			}
+			if lit, ok := valueSpec.Values[0].(*ast.CompositeLit); ok {
+				return lit
+			}
+		}
+	}
+	return nil
+}
+
+// basicLiteral returns the raw value of a basic literal expression
+func basicLiteral(expr ast.Expr) string {
+	lit, ok := expr.(*ast.BasicLit)
+	if !ok {
+		return ""
+	}
+	return lit.Value
+}
+
+// stringLiteral returns the unquoted value of a string literal expression
+func stringLiteral(expr ast.Expr) string {
+	value, err := strconv.Unquote(basicLiteral(expr))
+	if err != nil {
+		return ""
+	}
+	return value
+}
+
+// hasFieldDocs reports whether any field of the given types carries a doc comment
+func hasFieldDocs(types []*RuleType) bool {
+	for _, t := range types {
+		if t.HasFieldDocs() {
+			return true
+		}
+	}
+	return false
+}
+
 // typeNameToUI converts a type name to a UI-friendly name
 func typeNameToUI(name string) string {
 	// Remove "Rule" suffix
@@ -190,6 +586,62 @@ type {{.Name}} struct {
 {{- end}}
 }
 {{end}}
+{{- if .HasDocs}}
+func init() {
+{{- range .Types}}{{if .HasFieldDocs}}
+	registerFieldDocs("{{.Name}}", map[string]string{
+{{- range .Fields}}{{if .Doc}}
+		"{{.Name}}": {{printf "%q" .Doc}},
+{{- end}}{{end}}
+	})
+{{- end}}{{end}}
+}
+{{end}}
+`
+
+const descriptionsTemplate = `// Code generated by singbox-web-config generator. DO NOT EDIT.
+// Commit: {{.Commit}}
+
+package types
+
+func init() {
+	registerFieldDescriptions(map[string]FieldDescription{
+{{- range $tag, $field := .Descriptions}}
+		{{printf "%q" $tag}}: {Doc: {{printf "%q" $field.Doc}}, Type: {{printf "%q" $field.Type}}, Required: {{$field.Required}}},
+{{- end}}
+	})
+}
+`
+
+const validatorsTemplate = `// Code generated by singbox-web-config generator. DO NOT EDIT.
+// Commit: {{.Commit}}
+
+package types
+{{range .Validators}}
+// Validate reports the required fields of {{.Name}} that are not set
+func (o {{.Name}}) Validate() error {
+	var errs ValidationErrors
+{{- range .Checks}}
+{{- if .Required}}
+	errs = errs.required({{printf "%q" .Path}}, o.{{.Field}})
+{{- else if .List}}
+	for i := range o.{{.Field}} {
+		errs = errs.nestedIndex({{printf "%q" .Path}}, i, o.{{.Field}}[i])
+	}
+{{- else}}
+	errs = errs.nested({{printf "%q" .Path}}, o.{{.Field}})
+{{- end}}
+{{- end}}
+	return errs.err()
+}
+{{end}}
+func init() {
+	registerOutboundTypes(map[string]func() interface{}{
+{{- range .Outbounds}}
+		{{printf "%q" .Name}}: func() interface{} { return &{{.TypeName}}{} },
+{{- end}}
+	})
+}
 `
 
 const metadataTemplate = `// Code generated by singbox-web-config generator. DO NOT EDIT.
@@ -205,11 +657,37 @@ var Metadata = struct {
 	SingBoxBranch    string
 	GeneratorVersion string
 	TypesGenerated   int
+	CategoryHashes   map[string]string
+	CategoryTypes    map[string]int
 }{
 	Timestamp:        time.Unix({{.Timestamp.Unix}}, 0),
 	SingBoxCommit:    "{{.SingBoxCommit}}",
 	SingBoxBranch:    "{{.SingBoxBranch}}",
 	GeneratorVersion: "{{.GeneratorVersion}}",
 	TypesGenerated:   {{.TypesGenerated}},
+	CategoryHashes: map[string]string{
+{{- range $name, $hash := .CategoryHashes}}
+		"{{$name}}": "{{$hash}}",
+{{- end}}
+	},
+	CategoryTypes: map[string]int{
+{{- range $name, $count := .CategoryTypes}}
+		"{{$name}}": {{$count}},
+{{- end}}
+	},
+}
+`
+
+const registryTemplate = `// Code generated by singbox-web-config generator. DO NOT EDIT.
+// Commit: {{.Commit}}
+
+package types
+
+// Registry maps the name of every generated struct type to a constructor
+// returning a pointer to its zero value
+var Registry = map[string]func() interface{}{
+{{- range .Names}}
+	{{printf "%q" .}}: func() interface{} { return &{{.}}{} },
+{{- end}}
 }
 `
@@ -1,12 +1,19 @@
 package generator
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"go/ast"
 	"go/parser"
+	"go/scanner"
 	"go/token"
+	"io"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
 )
 
@@ -14,6 +21,7 @@ import (
 type Parser struct {
 	SourceDir   string
 	FileFilter  func(string) bool // Optional filter function for file names
+	Log         io.Writer         // Progress output, discarded by default
 	fset        *token.FileSet
 }
 
@@ -21,13 +29,22 @@ type Parser struct {
 func NewParser(sourceDir string) *Parser {
 	return &Parser{
 		SourceDir: sourceDir,
+		Log:       io.Discard,
 		fset:      token.NewFileSet(),
 	}
 }
 
-// ParseDirectory parses all Go files in the directory
+// WithLog sets where progress is written
+func (p *Parser) WithLog(w io.Writer) *Parser {
+	p.Log = w
+	return p
+}
+
+// ParseDirectory parses all Go files in the directory. Files that fail to parse
+// are reported as ParseErrors together with whatever files parsed successfully.
 func (p *Parser) ParseDirectory() (map[string]*ast.File, error) {
 	files := make(map[string]*ast.File)
+	var parseErrs ParseErrors
 
 	entries, err := os.ReadDir(p.SourceDir)
 	if err != nil {
@@ -35,28 +52,14 @@ func (p *Parser) ParseDirectory() (map[string]*ast.File, error) {
 	}
 
 	for _, entry := range entries {
-		if entry.IsDir() {
-			continue
-		}
-
-		if !strings.HasSuffix(entry.Name(), ".go") {
-			continue
-		}
-
-		// Skip test files
-		if strings.HasSuffix(entry.Name(), "_test.go") {
-			continue
-		}
-
-		// Apply file filter if provided
-		if p.FileFilter != nil && !p.FileFilter(entry.Name()) {
+		if !p.matchFile(entry) {
 			continue
 		}
 
 		filePath := filepath.Join(p.SourceDir, entry.Name())
 		astFile, err := parser.ParseFile(p.fset, filePath, nil, parser.ParseComments)
 		if err != nil {
-			fmt.Printf("Warning: failed to parse %s: %v\n", entry.Name(), err)
+			parseErrs = append(parseErrs, newParseErrors(filePath, err)...)
 			continue
 		}
 
@@ -64,13 +67,123 @@ func (p *Parser) ParseDirectory() (map[string]*ast.File, error) {
 	}
 
 	if len(files) == 0 {
+		if len(parseErrs) > 0 {
+			return nil, parseErrs
+		}
 		return nil, fmt.Errorf("no Go files found in %s", p.SourceDir)
 	}
 
-	fmt.Printf("Successfully parsed %d Go files\n", len(files))
+	fmt.Fprintf(p.Log, "Successfully parsed %d Go files\n", len(files))
+	if len(parseErrs) > 0 {
+		return files, parseErrs
+	}
 	return files, nil
 }
 
+// ParseError describes a failure to parse a source file at a specific position
+type ParseError struct {
+	File   string
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (e *ParseError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("%s: %s", e.File, e.Msg)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", e.File, e.Line, e.Column, e.Msg)
+}
+
+// ParseErrors is the list of files that failed to parse. ParseDirectory returns
+// it alongside the files that did parse, so callers can decide whether to continue.
+type ParseErrors []*ParseError
+
+func (e ParseErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return fmt.Sprintf("failed to parse %d location(s):\n  %s", len(e), strings.Join(messages, "\n  "))
+}
+
+// newParseErrors converts an error from go/parser into positioned parse errors
+func newParseErrors(filePath string, err error) ParseErrors {
+	var list scanner.ErrorList
+	if errors.As(err, &list) {
+		result := make(ParseErrors, 0, len(list))
+		for _, e := range list {
+			result = append(result, &ParseError{
+				File:   e.Pos.Filename,
+				Line:   e.Pos.Line,
+				Column: e.Pos.Column,
+				Msg:    e.Msg,
+			})
+		}
+		return result
+	}
+
+	return ParseErrors{{File: filePath, Msg: err.Error()}}
+}
+
+// HashFiles returns a SHA-256 hash over the names and contents of the files
+// ParseDirectory would parse, so callers can detect unchanged sources
+func (p *Parser) HashFiles() (string, error) {
+	names, err := p.MatchedFiles()
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join(p.SourceDir, name))
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00", name, len(data))
+		h.Write(data)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// MatchedFiles returns the sorted names of the files ParseDirectory would
+// parse
+func (p *Parser) MatchedFiles() ([]string, error) {
+	entries, err := os.ReadDir(p.SourceDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory: %w", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if p.matchFile(entry) {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// matchFile reports whether a directory entry is a Go source file selected by the filter
+func (p *Parser) matchFile(entry os.DirEntry) bool {
+	if entry.IsDir() {
+		return false
+	}
+
+	if !strings.HasSuffix(entry.Name(), ".go") {
+		return false
+	}
+
+	// Skip test files
+	if strings.HasSuffix(entry.Name(), "_test.go") {
+		return false
+	}
+
+	// Apply file filter if provided
+	return p.FileFilter == nil || p.FileFilter(entry.Name())
+}
+
 // WithFileFilter sets a custom file filter
 func (p *Parser) WithFileFilter(filter func(string) bool) *Parser {
 	p.FileFilter = filter
@@ -99,3 +212,25 @@ func FileFilterByNames(names ...string) func(string) bool {
 		return nameSet[name]
 	}
 }
+
+// FileFilterByGlob creates a filter that matches file names against a glob
+// pattern, as in filepath.Match
+func FileFilterByGlob(pattern string) (func(string) bool, error) {
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid glob %q: %w", pattern, err)
+	}
+	return func(name string) bool {
+		matched, _ := filepath.Match(pattern, name)
+		return matched
+	}, nil
+}
+
+// FileFilterByRegex creates a filter that matches file names containing a
+// match of a regular expression
+func FileFilterByRegex(pattern string) (func(string) bool, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regex %q: %w", pattern, err)
+	}
+	return re.MatchString, nil
+}
@@ -2,9 +2,12 @@ package generator
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
+	"time"
 )
 
 const (
@@ -12,6 +15,10 @@ const (
 	DefaultBranch     = "dev-next"
 	DefaultLocalPath  = ".cache/sing-box"
 	DefaultRulePath   = "option"
+	DefaultMaxAge     = time.Hour
+
+	// updatedAtFile records when the cached checkout was last fetched, relative to its .git directory
+	updatedAtFile = "singbox-web-config-updated-at"
 )
 
 // RepositoryManager handles sing-box repository operations
@@ -19,6 +26,11 @@ type RepositoryManager struct {
 	RepoURL   string
 	Branch    string
 	LocalPath string
+	Commit    string        // Pin the checkout to this commit instead of the branch head
+	Tag       string        // Pin the checkout to this tag instead of the branch head
+	Offline   bool          // Never touch the network, use the cached checkout as is
+	MaxAge    time.Duration // Skip fetching when the checkout was updated more recently than this
+	Log       io.Writer     // Progress output, discarded by default
 }
 
 // NewRepositoryManager creates a new repository manager with defaults
@@ -27,9 +39,17 @@ func NewRepositoryManager() *RepositoryManager {
 		RepoURL:   DefaultRepoURL,
 		Branch:    DefaultBranch,
 		LocalPath: DefaultLocalPath,
+		MaxAge:    DefaultMaxAge,
+		Log:       io.Discard,
 	}
 }
 
+// WithLog sets where progress is written
+func (r *RepositoryManager) WithLog(w io.Writer) *RepositoryManager {
+	r.Log = w
+	return r
+}
+
 // WithRepoURL sets a custom repository URL
 func (r *RepositoryManager) WithRepoURL(url string) *RepositoryManager {
 	r.RepoURL = url
@@ -48,18 +68,97 @@ func (r *RepositoryManager) WithLocalPath(path string) *RepositoryManager {
 	return r
 }
 
+// WithCommit pins the repository to a specific commit
+func (r *RepositoryManager) WithCommit(hash string) *RepositoryManager {
+	r.Commit = hash
+	return r
+}
+
+// WithTag pins the repository to a specific tag
+func (r *RepositoryManager) WithTag(tag string) *RepositoryManager {
+	r.Tag = tag
+	return r
+}
+
+// WithOffline enables or disables offline mode
+func (r *RepositoryManager) WithOffline(offline bool) *RepositoryManager {
+	r.Offline = offline
+	return r
+}
+
+// WithMaxAge sets how long a fetched checkout is considered fresh
+func (r *RepositoryManager) WithMaxAge(maxAge time.Duration) *RepositoryManager {
+	r.MaxAge = maxAge
+	return r
+}
+
 // Update clones or updates the sing-box repository
 func (r *RepositoryManager) Update() error {
+	_, statErr := os.Stat(r.LocalPath)
+
+	if r.Offline {
+		if os.IsNotExist(statErr) {
+			return fmt.Errorf("offline mode: no cached repository at %s, run once without --offline to clone it", r.LocalPath)
+		}
+		fmt.Fprintf(r.Log, "Offline mode: using cached repository at %s\n", r.LocalPath)
+		if ref := r.pinnedRef(); ref != "" {
+			return r.checkoutRef(ref, false)
+		}
+		return nil
+	}
+
 	// Check if directory exists
-	if _, err := os.Stat(r.LocalPath); os.IsNotExist(err) {
+	if os.IsNotExist(statErr) {
 		// Clone repository
-		fmt.Printf("Cloning sing-box repository from %s...\n", r.RepoURL)
-		return r.clone()
+		fmt.Fprintf(r.Log, "Cloning sing-box repository from %s...\n", r.RepoURL)
+		if err := r.clone(); err != nil {
+			return err
+		}
+		if ref := r.pinnedRef(); ref != "" {
+			if err := r.checkoutRef(ref, true); err != nil {
+				return err
+			}
+		}
+		return r.markUpdated()
+	}
+
+	// A pinned ref never moves, so only fetch when it isn't checked out yet
+	if ref := r.pinnedRef(); ref != "" {
+		if r.isCheckedOut(ref) {
+			fmt.Fprintf(r.Log, "Cached repository is already at %s\n", ref)
+			return nil
+		}
+		if err := r.checkoutRef(ref, true); err != nil {
+			return err
+		}
+		return r.markUpdated()
+	}
+
+	branch, err := r.GetBranch()
+	if err != nil {
+		return err
+	}
+
+	if branch != r.Branch {
+		// A plain pull would merge the requested branch into the wrong one
+		fmt.Fprintf(r.Log, "Cached repository is on %s, switching to %s...\n", branch, r.Branch)
+		if err := r.checkoutBranch(); err != nil {
+			return err
+		}
+		return r.markUpdated()
+	}
+
+	if updatedAt, ok := r.lastUpdated(); ok && time.Since(updatedAt) < r.MaxAge {
+		fmt.Fprintf(r.Log, "Cached repository was updated %s ago, skipping fetch\n", time.Since(updatedAt).Round(time.Second))
+		return nil
 	}
 
 	// Update existing repository
-	fmt.Printf("Updating existing sing-box repository...\n")
-	return r.pull()
+	fmt.Fprintf(r.Log, "Updating existing sing-box repository...\n")
+	if err := r.pull(); err != nil {
+		return err
+	}
+	return r.markUpdated()
 }
 
 // clone clones the repository
@@ -79,7 +178,7 @@ func (r *RepositoryManager) clone() error {
 		return fmt.Errorf("failed to clone repository: %w", err)
 	}
 
-	fmt.Printf("Successfully cloned sing-box repository\n")
+	fmt.Fprintf(r.Log, "Successfully cloned sing-box repository\n")
 	return nil
 }
 
@@ -93,7 +192,110 @@ func (r *RepositoryManager) pull() error {
 		return fmt.Errorf("failed to pull repository: %w", err)
 	}
 
-	fmt.Printf("Successfully updated sing-box repository\n")
+	fmt.Fprintf(r.Log, "Successfully updated sing-box repository\n")
+	return nil
+}
+
+// checkoutBranch fetches the requested branch and checks it out, replacing the current one
+func (r *RepositoryManager) checkoutBranch() error {
+	refspec := fmt.Sprintf("+refs/heads/%s:refs/remotes/origin/%s", r.Branch, r.Branch)
+	fetch := exec.Command("git", "-C", r.LocalPath, "fetch", "--depth", "1", "origin", refspec)
+	fetch.Stdout = os.Stdout
+	fetch.Stderr = os.Stderr
+
+	if err := fetch.Run(); err != nil {
+		return fmt.Errorf("failed to fetch branch %s: %w", r.Branch, err)
+	}
+
+	checkout := exec.Command("git", "-C", r.LocalPath, "checkout", "-B", r.Branch, "origin/"+r.Branch)
+	checkout.Stdout = os.Stdout
+	checkout.Stderr = os.Stderr
+
+	if err := checkout.Run(); err != nil {
+		return fmt.Errorf("failed to checkout branch %s: %w", r.Branch, err)
+	}
+
+	fmt.Fprintf(r.Log, "Switched sing-box repository to %s\n", r.Branch)
+	return nil
+}
+
+// pinnedRef returns the fetch ref for the requested commit or tag, or "" when following the branch
+func (r *RepositoryManager) pinnedRef() string {
+	if r.Commit != "" {
+		return r.Commit
+	}
+	if r.Tag != "" {
+		return "refs/tags/" + r.Tag
+	}
+	return ""
+}
+
+// checkoutRef checks out a commit or tag as a detached HEAD, fetching it first if requested
+func (r *RepositoryManager) checkoutRef(ref string, fetch bool) error {
+	target := ref
+	if fetch {
+		cmd := exec.Command("git", "-C", r.LocalPath, "fetch", "--depth", "1", "origin", "+"+ref+":"+ref)
+		if r.Commit != "" {
+			// Commits can't be used as a destination ref
+			cmd = exec.Command("git", "-C", r.LocalPath, "fetch", "--depth", "1", "origin", ref)
+			target = "FETCH_HEAD"
+		}
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("failed to fetch %s: %w", ref, err)
+		}
+	}
+
+	cmd := exec.Command("git", "-C", r.LocalPath, "checkout", "--detach", target)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to checkout %s: %w", ref, err)
+	}
+
+	fmt.Fprintf(r.Log, "Checked out sing-box repository at %s\n", ref)
+	return nil
+}
+
+// isCheckedOut reports whether HEAD already points at the given commit or tag
+func (r *RepositoryManager) isCheckedOut(ref string) bool {
+	want, err := exec.Command("git", "-C", r.LocalPath, "rev-parse", "--verify", "--quiet", ref+"^{commit}").Output()
+	if err != nil {
+		return false
+	}
+
+	head, err := exec.Command("git", "-C", r.LocalPath, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return false
+	}
+
+	return strings.TrimSpace(string(want)) == strings.TrimSpace(string(head))
+}
+
+// lastUpdated returns when the checkout was last fetched, if recorded
+func (r *RepositoryManager) lastUpdated() (time.Time, bool) {
+	data, err := os.ReadFile(filepath.Join(r.LocalPath, ".git", updatedAtFile))
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	updatedAt, err := time.Parse(time.RFC3339, strings.TrimSpace(string(data)))
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return updatedAt, true
+}
+
+// markUpdated records the current time as the last fetch of the checkout
+func (r *RepositoryManager) markUpdated() error {
+	path := filepath.Join(r.LocalPath, ".git", updatedAtFile)
+	if err := os.WriteFile(path, []byte(time.Now().Format(time.RFC3339)+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to record update time: %w", err)
+	}
 	return nil
 }
 
@@ -121,5 +323,5 @@ func (r *RepositoryManager) GetBranch() (string, error) {
 		return "", fmt.Errorf("failed to get branch: %w", err)
 	}
 
-	return string(output), nil
+	return strings.TrimSpace(string(output)), nil
 }
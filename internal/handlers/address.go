@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// addressResolveTimeout bounds the optional DNS lookup of a server address
+const addressResolveTimeout = 3 * time.Second
+
+// validateServerAddress checks that a server address is an IP address or a
+// syntactically valid hostname. It does not look the name up.
+func validateServerAddress(address string) error {
+	if address == "" {
+		return fmt.Errorf("server address is empty")
+	}
+	if net.ParseIP(address) != nil {
+		return nil
+	}
+	if strings.ContainsAny(address, ":[]") {
+		return fmt.Errorf("invalid server address %q: use a plain IP address or hostname without a port", address)
+	}
+
+	name := strings.TrimSuffix(address, ".")
+	if len(name) > 253 {
+		return fmt.Errorf("invalid server address %q: hostname is longer than 253 characters", address)
+	}
+	for _, label := range strings.Split(name, ".") {
+		if err := validateHostnameLabel(label); err != nil {
+			return fmt.Errorf("invalid server address %q: %w", address, err)
+		}
+	}
+	return nil
+}
+
+// validateHostnameLabel checks one dot-separated part of a hostname.
+// Underscores are allowed since some service names use them.
+func validateHostnameLabel(label string) error {
+	if label == "" {
+		return fmt.Errorf("empty label")
+	}
+	if len(label) > 63 {
+		return fmt.Errorf("label %q is longer than 63 characters", label)
+	}
+	if label[0] == '-' || label[len(label)-1] == '-' {
+		return fmt.Errorf("label %q starts or ends with a hyphen", label)
+	}
+	for _, c := range label {
+		isAlnum := c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+		if !isAlnum && c != '-' && c != '_' {
+			return fmt.Errorf("label %q contains invalid character %q", label, c)
+		}
+	}
+	return nil
+}
+
+// resolveServerAddress looks up a hostname with a short timeout. IP
+// addresses need no lookup. A failure is only worth a warning: the server may
+// be reachable only through a detour or a different resolver.
+func resolveServerAddress(ctx context.Context, address string) error {
+	if net.ParseIP(address) != nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, addressResolveTimeout)
+	defer cancel()
+
+	if _, err := net.DefaultResolver.LookupHost(ctx, address); err != nil {
+		return fmt.Errorf("server %q does not resolve: %w", address, err)
+	}
+	return nil
+}
+
+// setWarningTrigger sends an HX-Trigger header that raises the given event
+// alongside a "validationWarning" event carrying the message
+func setWarningTrigger(w http.ResponseWriter, event, warning string) {
+	trigger, err := json.Marshal(map[string]interface{}{
+		event:               nil,
+		"validationWarning": warning,
+	})
+	if err != nil {
+		w.Header().Set("HX-Trigger", event)
+		return
+	}
+	w.Header().Set("HX-Trigger", string(trigger))
+}
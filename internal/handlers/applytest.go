@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/matinhimself/singbox-web-config/internal/clash"
+)
+
+// applyTestWait bounds how long apply-and-test waits for a reloaded
+// sing-box to list the outbound in the Clash API, and applyTestPoll is how
+// often it asks
+const (
+	applyTestWait = 10 * time.Second
+	applyTestPoll = 500 * time.Millisecond
+)
+
+// OutboundApplyTestResponse reports an apply-and-test of one outbound. The
+// delay test is skipped, with Tested false, when the Clash API isn't
+// configured.
+type OutboundApplyTestResponse struct {
+	Tag      string `json:"tag"`
+	Reloaded bool   `json:"reloaded"`
+	Tested   bool   `json:"tested"`
+	Delay    int    `json:"delay,omitempty"`
+	Error    string `json:"error,omitempty"`
+	Message  string `json:"message"`
+}
+
+// handleOutboundApplyTest applies saved changes that sing-box isn't running
+// yet, then delay-tests the outbound named by the tag parameter through the
+// Clash API, giving one-click confirmation that an edited outbound works
+func (s *Server) handleOutboundApplyTest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	tag := r.URL.Query().Get("tag")
+	if tag == "" {
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, "Tag is required")
+		return
+	}
+
+	tags, err := s.configManager.GetRouteTargetTags()
+	if err != nil {
+		requestLogger(r).Error("failed to get outbound tags", "error", err)
+		writeInternalError(w, err, "Failed to get outbounds")
+		return
+	}
+	if !contains(tags, tag) {
+		writeJSONError(w, http.StatusNotFound, ErrCodeNotFound, fmt.Sprintf("Outbound %q not found", tag))
+		return
+	}
+
+	// Check the rate limit before reloading, so a refused test changes nothing
+	client := s.clashAPIClient()
+	if client != nil && !s.allowDelayTests(w, []string{tag}) {
+		return
+	}
+
+	timeout := 5000
+	if t, err := strconv.Atoi(r.URL.Query().Get("timeout")); err == nil && t > 0 {
+		timeout = t
+	}
+
+	response := OutboundApplyTestResponse{Tag: tag}
+
+	drift, err := s.configDrift()
+	if err != nil {
+		requestLogger(r).Error("failed to check config drift", "error", err)
+		writeInternalError(w, err, "Failed to check for pending changes")
+		return
+	}
+	if drift.Drift || drift.PendingApply {
+		if err := s.serviceManager.Reload(r.Context()); err != nil {
+			requestLogger(r).Error("failed to apply changes", "error", err)
+			writeInternalError(w, err, fmt.Sprintf("Failed to apply changes: %v", err))
+			return
+		}
+		s.markConfigApplied(r)
+		response.Reloaded = true
+		w.Header().Set("HX-Trigger", "changesApplied")
+	}
+
+	switch {
+	case client == nil:
+		response.Message = "Clash API not configured, so the outbound was not tested"
+	case !waitForProxy(r.Context(), client, tag):
+		response.Error = fmt.Sprintf("sing-box did not list %q within %s", tag, applyTestWait)
+		response.Message = "Outbound not available for testing"
+	default:
+		result := s.testProxyDelay(r.Context(), tag, r.URL.Query().Get("url"), timeout)
+		s.recordProxyDelays(r, result)
+		response.Tested = true
+		response.Delay = result.Delay
+		response.Error = result.Error
+		if result.Error != "" {
+			response.Message = "Delay test failed"
+		} else {
+			response.Message = fmt.Sprintf("%s responded in %d ms", tag, result.Delay)
+		}
+	}
+	if response.Reloaded {
+		response.Message = "Changes applied. " + response.Message
+	}
+
+	requestLogger(r).Info("applied and tested outbound", "tag", tag, "reloaded", response.Reloaded, "tested", response.Tested, "delay", response.Delay, "error", response.Error)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// waitForProxy polls the Clash API until it lists the named proxy, which
+// takes a moment after a reload. It reports false if applyTestWait passes
+// first.
+func waitForProxy(ctx context.Context, client *clash.Client, name string) bool {
+	ctx, cancel := context.WithTimeout(ctx, applyTestWait)
+	defer cancel()
+
+	ticker := time.NewTicker(applyTestPoll)
+	defer ticker.Stop()
+
+	for {
+		// Errors are expected while sing-box restarts, so just try again
+		if proxies, err := client.GetProxies(ctx); err == nil {
+			if _, ok := proxies[name]; ok {
+				return true
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+	}
+}
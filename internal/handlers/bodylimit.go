@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Default request body limits. Endpoints under configBodyPrefix accept whole
+// sing-box configs and get the larger limit.
+const (
+	DefaultMaxBodyBytes       int64 = 4 << 20
+	DefaultMaxConfigBodyBytes int64 = 32 << 20
+
+	configBodyPrefix = "/api/config/"
+)
+
+// withBodyLimit caps the size of every request body. Requests that declare a
+// larger Content-Length are rejected up front; bodies without a length fail
+// when a handler reads past the limit, see writeBodyError.
+func (s *Server) withBodyLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit := s.maxBodyBytes
+		if strings.HasPrefix(r.URL.Path, configBodyPrefix) {
+			limit = s.maxConfigBodyBytes
+		}
+
+		if r.ContentLength > limit {
+			writeBodyTooLarge(w, limit)
+			return
+		}
+		if r.Body != nil && r.Body != http.NoBody {
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// SetMaxBodyBytes sets the request body limits for regular and config
+// endpoints. Values below 1 restore the defaults.
+func (s *Server) SetMaxBodyBytes(limit, configLimit int64) {
+	if limit < 1 {
+		limit = DefaultMaxBodyBytes
+	}
+	if configLimit < 1 {
+		configLimit = DefaultMaxConfigBodyBytes
+	}
+	s.maxBodyBytes = limit
+	s.maxConfigBodyBytes = configLimit
+}
+
+// writeBodyError reports a failure to read or decode the request body. A body
+// over the size limit gets a 413, anything else a 400 with message.
+func writeBodyError(w http.ResponseWriter, err error, message string) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		writeBodyTooLarge(w, maxBytesErr.Limit)
+		return
+	}
+	writeJSONError(w, http.StatusBadRequest, ErrCodeBadRequest, message)
+}
+
+// writeBodyTooLarge writes the 413 response for an oversized request body
+func writeBodyTooLarge(w http.ResponseWriter, limit int64) {
+	writeJSONError(w, http.StatusRequestEntityTooLarge, ErrCodeTooLarge,
+		fmt.Sprintf("Request body exceeds the %d byte limit", limit))
+}
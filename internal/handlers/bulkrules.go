@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// bulkDomainFields maps the match kinds of a bulk domain list to rule fields
+var bulkDomainFields = map[string]string{
+	"suffix":  "domain_suffix",
+	"keyword": "domain_keyword",
+	"exact":   "domain",
+}
+
+// BulkDomainsResponse describes the rule added from a bulk domain list
+type BulkDomainsResponse struct {
+	Index   int                    `json:"index"`
+	Domains int                    `json:"domains"`
+	Rule    map[string]interface{} `json:"rule"`
+}
+
+// handleRuleBulkDomains shows the bulk domain form on GET. On POST it turns
+// the newline-separated "domains" field into one rule routing them to
+// "outbound" and appends it. "kind" picks domain_suffix (the default),
+// domain_keyword or domain; a line can override it with a "suffix:",
+// "keyword:" or "exact:" prefix, and the rule then holds a list per kind,
+// which sing-box matches as alternatives.
+func (s *Server) handleRuleBulkDomains(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.handleRuleBulkDomainsForm(w, r)
+		return
+	case http.MethodPost:
+	default:
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		writeBodyError(w, err, "Failed to parse form")
+		return
+	}
+
+	kind := r.FormValue("kind")
+	if kind == "" {
+		kind = "suffix"
+	}
+	if _, ok := bulkDomainFields[kind]; !ok {
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, fmt.Sprintf("Unknown match kind %q (expected suffix, keyword or exact)", kind))
+		return
+	}
+
+	outbound := strings.TrimSpace(r.FormValue("outbound"))
+	if outbound == "" {
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, "Choose an outbound for the domains")
+		return
+	}
+	tags, err := s.configManager.GetRouteTargetTags()
+	if err != nil {
+		requestLogger(r).Error("failed to get outbound tags", "error", err)
+		writeInternalError(w, err, "Failed to get outbounds")
+		return
+	}
+	if !contains(tags, outbound) {
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, fmt.Sprintf("Outbound %q does not exist", outbound))
+		return
+	}
+
+	domains, err := parseDomainList(r.FormValue("domains"), kind)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, err.Error())
+		return
+	}
+	if len(domains) == 0 {
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, "No domains to add")
+		return
+	}
+
+	rule := make(map[string]interface{})
+	count := 0
+	for _, kind := range []string{"exact", "suffix", "keyword"} {
+		if len(domains[kind]) == 0 {
+			continue
+		}
+		items := make([]interface{}, len(domains[kind]))
+		for i, domain := range domains[kind] {
+			items[i] = domain
+		}
+		rule[bulkDomainFields[kind]] = items
+		count += len(items)
+	}
+	rule["outbound"] = outbound
+
+	rules, err := s.configManager.GetRules()
+	if err != nil {
+		requestLogger(r).Error("failed to get rules", "error", err)
+		writeInternalError(w, err, "Failed to get rules")
+		return
+	}
+	rules = append(rules, rule)
+
+	if err := s.configManager.UpdateRules(rules); err != nil {
+		requestLogger(r).Error("failed to update rules", "error", err)
+		writeInternalError(w, err, "Failed to save rules")
+		return
+	}
+
+	requestLogger(r).Info("added bulk domain rule", "domains", count, "outbound", outbound)
+
+	noteChange(r, "routed %d domains through %s", count, outbound)
+
+	// Reload service to apply changes
+	s.reloadService(r)
+
+	if r.Header.Get("HX-Request") != "true" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(BulkDomainsResponse{Index: len(rules) - 1, Domains: count, Rule: rule})
+		return
+	}
+
+	w.Header().Set("HX-Trigger", "ruleCreated")
+	s.handleRulesList(w, r)
+}
+
+// handleRuleBulkDomainsForm renders the bulk domain form with the outbounds
+// the rule can route to
+func (s *Server) handleRuleBulkDomainsForm(w http.ResponseWriter, r *http.Request) {
+	tags, err := s.configManager.GetRouteTargetTags()
+	if err != nil {
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to get outbounds", err)
+		return
+	}
+
+	data := map[string]interface{}{
+		"Tags": tags,
+	}
+
+	if err := s.renderTemplate(w, "rule-bulk-form.html", data); err != nil {
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to render the page", err)
+	}
+}
+
+// parseDomainList reads one domain per line, grouped by match kind. Blank
+// lines and # comments are skipped, URLs are reduced to their host and
+// duplicates are dropped; "*." is stripped from suffixes, which match
+// subdomains anyway. Lines with a "suffix:", "keyword:" or "exact:" prefix
+// use that kind instead of defaultKind.
+func parseDomainList(text, defaultKind string) (map[string][]string, error) {
+	domains := make(map[string][]string)
+	seen := make(map[string]bool)
+
+	for i, line := range strings.Split(text, "\n") {
+		if comment := strings.Index(line, "#"); comment >= 0 {
+			line = line[:comment]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		kind := defaultKind
+		if prefix, rest, ok := strings.Cut(line, ":"); ok {
+			if _, known := bulkDomainFields[prefix]; known {
+				kind, line = prefix, strings.TrimSpace(rest)
+			}
+		}
+
+		if strings.Contains(line, "://") {
+			u, err := url.Parse(line)
+			if err != nil || u.Hostname() == "" {
+				return nil, fmt.Errorf("line %d: %q is not a valid URL", i+1, line)
+			}
+			line = u.Hostname()
+		}
+		line = strings.ToLower(strings.TrimSuffix(line, "."))
+		if kind == "suffix" {
+			line = strings.TrimPrefix(line, "*.")
+		}
+
+		if line == "" || strings.ContainsAny(line, " \t/") {
+			return nil, fmt.Errorf("line %d: %q is not a domain", i+1, line)
+		}
+		if kind != "keyword" && strings.Contains(line, "*") {
+			return nil, fmt.Errorf("line %d: %q has a wildcard, which only a leading *. of a suffix may use", i+1, line)
+		}
+
+		if seen[kind+":"+line] {
+			continue
+		}
+		seen[kind+":"+line] = true
+		domains[kind] = append(domains[kind], line)
+	}
+
+	return domains, nil
+}
@@ -0,0 +1,267 @@
+package handlers
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/matinhimself/singbox-web-config/internal/clash"
+	"github.com/matinhimself/singbox-web-config/internal/config"
+	"github.com/matinhimself/singbox-web-config/internal/service"
+)
+
+// bundleClashFile names the saved Clash API settings in a bundle archive
+const bundleClashFile = "clash.json"
+
+// maxBundleBytes caps the unpacked size of an uploaded bundle, whatever its
+// compressed size
+const maxBundleBytes int64 = 256 << 20
+
+// BundleRestoreResponse lists the files restored from a bundle
+type BundleRestoreResponse struct {
+	Restored []string `json:"restored"`
+}
+
+// handleConfigBundle downloads the tool's state as a tar.gz on GET and
+// restores an uploaded one on POST
+func (s *Server) handleConfigBundle(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.handleConfigBundleExport(w, r)
+	case http.MethodPost:
+		s.handleConfigBundleImport(w, r)
+	default:
+		writeMethodNotAllowed(w)
+	}
+}
+
+// handleConfigBundleExport streams the config, its backups, the disabled
+// outbounds and the saved Clash API URL as one tar.gz, for moving the tool
+// to another machine. The Clash secret is not exported.
+func (s *Server) handleConfigBundleExport(w http.ResponseWriter, r *http.Request) {
+	files, err := s.configManager.BundleFiles()
+	if err != nil {
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to export bundle", err)
+		return
+	}
+
+	if s.clashConfigMgr != nil {
+		clashConfig, err := s.clashConfigMgr.Load()
+		if err != nil {
+			requestLogger(r).Warn("leaving Clash config out of bundle", "error", err)
+		} else if clashConfig.URL != "" {
+			// The secret is saved encrypted with a key tied to this
+			// machine, so it is left out rather than written in plain text
+			data, err := json.MarshalIndent(clash.Config{URL: clashConfig.URL}, "", "  ")
+			if err == nil {
+				files = append(files, config.BundleFile{Name: bundleClashFile, Data: data})
+			}
+		}
+	}
+
+	now := time.Now()
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=singbox-web-config-%s.tar.gz", now.Format("20060102-150405")))
+
+	zw := gzip.NewWriter(w)
+	tw := tar.NewWriter(zw)
+	for _, file := range files {
+		header := &tar.Header{
+			Name:    file.Name,
+			Mode:    0644,
+			Size:    int64(len(file.Data)),
+			ModTime: now,
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			requestLogger(r).Error("failed to write bundle", "error", err)
+			return
+		}
+		if _, err := tw.Write(file.Data); err != nil {
+			requestLogger(r).Error("failed to write bundle", "error", err)
+			return
+		}
+	}
+	if err := tw.Close(); err != nil {
+		requestLogger(r).Error("failed to write bundle", "error", err)
+		return
+	}
+	if err := zw.Close(); err != nil {
+		requestLogger(r).Error("failed to write bundle", "error", err)
+	}
+}
+
+// handleConfigBundleImport restores a bundle uploaded as the "bundle" file
+// of a multipart form or as the raw request body. Every file is validated
+// before any is written, and the config is checked with sing-box like an
+// uploaded config.
+func (s *Server) handleConfigBundleImport(w http.ResponseWriter, r *http.Request) {
+	var body io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			writeBodyError(w, err, "Failed to parse upload")
+			return
+		}
+		file, _, err := r.FormFile("bundle")
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, "No bundle uploaded")
+			return
+		}
+		defer file.Close()
+		body = file
+	}
+
+	files, clashData, err := readBundle(body)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			writeBodyTooLarge(w, maxBytesErr.Limit)
+			return
+		}
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, "Invalid bundle: "+err.Error())
+		return
+	}
+
+	var clashConfig clash.Config
+	if clashData != nil {
+		if err := json.Unmarshal(clashData, &clashConfig); err != nil || clashConfig.URL == "" {
+			writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, "Invalid bundle: clash.json is not a valid Clash API config")
+			return
+		}
+	}
+
+	for _, file := range files {
+		if err := s.configManager.ValidateBundleFile(file); err != nil {
+			writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, "Invalid bundle: "+err.Error())
+			return
+		}
+		if file.Name != config.BundleConfigFile {
+			continue
+		}
+		if err := s.serviceManager.CheckConfig(r.Context(), file.Data); err != nil {
+			if !errors.Is(err, service.ErrBinaryNotFound) {
+				writeJSONError(w, http.StatusUnprocessableEntity, ErrCodeValidation, "sing-box check failed: "+err.Error())
+				return
+			}
+			requestLogger(r).Warn("skipping sing-box check of bundled config", "error", err)
+		}
+	}
+
+	restored, err := s.configManager.RestoreBundle(files)
+	if err != nil {
+		requestLogger(r).Error("failed to restore bundle", "error", err, "restored", restored)
+		message := fmt.Sprintf("Failed to restore bundle: %v", err)
+		if len(restored) == 0 {
+			writeInternalError(w, err, message)
+			return
+		}
+		// Part of the bundle is in place; say which part
+		message += fmt.Sprintf(" (already restored: %s)", strings.Join(restored, ", "))
+		writeAPIError(w, http.StatusInternalServerError, &APIError{Code: ErrCodeInternal, Message: message, Details: map[string]interface{}{"restored": restored}})
+		return
+	}
+
+	response := BundleRestoreResponse{Restored: restored}
+
+	if clashData != nil {
+		// Bundles carry no secret; keep the current one if the URL is the same
+		if currentURL, currentSecret := s.clashAPISettings(); clashConfig.Secret == "" && clashConfig.URL == currentURL {
+			clashConfig.Secret = currentSecret
+		}
+		s.setClashAPI(clashConfig.URL, clashConfig.Secret)
+		if s.clashConfigMgr != nil {
+			if err := s.clashConfigMgr.Save(&clashConfig); err != nil {
+				requestLogger(r).Warn("failed to save Clash config", "error", err)
+			}
+		}
+		response.Restored = append(response.Restored, bundleClashFile)
+	}
+
+	requestLogger(r).Info("restored bundle", "files", len(response.Restored))
+
+	noteChange(r, "restored a bundle of %d files", len(response.Restored))
+
+	// Reload service
+	s.reloadService(r)
+
+	w.Header().Set("HX-Redirect", "/rules")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// readBundle unpacks a tar.gz bundle into the config manager's files and the
+// Clash API settings, which are nil when the bundle has none. Directories are
+// skipped; links, other special entries and names that are absolute or climb
+// out of the archive are rejected.
+func readBundle(r io.Reader) ([]config.BundleFile, []byte, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("not a gzip archive: %w", err)
+	}
+	defer zr.Close()
+
+	var files []config.BundleFile
+	var clashData []byte
+	remaining := maxBundleBytes
+
+	tr := tar.NewReader(zr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read archive: %w", err)
+		}
+
+		name, err := bundleEntryName(header.Name)
+		if err != nil {
+			return nil, nil, err
+		}
+		if header.Typeflag == tar.TypeDir {
+			continue
+		}
+		if header.Typeflag != tar.TypeReg {
+			return nil, nil, fmt.Errorf("%s is not a regular file", name)
+		}
+		if header.Size > remaining {
+			return nil, nil, fmt.Errorf("archive unpacks to more than %d bytes", maxBundleBytes)
+		}
+		remaining -= header.Size
+
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+
+		if name == bundleClashFile {
+			clashData = data
+			continue
+		}
+		files = append(files, config.BundleFile{Name: name, Data: data})
+	}
+
+	if len(files) == 0 && clashData == nil {
+		return nil, nil, errors.New("archive is empty")
+	}
+	return files, clashData, nil
+}
+
+// bundleEntryName cleans the name of a tar entry, rejecting absolute paths,
+// Windows separators and paths that leave the archive root
+func bundleEntryName(name string) (string, error) {
+	if strings.Contains(name, `\`) || path.IsAbs(name) {
+		return "", fmt.Errorf("unsafe path %q", name)
+	}
+	cleaned := path.Clean(name)
+	if cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("unsafe path %q", name)
+	}
+	return cleaned, nil
+}
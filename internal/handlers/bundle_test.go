@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/matinhimself/singbox-web-config/internal/clash"
+)
+
+func TestBundleExportLeavesOutClashSecret(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv(clash.SecretKeyEnv, "test passphrase")
+
+	clashConfigMgr, err := clash.NewConfigManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := clashConfigMgr.Save(&clash.Config{URL: "http://127.0.0.1:9090", Secret: "s3cret"}); err != nil {
+		t.Fatal(err)
+	}
+
+	s, _ := newTestServer(t, testConfig)
+	s.clashConfigMgr = clashConfigMgr
+
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/config/bundle", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /api/config/bundle = %d: %s", rec.Code, rec.Body.String())
+	}
+
+	files, clashData, err := readBundle(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Error("bundle has no config")
+	}
+	if clashData == nil {
+		t.Fatal("bundle has no Clash config")
+	}
+	if strings.Contains(string(clashData), "s3cret") {
+		t.Errorf("bundle leaks the Clash secret: %s", clashData)
+	}
+
+	var exported clash.Config
+	if err := json.Unmarshal(clashData, &exported); err != nil {
+		t.Fatal(err)
+	}
+	if exported.URL != "http://127.0.0.1:9090" || exported.Secret != "" {
+		t.Errorf("exported Clash config = %+v, want the URL only", exported)
+	}
+}
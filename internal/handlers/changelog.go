@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/matinhimself/singbox-web-config/internal/config"
+)
+
+// Limits of GET /api/config/history
+const (
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 1000
+)
+
+type changeNoteContextKey struct{}
+
+// changeNote holds the summary a handler gives the change it made, see
+// noteChange
+type changeNote struct {
+	summary string
+}
+
+// withChangeLog records every successful mutating API request in the change
+// log, with the summary its handler noted and the user the authenticating
+// proxy named. Requests that change nothing, the same ones read-only mode
+// lets through, aren't recorded.
+func (s *Server) withChangeLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/") || isSafeMethod(r.Method) || readOnlyAllowed[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		note := &changeNote{}
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), changeNoteContextKey{}, note)))
+		if rec.status < 200 || rec.status >= 300 {
+			return
+		}
+
+		entry := config.ChangeEntry{
+			Time:      time.Now(),
+			Action:    r.Method + " " + r.URL.Path,
+			Summary:   note.summary,
+			RequestID: requestID(r),
+		}
+		if s.auditUserHeader != "" {
+			entry.User = r.Header.Get(s.auditUserHeader)
+		}
+		if err := s.configManager.RecordChange(entry); err != nil {
+			requestLogger(r).Warn("failed to record change", "error", err)
+		}
+	})
+}
+
+// noteChange gives the change a request made a short summary for the change
+// log, like "created outbound proxy-hk"
+func noteChange(r *http.Request, format string, args ...interface{}) {
+	if note, ok := r.Context().Value(changeNoteContextKey{}).(*changeNote); ok {
+		note.summary = fmt.Sprintf(format, args...)
+	}
+}
+
+// SetAuditUserHeader names the request header an authenticating reverse
+// proxy puts the user in, such as Remote-User, so the change log records who
+// made each change. Without one no user is recorded.
+func (s *Server) SetAuditUserHeader(name string) {
+	s.auditUserHeader = http.CanonicalHeaderKey(strings.TrimSpace(name))
+}
+
+// handleConfigHistory returns the most recent change log entries, newest
+// first. limit sets how many, up to maxHistoryLimit.
+func (s *Server) handleConfigHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	limit := defaultHistoryLimit
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxHistoryLimit {
+			writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, fmt.Sprintf("limit must be between 1 and %d", maxHistoryLimit))
+			return
+		}
+		limit = n
+	}
+
+	changes, err := s.configManager.RecentChanges(limit)
+	if err != nil {
+		requestLogger(r).Error("failed to read change log", "error", err)
+		writeInternalError(w, err, "Failed to read the change history")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(changes)
+}
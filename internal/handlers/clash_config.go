@@ -2,8 +2,11 @@ package handlers
 
 import (
 	"encoding/json"
-	"log"
+	"fmt"
 	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/matinhimself/singbox-web-config/internal/clash"
@@ -41,22 +44,50 @@ type ClashUpdateResponse struct {
 	Message string `json:"message"`
 }
 
+// clashAPIClient returns the Clash API client, nil while the API isn't
+// configured. Once set it is replaced but never cleared.
+func (s *Server) clashAPIClient() *clash.Client {
+	s.clashMu.RLock()
+	defer s.clashMu.RUnlock()
+	return s.clashClient
+}
+
+// clashAPISettings returns the URL and secret of the Clash API, empty while
+// it isn't configured
+func (s *Server) clashAPISettings() (string, string) {
+	s.clashMu.RLock()
+	defer s.clashMu.RUnlock()
+	return s.clashURL, s.clashSecret
+}
+
+// setClashAPI points the Clash API client at url
+func (s *Server) setClashAPI(url, secret string) {
+	client := clash.NewClient(url, secret)
+
+	s.clashMu.Lock()
+	defer s.clashMu.Unlock()
+	s.clashURL = url
+	s.clashSecret = secret
+	s.clashClient = client
+}
+
 // handleClashConfig returns the current Clash configuration
 func (s *Server) handleClashConfig(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(w)
 		return
 	}
 
+	clashURL, clashSecret := s.clashAPISettings()
 	response := ClashConfigResponse{
-		URL:         s.clashURL,
-		HasSecret:   s.clashSecret != "",
-		IsConnected: s.clashClient != nil,
+		URL:         clashURL,
+		HasSecret:   clashSecret != "",
+		IsConnected: s.clashAPIClient() != nil,
 	}
 
 	// Only send the secret if explicitly requested and it exists
-	if r.URL.Query().Get("include_secret") == "true" && s.clashSecret != "" {
-		response.Secret = s.clashSecret
+	if r.URL.Query().Get("include_secret") == "true" && clashSecret != "" {
+		response.Secret = clashSecret
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -66,30 +97,25 @@ func (s *Server) handleClashConfig(w http.ResponseWriter, r *http.Request) {
 // handleClashTest tests a Clash API connection
 func (s *Server) handleClashTest(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(w)
 		return
 	}
 
 	var req ClashTestRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeBodyError(w, err, "Invalid request body")
 		return
 	}
 
 	// Format URL
-	url := formatClashURL(req.URL)
-	if url == "" {
-		response := ClashTestResponse{
-			Success: false,
-			Message: "URL is required",
-		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(response)
+	clashURL, err := formatClashURL(req.URL)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, err.Error())
 		return
 	}
 
 	// Test the connection
-	err := clash.TestConnection(url, req.Secret)
+	err = clash.TestConnection(r.Context(), clashURL, req.Secret)
 	response := ClashTestResponse{
 		Success: err == nil,
 	}
@@ -107,58 +133,45 @@ func (s *Server) handleClashTest(w http.ResponseWriter, r *http.Request) {
 // handleClashUpdate updates the Clash API configuration
 func (s *Server) handleClashUpdate(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(w)
 		return
 	}
 
 	var req ClashUpdateRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeBodyError(w, err, "Invalid request body")
 		return
 	}
 
 	// Format URL
-	url := formatClashURL(req.URL)
-	if url == "" {
-		response := ClashUpdateResponse{
-			Success: false,
-			Message: "URL is required",
-		}
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(response)
+	clashURL, err := formatClashURL(req.URL)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, err.Error())
 		return
 	}
 
 	// Test the connection first
-	if err := clash.TestConnection(url, req.Secret); err != nil {
-		response := ClashUpdateResponse{
-			Success: false,
-			Message: "Failed to connect: " + err.Error(),
-		}
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(response)
+	if err := clash.TestConnection(r.Context(), clashURL, req.Secret); err != nil {
+		writeJSONError(w, http.StatusBadGateway, ErrCodeUpstream, fmt.Sprintf("Failed to connect to %s: %v", clashURL, err))
 		return
 	}
 
 	// Update the configuration
-	s.clashURL = url
-	s.clashSecret = req.Secret
-	s.clashClient = clash.NewClient(url, req.Secret)
+	s.setClashAPI(clashURL, req.Secret)
 
 	// Save the configuration
 	if s.clashConfigMgr != nil {
 		config := &clash.Config{
-			URL:    url,
+			URL:    clashURL,
 			Secret: req.Secret,
 		}
 		if err := s.clashConfigMgr.Save(config); err != nil {
-			log.Printf("Warning: failed to save Clash config: %v", err)
+			requestLogger(r).Warn("failed to save Clash config", "error", err)
 		}
 	}
 
-	log.Printf("Clash API configuration updated: %s", url)
+	requestLogger(r).Info("Clash API configuration updated", "url", clashURL)
+	noteChange(r, "set the Clash API to %s", clashURL)
 
 	response := ClashUpdateResponse{
 		Success: true,
@@ -169,18 +182,43 @@ func (s *Server) handleClashUpdate(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
-// formatClashURL ensures the Clash URL has proper http:// prefix
-func formatClashURL(url string) string {
-	if url == "" {
-		return ""
+// urlScheme matches a URL that starts with a scheme, even a mistyped one
+// like "htp://" or "http:/", as opposed to a bare "host:port"
+var urlScheme = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.-]*:/`)
+
+// formatClashURL checks a Clash API URL and returns it in the form the
+// client expects. http:// is assumed when no scheme is given, while an
+// explicit scheme and path prefix are kept as they are.
+func formatClashURL(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", fmt.Errorf("URL is required")
 	}
 
-	url = strings.TrimSpace(url)
+	if !urlScheme.MatchString(raw) {
+		raw = "http://" + raw
+	}
 
-	// Add http:// prefix if no protocol is specified
-	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
-		url = "http://" + url
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("unsupported scheme %q, use http or https", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return "", fmt.Errorf("URL %q has no host", raw)
+	}
+	if port := u.Port(); port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return "", fmt.Errorf("invalid port %q", port)
+		}
+	}
+	if u.User != nil || u.RawQuery != "" || u.Fragment != "" {
+		return "", fmt.Errorf("URL must not have credentials, a query or a fragment; set the secret separately")
 	}
 
-	return url
+	u.Path = strings.TrimRight(u.Path, "/")
+	u.RawPath = ""
+	return u.String(), nil
 }
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"sync"
+	"testing"
+)
+
+// TestClashAPIConcurrentUpdate changes the Clash API while other goroutines
+// read it, as handleClashUpdate does during rule hit sampling. Run with
+// -race to catch unguarded access.
+func TestClashAPIConcurrentUpdate(t *testing.T) {
+	s := &Server{}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				s.setClashAPI("http://127.0.0.1:9090", "secret")
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				s.clashAPIClient()
+				s.clashAPISettings()
+			}
+		}()
+	}
+	wg.Wait()
+
+	url, secret := s.clashAPISettings()
+	if s.clashAPIClient() == nil || url != "http://127.0.0.1:9090" || secret != "secret" {
+		t.Errorf("Clash API = %q, %q, want the last one set", url, secret)
+	}
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/matinhimself/singbox-web-config/internal/config"
+	"github.com/matinhimself/singbox-web-config/internal/service"
+)
+
+// ConfigPatchResponse reports a saved JSON Patch
+type ConfigPatchResponse struct {
+	Applied int    `json:"applied"`
+	Hash    string `json:"hash"`
+}
+
+// handleConfigPatch applies an RFC 6902 JSON Patch from the request body to
+// the config. The result is checked with sing-box and saved and reloaded
+// like any other edit; a patch that fails or leaves an invalid config
+// changes nothing.
+func (s *Server) handleConfigPatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPatch {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeBodyError(w, err, "Failed to read request body")
+		return
+	}
+
+	ops, err := config.ParsePatch(data)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, ErrCodeBadRequest, "Invalid JSON Patch: "+err.Error())
+		return
+	}
+
+	patched, err := s.configManager.PatchedConfig(ops)
+	switch {
+	case errors.Is(err, config.ErrPatchTestFailed):
+		writeJSONError(w, http.StatusConflict, ErrCodeConflict, err.Error())
+		return
+	case errors.Is(err, config.ErrPatchRejected):
+		writeJSONError(w, http.StatusUnprocessableEntity, ErrCodeValidation, err.Error())
+		return
+	case err != nil:
+		requestLogger(r).Error("failed to read config", "error", err)
+		writeInternalError(w, err, "Failed to read config")
+		return
+	}
+
+	if err := s.serviceManager.CheckConfig(r.Context(), patched); err != nil {
+		if !errors.Is(err, service.ErrBinaryNotFound) {
+			writeJSONError(w, http.StatusUnprocessableEntity, ErrCodeValidation, "sing-box check failed: "+err.Error())
+			return
+		}
+		requestLogger(r).Warn("skipping sing-box check of patched config", "error", err)
+	}
+
+	if err := s.configManager.ImportConfig(patched); err != nil {
+		requestLogger(r).Error("failed to save patched config", "error", err)
+		writeInternalError(w, err, "Failed to save config")
+		return
+	}
+
+	// Log every operation so programmatic edits can be traced
+	for _, op := range ops {
+		requestLogger(r).Info("patched config", "op", op.Op, "path", op.Path, "from", op.From)
+	}
+
+	noteChange(r, "applied a JSON Patch of %d operations", len(ops))
+
+	s.reloadService(r)
+
+	response := ConfigPatchResponse{Applied: len(ops)}
+	if hash, err := s.configManager.ConfigHash(); err != nil {
+		requestLogger(r).Warn("failed to hash config", "error", err)
+	} else {
+		response.Hash = hash
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
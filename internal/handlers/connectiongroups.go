@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/matinhimself/singbox-web-config/internal/types"
+)
+
+// connectionGroupings are the keys /ws/connections?group= rolls connections
+// up by
+var connectionGroupings = []string{"process", "host", "chain"}
+
+// groupExampleDestinations caps how many destinations a group lists
+const groupExampleDestinations = 3
+
+// ConnectionGroup summarizes the connections that share a process, host or
+// chain
+type ConnectionGroup struct {
+	Key          string   `json:"key"`
+	Count        int      `json:"count"`
+	Upload       int64    `json:"upload"`
+	Download     int64    `json:"download"`
+	Destinations []string `json:"destinations"`
+}
+
+// aggregateConnections rolls conns up by one of connectionGroupings, busiest
+// group first. Connections without the key, such as those sing-box couldn't
+// match to a process, are grouped under "unknown".
+func aggregateConnections(conns []types.ClashConnection, by string) []ConnectionGroup {
+	groups := []ConnectionGroup{}
+	indexes := make(map[string]int)
+	for _, conn := range conns {
+		key := connectionGroupKey(conn, by)
+		index, ok := indexes[key]
+		if !ok {
+			index = len(groups)
+			indexes[key] = index
+			groups = append(groups, ConnectionGroup{Key: key, Destinations: []string{}})
+		}
+
+		group := &groups[index]
+		group.Count++
+		group.Upload += conn.Upload
+		group.Download += conn.Download
+		if destination := connectionDestination(conn); len(group.Destinations) < groupExampleDestinations && !contains(group.Destinations, destination) {
+			group.Destinations = append(group.Destinations, destination)
+		}
+	}
+
+	sort.SliceStable(groups, func(i, j int) bool {
+		a, b := groups[i], groups[j]
+		if a.Upload+a.Download != b.Upload+b.Download {
+			return a.Upload+a.Download > b.Upload+b.Download
+		}
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Key < b.Key
+	})
+	return groups
+}
+
+// connectionGroupKey returns the value conn is grouped by. A connection
+// without a host is grouped by the IP it went to.
+func connectionGroupKey(conn types.ClashConnection, by string) string {
+	var key string
+	switch by {
+	case "process":
+		key = conn.Metadata.ProcessPath
+	case "host":
+		key = conn.Metadata.Host
+		if key == "" {
+			key = conn.Metadata.DestinationIP
+		}
+	case "chain":
+		key = strings.Join(conn.Chains, " → ")
+	}
+	if key == "" {
+		return "unknown"
+	}
+	return key
+}
+
+// connectionDestination formats where conn went as host:port, using the IP
+// when there is no host
+func connectionDestination(conn types.ClashConnection) string {
+	host := conn.Metadata.Host
+	if host == "" {
+		host = conn.Metadata.DestinationIP
+	}
+	if conn.Metadata.DestinationPort == "" {
+		return host
+	}
+	return net.JoinHostPort(host, conn.Metadata.DestinationPort)
+}
@@ -1,13 +1,21 @@
 package handlers
 
 import (
+	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"math"
 	"net/http"
-	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/matinhimself/singbox-web-config/internal/clash"
+	"github.com/matinhimself/singbox-web-config/internal/types"
 )
 
 var upgrader = websocket.Upgrader{
@@ -21,131 +29,325 @@ var upgrader = websocket.Upgrader{
 // handleConnectionsPage handles the connections monitoring page
 func (s *Server) handleConnectionsPage(w http.ResponseWriter, r *http.Request) {
 	data := PageData{
-		Title: "Live Connections",
-		Data:  nil,
+		Title:    "Live Connections",
+		ReadOnly: s.readOnly,
+		Data: map[string]interface{}{
+			"SavedFilters": s.uiSessions.get(r, uiStateConnectionsFilter),
+		},
 	}
 
 	if err := s.renderTemplate(w, "connections.html", data); err != nil {
-		log.Printf("Error rendering template: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to render the page", err)
 	}
 }
 
-// handleConnectionsWebSocket handles WebSocket proxy to Clash API
+// handleConnectionsWebSocket handles WebSocket proxy to Clash API. Both legs
+// are kept alive with pings, and a dropped Clash connection is redialed once
+// before the client is told the proxy gave up. With rates=true each snapshot
+// also carries upRate and downRate, see throughputMeter. With group set to
+// process, host or chain, snapshots carry the connections rolled up into
+// groups instead of every connection, see aggregateConnections.
 func (s *Server) handleConnectionsWebSocket(w http.ResponseWriter, r *http.Request) {
-	// Get Clash API URL from query parameter or use default
+	rates := r.URL.Query().Get("rates") == "true"
+
+	group := r.URL.Query().Get("group")
+	if group != "" && !contains(connectionGroupings, group) {
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, fmt.Sprintf("group must be one of %s", strings.Join(connectionGroupings, ", ")))
+		return
+	}
+
+	// Get Clash API URL from query parameter, the configured one or the default
 	clashAPIURL := r.URL.Query().Get("clash_api")
+	header := http.Header{}
+	if configuredURL, secret := s.clashAPISettings(); clashAPIURL == "" && configuredURL != "" {
+		clashAPIURL = configuredURL
+		if secret != "" {
+			header.Set("Authorization", "Bearer "+secret)
+		}
+	}
 	if clashAPIURL == "" {
-		// Default Clash API URL - you can make this configurable
 		clashAPIURL = "http://127.0.0.1:9090"
 	}
 
+	logger := requestLogger(r)
+
 	// Upgrade HTTP connection to WebSocket
 	clientConn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Printf("Failed to upgrade connection: %v", err)
+		logger.Error("failed to upgrade connection", "error", err)
 		return
 	}
 	defer clientConn.Close()
+	client := newWSPeer(clientConn)
 
-	// Parse the Clash API URL
-	u, err := url.Parse(clashAPIURL)
+	// Construct WebSocket URL for Clash API connections endpoint, keeping
+	// any path prefix the controller is served under
+	clashWSURL, err := clash.WebSocketURL(clashAPIURL, "/connections")
 	if err != nil {
-		log.Printf("Invalid Clash API URL: %v", err)
-		clientConn.WriteJSON(map[string]string{"error": "Invalid Clash API URL"})
+		logger.Error("invalid Clash API URL", "url", clashAPIURL, "error", err)
+		client.writeJSON(map[string]string{"error": "Invalid Clash API URL"})
 		return
 	}
 
-	// Construct WebSocket URL for Clash API connections endpoint
-	wsScheme := "ws"
-	if u.Scheme == "https" {
-		wsScheme = "wss"
-	}
-	clashWSURL := fmt.Sprintf("%s://%s/connections", wsScheme, u.Host)
-
-	log.Printf("Connecting to Clash API WebSocket: %s", clashWSURL)
+	logger.Info("connecting to Clash API WebSocket", "url", clashWSURL)
 
 	// Connect to Clash API WebSocket
-	clashConn, _, err := websocket.DefaultDialer.Dial(clashWSURL, nil)
+	upstream, err := dialClashWebSocket(clashWSURL, header)
 	if err != nil {
-		log.Printf("Failed to connect to Clash API: %v", err)
-		clientConn.WriteJSON(map[string]string{"error": fmt.Sprintf("Failed to connect to Clash API: %v", err)})
+		logger.Error("failed to connect to Clash API", "url", clashWSURL, "error", err)
+		client.writeJSON(map[string]string{"error": fmt.Sprintf("Failed to connect to Clash API: %v", err)})
 		return
 	}
-	defer clashConn.Close()
 
-	// Create channels for bidirectional communication
+	// The client reader forwards to whichever Clash connection is current
+	var current atomic.Pointer[wsPeer]
+	current.Store(upstream)
+	defer func() { current.Load().conn.Close() }()
+
 	done := make(chan struct{})
-	errChan := make(chan error, 2)
+	defer close(done)
+	go client.keepAlive(done, logger)
 
-	// Forward messages from Clash API to client
+	// Forward messages from client to Clash API (if needed)
+	clientGone := make(chan error, 1)
 	go func() {
-		defer close(done)
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				logPanic(logger, recovered)
+				clientGone <- fmt.Errorf("client forwarder panicked: %v", recovered)
+			}
+		}()
 		for {
-			_, message, err := clashConn.ReadMessage()
+			_, message, err := client.conn.ReadMessage()
 			if err != nil {
 				if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-					log.Printf("Clash API WebSocket error: %v", err)
+					logger.Warn("client WebSocket error", "error", err)
 				}
-				errChan <- err
+				clientGone <- err
 				return
 			}
 
-			// Parse and validate the message
-			var connMsg map[string]interface{}
-			if err := json.Unmarshal(message, &connMsg); err != nil {
-				log.Printf("Failed to parse Clash API message: %v", err)
-				continue
-			}
-
-			// Forward to client
-			if err := clientConn.WriteMessage(websocket.TextMessage, message); err != nil {
-				log.Printf("Failed to write to client: %v", err)
-				errChan <- err
-				return
+			// Forward to Clash API. A failed write means the Clash side is
+			// going down, which its own reader notices and handles.
+			if err := current.Load().write(websocket.TextMessage, message); err != nil {
+				logger.Warn("failed to write to Clash API", "error", err)
 			}
 		}
 	}()
 
-	// Forward messages from client to Clash API (if needed)
-	go func() {
-		for {
-			_, message, err := clientConn.ReadMessage()
-			if err != nil {
-				if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-					log.Printf("Client WebSocket error: %v", err)
+	for {
+		clashDone := make(chan error, 1)
+		stopPing := make(chan struct{})
+		go func(upstream *wsPeer) {
+			defer func() {
+				if recovered := recover(); recovered != nil {
+					logPanic(logger, recovered)
+					clashDone <- fmt.Errorf("Clash forwarder panicked: %v", recovered)
 				}
-				errChan <- err
-				return
+			}()
+			clashDone <- forwardClashMessages(upstream, client, rates, group, logger)
+		}(upstream)
+		go upstream.keepAlive(stopPing, logger)
+
+		select {
+		case err := <-clientGone:
+			close(stopPing)
+			logger.Info("WebSocket proxy closed", "error", err)
+			return
+		case err = <-clashDone:
+			close(stopPing)
+			upstream.conn.Close()
+		}
+
+		if errors.Is(err, errClientWrite) {
+			logger.Info("WebSocket proxy closed", "error", err)
+			return
+		}
+
+		logger.Warn("Clash API connection lost, reconnecting", "error", err)
+		if client.writeJSON(map[string]string{"type": "reconnecting"}) != nil {
+			return
+		}
+
+		select {
+		case err := <-clientGone:
+			logger.Info("WebSocket proxy closed", "error", err)
+			return
+		case <-time.After(wsReconnectDelay):
+		}
+
+		upstream, err = dialClashWebSocket(clashWSURL, header)
+		if err != nil {
+			logger.Error("failed to reconnect to Clash API", "url", clashWSURL, "error", err)
+			client.writeJSON(map[string]string{"error": fmt.Sprintf("Lost connection to Clash API: %v", err)})
+			return
+		}
+		current.Store(upstream)
+
+		logger.Info("reconnected to Clash API WebSocket", "url", clashWSURL)
+		if client.writeJSON(map[string]string{"type": "reconnected"}) != nil {
+			return
+		}
+	}
+}
+
+// forwardClashMessages copies connection snapshots from Clash to the client
+// until either side fails, adding transfer rates to them with rates and
+// replacing their connections with groups when group is set. Client write
+// failures are wrapped in errClientWrite so they aren't mistaken for a dead
+// Clash connection.
+func forwardClashMessages(clash, client *wsPeer, rates bool, group string, logger *slog.Logger) error {
+	var meter throughputMeter
+	for {
+		_, message, err := clash.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+				logger.Warn("Clash API WebSocket error", "error", err)
 			}
+			return err
+		}
 
-			// Forward to Clash API
-			if err := clashConn.WriteMessage(websocket.TextMessage, message); err != nil {
-				log.Printf("Failed to write to Clash API: %v", err)
-				errChan <- err
-				return
+		// Parse and validate the message
+		var connMsg map[string]interface{}
+		if err := json.Unmarshal(message, &connMsg); err != nil {
+			logger.Warn("failed to parse Clash API message", "error", err)
+			continue
+		}
+
+		if group != "" {
+			var snapshot types.ClashConnectionsMessage
+			if err := json.Unmarshal(message, &snapshot); err != nil {
+				logger.Warn("failed to parse Clash API connections", "error", err)
+				continue
+			}
+			delete(connMsg, "connections")
+			connMsg["groupBy"] = group
+			connMsg["groups"] = aggregateConnections(snapshot.Connections, group)
+			connMsg["connectionCount"] = len(snapshot.Connections)
+		}
+		if rates {
+			connMsg["upRate"], connMsg["downRate"] = meter.add(connMsg, time.Now())
+		}
+		if group != "" || rates {
+			if rewritten, err := json.Marshal(connMsg); err == nil {
+				message = rewritten
 			}
 		}
-	}()
 
-	// Wait for done or error
-	select {
-	case <-done:
-		log.Println("Clash API connection closed")
-	case err := <-errChan:
-		log.Printf("WebSocket proxy error: %v", err)
+		// Forward to client
+		if err := client.write(websocket.TextMessage, message); err != nil {
+			logger.Warn("failed to write to client", "error", err)
+			return fmt.Errorf("%w: %v", errClientWrite, err)
+		}
+	}
+}
+
+// throughputMeter derives transfer rates in whole bytes per second from the
+// cumulative uploadTotal and downloadTotal of consecutive snapshots. The
+// first snapshot, and one whose totals went down because sing-box
+// restarted, has no earlier sample to compare with and reports 0.
+type throughputMeter struct {
+	at       time.Time
+	up, down float64
+	seen     bool
+}
+
+// add records a snapshot taken at now and returns the rates since the
+// previous one
+func (m *throughputMeter) add(snapshot map[string]interface{}, now time.Time) (upRate, downRate float64) {
+	up, _ := snapshot["uploadTotal"].(float64)
+	down, _ := snapshot["downloadTotal"].(float64)
+
+	if elapsed := now.Sub(m.at).Seconds(); m.seen && elapsed > 0 && up >= m.up && down >= m.down {
+		upRate = math.Round((up - m.up) / elapsed)
+		downRate = math.Round((down - m.down) / elapsed)
+	}
+
+	m.at, m.up, m.down, m.seen = now, up, down, true
+	return upRate, downRate
+}
+
+// dialClashWebSocket connects to the Clash API WebSocket
+func dialClashWebSocket(wsURL string, header http.Header) (*wsPeer, error) {
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, header)
+	if err != nil {
+		return nil, err
+	}
+	return newWSPeer(conn), nil
+}
+
+// connectionsCSVHeader names the columns of a connections export
+var connectionsCSVHeader = []string{
+	"id", "start", "duration_seconds", "network", "type",
+	"source_ip", "source_port", "destination_ip", "destination_port", "host",
+	"dns_mode", "process_path", "upload_bytes", "download_bytes", "chains",
+	"rule", "rule_payload",
+}
+
+// handleConnectionsExport downloads the active connections as CSV. It takes
+// one snapshot from the Clash API rather than following the live stream.
+func (s *Server) handleConnectionsExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	client := s.clashAPIClient()
+	if client == nil {
+		writeJSONError(w, http.StatusBadRequest, ErrCodeNotConfigured, "Clash API not configured")
+		return
+	}
+
+	snapshot, err := client.GetConnections(r.Context())
+	if err != nil {
+		requestLogger(r).Error("failed to fetch connections", "error", err)
+		writeJSONError(w, http.StatusBadGateway, ErrCodeUpstream, "Failed to fetch connections: "+err.Error())
+		return
+	}
+
+	now := time.Now()
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=connections-%s.csv", now.Format("20060102-150405")))
+
+	cw := csv.NewWriter(w)
+	cw.Write(connectionsCSVHeader)
+	for _, conn := range snapshot.Connections {
+		meta := conn.Metadata
+		cw.Write([]string{
+			conn.ID,
+			conn.Start.Format(time.RFC3339),
+			strconv.FormatInt(int64(now.Sub(conn.Start).Seconds()), 10),
+			meta.Network,
+			meta.Type,
+			meta.SourceIP,
+			meta.SourcePort,
+			meta.DestinationIP,
+			meta.DestinationPort,
+			meta.Host,
+			meta.DNSMode,
+			meta.ProcessPath,
+			strconv.FormatInt(conn.Upload, 10),
+			strconv.FormatInt(conn.Download, 10),
+			strings.Join(conn.Chains, " → "),
+			conn.Rule,
+			conn.RulePayload,
+		})
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		requestLogger(r).Warn("failed to write connections export", "error", err)
 	}
 }
 
 // handleConnectionToRule handles creating a rule from connection data
 func (s *Server) handleConnectionToRule(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(w)
 		return
 	}
 
 	if err := r.ParseMultipartForm(1 << 10); err != nil {
-		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		writeBodyError(w, err, "Failed to parse form")
 		return
 	}
 
@@ -157,15 +359,14 @@ func (s *Server) handleConnectionToRule(w http.ResponseWriter, r *http.Request)
 	domain := r.FormValue("domain")
 	outbound := r.FormValue("outbound")
 
-	// Debug logging
-	log.Printf("DEBUG - Received form data:")
-	log.Printf("  source_ip: '%s'", sourceIP)
-	log.Printf("  destination_ip: '%s'", destinationIP)
-	log.Printf("  destination_port: '%s'", destinationPort)
-	log.Printf("  network: '%s'", network)
-	log.Printf("  domain: '%s'", domain)
-	log.Printf("  outbound: '%s'", outbound)
-	log.Printf("  All form values: %v", r.Form)
+	requestLogger(r).Debug("received connection rule form",
+		"source_ip", sourceIP,
+		"destination_ip", destinationIP,
+		"destination_port", destinationPort,
+		"network", network,
+		"domain", domain,
+		"outbound", outbound,
+	)
 
 	// Build rule from selected properties
 	rule := make(map[string]interface{})
@@ -195,7 +396,7 @@ func (s *Server) handleConnectionToRule(w http.ResponseWriter, r *http.Request)
 
 	// Validate that at least one matching field is selected
 	if !hasMatchingField {
-		http.Error(w, "At least one matching field must be selected", http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, "At least one matching field must be selected")
 		return
 	}
 
@@ -204,15 +405,13 @@ func (s *Server) handleConnectionToRule(w http.ResponseWriter, r *http.Request)
 		rule["outbound"] = outbound
 	}
 
-	// Debug: log the rule being created
-	ruleJSON, _ := json.Marshal(rule)
-	log.Printf("DEBUG - Creating rule: %s", string(ruleJSON))
+	requestLogger(r).Debug("creating rule from connection", "rule", rule)
 
 	// Get current rules
 	rules, err := s.configManager.GetRules()
 	if err != nil {
-		log.Printf("Error getting rules: %v", err)
-		http.Error(w, "Failed to get rules", http.StatusInternalServerError)
+		requestLogger(r).Error("failed to get rules", "error", err)
+		writeInternalError(w, err, "Failed to get rules")
 		return
 	}
 
@@ -221,15 +420,15 @@ func (s *Server) handleConnectionToRule(w http.ResponseWriter, r *http.Request)
 
 	// Update config
 	if err := s.configManager.UpdateRules(rules); err != nil {
-		log.Printf("Error updating rules: %v", err)
-		http.Error(w, "Failed to save rules", http.StatusInternalServerError)
+		requestLogger(r).Error("failed to update rules", "error", err)
+		writeInternalError(w, err, "Failed to save rules")
 		return
 	}
 
+	noteChange(r, "created route rule #%d from a connection", len(rules))
+
 	// Reload service to apply changes
-	if err := s.serviceManager.Reload(); err != nil {
-		log.Printf("Warning: failed to reload service: %v", err)
-	}
+	s.reloadService(r)
 
 	// Return success
 	w.Header().Set("HX-Trigger", "ruleCreated")
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"html/template"
+	"io"
+	"io/fs"
+	"os"
+)
+
+// templateExecutor renders a named template. In production it is the
+// *template.Template parsed once from the embedded files; in dev mode it is
+// devTemplates.
+type templateExecutor interface {
+	ExecuteTemplate(w io.Writer, name string, data interface{}) error
+}
+
+// devTemplates parses the templates from disk again for every render, so
+// edits show up on the next page load without a rebuild
+type devTemplates struct {
+	fsys  fs.FS
+	funcs template.FuncMap
+}
+
+// ExecuteTemplate parses the templates and renders name
+func (d devTemplates) ExecuteTemplate(w io.Writer, name string, data interface{}) error {
+	tmpl, err := parseTemplates(d.fsys, d.funcs)
+	if err != nil {
+		return err
+	}
+	return tmpl.ExecuteTemplate(w, name, data)
+}
+
+// SetDevTemplates renders pages from the templates under dir, which holds
+// web/templates like the webassets directory, instead of the embedded copy.
+// They are parsed on every render, so this is for working on the UI only.
+func (s *Server) SetDevTemplates(dir string) error {
+	fsys := os.DirFS(dir)
+	funcs := s.templateFuncs()
+	if _, err := parseTemplates(fsys, funcs); err != nil {
+		return err
+	}
+	s.templates = devTemplates{fsys: fsys, funcs: funcs}
+	return nil
+}
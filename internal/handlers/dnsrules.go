@@ -0,0 +1,338 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/matinhimself/singbox-web-config/internal/forms"
+	"github.com/matinhimself/singbox-web-config/internal/types"
+)
+
+// dnsRuleActions are the actions a DNS rule can take
+var dnsRuleActions = []string{"route", "route-options", "reject", "predefined"}
+
+// DNSRuleRow is a DNS rule as the DNS rules list shows it: the server,
+// strategy and action its matches get, and its other fields in Match
+type DNSRuleRow struct {
+	Index    int
+	Match    map[string]interface{}
+	Server   string
+	Strategy string
+	Action   string
+	Rule     interface{}
+}
+
+// dnsRuleSection returns the section of dns.rules
+func (s *Server) dnsRuleSection() ruleSection {
+	return ruleSection{
+		BaseURL:     "/api/dns/rules",
+		ListTarget:  "#dns-rules-list",
+		Types:       s.formBuilder.GetDNSRuleTypes(),
+		rules:       s.configManager.GetDNSRules,
+		ruleType:    dnsRuleType,
+		targetField: "server",
+		targets:     s.configManager.GetDNSServerTags,
+	}
+}
+
+// handleDNSPage handles the DNS rules page
+func (s *Server) handleDNSPage(w http.ResponseWriter, r *http.Request) {
+	data := PageData{
+		Title:    "DNS Rules",
+		ReadOnly: s.readOnly,
+	}
+
+	if err := s.renderTemplate(w, "dns.html", data); err != nil {
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to render the page", err)
+	}
+}
+
+// handleDNSRulesList renders the DNS rules with their server, strategy and
+// action in columns of their own
+func (s *Server) handleDNSRulesList(w http.ResponseWriter, r *http.Request) {
+	rules, err := s.configManager.GetDNSRules()
+	if err != nil {
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to load DNS rules", err)
+		return
+	}
+
+	rows := make([]DNSRuleRow, len(rules))
+	for i, rule := range rules {
+		rows[i] = dnsRuleRow(i, rule)
+	}
+
+	data := map[string]interface{}{
+		"Rules": rows,
+	}
+
+	if err := s.renderTemplate(w, "dns-rule-list.html", data); err != nil {
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to render the page", err)
+	}
+}
+
+// dnsRuleRow splits the action columns off a DNS rule. A rule without an
+// action routes, as in sing-box.
+func dnsRuleRow(index int, rule interface{}) DNSRuleRow {
+	row := DNSRuleRow{Index: index, Rule: rule, Match: map[string]interface{}{}, Action: "route"}
+	ruleMap, ok := rule.(map[string]interface{})
+	if !ok {
+		return row
+	}
+
+	for field, value := range ruleMap {
+		switch field {
+		case "action":
+			if action, _ := value.(string); action != "" {
+				row.Action = action
+			}
+		case "server":
+			row.Server, _ = value.(string)
+		case "strategy":
+			row.Strategy, _ = value.(string)
+		default:
+			row.Match[field] = value
+		}
+	}
+	return row
+}
+
+// isDNSRuleMatcher reports whether a DNS rule field is a matching condition.
+// DNS rules match on a list of outbounds, so outbound is one.
+func isDNSRuleMatcher(field string) bool {
+	return field == "outbound" || field != "type" && forms.GroupOf(field) == forms.GroupMatchers
+}
+
+// handleDNSRuleForm handles the HTMX endpoint for DNS rule forms
+func (s *Server) handleDNSRuleForm(w http.ResponseWriter, r *http.Request) {
+	s.renderRuleForm(w, r, s.dnsRuleSection())
+}
+
+// handleDNSRuleCreate appends a DNS rule built from the rule form
+func (s *Server) handleDNSRuleCreate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	rule, ok := s.dnsRuleFromForm(w, r)
+	if !ok {
+		return
+	}
+
+	rules, err := s.configManager.GetDNSRules()
+	if err != nil {
+		requestLogger(r).Error("failed to get DNS rules", "error", err)
+		writeInternalError(w, err, "Failed to get DNS rules")
+		return
+	}
+
+	rules = append(rules, rule)
+
+	if err := s.configManager.UpdateDNSRules(rules); err != nil {
+		requestLogger(r).Error("failed to update DNS rules", "error", err)
+		writeInternalError(w, err, "Failed to save DNS rules")
+		return
+	}
+
+	noteChange(r, "created DNS rule #%d", len(rules))
+
+	// Reload service to apply changes
+	s.reloadService(r)
+
+	s.handleDNSRulesList(w, r)
+}
+
+// handleDNSRuleUpdate replaces the DNS rule at the "index" form value
+func (s *Server) handleDNSRuleUpdate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodPut {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	rule, ok := s.dnsRuleFromForm(w, r)
+	if !ok {
+		return
+	}
+
+	index, err := strconv.Atoi(r.FormValue("index"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, ErrCodeBadRequest, "Invalid index")
+		return
+	}
+
+	rules, err := s.configManager.GetDNSRules()
+	if err != nil {
+		requestLogger(r).Error("failed to get DNS rules", "error", err)
+		writeInternalError(w, err, "Failed to get DNS rules")
+		return
+	}
+
+	if index < 0 || index >= len(rules) {
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, "Index out of range")
+		return
+	}
+
+	rules[index] = rule
+
+	if err := s.configManager.UpdateDNSRules(rules); err != nil {
+		requestLogger(r).Error("failed to update DNS rules", "error", err)
+		writeInternalError(w, err, "Failed to save DNS rules")
+		return
+	}
+
+	noteChange(r, "updated DNS rule #%d", index+1)
+
+	// Reload service
+	s.reloadService(r)
+
+	s.handleDNSRulesList(w, r)
+}
+
+// handleDNSRuleDelete deletes the DNS rule at the "index" query parameter
+func (s *Server) handleDNSRuleDelete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	index, err := strconv.Atoi(r.URL.Query().Get("index"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, ErrCodeBadRequest, "Invalid index")
+		return
+	}
+
+	rules, err := s.configManager.GetDNSRules()
+	if err != nil {
+		requestLogger(r).Error("failed to get DNS rules", "error", err)
+		writeInternalError(w, err, "Failed to get DNS rules")
+		return
+	}
+
+	if index < 0 || index >= len(rules) {
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, "Index out of range")
+		return
+	}
+
+	rules = append(rules[:index], rules[index+1:]...)
+
+	if err := s.configManager.UpdateDNSRules(rules); err != nil {
+		requestLogger(r).Error("failed to update DNS rules", "error", err)
+		writeInternalError(w, err, "Failed to save DNS rules")
+		return
+	}
+
+	noteChange(r, "deleted DNS rule #%d", index+1)
+
+	// Reload service
+	s.reloadService(r)
+
+	s.handleDNSRulesList(w, r)
+}
+
+// handleDNSRulePreview builds a DNS rule from the submitted form without
+// saving it, like handleRulePreview does for route rules
+func (s *Server) handleDNSRulePreview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		writeBodyError(w, err, "Failed to parse form")
+		return
+	}
+
+	rule := s.buildRuleFromForm(r)
+	response := RulePreviewResponse{
+		Rule:     rule,
+		Errors:   []string{},
+		Warnings: []string{},
+	}
+	for _, err := range s.validateDNSRule(rule) {
+		response.Errors = append(response.Errors, err.Error())
+	}
+
+	if r.Header.Get("HX-Request") != "true" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	if err := s.renderTemplate(w, "rule-preview.html", response); err != nil {
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to render the page", err)
+	}
+}
+
+// dnsRuleFromForm parses the form and builds a DNS rule from it, writing a
+// 400 and returning false if it isn't a valid DNS rule
+func (s *Server) dnsRuleFromForm(w http.ResponseWriter, r *http.Request) (map[string]interface{}, bool) {
+	if err := r.ParseForm(); err != nil {
+		writeBodyError(w, err, "Failed to parse form")
+		return nil, false
+	}
+
+	// Route rules have their own list
+	if ruleType := r.FormValue("rule_type"); ruleType != "" && !contains(s.formBuilder.GetDNSRuleTypes(), ruleType) {
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, fmt.Sprintf("%s is not a DNS rule type", ruleType))
+		return nil, false
+	}
+
+	rule := s.buildRuleFromForm(r)
+	if err := types.ValidateDNSRule(rule); err != nil {
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, err.Error())
+		return nil, false
+	}
+	if errs := s.validateDNSRule(rule); len(errs) > 0 {
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, errors.Join(errs...).Error())
+		return nil, false
+	}
+	return rule, true
+}
+
+// validateDNSRule reports every problem with a DNS rule built from the rule
+// form: an unknown action, a route action without a known DNS server, a
+// default rule without any condition, or a logical rule without a valid mode
+func (s *Server) validateDNSRule(rule map[string]interface{}) []error {
+	var errs []error
+
+	action, _ := rule["action"].(string)
+	if action != "" && !contains(dnsRuleActions, action) {
+		errs = append(errs, fmt.Errorf("unknown DNS rule action %q", action))
+	}
+
+	// An empty action means route
+	if action == "" || action == "route" {
+		server, _ := rule["server"].(string)
+		if server == "" {
+			errs = append(errs, fmt.Errorf("server is required for the route action"))
+		} else if tags, err := s.configManager.GetDNSServerTags(); err == nil && !contains(tags, server) {
+			errs = append(errs, fmt.Errorf("DNS server %q does not exist", server))
+		}
+	}
+
+	if isLogicalRule(rule) || rule["mode"] != nil {
+		if mode, _ := rule["mode"].(string); mode != "and" && mode != "or" {
+			errs = append(errs, fmt.Errorf("logical rules need a mode of \"and\" or \"or\""))
+		}
+		if rule["rules"] == nil {
+			errs = append(errs, fmt.Errorf("logical rules need at least one sub-rule"))
+		}
+		return errs
+	}
+
+	hasCondition := false
+	for field := range rule {
+		if isDNSRuleMatcher(field) {
+			hasCondition = true
+			break
+		}
+	}
+	if !hasCondition {
+		errs = append(errs, fmt.Errorf("at least one matching condition is required"))
+	}
+
+	return errs
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/matinhimself/singbox-web-config/internal/config"
+)
+
+// handleDNSSettings renders the DNS settings form on GET and saves it on POST
+func (s *Server) handleDNSSettings(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.renderDNSSettings(w, r, false)
+	case http.MethodPost:
+		s.handleDNSSettingsUpdate(w, r)
+	default:
+		writeMethodNotAllowed(w)
+	}
+}
+
+// handleDNSSettingsUpdate saves the DNS settings form
+func (s *Server) handleDNSSettingsUpdate(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeBodyError(w, err, "Failed to parse form")
+		return
+	}
+
+	settings := config.DNSSettings{
+		Final:            strings.TrimSpace(r.FormValue("final")),
+		Strategy:         strings.TrimSpace(r.FormValue("strategy")),
+		DisableCache:     r.FormValue("disable_cache") == "on",
+		DisableExpire:    r.FormValue("disable_expire") == "on",
+		IndependentCache: r.FormValue("independent_cache") == "on",
+		FakeIP: config.FakeIPSettings{
+			Enabled:    r.FormValue("fakeip_enabled") == "on",
+			Inet4Range: strings.TrimSpace(r.FormValue("fakeip_inet4_range")),
+			Inet6Range: strings.TrimSpace(r.FormValue("fakeip_inet6_range")),
+		},
+	}
+
+	if err := settings.Validate(); err != nil {
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, err.Error())
+		return
+	}
+
+	if settings.Final != "" {
+		tags, err := s.configManager.GetDNSServerTags()
+		if err != nil {
+			requestLogger(r).Error("failed to get DNS server tags", "error", err)
+			writeInternalError(w, err, "Failed to get DNS servers")
+			return
+		}
+		if !contains(tags, settings.Final) {
+			writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, fmt.Sprintf("Final DNS server %q does not exist", settings.Final))
+			return
+		}
+	}
+
+	if err := s.configManager.UpdateDNSSettings(settings); err != nil {
+		requestLogger(r).Error("failed to update DNS settings", "error", err)
+		writeInternalError(w, err, "Failed to save DNS settings")
+		return
+	}
+
+	noteChange(r, "updated DNS settings")
+
+	s.reloadService(r)
+
+	w.Header().Set("HX-Trigger", "dnsSettingsUpdated")
+	s.renderDNSSettings(w, r, true)
+}
+
+// renderDNSSettings renders the DNS settings form with the current values
+func (s *Server) renderDNSSettings(w http.ResponseWriter, r *http.Request, saved bool) {
+	settings, err := s.configManager.GetDNSSettings()
+	if err != nil {
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to load DNS settings", err)
+		return
+	}
+
+	tags, err := s.configManager.GetDNSServerTags()
+	if err != nil {
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to load DNS settings", err)
+		return
+	}
+
+	data := map[string]interface{}{
+		"Settings":   settings,
+		"Tags":       tags,
+		"Strategies": config.DNSStrategies,
+		// A final that no longer exists is still shown so it can be fixed
+		"FinalMissing": settings.Final != "" && !contains(tags, settings.Final),
+		"Saved":        saved,
+	}
+
+	if err := s.renderTemplate(w, "dns-settings.html", data); err != nil {
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to render the page", err)
+	}
+}
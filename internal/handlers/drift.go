@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ConfigDriftResponse reports whether the config on disk is what the running
+// sing-box instance last loaded
+type ConfigDriftResponse struct {
+	Drift        bool       `json:"drift"`
+	PendingApply bool       `json:"pending_apply"`
+	FileHash     string     `json:"file_hash"`
+	AppliedHash  string     `json:"applied_hash"`
+	LastReloaded *time.Time `json:"last_reloaded,omitempty"`
+}
+
+// reloadService reloads sing-box after a config change. A failed reload is
+// only logged; the saved file then differs from the running config, which
+// the drift check reports. With deferred reloads the change is only marked
+// as pending until it is applied.
+func (s *Server) reloadService(r *http.Request) {
+	if s.deferReload {
+		s.reloadMu.Lock()
+		s.pendingApply = true
+		s.reloadMu.Unlock()
+		return
+	}
+
+	if err := s.serviceManager.Reload(r.Context()); err != nil {
+		requestLogger(r).Warn("failed to reload service", "error", err)
+		return
+	}
+	s.markConfigApplied(r)
+}
+
+// markConfigApplied records the current config file as the one sing-box runs
+// and checks it again for warnings
+func (s *Server) markConfigApplied(r *http.Request) {
+	hash, err := s.configManager.ConfigHash()
+	if err != nil {
+		requestLogger(r).Warn("failed to hash config", "error", err)
+		return
+	}
+
+	now := time.Now()
+	s.reloadMu.Lock()
+	s.appliedHash = hash
+	s.lastReloaded = &now
+	s.pendingApply = false
+	s.reloadMu.Unlock()
+
+	// Check the applied config so the lists and the index page show what
+	// sing-box now warns about, like options it has deprecated
+	if result := s.validateConfigFile(r.Context()); len(result.Warnings) > 0 {
+		requestLogger(r).Info("sing-box warned about the config", "warnings", len(result.Warnings), "deprecated", result.DeprecatedCount())
+	}
+}
+
+// hasPendingChanges reports whether saved changes are waiting to be applied
+func (s *Server) hasPendingChanges() bool {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+	return s.pendingApply
+}
+
+// SetDeferReload makes config changes skip the automatic reload. They are
+// applied together through /api/service/apply.
+func (s *Server) SetDeferReload(deferReload bool) {
+	s.deferReload = deferReload
+}
+
+// SetReloadCommand makes reloads run command instead of reloading the
+// systemd unit. {{.ConfigPath}} in the command expands to the config path.
+func (s *Server) SetReloadCommand(command string) error {
+	return s.serviceManager.SetReloadCommand(command, s.configManager.Path())
+}
+
+// configDrift compares the config file with the last applied config
+func (s *Server) configDrift() (*ConfigDriftResponse, error) {
+	hash, err := s.configManager.ConfigHash()
+	if err != nil {
+		return nil, err
+	}
+
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+	return &ConfigDriftResponse{
+		Drift:        hash != s.appliedHash,
+		PendingApply: s.pendingApply,
+		FileHash:     hash,
+		AppliedHash:  s.appliedHash,
+		LastReloaded: s.lastReloaded,
+	}, nil
+}
+
+// handleConfigDrift reports whether the config file has changed since the
+// last successful reload
+func (s *Server) handleConfigDrift(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	drift, err := s.configDrift()
+	if err != nil {
+		requestLogger(r).Error("failed to check config drift", "error", err)
+		writeInternalError(w, err, "Failed to check config drift")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(drift)
+}
+
+// handleServiceApply reloads sing-box once to apply every saved change
+func (s *Server) handleServiceApply(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	if err := s.serviceManager.Reload(r.Context()); err != nil {
+		requestLogger(r).Error("failed to apply changes", "error", err)
+		writeInternalError(w, err, fmt.Sprintf("Failed to apply changes: %v", err))
+		return
+	}
+	s.markConfigApplied(r)
+	noteChange(r, "applied saved changes")
+
+	w.Header().Set("HX-Trigger", "changesApplied")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Changes applied",
+	})
+}
@@ -0,0 +1,433 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// handleEndpointsPage handles the endpoints management page
+func (s *Server) handleEndpointsPage(w http.ResponseWriter, r *http.Request) {
+	data := PageData{
+		Title:    "Endpoint Management",
+		ReadOnly: s.readOnly,
+		Data:     map[string]interface{}{},
+	}
+
+	if err := s.renderTemplate(w, "endpoints.html", data); err != nil {
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to render the page", err)
+	}
+}
+
+// handleEndpointsList handles the HTMX endpoint for the endpoints list
+func (s *Server) handleEndpointsList(w http.ResponseWriter, r *http.Request) {
+	endpoints, err := s.configManager.GetEndpoints()
+	if err != nil {
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to load endpoints", err)
+		return
+	}
+
+	data := map[string]interface{}{
+		"Endpoints": endpoints,
+	}
+
+	if err := s.renderTemplate(w, "endpoint-list.html", data); err != nil {
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to render the page", err)
+	}
+}
+
+// handleEndpointForm handles the HTMX endpoint for endpoint forms
+func (s *Server) handleEndpointForm(w http.ResponseWriter, r *http.Request) {
+	endpointType := r.URL.Query().Get("type")
+	tagToEdit := r.URL.Query().Get("tag")
+	editMode := tagToEdit != ""
+
+	var endpointData map[string]interface{}
+
+	if editMode {
+		endpoints, err := s.configManager.GetEndpoints()
+		if err != nil {
+			s.renderError(w, r, http.StatusInternalServerError, "Failed to get endpoints", err)
+			return
+		}
+
+		_, endpointData = findByTag(endpoints, tagToEdit)
+		if endpointData == nil {
+			http.Error(w, "Endpoint not found", http.StatusNotFound)
+			return
+		}
+
+		// Get type from endpoint data
+		if endpointType == "" {
+			endpointType, _ = endpointData["type"].(string)
+		}
+	}
+
+	if endpointType == "" {
+		endpointType = "wireguard" // Default type
+	}
+
+	// Outbounds and other endpoints can be used as a detour
+	allTags, err := s.configManager.GetRouteTargetTags()
+	if err != nil {
+		requestLogger(r).Warn("failed to get outbound tags", "error", err)
+		allTags = []string{}
+	}
+
+	formFields := buildEndpointFormFields(endpointType, allTags)
+
+	// Populate form with existing values if editing
+	if editMode {
+		populateEndpointFormValues(formFields, endpointData)
+	}
+
+	data := map[string]interface{}{
+		"Fields":        formFields,
+		"EndpointType":  endpointType,
+		"EndpointTypes": getAvailableEndpointTypes(),
+		"EditMode":      editMode,
+		"OriginalTag":   tagToEdit,
+	}
+
+	if err := s.renderTemplate(w, "endpoint-form.html", data); err != nil {
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to render the page", err)
+	}
+}
+
+// handleEndpointCreate handles creating a new endpoint
+func (s *Server) handleEndpointCreate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		writeBodyError(w, err, "Failed to parse form")
+		return
+	}
+
+	// Endpoint forms share the outbound form encoding
+	endpoint, err := buildOutboundFromForm(r.Form, endpointFieldsOfType(r.FormValue("type"), "number"), endpointFieldsOfType(r.FormValue("type"), "textarea"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, err.Error())
+		return
+	}
+
+	if err := validateEndpoint(endpoint); err != nil {
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, err.Error())
+		return
+	}
+
+	// Tags are shared with outbounds, so check both lists
+	tags, err := s.configManager.GetRouteTargetTags()
+	if err != nil {
+		requestLogger(r).Error("failed to get outbound tags", "error", err)
+		writeInternalError(w, err, "Failed to get endpoints")
+		return
+	}
+	if tag, _ := endpoint["tag"].(string); contains(tags, tag) {
+		writeJSONError(w, http.StatusConflict, ErrCodeConflict, fmt.Sprintf("Tag %q is already in use", tag))
+		return
+	}
+
+	endpoints, err := s.configManager.GetEndpoints()
+	if err != nil {
+		requestLogger(r).Error("failed to get endpoints", "error", err)
+		writeInternalError(w, err, "Failed to get endpoints")
+		return
+	}
+
+	endpoints = append(endpoints, endpoint)
+
+	if err := s.configManager.UpdateEndpoints(endpoints); err != nil {
+		requestLogger(r).Error("failed to update endpoints", "error", err)
+		writeInternalError(w, err, "Failed to save endpoints")
+		return
+	}
+
+	noteChange(r, "created endpoint %v", endpoint["tag"])
+
+	// Reload service
+	s.reloadService(r)
+
+	// Return updated list
+	w.Header().Set("HX-Trigger", "endpointCreated")
+	s.handleEndpointsList(w, r)
+}
+
+// handleEndpointUpdate handles updating an existing endpoint. A changed tag is
+// applied through a rename so references to the endpoint follow it.
+func (s *Server) handleEndpointUpdate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		writeBodyError(w, err, "Failed to parse form")
+		return
+	}
+
+	originalTag := r.FormValue("original_tag")
+	if originalTag == "" {
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, "Missing original_tag")
+		return
+	}
+
+	updatedEndpoint, err := buildOutboundFromForm(r.Form, endpointFieldsOfType(r.FormValue("type"), "number"), endpointFieldsOfType(r.FormValue("type"), "textarea"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, err.Error())
+		return
+	}
+
+	if err := validateEndpoint(updatedEndpoint); err != nil {
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, err.Error())
+		return
+	}
+
+	newTag, _ := updatedEndpoint["tag"].(string)
+	if newTag != originalTag {
+		if err := s.configManager.RenameEndpoint(originalTag, newTag); err != nil {
+			requestLogger(r).Error("failed to rename endpoint", "error", err)
+			writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, fmt.Sprintf("Failed to rename endpoint: %v", err))
+			return
+		}
+	}
+
+	endpoints, err := s.configManager.GetEndpoints()
+	if err != nil {
+		requestLogger(r).Error("failed to get endpoints", "error", err)
+		writeInternalError(w, err, "Failed to get endpoints")
+		return
+	}
+
+	index, _ := findByTag(endpoints, newTag)
+	if index == -1 {
+		writeJSONError(w, http.StatusNotFound, ErrCodeNotFound, "Endpoint to update not found")
+		return
+	}
+	endpoints[index] = updatedEndpoint
+
+	if err := s.configManager.UpdateEndpoints(endpoints); err != nil {
+		requestLogger(r).Error("failed to update endpoints", "error", err)
+		writeInternalError(w, err, "Failed to save endpoints")
+		return
+	}
+
+	noteChange(r, "updated endpoint %s", originalTag)
+
+	// Reload service
+	s.reloadService(r)
+
+	// Return updated list
+	w.Header().Set("HX-Trigger", "endpointUpdated")
+	s.handleEndpointsList(w, r)
+}
+
+// handleEndpointDelete handles deleting an endpoint
+func (s *Server) handleEndpointDelete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	tag := r.URL.Query().Get("tag")
+	if tag == "" {
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, "Invalid tag")
+		return
+	}
+
+	// Removes the endpoint from groups, refusing while rules still use it
+	if err := s.configManager.DeleteEndpoint(tag); err != nil {
+		requestLogger(r).Error("failed to delete endpoint", "error", err)
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, fmt.Sprintf("Failed to delete endpoint: %v", err))
+		return
+	}
+
+	noteChange(r, "deleted endpoint %s", tag)
+
+	// Reload service
+	s.reloadService(r)
+
+	// Return updated list
+	w.Header().Set("HX-Trigger", "endpointDeleted")
+	s.handleEndpointsList(w, r)
+}
+
+// handleEndpointRename handles renaming an endpoint and updating all references
+func (s *Server) handleEndpointRename(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		writeBodyError(w, err, "Failed to parse form")
+		return
+	}
+
+	oldTag := r.FormValue("old_tag")
+	newTag := strings.TrimSpace(r.FormValue("new_tag"))
+
+	if oldTag == "" || newTag == "" {
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, "Missing tag parameters")
+		return
+	}
+
+	if err := s.configManager.RenameEndpoint(oldTag, newTag); err != nil {
+		requestLogger(r).Error("failed to rename endpoint", "error", err)
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, fmt.Sprintf("Failed to rename endpoint: %v", err))
+		return
+	}
+
+	noteChange(r, "renamed endpoint %s to %s", oldTag, newTag)
+
+	// Reload service
+	s.reloadService(r)
+
+	// Return updated list
+	w.Header().Set("HX-Trigger", "endpointRenamed")
+	s.handleEndpointsList(w, r)
+}
+
+// getAvailableEndpointTypes returns the endpoint types that can be managed
+func getAvailableEndpointTypes() []map[string]string {
+	return []map[string]string{
+		{"value": "wireguard", "label": "WireGuard", "description": "WireGuard tunnel"},
+		{"value": "tailscale", "label": "Tailscale", "description": "Tailscale network"},
+	}
+}
+
+// buildEndpointFormFields builds the form fields for an endpoint type
+func buildEndpointFormFields(endpointType string, allTags []string) []FormField {
+	fields := []FormField{
+		{Name: "type", Label: "Type", Type: "hidden", Value: endpointType, Required: true},
+		{Name: "tag", Label: "Tag", Type: "text", Placeholder: "my-endpoint", Required: true, Description: "Unique identifier, shared with outbound tags"},
+	}
+
+	switch endpointType {
+	case "wireguard":
+		fields = append(fields, []FormField{
+			{Name: "address[]", Label: "Address", Type: "array", Placeholder: "10.0.0.2/32", Required: true, IsArray: true, Description: "Interface address(es) in CIDR form"},
+			{Name: "private_key", Label: "Private Key", Type: "text", Required: true},
+			{Name: "peers", Label: "Peers", Type: "textarea", Required: true,
+				Placeholder: `[{"address": "example.com", "port": 51820, "public_key": "...", "allowed_ips": ["0.0.0.0/0"]}]`,
+				Description: "JSON list of peers with address, port, public_key, pre_shared_key, allowed_ips, persistent_keepalive_interval and reserved"},
+			{Name: "listen_port", Label: "Listen Port", Type: "number", Placeholder: "51820"},
+			{Name: "mtu", Label: "MTU", Type: "number", Placeholder: "1408"},
+			{Name: "system", Label: "System Interface", Type: "checkbox", Description: "Use a system interface instead of the userspace stack"},
+			{Name: "name", Label: "Interface Name", Type: "text", Placeholder: "wg0", Description: "Only used with a system interface"},
+			{Name: "udp_timeout", Label: "UDP Timeout", Type: "text", Placeholder: "5m"},
+			{Name: "workers", Label: "Workers", Type: "number", Placeholder: "4"},
+		}...)
+	case "tailscale":
+		fields = append(fields, []FormField{
+			{Name: "auth_key", Label: "Auth Key", Type: "password", Description: "Leave empty to log in interactively from the service logs"},
+			{Name: "state_directory", Label: "State Directory", Type: "text", Placeholder: "tailscale"},
+			{Name: "control_url", Label: "Control URL", Type: "text", Placeholder: "https://controlplane.tailscale.com"},
+			{Name: "hostname", Label: "Hostname", Type: "text"},
+			{Name: "ephemeral", Label: "Ephemeral", Type: "checkbox"},
+			{Name: "accept_routes", Label: "Accept Routes", Type: "checkbox"},
+			{Name: "exit_node", Label: "Exit Node", Type: "text", Description: "Exit node name or IP"},
+			{Name: "exit_node_allow_lan_access", Label: "Allow LAN Access via Exit Node", Type: "checkbox"},
+			{Name: "advertise_routes[]", Label: "Advertise Routes", Type: "array", Placeholder: "192.168.1.0/24", IsArray: true},
+			{Name: "advertise_exit_node", Label: "Advertise Exit Node", Type: "checkbox"},
+			{Name: "udp_timeout", Label: "UDP Timeout", Type: "text", Placeholder: "5m"},
+		}...)
+	}
+
+	// Dialer options shared by both endpoint types
+	fields = append(fields, []FormField{
+		{Name: "detour", Label: "Detour", Type: "select", Options: allTags, Description: "Use another outbound as proxy chain"},
+		{Name: "bind_interface", Label: "Bind Interface", Type: "text", Description: "Bind to specific network interface"},
+	}...)
+
+	return fields
+}
+
+// endpointFieldsOfType returns the fields of an endpoint type's form with the
+// given input type, such as its number fields or its textareas, which hold
+// JSON. There are no generated endpoint types to read them from.
+func endpointFieldsOfType(endpointType, inputType string) map[string]bool {
+	fields := make(map[string]bool)
+	for _, field := range buildEndpointFormFields(endpointType, nil) {
+		if field.Type == inputType {
+			fields[field.Name] = true
+		}
+	}
+	return fields
+}
+
+// populateEndpointFormValues fills form fields from an endpoint. Lists of
+// objects, such as WireGuard peers, are shown as indented JSON.
+func populateEndpointFormValues(fields []FormField, data map[string]interface{}) {
+	for i := range fields {
+		field := &fields[i]
+		value, ok := data[strings.TrimSuffix(field.Name, "[]")]
+		if !ok {
+			continue
+		}
+
+		switch v := value.(type) {
+		case []interface{}:
+			if field.IsArray {
+				field.Values = nil
+				for _, item := range v {
+					field.Values = append(field.Values, fmt.Sprintf("%v", item))
+				}
+				continue
+			}
+			if encoded, err := json.MarshalIndent(v, "", "  "); err == nil {
+				field.Value = string(encoded)
+			}
+		case map[string]interface{}:
+			if encoded, err := json.MarshalIndent(v, "", "  "); err == nil {
+				field.Value = string(encoded)
+			}
+		default:
+			field.Value = value
+		}
+	}
+}
+
+// validateEndpoint checks the fields sing-box requires for an endpoint
+func validateEndpoint(endpoint map[string]interface{}) error {
+	endpointType, _ := endpoint["type"].(string)
+	if endpointType != "wireguard" && endpointType != "tailscale" {
+		return fmt.Errorf("unsupported endpoint type %q", endpointType)
+	}
+
+	tag, ok := endpoint["tag"].(string)
+	if !ok || tag == "" {
+		return fmt.Errorf("endpoint tag is required")
+	}
+
+	if endpointType == "wireguard" {
+		if addresses, ok := endpoint["address"].([]interface{}); !ok || len(addresses) == 0 {
+			return fmt.Errorf("address is required for wireguard endpoint")
+		}
+		if key, _ := endpoint["private_key"].(string); key == "" {
+			return fmt.Errorf("private_key is required for wireguard endpoint")
+		}
+		peers, ok := endpoint["peers"].([]interface{})
+		if !ok || len(peers) == 0 {
+			return fmt.Errorf("peers must be a JSON list with at least one peer")
+		}
+	}
+
+	return nil
+}
+
+// findByTag returns the index and map of the tagged item in an outbound or
+// endpoint list, or -1 and nil when no item has the tag
+func findByTag(items []interface{}, tag string) (int, map[string]interface{}) {
+	for i, item := range items {
+		if itemMap, ok := item.(map[string]interface{}); ok {
+			if t, ok := itemMap["tag"].(string); ok && t == tag {
+				return i, itemMap
+			}
+		}
+	}
+	return -1, nil
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/matinhimself/singbox-web-config/internal/config"
+	"github.com/matinhimself/singbox-web-config/internal/service"
+)
+
+// Error codes returned in APIError.Code so clients can tell failures apart
+// without parsing the message text
+const (
+	ErrCodeMethodNotAllowed = "method_not_allowed"
+	ErrCodeBadRequest       = "bad_request"
+	ErrCodeValidation       = "validation_error"
+	ErrCodeNotFound         = "not_found"
+	ErrCodeConflict         = "conflict"
+	ErrCodeTooLarge         = "request_too_large"
+	ErrCodeRateLimited      = "rate_limited"
+	ErrCodeNotConfigured    = "not_configured"
+	ErrCodeReadOnly         = "read_only"
+	ErrCodeForbidden        = "forbidden"
+	ErrCodeUpstream         = "upstream_error"
+	ErrCodeTimeout          = "timeout"
+	ErrCodeInternal         = "internal_error"
+	ErrCodeNotImplemented   = "not_implemented"
+)
+
+// APIError is the JSON body written by API handlers when a request fails
+type APIError struct {
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+// writeJSONError writes a structured JSON error response
+func writeJSONError(w http.ResponseWriter, status int, code, message string) {
+	writeAPIError(w, status, &APIError{Code: code, Message: message})
+}
+
+// permissionGuidance tells users how to give the manager the access it lacks
+const permissionGuidance = "run the manager as root or via sudo, or allow it with a Polkit rule"
+
+// isPermissionError reports whether err comes from the config or service
+// layer lacking the permissions for an operation
+func isPermissionError(err error) bool {
+	return errors.Is(err, config.ErrInsufficientPermissions) || errors.Is(err, service.ErrInsufficientPermissions)
+}
+
+// writeInternalError writes a 500 with message, or a 403 with guidance when
+// err is a permission problem, which no retry fixes
+func writeInternalError(w http.ResponseWriter, err error, message string) {
+	if isPermissionError(err) {
+		writeJSONError(w, http.StatusForbidden, ErrCodeForbidden, fmt.Sprintf("%s: insufficient permissions; %s", message, permissionGuidance))
+		return
+	}
+	writeJSONError(w, http.StatusInternalServerError, ErrCodeInternal, message)
+}
+
+// writeAPIError writes an APIError, including any details, as a JSON response
+func writeAPIError(w http.ResponseWriter, status int, apiErr *APIError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(apiErr); err != nil {
+		slog.Error("failed to encode API error", "error", err)
+	}
+}
+
+// writeMethodNotAllowed writes the standard JSON error for an unsupported method
+func writeMethodNotAllowed(w http.ResponseWriter) {
+	writeJSONError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+}
+
+// ErrorPageData is shown by the error page and the error-message fragment
+type ErrorPageData struct {
+	Status     int
+	StatusText string
+	Message    string
+	RequestID  string
+}
+
+// renderError logs err with the request's ID and shows userMsg and the ID
+// instead of a bare status text, so a user reporting the failure can quote
+// an ID that finds the details in the logs. HTMX requests get the
+// error-message fragment for their target, other requests the full error
+// page. Nothing is written if the handler already started its response.
+func (s *Server) renderError(w http.ResponseWriter, r *http.Request, status int, userMsg string, err error) {
+	logger := requestLogger(r)
+	if err != nil {
+		logger.Error("request failed", "status", status, "message", userMsg, "error", err)
+	} else {
+		logger.Error("request failed", "status", status, "message", userMsg)
+	}
+
+	if rec, ok := w.(*statusRecorder); ok && rec.wroteHeader {
+		return
+	}
+
+	if isPermissionError(err) {
+		status = http.StatusForbidden
+		userMsg = fmt.Sprintf("%s: insufficient permissions; %s", userMsg, permissionGuidance)
+	}
+
+	data := ErrorPageData{
+		Status:     status,
+		StatusText: http.StatusText(status),
+		Message:    userMsg,
+		RequestID:  requestID(r),
+	}
+	name := "error.html"
+	if r.Header.Get("HX-Request") == "true" {
+		name = "error-message"
+	}
+
+	var body bytes.Buffer
+	if err := s.templates.ExecuteTemplate(&body, name, PageData{Title: data.StatusText, ReadOnly: s.readOnly, Data: data}); err != nil {
+		logger.Error("failed to render error page", "error", err)
+		http.Error(w, fmt.Sprintf("%s (request ID %s)", userMsg, data.RequestID), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	body.WriteTo(w)
+}
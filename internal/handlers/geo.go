@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/matinhimself/singbox-web-config/internal/config"
+)
+
+// handleGeoPage handles the geo database and rule set page
+func (s *Server) handleGeoPage(w http.ResponseWriter, r *http.Request) {
+	data := PageData{
+		Title:    "Geo Resources",
+		ReadOnly: s.readOnly,
+		Data:     map[string]interface{}{},
+	}
+
+	if err := s.renderTemplate(w, "geo.html", data); err != nil {
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to render the page", err)
+	}
+}
+
+// handleGeoList handles the HTMX endpoint listing geo databases and rule
+// sets along with warnings about missing ones
+func (s *Server) handleGeoList(w http.ResponseWriter, r *http.Request) {
+	resources, err := s.configManager.GeoResources()
+	if err != nil {
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to load geo resources", err)
+		return
+	}
+
+	warnings, err := s.configManager.GeoWarnings()
+	if err != nil {
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to load geo resources", err)
+		return
+	}
+
+	data := map[string]interface{}{
+		"Resources": resources,
+		"Warnings":  warnings,
+	}
+
+	if err := s.renderTemplate(w, "geo-list.html", data); err != nil {
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to render the page", err)
+	}
+}
+
+// handleGeoUpdate downloads the geoip or geosite database named by the kind
+// parameter and reloads sing-box so it picks up the new file
+func (s *Server) handleGeoUpdate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	kind := r.URL.Query().Get("kind")
+	if kind != config.GeoKindGeoIP && kind != config.GeoKindGeosite {
+		writeJSONError(w, http.StatusBadRequest, ErrCodeBadRequest, "kind must be geoip or geosite")
+		return
+	}
+
+	resource, err := s.configManager.DownloadGeoDatabase(r.Context(), kind)
+	if errors.Is(err, config.ErrGeoNotConfigured) {
+		writeJSONError(w, http.StatusNotFound, ErrCodeNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		requestLogger(r).Error("failed to download geo database", "kind", kind, "error", err)
+		writeJSONError(w, http.StatusBadGateway, ErrCodeUpstream, fmt.Sprintf("Failed to update %s database: %v", kind, err))
+		return
+	}
+	requestLogger(r).Info("updated geo database", "kind", kind, "path", resource.Path, "size", resource.Size)
+
+	noteChange(r, "updated %s database", kind)
+
+	s.reloadService(r)
+
+	w.Header().Set("HX-Trigger", "geoUpdated")
+	s.handleGeoList(w, r)
+}
@@ -1,21 +1,28 @@
 package handlers
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"io/fs"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/matinhimself/singbox-web-config/internal/config"
+	"github.com/matinhimself/singbox-web-config/internal/forms"
+	"github.com/matinhimself/singbox-web-config/internal/service"
 	"github.com/matinhimself/singbox-web-config/internal/types"
 )
 
 // PageData represents common data for all pages
 type PageData struct {
-	Title string
-	Data  interface{}
+	Title    string
+	Data     interface{}
+	ReadOnly bool
 }
 
 // handleIndex handles the home page
@@ -26,50 +33,58 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
 	}
 
 	data := PageData{
-		Title: "Sing-Box Config Manager",
+		Title:    "Sing-Box Config Manager",
+		ReadOnly: s.readOnly,
 		Data: map[string]interface{}{
-			"Metadata": types.Metadata,
+			"Metadata":       types.Metadata,
+			"Validation":     s.lastValidation(),
+			"SingBoxVersion": s.singBoxVersion,
+			"VersionWarning": s.versionWarning,
 		},
 	}
 
 	if err := s.renderTemplate(w, "index.html", data); err != nil {
-		log.Printf("Error rendering template: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to render the page", err)
 	}
 }
 
 // handleRulesPage handles the rules management page
 func (s *Server) handleRulesPage(w http.ResponseWriter, r *http.Request) {
 	data := PageData{
-		Title: "Route Rules",
-		Data:  map[string]interface{}{
-			// RuleTypes removed - types.AvailableRuleTypes() doesn't exist
+		Title:    "Route Rules",
+		ReadOnly: s.readOnly,
+		Data: map[string]interface{}{
+			"RuleFilter": s.uiSessions.get(r, uiStateRuleFilter),
 		},
 	}
 
 	if err := s.renderTemplate(w, "rules.html", data); err != nil {
-		log.Printf("Error rendering template: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to render the page", err)
 	}
 }
 
 // handleServicePage handles the service management page
 func (s *Server) handleServicePage(w http.ResponseWriter, r *http.Request) {
-	status, err := s.serviceManager.GetStatus()
+	status, err := s.serviceManager.GetStatus(r.Context())
 	if err != nil {
-		log.Printf("Error getting service status: %v", err)
+		requestLogger(r).Error("failed to get service status", "error", err)
 	}
 
+	// An empty path shows that no binary was found
+	binaryPath, _ := service.FindSingBox()
+
 	data := PageData{
-		Title: "Service Management",
+		Title:    "Service Management",
+		ReadOnly: s.readOnly,
 		Data: map[string]interface{}{
-			"Status": status,
+			"Status":         status,
+			"BinaryPath":     binaryPath,
+			"SingBoxVersion": s.singBoxVersion,
 		},
 	}
 
 	if err := s.renderTemplate(w, "service.html", data); err != nil {
-		log.Printf("Error rendering template: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to render the page", err)
 	}
 }
 
@@ -77,24 +92,122 @@ func (s *Server) handleServicePage(w http.ResponseWriter, r *http.Request) {
 func (s *Server) handleRulesList(w http.ResponseWriter, r *http.Request) {
 	rules, err := s.configManager.GetRules()
 	if err != nil {
-		log.Printf("Error getting rules: %v", err)
-		http.Error(w, "Failed to load rules", http.StatusInternalServerError)
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to load rules", err)
 		return
 	}
 
 	data := map[string]interface{}{
-		"Rules": rules,
+		"Rules":          rules,
+		"ConfigWarnings": s.configWarnings(),
+	}
+
+	// Filter on the given or remembered text, keeping rule indexes intact
+	if filter := s.uiParam(w, r, "q", uiStateRuleFilter); filter != "" {
+		matches, count := filterRules(rules, filter)
+		data["Filter"] = filter
+		data["FilterMatches"] = matches
+		data["FilterCount"] = count
+	}
+
+	// Point out rules an earlier rule keeps from ever matching
+	if warnings := config.ShadowedRules(rules); len(warnings) > 0 {
+		shadowed := make(map[int]string, len(warnings))
+		for _, warning := range warnings {
+			shadowed[warning.Later] = warning.Message
+		}
+		data["ShadowWarnings"] = warnings
+		data["Shadowed"] = shadowed
+	}
+
+	// Annotate rules with recent hits once sampling has started
+	client := s.clashAPIClient()
+	if s.ruleHits != nil && client != nil {
+		hitCounts, unmatchedHits := matchRuleHits(rules, s.ruleHits.counts())
+		data["HitCounts"] = hitCounts
+		data["UnmatchedHits"] = unmatchedHits
+		data["HitWindow"] = s.ruleHitWindow.String()
+	}
+
+	// Mark mode-gated rules, greying out those the live mode skips
+	if modes := ruleModes(rules); modes != nil {
+		data["RuleModes"] = modes
+		if client != nil {
+			if mode, err := client.GetMode(r.Context()); err != nil {
+				requestLogger(r).Warn("failed to get Clash mode", "error", err)
+			} else {
+				data["ClashMode"] = mode
+				data["InactiveRules"] = inactiveRules(modes, mode)
+			}
+		}
 	}
 
 	if err := s.renderTemplate(w, "rule-list.html", data); err != nil {
-		log.Printf("Error rendering template: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to render the page", err)
+	}
+}
+
+// filterRules marks the rules whose JSON contains filter, ignoring case, and
+// counts them
+func filterRules(rules []interface{}, filter string) ([]bool, int) {
+	filter = strings.ToLower(filter)
+	matches := make([]bool, len(rules))
+	count := 0
+	for i, rule := range rules {
+		data, err := json.Marshal(rule)
+		if err == nil && strings.Contains(strings.ToLower(string(data)), filter) {
+			matches[i] = true
+			count++
+		}
+	}
+	return matches, count
+}
+
+// ruleSection is a list of rules edited with the rule form: the route rules
+// or the DNS rules. Each keeps to its own rule types, so a rule can't be
+// saved into the wrong list.
+type ruleSection struct {
+	// BaseURL prefixes the section's form, create, update and preview
+	// endpoints
+	BaseURL string
+	// ListTarget is the element a saved rule's list replaces
+	ListTarget string
+	// Types are the rule types the form offers, the first being the default
+	Types []string
+
+	rules    func() ([]interface{}, error)
+	ruleType func(rule map[string]interface{}) string
+	// targetField is the rule field naming where matches go, shown as a
+	// select of targets()
+	targetField string
+	targets     func() ([]string, error)
+}
+
+// routeRuleSection returns the section of route.rules
+func (s *Server) routeRuleSection() ruleSection {
+	return ruleSection{
+		BaseURL:     "/api/rules",
+		ListTarget:  "#rules-list",
+		Types:       s.formBuilder.GetRouteRuleTypes(),
+		rules:       s.configManager.GetRules,
+		ruleType:    routeRuleType,
+		targetField: "outbound",
+		targets:     s.getOutboundTags,
 	}
 }
 
 // handleRuleForm handles the HTMX endpoint for rule forms
 func (s *Server) handleRuleForm(w http.ResponseWriter, r *http.Request) {
+	s.renderRuleForm(w, r, s.routeRuleSection())
+}
+
+// renderRuleForm renders the rule form of a section, filled in with the rule
+// at the "index" query parameter when editing
+func (s *Server) renderRuleForm(w http.ResponseWriter, r *http.Request, section ruleSection) {
+	// The form's own type select sends rule_type
 	ruleType := r.URL.Query().Get("type")
+	if ruleType == "" {
+		ruleType = r.URL.Query().Get("rule_type")
+	}
 	indexStr := r.URL.Query().Get("index")
 	editMode := indexStr != ""
 
@@ -110,10 +223,9 @@ func (s *Server) handleRuleForm(w http.ResponseWriter, r *http.Request) {
 		}
 		ruleIndex = index
 
-		rules, err := s.configManager.GetRules()
+		rules, err := section.rules()
 		if err != nil {
-			log.Printf("Error getting rules: %v", err)
-			http.Error(w, "Failed to get rules", http.StatusInternalServerError)
+			s.renderError(w, r, http.StatusInternalServerError, "Failed to get rules", err)
 			return
 		}
 
@@ -127,93 +239,128 @@ func (s *Server) handleRuleForm(w http.ResponseWriter, r *http.Request) {
 			ruleData = rule
 			// Determine rule type from the rule data if not specified
 			if ruleType == "" {
-				ruleType = s.determineRuleType(rule)
+				ruleType = section.ruleType(rule)
 			}
 		} else {
-			http.Error(w, "Invalid rule format", http.StatusInternalServerError)
+			s.renderError(w, r, http.StatusInternalServerError, "Invalid rule format", fmt.Errorf("rule %d is a %T", index, rules[index]))
 			return
 		}
 	}
 
 	if ruleType == "" {
-		ruleType = "RawDefaultRule" // Default type
+		ruleType = section.Types[0] // Default type
+	}
+	if !contains(section.Types, ruleType) {
+		http.Error(w, fmt.Sprintf("Rule type %s does not belong in this list", ruleType), http.StatusBadRequest)
+		return
 	}
 
 	formDef, err := s.formBuilder.BuildForm(ruleType)
 	if err != nil {
-		log.Printf("Error building form: %v", err)
-		http.Error(w, "Failed to build form", http.StatusInternalServerError)
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to build form", err)
 		return
 	}
 
 	// Populate form with existing values if editing
 	if editMode && ruleData != nil {
+		normalizeListable(ruleData, formDef.ArrayKeys())
 		s.formBuilder.PopulateFormValues(formDef, ruleData)
 	}
 
-	// Get outbounds for dropdown
-	outbounds, err := s.getOutboundTags()
+	// Get outbounds or DNS servers for the target dropdown
+	targets, err := section.targets()
 	if err != nil {
-		log.Printf("Warning: failed to get outbounds: %v", err)
+		requestLogger(r).Warn("failed to get rule targets", "field", section.targetField, "error", err)
 	}
 
-	// Update Outbound field to be a select with outbound options
+	// Update the target field to be a select with the target options
 	for i := range formDef.Fields {
-		if formDef.Fields[i].JSONTag == "outbound" {
-			// If it's an array field (for DNS rules), keep it as array but still show options
+		if formDef.Fields[i].JSONTag == section.targetField {
+			// If it's an array field (the outbound matcher of DNS rules), keep it as array but still show options
 			if formDef.Fields[i].Type != "array" {
 				formDef.Fields[i].Type = "select"
 			}
-			formDef.Fields[i].Options = outbounds
+			formDef.Fields[i].Options = targets
 			break
 		}
 	}
 
 	data := map[string]interface{}{
 		"Form":      formDef,
-		"RuleTypes": s.formBuilder.GetAvailableRuleTypes(),
+		"RuleTypes": section.Types,
+		"Section":   section,
 		"EditMode":  editMode,
 		"RuleIndex": ruleIndex,
 	}
 
 	if err := s.renderTemplate(w, "rule-form.html", data); err != nil {
-		log.Printf("Error rendering template: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to render the page", err)
 	}
 }
 
-// determineRuleType tries to determine the rule type from rule data
-func (s *Server) determineRuleType(rule map[string]interface{}) string {
-	// Check for logical rule
-	if _, hasMode := rule["mode"]; hasMode {
-		if _, hasRules := rule["rules"]; hasRules {
-			// Check if it's DNS or routing
-			if _, hasServer := rule["server"]; hasServer {
-				return "RawLogicalDNSRule"
+// normalizeListable wraps single values of sing-box listable fields, such as
+// "domain": "example.com", in an array so they edit like any other list
+func normalizeListable(rule map[string]interface{}, arrayKeys []string) {
+	for _, key := range arrayKeys {
+		switch value := rule[key].(type) {
+		case nil, []interface{}:
+		case []string:
+			items := make([]interface{}, len(value))
+			for i, item := range value {
+				items[i] = item
 			}
-			return "RawLogicalRule"
+			rule[key] = items
+		default:
+			rule[key] = []interface{}{value}
 		}
 	}
+}
 
-	// Check for rule set
-	if _, hasType := rule["type"]; hasType {
-		if ruleType, ok := rule["type"].(string); ok {
-			if ruleType == "local" {
-				return "LocalRuleSet"
-			}
-			if ruleType == "remote" {
-				return "RemoteRuleSet"
-			}
-		}
+// routeRuleType returns the form type of a route rule
+func routeRuleType(rule map[string]interface{}) string {
+	if isLogicalRule(rule) {
+		return "RawLogicalRule"
 	}
+	return "RawDefaultRule"
+}
 
-	// Check if it's a DNS rule
-	if _, hasServer := rule["server"]; hasServer {
-		return "RawDefaultDNSRule"
+// dnsRuleType returns the form type of a DNS rule
+func dnsRuleType(rule map[string]interface{}) string {
+	if isLogicalRule(rule) {
+		return "RawLogicalDNSRule"
 	}
+	return "RawDefaultDNSRule"
+}
 
-	// Default to regular rule
-	return "RawDefaultRule"
+// isLogicalRule reports whether a route or DNS rule combines sub-rules. The
+// logical rule form has no type field, so a mode with sub-rules marks one too.
+func isLogicalRule(rule map[string]interface{}) bool {
+	if ruleType, _ := rule["type"].(string); ruleType == "logical" {
+		return true
+	}
+	_, hasMode := rule["mode"]
+	_, hasRules := rule["rules"]
+	return hasMode && hasRules
+}
+
+// DefaultFallbackOutbounds are offered as rule targets while the config has
+// no outbounds yet. Block and DNS outbounds are deprecated in favour of the
+// reject and hijack-dns rule actions, so only direct is suggested.
+var DefaultFallbackOutbounds = []string{"direct"}
+
+// SetFallbackOutbounds sets the outbound tags offered while the config has
+// none. An empty list restores the default.
+func (s *Server) SetFallbackOutbounds(tags []string) {
+	var fallback []string
+	for _, tag := range tags {
+		if tag = strings.TrimSpace(tag); tag != "" && !contains(fallback, tag) {
+			fallback = append(fallback, tag)
+		}
+	}
+	if len(fallback) == 0 {
+		fallback = DefaultFallbackOutbounds
+	}
+	s.fallbackOutbounds = fallback
 }
 
 // getOutboundTags retrieves all outbound tags from the config
@@ -232,9 +379,9 @@ func (s *Server) getOutboundTags() ([]string, error) {
 		}
 	}
 
-	// Add some common default outbounds
+	// Suggest the fallback outbounds until the config has its own
 	if len(tags) == 0 {
-		tags = []string{"direct", "block", "dns-out"}
+		tags = append(tags, s.fallbackOutbounds...)
 	}
 
 	return tags, nil
@@ -243,23 +390,40 @@ func (s *Server) getOutboundTags() ([]string, error) {
 // handleRuleCreate handles creating a new rule
 func (s *Server) handleRuleCreate(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(w)
 		return
 	}
 
 	if err := r.ParseForm(); err != nil {
-		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		writeBodyError(w, err, "Failed to parse form")
+		return
+	}
+
+	// DNS rules have their own list, see dnsrules.go
+	if ruleType := r.FormValue("rule_type"); ruleType != "" && !contains(s.formBuilder.GetRouteRuleTypes(), ruleType) {
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, fmt.Sprintf("%s is not a route rule type", ruleType))
 		return
 	}
 
 	// Build rule from form data
 	rule := s.buildRuleFromForm(r)
 
+	// Validate required fields and ports, correcting ranges written with a dash
+	if err := types.ValidateRule(rule); err != nil {
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, err.Error())
+		return
+	}
+	warning, err := checkRulePorts(rule)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, err.Error())
+		return
+	}
+
 	// Get current rules
 	rules, err := s.configManager.GetRules()
 	if err != nil {
-		log.Printf("Error getting rules: %v", err)
-		http.Error(w, "Failed to get rules", http.StatusInternalServerError)
+		requestLogger(r).Error("failed to get rules", "error", err)
+		writeInternalError(w, err, "Failed to get rules")
 		return
 	}
 
@@ -268,45 +432,48 @@ func (s *Server) handleRuleCreate(w http.ResponseWriter, r *http.Request) {
 
 	// Update config
 	if err := s.configManager.UpdateRules(rules); err != nil {
-		log.Printf("Error updating rules: %v", err)
-		http.Error(w, "Failed to save rules", http.StatusInternalServerError)
+		requestLogger(r).Error("failed to update rules", "error", err)
+		writeInternalError(w, err, "Failed to save rules")
 		return
 	}
 
+	noteChange(r, "created route rule #%d", len(rules))
+
 	// Reload service to apply changes
-	if err := s.serviceManager.Reload(); err != nil {
-		log.Printf("Warning: failed to reload service: %v", err)
-	}
+	s.reloadService(r)
 
 	// Return updated rules list
+	if warning != "" {
+		setWarningTrigger(w, "ruleCreated", warning)
+	}
 	s.handleRulesList(w, r)
 }
 
 // handleRuleDelete handles deleting a rule
 func (s *Server) handleRuleDelete(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(w)
 		return
 	}
 
 	indexStr := r.URL.Query().Get("index")
 	index, err := strconv.Atoi(indexStr)
 	if err != nil {
-		http.Error(w, "Invalid index", http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, ErrCodeBadRequest, "Invalid index")
 		return
 	}
 
 	// Get current rules
 	rules, err := s.configManager.GetRules()
 	if err != nil {
-		log.Printf("Error getting rules: %v", err)
-		http.Error(w, "Failed to get rules", http.StatusInternalServerError)
+		requestLogger(r).Error("failed to get rules", "error", err)
+		writeInternalError(w, err, "Failed to get rules")
 		return
 	}
 
 	// Check bounds
 	if index < 0 || index >= len(rules) {
-		http.Error(w, "Index out of range", http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, "Index out of range")
 		return
 	}
 
@@ -315,15 +482,15 @@ func (s *Server) handleRuleDelete(w http.ResponseWriter, r *http.Request) {
 
 	// Update config
 	if err := s.configManager.UpdateRules(rules); err != nil {
-		log.Printf("Error updating rules: %v", err)
-		http.Error(w, "Failed to save rules", http.StatusInternalServerError)
+		requestLogger(r).Error("failed to update rules", "error", err)
+		writeInternalError(w, err, "Failed to save rules")
 		return
 	}
 
+	noteChange(r, "deleted route rule #%d", index+1)
+
 	// Reload service
-	if err := s.serviceManager.Reload(); err != nil {
-		log.Printf("Warning: failed to reload service: %v", err)
-	}
+	s.reloadService(r)
 
 	// Return updated rules list
 	s.handleRulesList(w, r)
@@ -332,36 +499,53 @@ func (s *Server) handleRuleDelete(w http.ResponseWriter, r *http.Request) {
 // handleRuleUpdate handles updating a rule
 func (s *Server) handleRuleUpdate(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost && r.Method != http.MethodPut {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(w)
 		return
 	}
 
 	if err := r.ParseForm(); err != nil {
-		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		writeBodyError(w, err, "Failed to parse form")
 		return
 	}
 
 	indexStr := r.FormValue("index")
 	index, err := strconv.Atoi(indexStr)
 	if err != nil {
-		http.Error(w, "Invalid index", http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, ErrCodeBadRequest, "Invalid index")
+		return
+	}
+
+	// DNS rules have their own list, see dnsrules.go
+	if ruleType := r.FormValue("rule_type"); ruleType != "" && !contains(s.formBuilder.GetRouteRuleTypes(), ruleType) {
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, fmt.Sprintf("%s is not a route rule type", ruleType))
 		return
 	}
 
 	// Build rule from form data
 	rule := s.buildRuleFromForm(r)
 
+	// Validate required fields and ports, correcting ranges written with a dash
+	if err := types.ValidateRule(rule); err != nil {
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, err.Error())
+		return
+	}
+	warning, err := checkRulePorts(rule)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, err.Error())
+		return
+	}
+
 	// Get current rules
 	rules, err := s.configManager.GetRules()
 	if err != nil {
-		log.Printf("Error getting rules: %v", err)
-		http.Error(w, "Failed to get rules", http.StatusInternalServerError)
+		requestLogger(r).Error("failed to get rules", "error", err)
+		writeInternalError(w, err, "Failed to get rules")
 		return
 	}
 
 	// Check bounds
 	if index < 0 || index >= len(rules) {
-		http.Error(w, "Index out of range", http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, "Index out of range")
 		return
 	}
 
@@ -370,29 +554,32 @@ func (s *Server) handleRuleUpdate(w http.ResponseWriter, r *http.Request) {
 
 	// Update config
 	if err := s.configManager.UpdateRules(rules); err != nil {
-		log.Printf("Error updating rules: %v", err)
-		http.Error(w, "Failed to save rules", http.StatusInternalServerError)
+		requestLogger(r).Error("failed to update rules", "error", err)
+		writeInternalError(w, err, "Failed to save rules")
 		return
 	}
 
+	noteChange(r, "updated route rule #%d", index+1)
+
 	// Reload service
-	if err := s.serviceManager.Reload(); err != nil {
-		log.Printf("Warning: failed to reload service: %v", err)
-	}
+	s.reloadService(r)
 
 	// Return updated rules list
+	if warning != "" {
+		setWarningTrigger(w, "ruleUpdated", warning)
+	}
 	s.handleRulesList(w, r)
 }
 
 // handleRuleReorder handles reordering rules via drag and drop
 func (s *Server) handleRuleReorder(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(w)
 		return
 	}
 
 	if err := r.ParseForm(); err != nil {
-		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		writeBodyError(w, err, "Failed to parse form")
 		return
 	}
 
@@ -401,63 +588,185 @@ func (s *Server) handleRuleReorder(w http.ResponseWriter, r *http.Request) {
 
 	fromIndex, err := strconv.Atoi(fromStr)
 	if err != nil {
-		http.Error(w, "Invalid from index", http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, ErrCodeBadRequest, "Invalid from index")
 		return
 	}
 
 	toIndex, err := strconv.Atoi(toStr)
 	if err != nil {
-		http.Error(w, "Invalid to index", http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, ErrCodeBadRequest, "Invalid to index")
 		return
 	}
 
 	// Get current rules
 	rules, err := s.configManager.GetRules()
 	if err != nil {
-		log.Printf("Error getting rules: %v", err)
-		http.Error(w, "Failed to get rules", http.StatusInternalServerError)
+		requestLogger(r).Error("failed to get rules", "error", err)
+		writeInternalError(w, err, "Failed to get rules")
 		return
 	}
 
+	// The indexes refer to the list the client saw. A different rule count
+	// means it changed since, so moving by index would reorder the wrong
+	// rules; send the current list back instead.
+	if countStr := r.FormValue("count"); countStr != "" {
+		count, err := strconv.Atoi(countStr)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, ErrCodeBadRequest, "Invalid count")
+			return
+		}
+		if count != len(rules) {
+			requestLogger(r).Info("rejected reorder of a stale rule list", "count", count, "current", len(rules))
+			message := "Rules changed since the list was loaded; reorder again on the refreshed list"
+			if r.Header.Get("HX-Request") != "true" {
+				writeAPIError(w, http.StatusConflict, &APIError{Code: ErrCodeConflict, Message: message, Details: map[string]interface{}{"rules": rules}})
+				return
+			}
+			w.WriteHeader(http.StatusConflict)
+			s.handleRulesList(w, r)
+			return
+		}
+	}
+
 	// Check bounds
 	if fromIndex < 0 || fromIndex >= len(rules) || toIndex < 0 || toIndex >= len(rules) {
-		http.Error(w, "Index out of range", http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, "Index out of range")
 		return
 	}
 
-	// Reorder rules
-	rule := rules[fromIndex]
-	rules = append(rules[:fromIndex], rules[fromIndex+1:]...)
-
-	// Insert at new position
+	// Dropping onto a later rule places the dragged rule just before it
 	if toIndex > fromIndex {
 		toIndex--
 	}
-
-	newRules := make([]interface{}, 0, len(rules)+1)
-	newRules = append(newRules, rules[:toIndex]...)
-	newRules = append(newRules, rule)
-	newRules = append(newRules, rules[toIndex:]...)
+	rules = moveSlice(rules, fromIndex, toIndex)
 
 	// Update config
-	if err := s.configManager.UpdateRules(newRules); err != nil {
-		log.Printf("Error updating rules: %v", err)
-		http.Error(w, "Failed to save rules", http.StatusInternalServerError)
+	if err := s.configManager.UpdateRules(rules); err != nil {
+		requestLogger(r).Error("failed to update rules", "error", err)
+		writeInternalError(w, err, "Failed to save rules")
 		return
 	}
 
+	noteChange(r, "moved route rule #%d to #%d", fromIndex+1, toIndex+1)
+
 	// Reload service
-	if err := s.serviceManager.Reload(); err != nil {
-		log.Printf("Warning: failed to reload service: %v", err)
+	s.reloadService(r)
+
+	// Return updated rules list
+	s.handleRulesList(w, r)
+}
+
+// handleRuleMove moves a single rule to the top, the bottom, or an explicit index.
+// Since sing-box evaluates rules in order and the first match wins, this gives
+// keyboard and script users a way to reposition a rule without drag and drop.
+func (s *Server) handleRuleMove(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		writeBodyError(w, err, "Failed to parse form")
+		return
+	}
+
+	index, err := strconv.Atoi(r.FormValue("index"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, ErrCodeBadRequest, "Invalid index")
+		return
+	}
+
+	position := strings.TrimSpace(r.FormValue("position"))
+	if position == "" {
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, "Missing position")
+		return
+	}
+
+	// Get current rules
+	rules, err := s.configManager.GetRules()
+	if err != nil {
+		requestLogger(r).Error("failed to get rules", "error", err)
+		writeInternalError(w, err, "Failed to get rules")
+		return
+	}
+
+	// Check bounds
+	if index < 0 || index >= len(rules) {
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, "Index out of range")
+		return
+	}
+
+	target, err := resolveMovePosition(position, len(rules))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, err.Error())
+		return
+	}
+
+	if target != index {
+		rules = moveSlice(rules, index, target)
+
+		// Update config
+		if err := s.configManager.UpdateRules(rules); err != nil {
+			requestLogger(r).Error("failed to update rules", "error", err)
+			writeInternalError(w, err, "Failed to save rules")
+			return
+		}
+
+		noteChange(r, "moved route rule #%d to #%d", index+1, target+1)
+
+		// Reload service
+		s.reloadService(r)
 	}
 
 	// Return updated rules list
 	s.handleRulesList(w, r)
 }
 
-// buildRuleFromForm builds a rule map from form data
+// resolveMovePosition converts a move position ("top", "bottom" or a numeric
+// index) into a destination index for a list of the given length.
+func resolveMovePosition(position string, length int) (int, error) {
+	switch strings.ToLower(position) {
+	case "top":
+		return 0, nil
+	case "bottom":
+		return length - 1, nil
+	}
+
+	target, err := strconv.Atoi(position)
+	if err != nil {
+		return 0, fmt.Errorf("invalid position %q: expected top, bottom or an index", position)
+	}
+	if target < 0 || target >= length {
+		return 0, fmt.Errorf("position %d out of range", target)
+	}
+	return target, nil
+}
+
+// moveSlice moves the element at index from so that it ends up at index to,
+// shifting the elements in between. Both indices must be within bounds.
+func moveSlice(items []interface{}, from, to int) []interface{} {
+	if from == to {
+		return items
+	}
+
+	item := items[from]
+	if from < to {
+		copy(items[from:to], items[from+1:to+1])
+	} else {
+		copy(items[to+1:from+1], items[to:from])
+	}
+	items[to] = item
+	return items
+}
+
+// buildRuleFromForm builds a rule map from form data.
+// Array fields are submitted as repeated "name[]" inputs and every input is kept
+// as one value, so values containing commas (regex quantifiers, header values)
+// are preserved. For older clients, a plain "name" field holding a comma list is
+// still split when the rule type declares that field as an array.
 func (s *Server) buildRuleFromForm(r *http.Request) map[string]interface{} {
 	rule := make(map[string]interface{})
+	legacyArrays := s.ruleArrayFields(r.FormValue("rule_type"))
 
 	for key, values := range r.Form {
 		if key == "index" || key == "rule_type" {
@@ -465,21 +774,16 @@ func (s *Server) buildRuleFromForm(r *http.Request) map[string]interface{} {
 		}
 
 		if strings.HasSuffix(key, "[]") {
-			fieldName := strings.TrimSuffix(key, "[]")
-
-			var collectedValues []string
-			for _, v := range values {
-				parts := strings.Split(v, ",")
-				for _, part := range parts {
-					trimmedPart := strings.TrimSpace(part)
-					if trimmedPart != "" {
-						collectedValues = append(collectedValues, trimmedPart)
-					}
-				}
+			if items := collectArrayValues(values); len(items) > 0 {
+				rule[strings.TrimSuffix(key, "[]")] = items
 			}
-
-			if len(collectedValues) > 0 {
-				rule[fieldName] = collectedValues
+		} else if legacyArrays[key] {
+			// Discrete inputs take precedence over a legacy comma list
+			if _, ok := r.Form[key+"[]"]; ok {
+				continue
+			}
+			if items := splitLegacyArrayValues(key, values); len(items) > 0 {
+				rule[key] = items
 			}
 		} else {
 			// Handle single value fields
@@ -492,13 +796,58 @@ func (s *Server) buildRuleFromForm(r *http.Request) map[string]interface{} {
 	return rule
 }
 
+// ruleArrayFields returns the JSON names of the array fields of a rule type.
+// An empty type falls back to the default rule, matching the rule form.
+func (s *Server) ruleArrayFields(ruleType string) map[string]bool {
+	if ruleType == "" {
+		ruleType = "RawDefaultRule"
+	}
+
+	fields := make(map[string]bool)
+	formDef, err := s.formBuilder.BuildForm(ruleType)
+	if err != nil {
+		return fields
+	}
+	for _, field := range formDef.Fields {
+		if field.Type == forms.FieldTypeArray {
+			fields[field.JSONTag] = true
+		}
+	}
+	return fields
+}
+
+// collectArrayValues returns the trimmed, non-empty values of repeated form
+// inputs, treating each input as exactly one array element.
+func collectArrayValues(values []string) []string {
+	var items []string
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			items = append(items, v)
+		}
+	}
+	return items
+}
+
+// splitLegacyArrayValues splits single-field comma lists submitted by older
+// clients into array elements. Regex fields such as domain_regex aren't
+// split, since a comma in a regex like a{1,3} is part of it.
+func splitLegacyArrayValues(field string, values []string) []string {
+	if strings.HasSuffix(field, "_regex") {
+		return collectArrayValues(values)
+	}
+	var items []string
+	for _, v := range values {
+		items = append(items, collectArrayValues(strings.Split(v, ","))...)
+	}
+	return items
+}
+
 // Service management handlers
 
 func (s *Server) handleServiceStatus(w http.ResponseWriter, r *http.Request) {
-	status, err := s.serviceManager.GetStatus()
+	status, err := s.serviceManager.GetStatus(r.Context())
 	if err != nil {
-		log.Printf("Error getting service status: %v", err)
-		http.Error(w, "Failed to get service status", http.StatusInternalServerError)
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to get service status", err)
 		return
 	}
 
@@ -507,68 +856,107 @@ func (s *Server) handleServiceStatus(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := s.renderTemplate(w, "service-status.html", data); err != nil {
-		log.Printf("Error rendering template: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to render the page", err)
 	}
 }
 
 func (s *Server) handleServiceStart(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(w)
 		return
 	}
 
-	if err := s.serviceManager.Start(); err != nil {
-		log.Printf("Error starting service: %v", err)
-		http.Error(w, fmt.Sprintf("Failed to start service: %v", err), http.StatusInternalServerError)
+	if err := s.serviceManager.Start(r.Context()); err != nil {
+		requestLogger(r).Error("failed to start service", "error", err)
+		writeInternalError(w, err, fmt.Sprintf("Failed to start service: %v", err))
 		return
 	}
+	// A fresh start loads the config file as it is now
+	s.markConfigApplied(r)
+	noteChange(r, "started sing-box")
 
 	s.handleServiceStatus(w, r)
 }
 
 func (s *Server) handleServiceStop(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(w)
 		return
 	}
 
-	if err := s.serviceManager.Stop(); err != nil {
-		log.Printf("Error stopping service: %v", err)
-		http.Error(w, fmt.Sprintf("Failed to stop service: %v", err), http.StatusInternalServerError)
+	if err := s.serviceManager.Stop(r.Context()); err != nil {
+		requestLogger(r).Error("failed to stop service", "error", err)
+		writeInternalError(w, err, fmt.Sprintf("Failed to stop service: %v", err))
 		return
 	}
+	noteChange(r, "stopped sing-box")
 
 	s.handleServiceStatus(w, r)
 }
 
 func (s *Server) handleServiceRestart(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(w)
 		return
 	}
 
-	if err := s.serviceManager.Restart(); err != nil {
-		log.Printf("Error restarting service: %v", err)
-		http.Error(w, fmt.Sprintf("Failed to restart service: %v", err), http.StatusInternalServerError)
+	if err := s.serviceManager.Restart(r.Context()); err != nil {
+		requestLogger(r).Error("failed to restart service", "error", err)
+		writeInternalError(w, err, fmt.Sprintf("Failed to restart service: %v", err))
 		return
 	}
+	// A fresh start loads the config file as it is now
+	s.markConfigApplied(r)
+	noteChange(r, "restarted sing-box")
 
 	s.handleServiceStatus(w, r)
 }
 
-func (s *Server) handleServiceLogs(w http.ResponseWriter, r *http.Request) {
-	lines := 100
-	if linesStr := r.URL.Query().Get("lines"); linesStr != "" {
-		if l, err := strconv.Atoi(linesStr); err == nil {
-			lines = l
-		}
+// handleServiceEnable makes the service start on boot
+func (s *Server) handleServiceEnable(w http.ResponseWriter, r *http.Request) {
+	s.setServiceEnabled(w, r, true)
+}
+
+// handleServiceDisable stops the service from starting on boot
+func (s *Server) handleServiceDisable(w http.ResponseWriter, r *http.Request) {
+	s.setServiceEnabled(w, r, false)
+}
+
+// setServiceEnabled enables or disables the service and renders the
+// refreshed status
+func (s *Server) setServiceEnabled(w http.ResponseWriter, r *http.Request, enabled bool) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	action, change := "enable", s.serviceManager.Enable
+	if !enabled {
+		action, change = "disable", s.serviceManager.Disable
+	}
+
+	if err := change(r.Context()); err != nil {
+		requestLogger(r).Error("failed to "+action+" service", "error", err)
+		writeInternalError(w, err, fmt.Sprintf("Failed to %s service: %v", action, err))
+		return
 	}
+	noteChange(r, "%sd starting sing-box on boot", action)
+
+	s.handleServiceStatus(w, r)
+}
+
+// Bounds of the lines parameter of the service logs
+const (
+	defaultLogLines = 100
+	maxLogLines     = 5000
+)
+
+func (s *Server) handleServiceLogs(w http.ResponseWriter, r *http.Request) {
+	lines := logLines(r.URL.Query().Get("lines"))
 
-	logs, err := s.serviceManager.GetLogs(lines)
+	logs, err := s.serviceManager.GetLogs(r.Context(), lines)
 	if err != nil {
-		log.Printf("Error getting service logs: %v", err)
-		http.Error(w, "Failed to get service logs", http.StatusInternalServerError)
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to get service logs", err)
 		return
 	}
 
@@ -577,78 +965,358 @@ func (s *Server) handleServiceLogs(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := s.renderTemplate(w, "service-logs.html", data); err != nil {
-		log.Printf("Error rendering template: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to render the page", err)
 	}
 }
 
+// logLines reads the lines parameter of the service logs. "all" means the
+// most allowed, anything that isn't a number the default, and numbers are
+// clamped to 1 through maxLogLines so journalctl never dumps the journal.
+func logLines(value string) int {
+	if value == "all" {
+		return maxLogLines
+	}
+	lines, err := strconv.Atoi(value)
+	if err != nil {
+		return defaultLogLines
+	}
+	return min(max(lines, 1), maxLogLines)
+}
+
 // Config management handlers
 
 func (s *Server) handleConfigExport(w http.ResponseWriter, r *http.Request) {
 	config, err := s.configManager.LoadConfig()
 	if err != nil {
-		log.Printf("Error loading config: %v", err)
-		http.Error(w, "Failed to load config", http.StatusInternalServerError)
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to load config", err)
+		return
+	}
+
+	// MarshalConfig keeps fields the generated types don't know about
+	data, err := s.configManager.MarshalConfig(config)
+	if err != nil {
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to export config", err)
+		return
+	}
+
+	// format selects the output: compact (default), pretty, or singbox for
+	// the canonical output of `sing-box format`
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "compact":
+		data, err = compactJSON(data)
+	case "pretty":
+	case "singbox":
+		data, err = s.serviceManager.FormatConfig(r.Context(), data)
+		if err != nil {
+			requestLogger(r).Error("failed to format config with sing-box", "error", err)
+			http.Error(w, "Failed to format config with sing-box: "+err.Error(), http.StatusBadGateway)
+			return
+		}
+	default:
+		http.Error(w, fmt.Sprintf("Unknown format %q (expected compact, pretty or singbox)", format), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to export config", err)
 		return
 	}
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		data = append(data, '\n')
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Content-Disposition", "attachment; filename=sing-box-config.json")
+	w.Write(data)
+}
 
-	if err := json.NewEncoder(w).Encode(config); err != nil {
-		log.Printf("Error encoding config: %v", err)
-		http.Error(w, "Failed to export config", http.StatusInternalServerError)
+// compactJSON removes insignificant whitespace from JSON
+func compactJSON(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, data); err != nil {
+		return nil, err
 	}
+	return buf.Bytes(), nil
 }
 
+// defaultBackupPageSize is how many backups a page of the backup list shows
+// unless "limit" says otherwise
+const defaultBackupPageSize = 20
+
+// maxBackupPageSize caps the "limit" of the backup list
+const maxBackupPageSize = 100
+
+// backupPageChanges is how many change log entries the backup list shows
+const backupPageChanges = 10
+
+// handleConfigBackups renders a page of the backup list, newest first. The
+// 1-based "page" and the page size "limit" come from the query or, after a
+// backup action, the posted form.
 func (s *Server) handleConfigBackups(w http.ResponseWriter, r *http.Request) {
-	backups, err := s.configManager.ListBackups()
+	page, limit, err := backupPageParams(r)
+	if err != nil {
+		s.renderError(w, r, http.StatusBadRequest, "Invalid page or limit", err)
+		return
+	}
+
+	backups, total, err := s.configManager.ListBackupsPaged((page-1)*limit, limit)
 	if err != nil {
-		log.Printf("Error listing backups: %v", err)
-		http.Error(w, "Failed to list backups", http.StatusInternalServerError)
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to list backups", err)
 		return
 	}
 
+	// A page past the end, such as after the last backup on it went away,
+	// shows the last page instead
+	pages := (total + limit - 1) / limit
+	if page > pages && pages > 0 {
+		page = pages
+		backups, total, err = s.configManager.ListBackupsPaged((page-1)*limit, limit)
+		if err != nil {
+			s.renderError(w, r, http.StatusInternalServerError, "Failed to list backups", err)
+			return
+		}
+	}
+
 	data := map[string]interface{}{
 		"Backups": backups,
+		"Page":    page,
+		"Pages":   pages,
+		"Limit":   limit,
+		"Total":   total,
+		"First":   (page-1)*limit + 1,
+		"Last":    (page-1)*limit + len(backups),
+	}
+
+	// Show what the edits between the backups were for
+	if changes, err := s.configManager.RecentChanges(backupPageChanges); err != nil {
+		requestLogger(r).Warn("failed to read change log", "error", err)
+	} else {
+		data["Changes"] = changes
 	}
 
 	if err := s.renderTemplate(w, "config-backups.html", data); err != nil {
-		log.Printf("Error rendering template: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to render the page", err)
+	}
+}
+
+// backupPageParams reads the backup list's "page" and "limit", defaulting
+// to the first page of defaultBackupPageSize
+func backupPageParams(r *http.Request) (page, limit int, err error) {
+	page, limit = 1, defaultBackupPageSize
+	if value := r.FormValue("page"); value != "" {
+		page, err = strconv.Atoi(value)
+		if err != nil || page < 1 {
+			return 0, 0, fmt.Errorf("invalid page %q", value)
+		}
+	}
+	if value := r.FormValue("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxBackupPageSize {
+			return 0, 0, fmt.Errorf("invalid limit %q (expected 1 to %d)", value, maxBackupPageSize)
+		}
 	}
+	return page, limit, nil
+}
+
+// handleConfigBackupDownload downloads a backup as JSON, decompressing
+// gzipped backups
+func (s *Server) handleConfigBackupDownload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	backupName := r.URL.Query().Get("name")
+	if backupName == "" {
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, "No backup specified")
+		return
+	}
+
+	data, err := s.configManager.ReadBackup(backupName)
+	switch {
+	case errors.Is(err, config.ErrInvalidBackupName):
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, err.Error())
+		return
+	case errors.Is(err, fs.ErrNotExist):
+		writeJSONError(w, http.StatusNotFound, ErrCodeNotFound, "Backup not found")
+		return
+	case err != nil:
+		requestLogger(r).Error("failed to read backup", "error", err)
+		writeInternalError(w, err, fmt.Sprintf("Failed to read backup: %v", err))
+		return
+	}
+
+	filename := strings.TrimSuffix(backupName, ".gz")
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Write(data)
 }
 
 func (s *Server) handleConfigRestore(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(w)
 		return
 	}
 
 	backupName := r.FormValue("backup")
 	if backupName == "" {
-		http.Error(w, "No backup specified", http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, "No backup specified")
 		return
 	}
 
 	if err := s.configManager.RestoreBackup(backupName); err != nil {
-		log.Printf("Error restoring backup: %v", err)
-		http.Error(w, fmt.Sprintf("Failed to restore backup: %v", err), http.StatusInternalServerError)
+		requestLogger(r).Error("failed to restore backup", "error", err)
+		writeInternalError(w, err, fmt.Sprintf("Failed to restore backup: %v", err))
 		return
 	}
 
+	noteChange(r, "restored backup %s", backupName)
+
 	// Reload service
-	if err := s.serviceManager.Reload(); err != nil {
-		log.Printf("Warning: failed to reload service: %v", err)
+	s.reloadService(r)
+
+	w.Header().Set("HX-Redirect", "/rules")
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleConfigUpload replaces the current config with an uploaded file after
+// checking that it parses and that sing-box accepts it
+func (s *Server) handleConfigUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
 	}
 
+	if err := r.ParseMultipartForm(1 << 20); err != nil {
+		writeBodyError(w, err, "Failed to parse upload")
+		return
+	}
+
+	file, header, err := r.FormFile("config")
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, "No config file uploaded")
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		writeBodyError(w, err, "Failed to read upload")
+		return
+	}
+
+	var config types.Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		reason := "is not a valid sing-box config"
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			reason = "is not valid JSON"
+		}
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation,
+			fmt.Sprintf("%s %s: %s", header.Filename, reason, describeJSONError(data, err)))
+		return
+	}
+
+	if err := s.serviceManager.CheckConfig(r.Context(), data); err != nil {
+		if !errors.Is(err, service.ErrBinaryNotFound) {
+			writeJSONError(w, http.StatusUnprocessableEntity, ErrCodeValidation, "sing-box check failed: "+err.Error())
+			return
+		}
+		requestLogger(r).Warn("skipping sing-box check of uploaded config", "error", err)
+	}
+
+	if err := s.configManager.ImportConfig(data); err != nil {
+		requestLogger(r).Error("failed to import config", "error", err)
+		writeInternalError(w, err, fmt.Sprintf("Failed to import config: %v", err))
+		return
+	}
+
+	requestLogger(r).Info("imported uploaded config", "file", header.Filename, "bytes", len(data))
+
+	noteChange(r, "imported uploaded config %s", header.Filename)
+
+	// Reload service
+	s.reloadService(r)
+
 	w.Header().Set("HX-Redirect", "/rules")
 	w.WriteHeader(http.StatusOK)
 }
 
+// ConfigNormalizeResponse is a config in sing-box's canonical form along
+// with the warnings sing-box logged about it
+type ConfigNormalizeResponse struct {
+	Config   string                  `json:"config"`
+	Warnings []service.ConfigWarning `json:"warnings"`
+}
+
+// handleConfigNormalize runs a JSON config from the request body through
+// `sing-box format` without saving it, returning the canonical form and any
+// deprecation or other warnings sing-box reports
+func (s *Server) handleConfigNormalize(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeBodyError(w, err, "Failed to read request body")
+		return
+	}
+
+	var config interface{}
+	if err := json.Unmarshal(data, &config); err != nil {
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, "Config is not valid JSON: "+describeJSONError(data, err))
+		return
+	}
+
+	normalized, warnings, err := s.serviceManager.NormalizeConfig(r.Context(), data)
+	if errors.Is(err, service.ErrBinaryNotFound) {
+		writeJSONError(w, http.StatusNotImplemented, ErrCodeNotImplemented, "Cannot normalize config: "+err.Error())
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusUnprocessableEntity, ErrCodeValidation, "sing-box rejected the config: "+err.Error())
+		return
+	}
+
+	response := ConfigNormalizeResponse{
+		Config:   string(normalized),
+		Warnings: warnings,
+	}
+	if response.Warnings == nil {
+		response.Warnings = []service.ConfigWarning{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// describeJSONError adds the line and column to JSON decoding errors that
+// carry an input offset
+func describeJSONError(data []byte, err error) string {
+	var offset int64
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		offset = syntaxErr.Offset
+	case errors.As(err, &typeErr):
+		offset = typeErr.Offset
+	default:
+		return err.Error()
+	}
+
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	line := 1 + bytes.Count(data[:offset], []byte("\n"))
+	column := int(offset) - bytes.LastIndexByte(data[:offset], '\n')
+	return fmt.Sprintf("%v (line %d, column %d)", err, line, column)
+}
+
 func (s *Server) handleConfigCreateBackup(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(w)
 		return
 	}
 
@@ -662,54 +1330,83 @@ func (s *Server) handleConfigCreateBackup(w http.ResponseWriter, r *http.Request
 		description = "Manual backup created by user"
 	}
 
-	if err := s.configManager.CreateBackupWithName(name, description); err != nil {
-		log.Printf("Error creating backup: %v", err)
-		http.Error(w, fmt.Sprintf("Failed to create backup: %v", err), http.StatusInternalServerError)
+	created, err := s.configManager.CreateBackupWithName(name, description)
+	if err != nil {
+		requestLogger(r).Error("failed to create backup", "error", err)
+		writeInternalError(w, err, fmt.Sprintf("Failed to create backup: %v", err))
+		return
+	}
+	// Return updated backup list
+	if created {
+		w.Header().Set("HX-Trigger", "backupCreated")
+	} else {
+		w.Header().Set("HX-Trigger", "backupSkipped")
+	}
+	s.handleConfigBackups(w, r)
+}
+
+func (s *Server) handleConfigBackupPin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	backupName := r.FormValue("backup")
+	if backupName == "" {
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, "No backup specified")
+		return
+	}
+
+	var err error
+	if r.FormValue("pinned") == "false" {
+		err = s.configManager.UnpinBackup(backupName)
+	} else {
+		err = s.configManager.PinBackup(backupName)
+	}
+	if err != nil {
+		requestLogger(r).Error("failed to update backup pin", "error", err)
+		writeInternalError(w, err, fmt.Sprintf("Failed to update backup: %v", err))
 		return
 	}
 
 	// Return updated backup list
-	w.Header().Set("HX-Trigger", "backupCreated")
 	s.handleConfigBackups(w, r)
 }
 
-// Rule Actions Management
+func (s *Server) handleConfigBackupDescribe(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	backupName := r.FormValue("backup")
+	if backupName == "" {
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, "No backup specified")
+		return
+	}
 
-type RuleActionData struct {
-	Type                      string
-	Outbound                  string
-	Sniffer                   []string
-	Timeout                   uint32
-	Server                    string
-	Strategy                  string
-	DisableCache              bool
-	RewriteTTL                *uint32
-	ClientSubnet              *string
-	Method                    string
-	NoDrop                    bool
-	OverrideAddress           string
-	OverridePort              uint16
-	NetworkStrategy           *string
-	FallbackDelay             uint32
-	UDPDisableDomainUnmapping bool
-	UDPConnect                bool
-	UDPTimeout                uint32
-	TLSFragment               bool
-	TLSFragmentFallbackDelay  uint32
-	TLSRecordFragment         bool
-	Config                    map[string]interface{}
+	if err := s.configManager.UpdateBackupDescription(backupName, r.FormValue("description")); err != nil {
+		requestLogger(r).Error("failed to update backup description", "error", err)
+		writeInternalError(w, err, fmt.Sprintf("Failed to update backup: %v", err))
+		return
+	}
+
+	// Return updated backup list
+	s.handleConfigBackups(w, r)
 }
 
+// Rule Actions Management
+
 // handleRuleActionsPage handles the rule actions management page
 func (s *Server) handleRuleActionsPage(w http.ResponseWriter, r *http.Request) {
 	data := PageData{
-		Title: "Rule Actions",
-		Data:  map[string]interface{}{},
+		Title:    "Rule Actions",
+		ReadOnly: s.readOnly,
+		Data:     map[string]interface{}{},
 	}
 
 	if err := s.renderTemplate(w, "rule-actions.html", data); err != nil {
-		log.Printf("Error rendering template: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to render the page", err)
 	}
 }
 
@@ -721,227 +1418,82 @@ func (s *Server) handleRuleActionsList(w http.ResponseWriter, r *http.Request) {
 	http.Error(w, "NOT IMPLEMENTED: rule_action field doesn't exist in current sing-box schema", http.StatusNotImplemented)
 }
 
-// parseRuleAction parses a rule action from config
-func (s *Server) parseRuleAction(actionMap map[string]interface{}) RuleActionData {
-	action := RuleActionData{
-		Config: actionMap,
+// handleRuleActionForm handles showing the rule action form
+// Fields are generated from the route action option types for the selected action
+func (s *Server) handleRuleActionForm(w http.ResponseWriter, r *http.Request) {
+	actionType := r.URL.Query().Get("action")
+	if actionType == "" {
+		actionType = "route" // Default action
 	}
 
-	// Get action type
-	if actionType, ok := actionMap["action"].(string); ok {
-		action.Type = actionType
+	formDef, err := s.formBuilder.BuildActionForm(actionType)
+	if err != nil {
+		requestLogger(r).Error("failed to build action form", "error", err)
+		http.Error(w, "Failed to build form", http.StatusBadRequest)
+		return
 	}
 
-	// Parse based on type
-	if outbound, ok := actionMap["outbound"].(string); ok {
-		action.Outbound = outbound
+	// Get outbounds for dropdown
+	outbounds, err := s.getOutboundTags()
+	if err != nil {
+		requestLogger(r).Warn("failed to get outbounds", "error", err)
 	}
-	if sniffer, ok := actionMap["sniffer"].([]interface{}); ok {
-		for _, s := range sniffer {
-			if str, ok := s.(string); ok {
-				action.Sniffer = append(action.Sniffer, str)
-			}
+
+	for i := range formDef.Fields {
+		if formDef.Fields[i].JSONTag == "outbound" {
+			formDef.Fields[i].Type = "select"
+			formDef.Fields[i].Options = outbounds
+			break
 		}
 	}
-	if timeout, ok := actionMap["timeout"].(float64); ok {
-		action.Timeout = uint32(timeout)
-	}
-	if server, ok := actionMap["server"].(string); ok {
-		action.Server = server
-	}
-	if strategy, ok := actionMap["strategy"].(string); ok {
-		action.Strategy = strategy
-	}
-	if disableCache, ok := actionMap["disable_cache"].(bool); ok {
-		action.DisableCache = disableCache
-	}
-	if method, ok := actionMap["method"].(string); ok {
-		action.Method = method
-	}
-	if noDrop, ok := actionMap["no_drop"].(bool); ok {
-		action.NoDrop = noDrop
-	}
-	if overrideAddress, ok := actionMap["override_address"].(string); ok {
-		action.OverrideAddress = overrideAddress
-	}
-	if overridePort, ok := actionMap["override_port"].(float64); ok {
-		action.OverridePort = uint16(overridePort)
-	}
-	if udpConnect, ok := actionMap["udp_connect"].(bool); ok {
-		action.UDPConnect = udpConnect
-	}
-	if tlsFragment, ok := actionMap["tls_fragment"].(bool); ok {
-		action.TLSFragment = tlsFragment
-	}
-	if tlsRecordFragment, ok := actionMap["tls_record_fragment"].(bool); ok {
-		action.TLSRecordFragment = tlsRecordFragment
-	}
-	if fallbackDelay, ok := actionMap["fallback_delay"].(float64); ok {
-		action.FallbackDelay = uint32(fallbackDelay)
-	}
-	if udpTimeout, ok := actionMap["udp_timeout"].(float64); ok {
-		action.UDPTimeout = uint32(udpTimeout)
-	}
-	if udpDisableDomainUnmapping, ok := actionMap["udp_disable_domain_unmapping"].(bool); ok {
-		action.UDPDisableDomainUnmapping = udpDisableDomainUnmapping
-	}
-	if tlsFragmentFallbackDelay, ok := actionMap["tls_fragment_fallback_delay"].(float64); ok {
-		action.TLSFragmentFallbackDelay = uint32(tlsFragmentFallbackDelay)
-	}
-	// Handle pointer fields
-	if networkStrategy, ok := actionMap["network_strategy"].(string); ok && networkStrategy != "" {
-		action.NetworkStrategy = &networkStrategy
-	}
-	if clientSubnet, ok := actionMap["client_subnet"].(string); ok && clientSubnet != "" {
-		action.ClientSubnet = &clientSubnet
-	}
-	if rewriteTTL, ok := actionMap["rewrite_ttl"].(float64); ok {
-		ttl := uint32(rewriteTTL)
-		action.RewriteTTL = &ttl
-	}
 
-	return action
-}
+	data := map[string]interface{}{
+		"Form":        formDef,
+		"ActionTypes": s.formBuilder.GetAvailableActionTypes(),
+		"Action":      actionType,
+		"EditMode":    false,
+	}
 
-// handleRuleActionForm handles showing the rule action form
-// NOTE: route.rule_action field doesn't exist in current sing-box schema
-func (s *Server) handleRuleActionForm(w http.ResponseWriter, r *http.Request) {
-	// NOT IMPLEMENTED: route.rule_action field doesn't exist in the current sing-box schema
-	// Rule action functionality needs to be reimplemented using the current sing-box model
-	http.Error(w, "NOT IMPLEMENTED: rule_action field doesn't exist in current sing-box schema", http.StatusNotImplemented)
+	if err := s.renderTemplate(w, "rule-action-form.html", data); err != nil {
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to render the page", err)
+	}
 }
 
 // handleRuleActionCreate handles creating a new rule action
 // NOTE: route.rule_action field doesn't exist in current sing-box schema
 func (s *Server) handleRuleActionCreate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+
 	// NOT IMPLEMENTED: route.rule_action field doesn't exist in the current sing-box schema
 	// Rule action functionality needs to be reimplemented using the current sing-box model
-	http.Error(w, "NOT IMPLEMENTED: rule_action field doesn't exist in current sing-box schema", http.StatusNotImplemented)
+	writeJSONError(w, http.StatusNotImplemented, ErrCodeNotImplemented, "NOT IMPLEMENTED: rule_action field doesn't exist in current sing-box schema")
 }
 
 // handleRuleActionUpdate handles updating an existing rule action
 // NOTE: route.rule_action field doesn't exist in current sing-box schema
 func (s *Server) handleRuleActionUpdate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+
 	// NOT IMPLEMENTED: route.rule_action field doesn't exist in the current sing-box schema
 	// Rule action functionality needs to be reimplemented using the current sing-box model
-	http.Error(w, "NOT IMPLEMENTED: rule_action field doesn't exist in current sing-box schema", http.StatusNotImplemented)
+	writeJSONError(w, http.StatusNotImplemented, ErrCodeNotImplemented, "NOT IMPLEMENTED: rule_action field doesn't exist in current sing-box schema")
 }
 
 // handleRuleActionDelete handles deleting a rule action
 // NOTE: route.rule_action field doesn't exist in current sing-box schema
 func (s *Server) handleRuleActionDelete(w http.ResponseWriter, r *http.Request) {
-	// NOT IMPLEMENTED: route.rule_action field doesn't exist in the current sing-box schema
-	// Rule action functionality needs to be reimplemented using the current sing-box model
-	http.Error(w, "NOT IMPLEMENTED: rule_action field doesn't exist in current sing-box schema", http.StatusNotImplemented)
-}
-
-// buildRuleActionFromForm builds a rule action map from form data
-func (s *Server) buildRuleActionFromForm(r *http.Request) map[string]interface{} {
-	action := make(map[string]interface{})
-
-	// Get action type
-	actionType := r.FormValue("action")
-	if actionType != "" {
-		action["action"] = actionType
-	}
-
-	// Add fields based on action type
-	switch actionType {
-	case "route":
-		if outbound := r.FormValue("outbound"); outbound != "" {
-			action["outbound"] = outbound
-		}
-
-	case "sniff":
-		if sniffers := r.Form["sniffer[]"]; len(sniffers) > 0 {
-			var validSniffers []string
-			for _, s := range sniffers {
-				s = strings.TrimSpace(s)
-				if s != "" {
-					validSniffers = append(validSniffers, s)
-				}
-			}
-			if len(validSniffers) > 0 {
-				action["sniffer"] = validSniffers
-			}
-		}
-		if timeout := r.FormValue("timeout"); timeout != "" {
-			if val, err := strconv.ParseUint(timeout, 10, 32); err == nil {
-				action["timeout"] = uint32(val)
-			}
-		}
-
-	case "resolve":
-		if server := r.FormValue("server"); server != "" {
-			action["server"] = server
-		}
-		if strategy := r.FormValue("strategy"); strategy != "" {
-			action["strategy"] = strategy
-		}
-		if r.FormValue("disable_cache") == "on" {
-			action["disable_cache"] = true
-		}
-		if rewriteTTL := r.FormValue("rewrite_ttl"); rewriteTTL != "" {
-			if val, err := strconv.ParseUint(rewriteTTL, 10, 32); err == nil {
-				ttl := uint32(val)
-				action["rewrite_ttl"] = &ttl
-			}
-		}
-		if clientSubnet := r.FormValue("client_subnet"); clientSubnet != "" {
-			action["client_subnet"] = &clientSubnet
-		}
-
-	case "reject":
-		if method := r.FormValue("method"); method != "" {
-			action["method"] = method
-		}
-		if r.FormValue("no_drop") == "on" {
-			action["no_drop"] = true
-		}
-
-	case "route-options":
-		if outbound := r.FormValue("outbound"); outbound != "" {
-			action["outbound"] = outbound
-		}
-		if overrideAddress := r.FormValue("override_address"); overrideAddress != "" {
-			action["override_address"] = overrideAddress
-		}
-		if overridePort := r.FormValue("override_port"); overridePort != "" {
-			if val, err := strconv.ParseUint(overridePort, 10, 16); err == nil {
-				action["override_port"] = uint16(val)
-			}
-		}
-		if networkStrategy := r.FormValue("network_strategy"); networkStrategy != "" {
-			action["network_strategy"] = &networkStrategy
-		}
-		if fallbackDelay := r.FormValue("fallback_delay"); fallbackDelay != "" {
-			if val, err := strconv.ParseUint(fallbackDelay, 10, 32); err == nil {
-				action["fallback_delay"] = uint32(val)
-			}
-		}
-		if udpTimeout := r.FormValue("udp_timeout"); udpTimeout != "" {
-			if val, err := strconv.ParseUint(udpTimeout, 10, 32); err == nil {
-				action["udp_timeout"] = uint32(val)
-			}
-		}
-		if r.FormValue("udp_disable_domain_unmapping") == "on" {
-			action["udp_disable_domain_unmapping"] = true
-		}
-		if r.FormValue("udp_connect") == "on" {
-			action["udp_connect"] = true
-		}
-		if r.FormValue("tls_fragment") == "on" {
-			action["tls_fragment"] = true
-		}
-		if tlsFragmentFallbackDelay := r.FormValue("tls_fragment_fallback_delay"); tlsFragmentFallbackDelay != "" {
-			if val, err := strconv.ParseUint(tlsFragmentFallbackDelay, 10, 32); err == nil {
-				action["tls_fragment_fallback_delay"] = uint32(val)
-			}
-		}
-		if r.FormValue("tls_record_fragment") == "on" {
-			action["tls_record_fragment"] = true
-		}
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		writeMethodNotAllowed(w)
+		return
 	}
 
-	return action
+	// NOT IMPLEMENTED: route.rule_action field doesn't exist in the current sing-box schema
+	// Rule action functionality needs to be reimplemented using the current sing-box model
+	writeJSONError(w, http.StatusNotImplemented, ErrCodeNotImplemented, "NOT IMPLEMENTED: rule_action field doesn't exist in current sing-box schema")
 }
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/matinhimself/singbox-web-config/internal/config"
+)
+
+func TestCollectArrayValues(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []string
+		want   []string
+	}{
+		{name: "one value per input", values: []string{"example.com", "example.org"}, want: []string{"example.com", "example.org"}},
+		{name: "trims and drops empty inputs", values: []string{"  example.com ", "", "   "}, want: []string{"example.com"}},
+		{name: "regex with commas stays whole", values: []string{`^ad[0-9]{1,3}\.example\.com$`, `^(a|b),c$`}, want: []string{`^ad[0-9]{1,3}\.example\.com$`, `^(a|b),c$`}},
+		{name: "nothing submitted", values: nil, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := collectArrayValues(tt.values); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("collectArrayValues(%q) = %q, want %q", tt.values, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitLegacyArrayValues(t *testing.T) {
+	tests := []struct {
+		name   string
+		field  string
+		values []string
+		want   []string
+	}{
+		{name: "comma list", field: "domain", values: []string{"example.com, example.org,example.net"}, want: []string{"example.com", "example.org", "example.net"}},
+		{name: "empty items dropped", field: "domain", values: []string{"example.com,, ,"}, want: []string{"example.com"}},
+		{name: "several inputs", field: "domain_suffix", values: []string{"a.com,b.com", "c.com"}, want: []string{"a.com", "b.com", "c.com"}},
+		{name: "regex with commas stays whole", field: "domain_regex", values: []string{`^ad[0-9]{1,3}\.example\.com$`}, want: []string{`^ad[0-9]{1,3}\.example\.com$`}},
+		{name: "process path regex", field: "process_path_regex", values: []string{` ^/usr/(s?bin){1,2}/curl$ `}, want: []string{`^/usr/(s?bin){1,2}/curl$`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitLegacyArrayValues(tt.field, tt.values); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitLegacyArrayValues(%q, %q) = %q, want %q", tt.field, tt.values, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigBackupDownloadErrors(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(configPath, []byte(testConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, _ := newTestServer(t, testConfig)
+	manager, err := config.NewManager(configPath, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.configManager = manager
+
+	tests := []struct {
+		name   string
+		status int
+		code   string
+	}{
+		{name: "", status: http.StatusBadRequest, code: ErrCodeValidation},
+		{name: "..%2Fconfig.json", status: http.StatusBadRequest, code: ErrCodeValidation},
+		{name: "missing.json", status: http.StatusNotFound, code: ErrCodeNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/config/backups/download?name="+tt.name, nil))
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.status)
+			}
+			var apiErr APIError
+			if err := json.Unmarshal(rec.Body.Bytes(), &apiErr); err != nil {
+				t.Fatalf("body %q is not a JSON error: %v", rec.Body.String(), err)
+			}
+			if apiErr.Code != tt.code {
+				t.Errorf("code = %q, want %q", apiErr.Code, tt.code)
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"html/template"
+	"time"
 )
 
 // Template helper functions
@@ -20,6 +21,9 @@ func templateFuncMap() template.FuncMap {
 		"dict":        dict,
 		"list":        list,
 		"has":         has,
+		"formatBytes": formatBytes,
+		"timeAgo":     timeAgo,
+		"ruleSummary": ruleSummary,
 	}
 }
 
@@ -102,3 +106,32 @@ func has(value string, slice []string) bool {
 	}
 	return false
 }
+
+// formatBytes renders a byte count with a binary unit, e.g. 1.5 MiB
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// timeAgo renders how long ago t was in its largest whole unit, e.g. 3m ago
+func timeAgo(t time.Time) string {
+	d := time.Since(t)
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d/time.Minute))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d/time.Hour))
+	default:
+		return fmt.Sprintf("%dd ago", int(d/(24*time.Hour)))
+	}
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// unixAddrPrefix marks an address as a Unix domain socket path, as in
+// "unix:/run/singbox-web.sock"
+const unixAddrPrefix = "unix:"
+
+// unixSocketMode lets the socket's owner and group, such as a reverse
+// proxy's, connect
+const unixSocketMode = 0660
+
+// unixSocketPath returns the socket path of a "unix:" address
+func unixSocketPath(addr string) (string, bool) {
+	path, ok := strings.CutPrefix(addr, unixAddrPrefix)
+	return path, ok
+}
+
+// listen opens the server's listener: a Unix domain socket for a "unix:"
+// address, TCP otherwise
+func (s *Server) listen() (net.Listener, error) {
+	path, ok := unixSocketPath(s.addr)
+	if !ok {
+		return net.Listen("tcp", s.addr)
+	}
+	if path == "" {
+		return nil, fmt.Errorf("address %q has no socket path", s.addr)
+	}
+
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, unixSocketMode); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to set socket permissions: %w", err)
+	}
+	return listener, nil
+}
+
+// removeStaleSocket removes a socket file left behind by a server that
+// didn't shut down cleanly. A file that isn't a socket, or a socket another
+// process still accepts connections on, is left alone and reported.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&fs.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return fmt.Errorf("another process is listening on %s", path)
+	}
+	return os.Remove(path)
+}
@@ -3,22 +3,25 @@ package handlers
 import (
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/matinhimself/singbox-web-config/internal/types"
 )
 
 // handleOutboundsPage handles the outbounds management page
 func (s *Server) handleOutboundsPage(w http.ResponseWriter, r *http.Request) {
 	data := PageData{
-		Title: "Outbound Management",
-		Data:  map[string]interface{}{},
+		Title:    "Outbound Management",
+		ReadOnly: s.readOnly,
+		Data:     map[string]interface{}{},
 	}
 
 	if err := s.renderTemplate(w, "outbounds.html", data); err != nil {
-		log.Printf("Error rendering template: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to render the page", err)
 	}
 }
 
@@ -26,18 +29,32 @@ func (s *Server) handleOutboundsPage(w http.ResponseWriter, r *http.Request) {
 func (s *Server) handleOutboundsList(w http.ResponseWriter, r *http.Request) {
 	outbounds, err := s.configManager.GetOutbounds()
 	if err != nil {
-		log.Printf("Error getting outbounds: %v", err)
-		http.Error(w, "Failed to load outbounds", http.StatusInternalServerError)
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to load outbounds", err)
+		return
+	}
+
+	disabled, err := s.configManager.GetDisabledOutbounds()
+	if err != nil {
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to load outbounds", err)
 		return
 	}
 
+	// Count references so unused outbounds stand out in the list
+	referenceCounts, err := s.configManager.ReferenceCounts()
+	if err != nil {
+		requestLogger(r).Warn("failed to count references", "error", err)
+		referenceCounts = map[string]int{}
+	}
+
 	data := map[string]interface{}{
-		"Outbounds": outbounds,
+		"Outbounds":         outbounds,
+		"DisabledOutbounds": disabled,
+		"ReferenceCounts":   referenceCounts,
+		"ConfigWarnings":    s.configWarnings(),
 	}
 
 	if err := s.renderTemplate(w, "outbound-list.html", data); err != nil {
-		log.Printf("Error rendering template: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to render the page", err)
 	}
 }
 
@@ -55,8 +72,7 @@ func (s *Server) handleOutboundForm(w http.ResponseWriter, r *http.Request) {
 		// Get existing outbound for editing
 		outbounds, err := s.configManager.GetOutbounds()
 		if err != nil {
-			log.Printf("Error getting outbounds: %v", err)
-			http.Error(w, "Failed to get outbounds", http.StatusInternalServerError)
+			s.renderError(w, r, http.StatusInternalServerError, "Failed to get outbounds", err)
 			return
 		}
 
@@ -89,9 +105,9 @@ func (s *Server) handleOutboundForm(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get all outbound tags for selector/urltest outbounds
-	allOutbounds, err := s.configManager.GetOutboundTags()
+	allOutbounds, err := s.configManager.GetRouteTargetTags()
 	if err != nil {
-		log.Printf("Warning: failed to get outbound tags: %v", err)
+		requestLogger(r).Warn("failed to get outbound tags", "error", err)
 		allOutbounds = []string{}
 	}
 
@@ -113,32 +129,40 @@ func (s *Server) handleOutboundForm(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := s.renderTemplate(w, "outbound-form.html", data); err != nil {
-		log.Printf("Error rendering template: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to render the page", err)
 	}
 }
 
 // handleOutboundCreate handles creating a new outbound
 func (s *Server) handleOutboundCreate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+
 	if err := r.ParseForm(); err != nil {
-		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		writeBodyError(w, err, "Failed to parse form")
 		return
 	}
 
 	// Build outbound from form data
-	outbound := buildOutboundFromForm(r.Form)
+	outbound, err := buildOutboundFromForm(r.Form, types.OutboundNumberFields(r.FormValue("type")), types.OutboundJSONFields(r.FormValue("type")))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, err.Error())
+		return
+	}
 
 	// Validate required fields
 	if err := validateOutbound(outbound); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, err.Error())
 		return
 	}
 
 	// Get current outbounds
 	outbounds, err := s.configManager.GetOutbounds()
 	if err != nil {
-		log.Printf("Error getting outbounds: %v", err)
-		http.Error(w, "Failed to get outbounds", http.StatusInternalServerError)
+		requestLogger(r).Error("failed to get outbounds", "error", err)
+		writeInternalError(w, err, "Failed to get outbounds")
 		return
 	}
 
@@ -147,48 +171,61 @@ func (s *Server) handleOutboundCreate(w http.ResponseWriter, r *http.Request) {
 
 	// Save updated outbounds
 	if err := s.configManager.UpdateOutbounds(outbounds); err != nil {
-		log.Printf("Error updating outbounds: %v", err)
-		http.Error(w, "Failed to save outbounds", http.StatusInternalServerError)
+		requestLogger(r).Error("failed to update outbounds", "error", err)
+		writeInternalError(w, err, "Failed to save outbounds")
 		return
 	}
 
+	noteChange(r, "created outbound %v", outbound["tag"])
+
 	// Reload service
-	if err := s.serviceManager.Reload(); err != nil {
-		log.Printf("Warning: failed to reload service: %v", err)
-	}
+	s.reloadService(r)
 
 	// Return updated list
-	w.Header().Set("HX-Trigger", "outboundCreated")
+	if warning := resolveWarning(r, outbound); warning != "" {
+		setWarningTrigger(w, "outboundCreated", warning)
+	} else {
+		w.Header().Set("HX-Trigger", "outboundCreated")
+	}
 	s.handleOutboundsList(w, r)
 }
 
 // handleOutboundUpdate handles updating an existing outbound
 func (s *Server) handleOutboundUpdate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+
 	if err := r.ParseForm(); err != nil {
-		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		writeBodyError(w, err, "Failed to parse form")
 		return
 	}
 
 	originalTag := r.FormValue("original_tag")
 	if originalTag == "" {
-		http.Error(w, "Missing original_tag", http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, "Missing original_tag")
 		return
 	}
 
 	// Build outbound from form data
-	updatedOutbound := buildOutboundFromForm(r.Form)
+	updatedOutbound, err := buildOutboundFromForm(r.Form, types.OutboundNumberFields(r.FormValue("type")), types.OutboundJSONFields(r.FormValue("type")))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, err.Error())
+		return
+	}
 
 	// Validate required fields
 	if err := validateOutbound(updatedOutbound); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, err.Error())
 		return
 	}
 
 	// Get current outbounds
 	outbounds, err := s.configManager.GetOutbounds()
 	if err != nil {
-		log.Printf("Error getting outbounds: %v", err)
-		http.Error(w, "Failed to get outbounds", http.StatusInternalServerError)
+		requestLogger(r).Error("failed to get outbounds", "error", err)
+		writeInternalError(w, err, "Failed to get outbounds")
 		return
 	}
 
@@ -204,7 +241,7 @@ func (s *Server) handleOutboundUpdate(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if updateIndex == -1 {
-		http.Error(w, "Outbound to update not found", http.StatusBadRequest)
+		writeJSONError(w, http.StatusNotFound, ErrCodeNotFound, "Outbound to update not found")
 		return
 	}
 
@@ -236,34 +273,43 @@ func (s *Server) handleOutboundUpdate(w http.ResponseWriter, r *http.Request) {
 
 	// Save updated outbounds
 	if err := s.configManager.UpdateOutbounds(outbounds); err != nil {
-		log.Printf("Error updating outbounds: %v", err)
-		http.Error(w, "Failed to save outbounds", http.StatusInternalServerError)
+		requestLogger(r).Error("failed to update outbounds", "error", err)
+		writeInternalError(w, err, "Failed to save outbounds")
 		return
 	}
 
+	noteChange(r, "updated outbound %s", originalTag)
+
 	// Reload service
-	if err := s.serviceManager.Reload(); err != nil {
-		log.Printf("Warning: failed to reload service: %v", err)
-	}
+	s.reloadService(r)
 
 	// Return updated list
-	w.Header().Set("HX-Trigger", "outboundUpdated")
+	if warning := resolveWarning(r, updatedOutbound); warning != "" {
+		setWarningTrigger(w, "outboundUpdated", warning)
+	} else {
+		w.Header().Set("HX-Trigger", "outboundUpdated")
+	}
 	s.handleOutboundsList(w, r)
 }
 
 // handleOutboundDelete handles deleting an outbound
 func (s *Server) handleOutboundDelete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		writeMethodNotAllowed(w)
+		return
+	}
+
 	tagToDelete := r.URL.Query().Get("tag")
 	if tagToDelete == "" {
-		http.Error(w, "Invalid tag", http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, "Invalid tag")
 		return
 	}
 
 	// Get current outbounds
 	outbounds, err := s.configManager.GetOutbounds()
 	if err != nil {
-		log.Printf("Error getting outbounds: %v", err)
-		http.Error(w, "Failed to get outbounds", http.StatusInternalServerError)
+		requestLogger(r).Error("failed to get outbounds", "error", err)
+		writeInternalError(w, err, "Failed to get outbounds")
 		return
 	}
 
@@ -313,7 +359,7 @@ func (s *Server) handleOutboundDelete(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if deleteIndex == -1 {
-		http.Error(w, "Outbound not found", http.StatusBadRequest)
+		writeJSONError(w, http.StatusNotFound, ErrCodeNotFound, "Outbound not found")
 		return
 	}
 
@@ -322,15 +368,15 @@ func (s *Server) handleOutboundDelete(w http.ResponseWriter, r *http.Request) {
 
 	// Save updated outbounds
 	if err := s.configManager.UpdateOutbounds(outbounds); err != nil {
-		log.Printf("Error updating outbounds: %v", err)
-		http.Error(w, "Failed to save outbounds", http.StatusInternalServerError)
+		requestLogger(r).Error("failed to update outbounds", "error", err)
+		writeInternalError(w, err, "Failed to save outbounds")
 		return
 	}
 
+	noteChange(r, "deleted outbound %s", tagToDelete)
+
 	// Reload service
-	if err := s.serviceManager.Reload(); err != nil {
-		log.Printf("Warning: failed to reload service: %v", err)
-	}
+	s.reloadService(r)
 
 	// Return updated list
 	w.Header().Set("HX-Trigger", "outboundDeleted")
@@ -339,18 +385,23 @@ func (s *Server) handleOutboundDelete(w http.ResponseWriter, r *http.Request) {
 
 // handleOutboundReorder handles reordering outbounds (drag-and-drop)
 func (s *Server) handleOutboundReorder(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+
 	fromTag := r.URL.Query().Get("fromTag")
 	toTag := r.URL.Query().Get("toTag")
 
 	if fromTag == "" || toTag == "" {
-		http.Error(w, "Invalid from or to tag", http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, "Invalid from or to tag")
 		return
 	}
 
 	outbounds, err := s.configManager.GetOutbounds()
 	if err != nil {
-		log.Printf("Error getting outbounds: %v", err)
-		http.Error(w, "Failed to get outbounds", http.StatusInternalServerError)
+		requestLogger(r).Error("failed to get outbounds", "error", err)
+		writeInternalError(w, err, "Failed to get outbounds")
 		return
 	}
 
@@ -370,29 +421,27 @@ func (s *Server) handleOutboundReorder(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if fromIndex == -1 || toIndex == -1 {
-		http.Error(w, "Could not find outbounds to reorder", http.StatusBadRequest)
+		writeJSONError(w, http.StatusNotFound, ErrCodeNotFound, "Could not find outbounds to reorder")
 		return
 	}
 
-	// Reorder
-	item := outbounds[fromIndex]
-	outbounds = append(outbounds[:fromIndex], outbounds[fromIndex+1:]...)
+	// Dropping onto a later outbound places the dragged one just before it
 	if toIndex > fromIndex {
 		toIndex--
 	}
-	outbounds = append(outbounds[:toIndex], append([]interface{}{item}, outbounds[toIndex:]...)...)
+	outbounds = moveSlice(outbounds, fromIndex, toIndex)
 
 	// Save updated outbounds
 	if err := s.configManager.UpdateOutbounds(outbounds); err != nil {
-		log.Printf("Error updating outbounds: %v", err)
-		http.Error(w, "Failed to save outbounds", http.StatusInternalServerError)
+		requestLogger(r).Error("failed to update outbounds", "error", err)
+		writeInternalError(w, err, "Failed to save outbounds")
 		return
 	}
 
+	noteChange(r, "moved outbound %s to the place of %s", fromTag, toTag)
+
 	// Reload service
-	if err := s.serviceManager.Reload(); err != nil {
-		log.Printf("Warning: failed to reload service: %v", err)
-	}
+	s.reloadService(r)
 
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("OK"))
@@ -400,8 +449,13 @@ func (s *Server) handleOutboundReorder(w http.ResponseWriter, r *http.Request) {
 
 // handleOutboundRename handles renaming an outbound and updating all references
 func (s *Server) handleOutboundRename(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+
 	if err := r.ParseForm(); err != nil {
-		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		writeBodyError(w, err, "Failed to parse form")
 		return
 	}
 
@@ -409,27 +463,147 @@ func (s *Server) handleOutboundRename(w http.ResponseWriter, r *http.Request) {
 	newTag := r.FormValue("new_tag")
 
 	if oldTag == "" || newTag == "" {
-		http.Error(w, "Missing tag parameters", http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, "Missing tag parameters")
 		return
 	}
 
 	// Rename outbound and update all references
 	if err := s.configManager.RenameOutbound(oldTag, newTag); err != nil {
-		log.Printf("Error renaming outbound: %v", err)
-		http.Error(w, "Failed to rename outbound", http.StatusInternalServerError)
+		requestLogger(r).Error("failed to rename outbound", "error", err)
+		writeInternalError(w, err, "Failed to rename outbound")
 		return
 	}
 
+	noteChange(r, "renamed outbound %s to %s", oldTag, newTag)
+
 	// Reload service
-	if err := s.serviceManager.Reload(); err != nil {
-		log.Printf("Warning: failed to reload service: %v", err)
-	}
+	s.reloadService(r)
 
 	// Return updated list
 	w.Header().Set("HX-Trigger", "outboundRenamed")
 	s.handleOutboundsList(w, r)
 }
 
+// handleOutboundToggle disables an outbound or re-enables a disabled one
+func (s *Server) handleOutboundToggle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	tag := r.URL.Query().Get("tag")
+	if tag == "" {
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, "Invalid tag")
+		return
+	}
+
+	disabled, err := s.configManager.IsOutboundDisabled(tag)
+	if err != nil {
+		requestLogger(r).Error("failed to get disabled outbounds", "error", err)
+		writeInternalError(w, err, "Failed to get outbounds")
+		return
+	}
+
+	if disabled {
+		err = s.configManager.EnableOutbound(tag)
+	} else {
+		err = s.configManager.DisableOutbound(tag)
+	}
+	if err != nil {
+		requestLogger(r).Error("failed to toggle outbound", "tag", tag, "error", err)
+		writeJSONError(w, http.StatusBadRequest, ErrCodeBadRequest, fmt.Sprintf("Failed to toggle outbound: %v", err))
+		return
+	}
+
+	action := "disabled"
+	if disabled {
+		action = "enabled"
+	}
+	noteChange(r, "%s outbound %s", action, tag)
+
+	// Reload service
+	s.reloadService(r)
+
+	// Return updated list
+	w.Header().Set("HX-Trigger", "outboundToggled")
+	s.handleOutboundsList(w, r)
+}
+
+// handleOutboundClone duplicates an outbound under a new unique tag
+func (s *Server) handleOutboundClone(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	tag := r.URL.Query().Get("tag")
+	if tag == "" {
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, "Invalid tag")
+		return
+	}
+
+	outbounds, err := s.configManager.GetOutbounds()
+	if err != nil {
+		requestLogger(r).Error("failed to get outbounds", "error", err)
+		writeInternalError(w, err, "Failed to get outbounds")
+		return
+	}
+
+	disabled, err := s.configManager.GetDisabledOutbounds()
+	if err != nil {
+		requestLogger(r).Error("failed to get disabled outbounds", "error", err)
+		writeInternalError(w, err, "Failed to get outbounds")
+		return
+	}
+
+	// Tags are unique across outbounds and endpoints, and disabled outbounds
+	// keep theirs, so a clone must not reuse any of them
+	existingTags, err := s.configManager.GetRouteTargetTags()
+	if err != nil {
+		requestLogger(r).Error("failed to get tags", "error", err)
+		writeInternalError(w, err, "Failed to get outbounds")
+		return
+	}
+	var original map[string]interface{}
+	for _, outbound := range outbounds {
+		if outboundMap, ok := outbound.(map[string]interface{}); ok {
+			if t, ok := outboundMap["tag"].(string); ok && t == tag {
+				original = outboundMap
+			}
+		}
+	}
+	for _, d := range disabled {
+		if t, ok := d.Outbound["tag"].(string); ok {
+			existingTags = append(existingTags, t)
+		}
+	}
+
+	if original == nil {
+		writeJSONError(w, http.StatusNotFound, ErrCodeNotFound, "Outbound not found")
+		return
+	}
+
+	clone := deepCopy(original).(map[string]interface{})
+	clone["tag"] = uniqueTag(tag+"-copy", existingTags)
+	outbounds = append(outbounds, clone)
+
+	// Save updated outbounds
+	if err := s.configManager.UpdateOutbounds(outbounds); err != nil {
+		requestLogger(r).Error("failed to update outbounds", "error", err)
+		writeInternalError(w, err, "Failed to save outbounds")
+		return
+	}
+
+	noteChange(r, "cloned outbound %s as %s", tag, clone["tag"])
+
+	// Reload service
+	s.reloadService(r)
+
+	// Return updated list
+	w.Header().Set("HX-Trigger", "outboundCloned")
+	s.handleOutboundsList(w, r)
+}
+
 // handleGroupManage handles managing outbound groups (selector/urltest)
 func (s *Server) handleGroupManage(w http.ResponseWriter, r *http.Request) {
 	tagToManage := r.URL.Query().Get("tag")
@@ -440,8 +614,7 @@ func (s *Server) handleGroupManage(w http.ResponseWriter, r *http.Request) {
 
 	outbounds, err := s.configManager.GetOutbounds()
 	if err != nil {
-		log.Printf("Error getting outbounds: %v", err)
-		http.Error(w, "Failed to get outbounds", http.StatusInternalServerError)
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to get outbounds", err)
 		return
 	}
 
@@ -470,9 +643,9 @@ func (s *Server) handleGroupManage(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get all available outbounds for selection
-	allTags, err := s.configManager.GetOutboundTags()
+	allTags, err := s.configManager.GetRouteTargetTags()
 	if err != nil {
-		log.Printf("Error getting outbound tags: %v", err)
+		requestLogger(r).Error("failed to get outbound tags", "error", err)
 		allTags = []string{}
 	}
 
@@ -503,35 +676,39 @@ func (s *Server) handleGroupManage(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := s.renderTemplate(w, "group-manage.html", data); err != nil {
-		log.Printf("Error rendering template: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to render the page", err)
 	}
 }
 
 // handleGroupUpdate handles updating group members
 func (s *Server) handleGroupUpdate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+
 	if err := r.ParseForm(); err != nil {
-		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		writeBodyError(w, err, "Failed to parse form")
 		return
 	}
 
 	tagToUpdate := r.FormValue("tag")
 	if tagToUpdate == "" {
-		http.Error(w, "Invalid tag", http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, "Invalid tag")
 		return
 	}
 
 	// Get selected members
 	members := r.Form["members[]"]
 	if len(members) == 0 {
-		http.Error(w, "At least one member is required", http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, "At least one member is required")
 		return
 	}
 
 	outbounds, err := s.configManager.GetOutbounds()
 	if err != nil {
-		log.Printf("Error getting outbounds: %v", err)
-		http.Error(w, "Failed to get outbounds", http.StatusInternalServerError)
+		requestLogger(r).Error("failed to get outbounds", "error", err)
+		writeInternalError(w, err, "Failed to get outbounds")
 		return
 	}
 
@@ -548,7 +725,7 @@ func (s *Server) handleGroupUpdate(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if outboundIndex == -1 {
-		http.Error(w, "Outbound group not found", http.StatusBadRequest)
+		writeJSONError(w, http.StatusNotFound, ErrCodeNotFound, "Outbound group not found")
 		return
 	}
 
@@ -566,28 +743,56 @@ func (s *Server) handleGroupUpdate(w http.ResponseWriter, r *http.Request) {
 
 	// Save updated outbounds
 	if err := s.configManager.UpdateOutbounds(outbounds); err != nil {
-		log.Printf("Error updating outbounds: %v", err)
-		http.Error(w, "Failed to save outbounds", http.StatusInternalServerError)
+		requestLogger(r).Error("failed to update outbounds", "error", err)
+		writeInternalError(w, err, "Failed to save outbounds")
 		return
 	}
 
+	noteChange(r, "updated group %s", tagToUpdate)
+
 	// Reload service
-	if err := s.serviceManager.Reload(); err != nil {
-		log.Printf("Warning: failed to reload service: %v", err)
-	}
+	s.reloadService(r)
 
 	// Return updated list
 	w.Header().Set("HX-Trigger", "groupUpdated")
 	s.handleOutboundsList(w, r)
 }
 
+// handleOutboundTags returns the outbound and endpoint tags starting with the
+// q query parameter, case-insensitively, for autocomplete widgets
+func (s *Server) handleOutboundTags(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	tags, err := s.configManager.GetRouteTargetTags()
+	if err != nil {
+		requestLogger(r).Error("failed to get outbound tags", "error", err)
+		writeInternalError(w, err, "Failed to get outbound tags")
+		return
+	}
+
+	prefix := strings.ToLower(r.URL.Query().Get("q"))
+	matches := []string{}
+	for _, tag := range tags {
+		if strings.HasPrefix(strings.ToLower(tag), prefix) {
+			matches = append(matches, tag)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(matches)
+}
+
 // Helper functions
 
+// getAvailableOutboundTypes lists the outbound types that can be created.
+// Block and DNS outbounds are left out because sing-box deprecated them for
+// the reject and hijack-dns rule actions; existing ones can still be edited.
 func getAvailableOutboundTypes() []map[string]string {
 	return []map[string]string{
 		{"value": "direct", "label": "Direct", "description": "Direct connection"},
-		{"value": "block", "label": "Block", "description": "Block connection"},
-		{"value": "dns", "label": "DNS", "description": "DNS outbound"},
 		{"value": "socks", "label": "SOCKS", "description": "SOCKS proxy"},
 		{"value": "http", "label": "HTTP", "description": "HTTP proxy"},
 		{"value": "shadowsocks", "label": "Shadowsocks", "description": "Shadowsocks protocol"},
@@ -605,7 +810,13 @@ func getAvailableOutboundTypes() []map[string]string {
 	}
 }
 
-func buildOutboundFromForm(form map[string][]string) map[string]interface{} {
+// buildOutboundFromForm converts form values to an outbound: fields in
+// numberFields become numbers and booleans are typed, values of fields in
+// jsonFields starting with { or [ are parsed as JSON and "name[]" fields
+// become lists. Other values stay strings even if they look numeric or like
+// JSON, like a password of 0123 or [secret]. A number or JSON value that
+// doesn't parse is an error naming the field.
+func buildOutboundFromForm(form map[string][]string, numberFields, jsonFields map[string]bool) (map[string]interface{}, error) {
 	outbound := make(map[string]interface{})
 
 	for key, values := range form {
@@ -644,8 +855,11 @@ func buildOutboundFromForm(form map[string][]string) map[string]interface{} {
 
 		value := values[0]
 
-		// Try to parse as number
-		if intVal, err := strconv.Atoi(value); err == nil {
+		if numberFields[key] {
+			intVal, err := strconv.Atoi(strings.TrimSpace(value))
+			if err != nil {
+				return nil, fmt.Errorf("field %q must be a whole number", key)
+			}
 			outbound[key] = intVal
 			continue
 		}
@@ -659,56 +873,75 @@ func buildOutboundFromForm(form map[string][]string) map[string]interface{} {
 			continue
 		}
 
-		// Handle JSON objects
-		if strings.HasPrefix(value, "{") || strings.HasPrefix(value, "[") {
+		// Handle JSON objects and arrays. A value of an object or list field
+		// that looks like JSON but doesn't parse is a typo, which saved as a
+		// string would break the config.
+		if jsonFields[key] && (strings.HasPrefix(value, "{") || strings.HasPrefix(value, "[")) {
 			var jsonValue interface{}
-			if err := json.Unmarshal([]byte(value), &jsonValue); err == nil {
-				outbound[key] = jsonValue
-				continue
+			if err := json.Unmarshal([]byte(value), &jsonValue); err != nil {
+				return nil, fmt.Errorf("field %q is not valid JSON: %v", key, err)
 			}
+			outbound[key] = jsonValue
+			continue
 		}
 
 		// Default to string
 		outbound[key] = value
 	}
 
-	return outbound
+	return outbound, nil
 }
 
+// validateOutbound checks the outbound's required fields with the validators
+// generated from sing-box, then the values sing-box would reject at startup
 func validateOutbound(outbound map[string]interface{}) error {
-	outboundType, ok := outbound["type"].(string)
-	if !ok || outboundType == "" {
-		return fmt.Errorf("outbound type is required")
-	}
-
-	tag, ok := outbound["tag"].(string)
-	if !ok || tag == "" {
-		return fmt.Errorf("outbound tag is required")
+	if err := types.ValidateOutbound(outbound); err != nil {
+		return err
 	}
 
-	// Type-specific validation
-	switch outboundType {
-	case "socks", "http", "shadowsocks", "vmess", "vless", "trojan", "wireguard", "hysteria", "hysteria2", "tuic", "ssh":
-		if _, ok := outbound["server"]; !ok {
-			return fmt.Errorf("server is required for %s outbound", outboundType)
+	if server, ok := outbound["server"].(string); ok {
+		if err := validateServerAddress(server); err != nil {
+			return err
 		}
-		if _, ok := outbound["server_port"]; !ok {
-			return fmt.Errorf("server_port is required for %s outbound", outboundType)
+	}
+	if port, ok := outbound["server_port"].(int); ok && (port < 1 || port > 65535) {
+		return fmt.Errorf("server_port %d is out of range", port)
+	}
+	for key, value := range outbound {
+		if _, ok := types.DurationField(key); !ok {
+			continue
 		}
-	case "selector", "urltest":
-		outbounds, ok := outbound["outbounds"].([]interface{})
-		if !ok || len(outbounds) == 0 {
-			return fmt.Errorf("at least one outbound is required for %s", outboundType)
+		if duration, ok := value.(string); ok {
+			if _, err := time.ParseDuration(duration); err != nil {
+				return fmt.Errorf("field %q must be a duration such as 5s or 300ms", key)
+			}
 		}
 	}
 
 	return nil
 }
 
+// resolveWarning looks up the outbound's server when the request asks for it
+// with ?resolve=true, returning a warning message if the lookup fails
+func resolveWarning(r *http.Request, outbound map[string]interface{}) string {
+	if r.URL.Query().Get("resolve") != "true" {
+		return ""
+	}
+	server, ok := outbound["server"].(string)
+	if !ok || server == "" {
+		return ""
+	}
+	if err := resolveServerAddress(r.Context(), server); err != nil {
+		requestLogger(r).Warn("outbound server does not resolve", "server", server, "error", err)
+		return err.Error()
+	}
+	return ""
+}
+
 func populateOutboundFormValues(fields []FormField, data map[string]interface{}) {
 	for i := range fields {
 		field := &fields[i]
-		if value, ok := data[field.Name]; ok {
+		if value, ok := data[strings.TrimSuffix(field.Name, "[]")]; ok {
 			if field.IsArray {
 				if arrayValue, ok := value.([]interface{}); ok {
 					var strValues []string
@@ -733,6 +966,39 @@ func contains(slice []string, item string) bool {
 	return false
 }
 
+// deepCopy copies decoded JSON values so the result shares no maps or slices with the source
+func deepCopy(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			copied[key] = deepCopy(item)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, item := range v {
+			copied[i] = deepCopy(item)
+		}
+		return copied
+	default:
+		return v
+	}
+}
+
+// uniqueTag returns base, or base with the lowest numeric suffix that isn't already taken
+func uniqueTag(base string, existing []string) string {
+	if !contains(existing, base) {
+		return base
+	}
+	for i := 2; ; i++ {
+		candidate := fmt.Sprintf("%s-%d", base, i)
+		if !contains(existing, candidate) {
+			return candidate
+		}
+	}
+}
+
 // FormField represents a field in the outbound form
 type FormField struct {
 	Name        string
@@ -876,16 +1142,48 @@ func (s *Server) buildOutboundFormFields(outboundType string, allOutbounds []str
 		}
 	}
 
-	// Add common dialer options for applicable types
-	if outboundType != "block" && outboundType != "dns" && outboundType != "selector" && outboundType != "urltest" {
-		dialerFields := []FormField{
-			{Name: "detour", Label: "Detour", Type: "select", Options: allOutbounds, Description: "Use another outbound as proxy chain"},
-			{Name: "bind_interface", Label: "Bind Interface", Type: "text", Description: "Bind to specific network interface"},
-			{Name: "connect_timeout", Label: "Connect Timeout (seconds)", Type: "number", Placeholder: "5"},
-			{Name: "tcp_fast_open", Label: "TCP Fast Open", Type: "checkbox"},
-		}
-		specificFields = append(specificFields, dialerFields...)
+	// Add the dialer options to types that dial connections themselves
+	if types.OutboundHasDialer(outboundType) {
+		specificFields = append(specificFields, s.outboundDialerFields(allOutbounds)...)
 	}
 
 	return append(commonFields, specificFields...)
 }
+
+// outboundDialerFields returns the dialer option fields of an outbound form,
+// read from the generated DialerOptions so every option sing-box accepts is
+// there. The detour picks from the other outbounds.
+func (s *Server) outboundDialerFields(allOutbounds []string) []FormField {
+	form, err := s.formBuilder.BuildForm("DialerOptions")
+	if err != nil {
+		slog.Warn("failed to build dialer fields", "error", err)
+		return nil
+	}
+
+	fields := make([]FormField, 0, len(form.Fields))
+	for _, f := range form.Fields {
+		field := FormField{
+			Name:        f.JSONTag,
+			Label:       f.Label,
+			Type:        string(f.Type),
+			Placeholder: f.Placeholder,
+			IsArray:     f.IsArray,
+			Options:     f.Options,
+			Description: f.Description,
+		}
+		if f.IsArray {
+			field.Name += "[]"
+		}
+
+		switch f.JSONTag {
+		case "detour":
+			field.Type = "select"
+			field.Options = allOutbounds
+			field.Description = "Use another outbound as proxy chain"
+		case "netns":
+			field.Label = "Network Namespace"
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/matinhimself/singbox-web-config/internal/types"
+)
+
+func TestBuildOutboundFromFormJSONFields(t *testing.T) {
+	tests := []struct {
+		name    string
+		form    map[string][]string
+		field   string
+		want    interface{}
+		wantErr string
+	}{
+		{
+			name:  "valid object",
+			form:  map[string][]string{"type": {"vless"}, "tls": {`{"enabled": true, "server_name": "example.com"}`}},
+			field: "tls",
+			want:  map[string]interface{}{"enabled": true, "server_name": "example.com"},
+		},
+		{
+			name:  "valid array",
+			form:  map[string][]string{"type": {"vless"}, "network_type": {`["wifi", "ethernet"]`}},
+			field: "network_type",
+			want:  []interface{}{"wifi", "ethernet"},
+		},
+		{
+			name:    "malformed object",
+			form:    map[string][]string{"type": {"vless"}, "tls": {`{"enabled": true`}},
+			wantErr: `field "tls" is not valid JSON`,
+		},
+		{
+			name:  "string that looks like JSON",
+			form:  map[string][]string{"type": {"shadowsocks"}, "password": {"[not-json"}},
+			field: "password",
+			want:  "[not-json",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outboundType := tt.form["type"][0]
+			outbound, err := buildOutboundFromForm(tt.form, types.OutboundNumberFields(outboundType), types.OutboundJSONFields(outboundType))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("buildOutboundFromForm() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := outbound[tt.field]; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s = %#v, want %#v", tt.field, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOutboundCloneSkipsEndpointTags(t *testing.T) {
+	s, store := newTestServer(t, `{"outbounds":[{"type":"direct","tag":"a"}],"endpoints":[{"type":"wireguard","tag":"a-copy"}]}`)
+	s.deferReload = true
+
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/outbounds/clone?tag=a", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST /api/outbounds/clone = %d: %s", rec.Code, rec.Body.String())
+	}
+
+	data, err := store.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var config struct {
+		Outbounds []map[string]interface{} `json:"outbounds"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Outbounds) != 2 || config.Outbounds[1]["tag"] != "a-copy-2" {
+		t.Errorf("outbounds after clone = %v, want a clone tagged a-copy-2", config.Outbounds)
+	}
+}
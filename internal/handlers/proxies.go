@@ -1,13 +1,40 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
-	"log"
+	"fmt"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/matinhimself/singbox-web-config/internal/clash"
 )
 
+// delayTestGrace is added to a delay test's own timeout so Clash can report
+// the timeout itself before the HTTP call is abandoned
+const delayTestGrace = time.Second
+
+// DefaultDelayTestConcurrency bounds how many node delay tests run at once
+// for a group unless overridden with SetDelayTestConcurrency
+const DefaultDelayTestConcurrency = 8
+
+// DefaultHealthyDelay is the delay in milliseconds under which a URLTest
+// group member counts as healthy unless the "threshold" query parameter
+// says otherwise
+const DefaultHealthyDelay = 1000
+
+// delayTestResult is the outcome of a single node's delay test
+type delayTestResult struct {
+	Name    string `json:"name"`
+	Delay   int    `json:"delay"`
+	Error   string `json:"error,omitempty"`
+	Timeout bool   `json:"timeout,omitempty"`
+}
+
 // ProxyGroupData represents a proxy group with its members
 type ProxyGroupData struct {
 	Name      string
@@ -15,70 +42,144 @@ type ProxyGroupData struct {
 	Now       string
 	Proxies   []ProxyNodeData
 	CanSwitch bool
+	// Total counts the group's nodes before a search filtered them
+	Total int
+	// HealthChecked is set for URLTest groups, which switch members by
+	// delay. Healthy reports whether any member's last delay is under the
+	// health threshold, and NowDelay is the selected member's last delay.
+	HealthChecked bool
+	Healthy       bool
+	NowDelay      int
 }
 
 // ProxyNodeData represents a proxy node
 type ProxyNodeData struct {
-	Name  string
-	Type  string
+	Name    string
+	Type    string
+	Delay   int
+	IsNow   bool
+	History []DelaySample
+	// LastTest is the last delay test run through this server, which
+	// outlives Clash's history across sing-box restarts
+	LastTest *clash.ProxyStat
+}
+
+// DelaySample is one point of a node's delay history. A zero delay marks a
+// failed test.
+type DelaySample struct {
+	Time  time.Time
 	Delay int
-	IsNow bool
+}
+
+// maxDelayHistory caps how many recent delay samples are kept per node
+const maxDelayHistory = 20
+
+// Sparkline dimensions, in SVG user units
+const (
+	sparklineWidth  = 60
+	sparklineHeight = 16
+)
+
+// SparklinePoints returns the history as SVG polyline points scaled to the
+// sparkline box, oldest first. Failed tests are drawn at the top of the box.
+// It returns an empty string when there are fewer than two samples.
+func (n ProxyNodeData) SparklinePoints() string {
+	if len(n.History) < 2 {
+		return ""
+	}
+
+	maxDelay := 0
+	for _, sample := range n.History {
+		if sample.Delay > maxDelay {
+			maxDelay = sample.Delay
+		}
+	}
+	if maxDelay == 0 {
+		maxDelay = 1
+	}
+
+	points := make([]string, len(n.History))
+	step := float64(sparklineWidth) / float64(len(n.History)-1)
+	for i, sample := range n.History {
+		delay := sample.Delay
+		if delay == 0 {
+			delay = maxDelay
+		}
+		y := sparklineHeight - float64(delay)/float64(maxDelay)*sparklineHeight
+		points[i] = fmt.Sprintf("%.1f,%.1f", float64(i)*step, y)
+	}
+	return strings.Join(points, " ")
 }
 
 // handleProxiesPage handles the proxies management page
 func (s *Server) handleProxiesPage(w http.ResponseWriter, r *http.Request) {
+	clashURL, clashSecret := s.clashAPISettings()
 	data := PageData{
-		Title: "Proxy Management",
+		Title:    "Proxy Management",
+		ReadOnly: s.readOnly,
 		Data: map[string]interface{}{
-			"ClashURL":    s.clashURL,
-			"ClashSecret": s.clashSecret,
+			"ClashURL":    clashURL,
+			"ClashSecret": clashSecret,
+			"ProxySort":   s.uiSessions.get(r, uiStateProxySort),
 		},
 	}
 
 	if err := s.renderTemplate(w, "proxies.html", data); err != nil {
-		log.Printf("Error rendering template: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to render the page", err)
 	}
 }
 
 // handleProxiesSettings displays current Clash API settings (read-only)
 // Settings are configured via command-line arguments only
 func (s *Server) handleProxiesSettings(w http.ResponseWriter, r *http.Request) {
+	clashURL, clashSecret := s.clashAPISettings()
 	data := map[string]interface{}{
-		"ClashURL":       s.clashURL,
-		"ClashSecret":    s.clashSecret,
-		"HasClashClient": s.clashClient != nil,
+		"ClashURL":       clashURL,
+		"ClashSecret":    clashSecret,
+		"HasClashClient": s.clashAPIClient() != nil,
 	}
 
 	if err := s.renderTemplate(w, "proxy-settings.html", data); err != nil {
-		log.Printf("Error rendering template: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to render the page", err)
 	}
 }
 
 // handleProxiesGroups handles fetching all proxy groups
 func (s *Server) handleProxiesGroups(w http.ResponseWriter, r *http.Request) {
-	if s.clashClient == nil {
+	client := s.clashAPIClient()
+	if client == nil {
 		http.Error(w, "Clash API not configured", http.StatusBadRequest)
 		return
 	}
 
-	proxies, err := s.clashClient.GetProxies()
+	proxies, err := client.GetProxies(r.Context())
 	if err != nil {
-		log.Printf("Error fetching proxies: %v", err)
-		http.Error(w, "Failed to fetch proxies: "+err.Error(), http.StatusInternalServerError)
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to fetch proxies", err)
 		return
 	}
 
-	// Process proxy groups
+	threshold := DefaultHealthyDelay
+	if value := r.FormValue("threshold"); value != "" {
+		threshold, err = strconv.Atoi(value)
+		if err != nil || threshold <= 0 {
+			s.renderError(w, r, http.StatusBadRequest, "Invalid health threshold", fmt.Errorf("invalid threshold %q", value))
+			return
+		}
+	}
+
+	s.pruneProxyStats(r, proxies)
+	order := s.uiParam(w, r, "sort", uiStateProxySort)
+	query := strings.TrimSpace(r.FormValue("q"))
+
+	// Process proxy groups, leaving out providers and nodes that list members
 	var groups []ProxyGroupData
 	for name, proxy := range proxies {
-		if len(proxy.All) > 0 {
+		if proxy.IsGroup() {
 			group := ProxyGroupData{
 				Name:      name,
 				Type:      proxy.Type,
 				Now:       proxy.Now,
-				CanSwitch: proxy.Type == "Selector" || proxy.Type == "URLTest" || proxy.Type == "Fallback",
+				CanSwitch: !s.readOnly && contains([]string{"selector", "urltest", "fallback"}, strings.ToLower(proxy.Type)),
 			}
 
 			// Get proxy nodes for this group
@@ -94,82 +195,310 @@ func (s *Server) handleProxiesGroups(w http.ResponseWriter, r *http.Request) {
 					if len(proxyNode.History) > 0 {
 						node.Delay = proxyNode.History[len(proxyNode.History)-1].Delay
 					}
+
+					history := proxyNode.History
+					if len(history) > maxDelayHistory {
+						history = history[len(history)-maxDelayHistory:]
+					}
+					for _, h := range history {
+						node.History = append(node.History, DelaySample{Time: h.Time, Delay: h.Delay})
+					}
+				}
+
+				if s.proxyStats != nil {
+					if stat, ok := s.proxyStats.Get(proxyName); ok {
+						node.LastTest = &stat
+					}
 				}
 
 				group.Proxies = append(group.Proxies, node)
 			}
+			group.Total = len(group.Proxies)
+			if proxy.Type == "URLTest" {
+				annotateGroupHealth(&group, threshold)
+			}
+			if query != "" {
+				group.Proxies = filterProxyNodes(group.Proxies, query)
+				if len(group.Proxies) == 0 && !nameMatches(group.Now, query) {
+					continue
+				}
+			}
+			sortProxyNodes(group.Proxies, order)
 
 			groups = append(groups, group)
 		}
 	}
 
 	data := map[string]interface{}{
-		"Groups": groups,
+		"Groups":    groups,
+		"Query":     query,
+		"Threshold": threshold,
 	}
 
 	if err := s.renderTemplate(w, "proxy-groups.html", data); err != nil {
-		log.Printf("Error rendering template: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to render the page", err)
+	}
+}
+
+// annotateGroupHealth sets a group's health from its members' last delays.
+// A zero delay is a failed or missing test, so it never counts as healthy.
+func annotateGroupHealth(group *ProxyGroupData, threshold int) {
+	group.HealthChecked = true
+	for _, node := range group.Proxies {
+		if node.Delay > 0 && node.Delay < threshold {
+			group.Healthy = true
+		}
+		if node.IsNow {
+			group.NowDelay = node.Delay
+		}
+	}
+}
+
+// filterProxyNodes returns the nodes whose name contains query, ignoring case
+func filterProxyNodes(nodes []ProxyNodeData, query string) []ProxyNodeData {
+	var matches []ProxyNodeData
+	for _, node := range nodes {
+		if nameMatches(node.Name, query) {
+			matches = append(matches, node)
+		}
+	}
+	return matches
+}
+
+// nameMatches reports whether name contains query, ignoring case
+func nameMatches(name, query string) bool {
+	return strings.Contains(strings.ToLower(name), strings.ToLower(query))
+}
+
+// sortProxyNodes orders a group's nodes by name or by their latest delay,
+// untested and failed nodes last. Any other order keeps the group's own.
+func sortProxyNodes(nodes []ProxyNodeData, order string) {
+	switch order {
+	case "name":
+		sort.SliceStable(nodes, func(i, j int) bool {
+			return strings.ToLower(nodes[i].Name) < strings.ToLower(nodes[j].Name)
+		})
+	case "delay":
+		sort.SliceStable(nodes, func(i, j int) bool {
+			a, b := nodes[i].Delay, nodes[j].Delay
+			if a <= 0 || b <= 0 {
+				return a > 0 && b <= 0
+			}
+			return a < b
+		})
 	}
 }
 
 // handleProxySwitch handles switching the active proxy in a group
 func (s *Server) handleProxySwitch(w http.ResponseWriter, r *http.Request) {
-	log.Printf("ProxySwitch: Received request - Method: %s, URL: %s", r.Method, r.URL.String())
-
 	if r.Method != http.MethodPost && r.Method != "PUT" {
-		log.Printf("ProxySwitch: Method not allowed - %s", r.Method)
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(w)
 		return
 	}
 
-	if s.clashClient == nil {
-		log.Printf("ProxySwitch: Clash API not configured")
-		http.Error(w, "Clash API not configured", http.StatusBadRequest)
+	client := s.clashAPIClient()
+	if client == nil {
+		writeJSONError(w, http.StatusBadRequest, ErrCodeNotConfigured, "Clash API not configured")
 		return
 	}
 
 	if err := r.ParseForm(); err != nil {
-		log.Printf("ProxySwitch: Failed to parse form - %v", err)
-		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		writeBodyError(w, err, "Failed to parse form")
 		return
 	}
 
 	groupName := r.FormValue("group")
 	proxyName := r.FormValue("proxy")
 
-	log.Printf("ProxySwitch: Parsed values - Group: '%s', Proxy: '%s'", groupName, proxyName)
-
 	if groupName == "" || proxyName == "" {
-		log.Printf("ProxySwitch: Missing parameters - Group: '%s', Proxy: '%s'", groupName, proxyName)
-		http.Error(w, "Group and proxy names are required", http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, "Group and proxy names are required")
 		return
 	}
 
-	log.Printf("ProxySwitch: Attempting to switch group '%s' to proxy '%s'", groupName, proxyName)
-	if err := s.clashClient.SwitchProxy(groupName, proxyName); err != nil {
-		log.Printf("ProxySwitch: Error switching proxy: %v", err)
-		http.Error(w, "Failed to switch proxy: "+err.Error(), http.StatusInternalServerError)
+	logger := requestLogger(r).With("group", groupName, "proxy", proxyName)
+	if err := client.SwitchProxy(r.Context(), groupName, proxyName); err != nil {
+		logger.Error("failed to switch proxy", "error", err)
+		writeJSONError(w, http.StatusBadGateway, ErrCodeUpstream, "Failed to switch proxy: "+err.Error())
 		return
 	}
 
-	log.Printf("ProxySwitch: Successfully switched group '%s' to proxy '%s'", groupName, proxyName)
+	logger.Info("switched proxy")
 
 	// Return updated proxy groups
 	w.Header().Set("HX-Trigger", "proxySwitched")
 	s.handleProxiesGroups(w, r)
 }
 
+// ProxySwitch is one group selection in a batch switch request
+type ProxySwitch struct {
+	Group string `json:"group"`
+	Proxy string `json:"proxy"`
+}
+
+// ProxySwitchMultipleRequest represents a request to switch several groups
+type ProxySwitchMultipleRequest struct {
+	Switches []ProxySwitch `json:"switches"`
+}
+
+// ProxySwitchResult reports the outcome of one selection. Changed is false
+// when the group already had the requested proxy selected.
+type ProxySwitchResult struct {
+	Group   string `json:"group"`
+	Proxy   string `json:"proxy"`
+	Success bool   `json:"success"`
+	Changed bool   `json:"changed"`
+	Error   string `json:"error,omitempty"`
+}
+
+// ProxySwitchMultipleResponse represents the response from a batch switch
+type ProxySwitchMultipleResponse struct {
+	Success bool                `json:"success"`
+	Results []ProxySwitchResult `json:"results"`
+}
+
+// handleProxySwitchMultiple switches several groups in one request. Every
+// selection is attempted and reported on its own, so one bad group doesn't
+// stop the rest. Groups already on the requested proxy are left alone, which
+// makes resubmitting the same selections harmless.
+func (s *Server) handleProxySwitchMultiple(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	client := s.clashAPIClient()
+	if client == nil {
+		writeJSONError(w, http.StatusBadRequest, ErrCodeNotConfigured, "Clash API not configured")
+		return
+	}
+
+	var req ProxySwitchMultipleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeBodyError(w, err, "Invalid request body")
+		return
+	}
+
+	if len(req.Switches) == 0 {
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, "At least one switch is required")
+		return
+	}
+
+	// Current selections let unchanged groups be skipped. If they can't be
+	// fetched every switch is still attempted.
+	groups, err := client.GetProxyGroups(r.Context())
+	if err != nil {
+		requestLogger(r).Warn("failed to get proxy groups", "error", err)
+	}
+
+	response := ProxySwitchMultipleResponse{
+		Success: true,
+		Results: make([]ProxySwitchResult, 0, len(req.Switches)),
+	}
+	for _, sw := range req.Switches {
+		result := ProxySwitchResult{Group: sw.Group, Proxy: sw.Proxy}
+		logger := requestLogger(r).With("group", sw.Group, "proxy", sw.Proxy)
+
+		switch {
+		case sw.Group == "" || sw.Proxy == "":
+			result.Error = "Group and proxy names are required"
+		case groups != nil && groups[sw.Group].Now == sw.Proxy:
+			result.Success = true
+		default:
+			if err := client.SwitchProxy(r.Context(), sw.Group, sw.Proxy); err != nil {
+				logger.Error("failed to switch proxy", "error", err)
+				result.Error = err.Error()
+				break
+			}
+			logger.Info("switched proxy")
+			result.Success = true
+			result.Changed = true
+			if groups != nil {
+				group := groups[sw.Group]
+				group.Now = sw.Proxy
+				groups[sw.Group] = group
+			}
+		}
+
+		if !result.Success {
+			response.Success = false
+		}
+		response.Results = append(response.Results, result)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("HX-Trigger", "proxySwitched")
+	json.NewEncoder(w).Encode(response)
+}
+
+// handleProxyMode shows the running instance's global mode on GET and
+// switches it on POST. Switching only affects the live instance, not the
+// config file.
+func (s *Server) handleProxyMode(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	client := s.clashAPIClient()
+	if client == nil {
+		writeJSONError(w, http.StatusBadRequest, ErrCodeNotConfigured, "Clash API not configured")
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		if err := r.ParseForm(); err != nil {
+			writeBodyError(w, err, "Failed to parse form")
+			return
+		}
+
+		mode := r.FormValue("mode")
+		if !clash.ValidMode(mode) {
+			writeJSONError(w, http.StatusBadRequest, ErrCodeValidation,
+				fmt.Sprintf("Mode must be one of %s", strings.Join(clash.Modes, ", ")))
+			return
+		}
+
+		if err := client.SetMode(r.Context(), mode); err != nil {
+			requestLogger(r).Error("failed to set mode", "mode", mode, "error", err)
+			writeJSONError(w, http.StatusBadGateway, ErrCodeUpstream, "Failed to set mode: "+err.Error())
+			return
+		}
+		requestLogger(r).Info("switched mode", "mode", mode)
+		w.Header().Set("HX-Trigger", "modeSwitched")
+	}
+
+	mode, err := client.GetMode(r.Context())
+	if err != nil {
+		requestLogger(r).Error("failed to get mode", "error", err)
+		writeJSONError(w, http.StatusBadGateway, ErrCodeUpstream, "Failed to get mode: "+err.Error())
+		return
+	}
+
+	data := map[string]interface{}{
+		"Mode":  mode,
+		"Modes": clash.Modes,
+	}
+
+	if err := s.renderTemplate(w, "proxy-mode.html", data); err != nil {
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to render the page", err)
+	}
+}
+
 // handleProxyDelayTest handles testing proxy delay
 func (s *Server) handleProxyDelayTest(w http.ResponseWriter, r *http.Request) {
-	if s.clashClient == nil {
-		http.Error(w, "Clash API not configured", http.StatusBadRequest)
+	client := s.clashAPIClient()
+	if client == nil {
+		writeJSONError(w, http.StatusBadRequest, ErrCodeNotConfigured, "Clash API not configured")
 		return
 	}
 
 	proxyName := r.URL.Query().Get("name")
 	if proxyName == "" {
-		http.Error(w, "Proxy name is required", http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, "Proxy name is required")
+		return
+	}
+
+	if !s.allowDelayTests(w, []string{proxyName}) {
 		return
 	}
 
@@ -177,12 +506,16 @@ func (s *Server) handleProxyDelayTest(w http.ResponseWriter, r *http.Request) {
 	timeoutStr := r.URL.Query().Get("timeout")
 	timeout := 5000
 	if timeoutStr != "" {
-		if t, err := strconv.Atoi(timeoutStr); err == nil {
+		if t, err := strconv.Atoi(timeoutStr); err == nil && t > 0 {
 			timeout = t
 		}
 	}
 
-	delay, err := s.clashClient.TestProxyDelay(proxyName, testURL, timeout)
+	ctx, cancel := delayTestContext(r.Context(), timeout)
+	defer cancel()
+
+	delay, err := client.TestProxyDelay(ctx, proxyName, testURL, timeout)
+	s.recordProxyDelays(r, delayTestResult{Name: proxyName, Delay: delay})
 	if err != nil {
 		// Return error but don't fail completely
 		response := map[string]interface{}{
@@ -208,20 +541,30 @@ func (s *Server) handleProxyDelayTest(w http.ResponseWriter, r *http.Request) {
 
 // handleProxyGroupDelayTest handles testing all proxies in a group
 func (s *Server) handleProxyGroupDelayTest(w http.ResponseWriter, r *http.Request) {
-	if s.clashClient == nil {
-		http.Error(w, "Clash API not configured", http.StatusBadRequest)
+	client := s.clashAPIClient()
+	if client == nil {
+		writeJSONError(w, http.StatusBadRequest, ErrCodeNotConfigured, "Clash API not configured")
 		return
 	}
 
 	groupName := r.URL.Query().Get("group")
 	if groupName == "" {
-		http.Error(w, "Group name is required", http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, "Group name is required")
 		return
 	}
 
-	proxy, err := s.clashClient.GetProxy(groupName)
+	proxy, err := client.GetProxy(r.Context(), groupName)
 	if err != nil {
-		http.Error(w, "Failed to get proxy group: "+err.Error(), http.StatusInternalServerError)
+		writeJSONError(w, http.StatusBadGateway, ErrCodeUpstream, "Failed to get proxy group: "+err.Error())
+		return
+	}
+	if !proxy.IsGroup() {
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, fmt.Sprintf("%q is not a proxy group", groupName))
+		return
+	}
+
+	// Every member counts against its own limit, as if tested one by one
+	if !s.allowDelayTests(w, proxy.All) {
 		return
 	}
 
@@ -229,25 +572,26 @@ func (s *Server) handleProxyGroupDelayTest(w http.ResponseWriter, r *http.Reques
 	timeoutStr := r.URL.Query().Get("timeout")
 	timeout := 5000
 	if timeoutStr != "" {
-		if t, err := strconv.Atoi(timeoutStr); err == nil {
+		if t, err := strconv.Atoi(timeoutStr); err == nil && t > 0 {
 			timeout = t
 		}
 	}
 
-	results := make([]map[string]interface{}, 0)
-	for _, proxyName := range proxy.All {
-		delay, err := s.clashClient.TestProxyDelay(proxyName, testURL, timeout)
-		result := map[string]interface{}{
-			"name": proxyName,
-		}
-		if err != nil {
-			result["delay"] = 0
-			result["error"] = err.Error()
-			result["timeout"] = strings.Contains(err.Error(), "timeout") || strings.Contains(err.Error(), "context deadline exceeded")
-		} else {
-			result["delay"] = delay
-		}
-		results = append(results, result)
+	if r.URL.Query().Get("stream") == "true" {
+		s.streamProxyDelays(w, r, groupName, proxy.All, testURL, timeout)
+		return
+	}
+
+	// Results keep the group's member order; nodes that fail still report
+	results := make([]delayTestResult, len(proxy.All))
+	s.testProxyDelays(r.Context(), proxy.All, testURL, timeout, func(i int, result delayTestResult) {
+		results[i] = result
+	})
+	s.recordProxyDelays(r, results...)
+
+	// Nothing to send once the browser has gone away
+	if r.Context().Err() != nil {
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -256,3 +600,176 @@ func (s *Server) handleProxyGroupDelayTest(w http.ResponseWriter, r *http.Reques
 		"results": results,
 	})
 }
+
+// delayTestContext bounds a single delay test by its requested timeout in
+// milliseconds, and cancels it when the incoming request is cancelled
+func delayTestContext(parent context.Context, timeout int) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(parent, time.Duration(timeout)*time.Millisecond+delayTestGrace)
+}
+
+// streamProxyDelays reports a group's delay tests as server-sent events: a
+// "start" event with the node count, one "result" event per node as soon as its
+// test finishes, and a final "done" event
+func (s *Server) streamProxyDelays(w http.ResponseWriter, r *http.Request, groupName string, names []string, testURL string, timeout int) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSONError(w, http.StatusInternalServerError, ErrCodeInternal, "Streaming not supported")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	writeEvent := func(event string, data interface{}) {
+		payload, err := json.Marshal(data)
+		if err != nil {
+			requestLogger(r).Error("failed to encode event", "event", event, "error", err)
+			return
+		}
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+		flusher.Flush()
+	}
+
+	writeEvent("start", map[string]interface{}{
+		"group": groupName,
+		"total": len(names),
+	})
+
+	var results []delayTestResult
+	s.testProxyDelays(r.Context(), names, testURL, timeout, func(_ int, result delayTestResult) {
+		results = append(results, result)
+		writeEvent("result", result)
+	})
+	s.recordProxyDelays(r, results...)
+
+	if r.Context().Err() != nil {
+		return
+	}
+	writeEvent("done", map[string]interface{}{
+		"group": groupName,
+	})
+}
+
+// testProxyDelays runs delay tests for the named proxies on a bounded pool of
+// workers. report is called from the calling goroutine with each result's index
+// as it completes. Tests not yet started are skipped once ctx is cancelled.
+func (s *Server) testProxyDelays(ctx context.Context, names []string, testURL string, timeout int, report func(int, delayTestResult)) {
+	type indexedResult struct {
+		index  int
+		result delayTestResult
+	}
+
+	jobs := make(chan int)
+	done := make(chan indexedResult)
+
+	workers := s.delayTestConcurrency
+	if workers <= 0 {
+		workers = DefaultDelayTestConcurrency
+	}
+	if len(names) < workers {
+		workers = len(names)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range jobs {
+				done <- indexedResult{index, s.testProxyDelay(ctx, names[index], testURL, timeout)}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+		for i := range names {
+			select {
+			case jobs <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	for r := range done {
+		report(r.index, r.result)
+	}
+}
+
+// testProxyDelay runs a single delay test bounded by its own timeout. It runs
+// on worker goroutines, so a panic is reported as a failed test rather than
+// crashing the server.
+func (s *Server) testProxyDelay(ctx context.Context, name, testURL string, timeout int) (result delayTestResult) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			logPanic(loggerFromContext(ctx), recovered)
+			result = delayTestResult{Name: name, Error: "internal error"}
+		}
+	}()
+
+	ctx, cancel := delayTestContext(ctx, timeout)
+	defer cancel()
+
+	result = delayTestResult{Name: name}
+	delay, err := s.clashAPIClient().TestProxyDelay(ctx, name, testURL, timeout)
+	if err != nil {
+		result.Error = err.Error()
+		result.Timeout = strings.Contains(err.Error(), "timeout") || strings.Contains(err.Error(), "context deadline exceeded")
+		return result
+	}
+	result.Delay = delay
+	return result
+}
+
+// recordProxyDelays stores delay test results as each proxy's last test.
+// Tests skipped because the request was cancelled are not recorded.
+func (s *Server) recordProxyDelays(r *http.Request, results ...delayTestResult) {
+	if s.proxyStats == nil {
+		return
+	}
+
+	now := time.Now()
+	recorded := false
+	for _, result := range results {
+		if result.Name == "" || (result.Delay <= 0 && r.Context().Err() != nil) {
+			continue
+		}
+		s.proxyStats.Record(result.Name, result.Delay, now)
+		recorded = true
+	}
+	if !recorded {
+		return
+	}
+
+	if err := s.proxyStats.Save(); err != nil {
+		requestLogger(r).Warn("failed to save proxy stats", "error", err)
+	}
+}
+
+// pruneProxyStats drops the stats of proxies Clash no longer reports. An
+// empty list is ignored so that a sing-box still starting up doesn't wipe them.
+func (s *Server) pruneProxyStats(r *http.Request, proxies map[string]clash.Proxy) {
+	if s.proxyStats == nil || len(proxies) == 0 {
+		return
+	}
+
+	existing := make(map[string]bool, len(proxies))
+	for name := range proxies {
+		existing[name] = true
+	}
+	if !s.proxyStats.Prune(existing) {
+		return
+	}
+
+	if err := s.proxyStats.Save(); err != nil {
+		requestLogger(r).Warn("failed to save proxy stats", "error", err)
+	}
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultDelayTestRateLimit is how many delay tests a single proxy may get
+// per minute unless overridden with SetDelayTestRateLimit
+const DefaultDelayTestRateLimit = 10
+
+// delayTestBurst caps how many delay tests of one proxy can run back to back
+// before the per-minute rate applies
+const delayTestBurst = 3
+
+// maxIdleBuckets is how many buckets are kept before full ones are pruned
+const maxIdleBuckets = 1024
+
+// tokenBucket holds the tokens left for one key as of last
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter is a token bucket rate limiter keyed by name. A nil limiter
+// allows everything.
+type rateLimiter struct {
+	mu      sync.Mutex
+	rate    float64 // tokens added per second
+	burst   float64
+	buckets map[string]*tokenBucket
+}
+
+// newRateLimiter allows perMinute requests per key, at most burst at once.
+// It returns nil, disabling limiting, when perMinute is not positive.
+func newRateLimiter(perMinute, burst int) *rateLimiter {
+	if perMinute <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{
+		rate:    float64(perMinute) / 60,
+		burst:   float64(burst),
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// allowAll takes one token for every key, or none if any key is out of
+// tokens. In that case it returns how long until all of them have one.
+func (l *rateLimiter) allowAll(keys []string, now time.Time) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var wait time.Duration
+	for _, key := range keys {
+		bucket := l.refill(key, now)
+		if bucket.tokens < 1 {
+			missing := time.Duration((1 - bucket.tokens) / l.rate * float64(time.Second))
+			if missing > wait {
+				wait = missing
+			}
+		}
+	}
+	if wait > 0 {
+		return false, wait
+	}
+
+	for _, key := range keys {
+		l.buckets[key].tokens--
+	}
+	return true, 0
+}
+
+// refill returns the bucket for key topped up to now, creating a full one if
+// needed
+func (l *rateLimiter) refill(key string, now time.Time) *tokenBucket {
+	bucket, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= maxIdleBuckets {
+			l.prune(now)
+		}
+		bucket = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = bucket
+		return bucket
+	}
+
+	elapsed := now.Sub(bucket.last).Seconds()
+	if elapsed > 0 {
+		bucket.tokens = math.Min(l.burst, bucket.tokens+elapsed*l.rate)
+		bucket.last = now
+	}
+	return bucket
+}
+
+// prune drops buckets that have refilled completely, since a new bucket
+// starts out full anyway
+func (l *rateLimiter) prune(now time.Time) {
+	for key, bucket := range l.buckets {
+		if bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// SetDelayTestRateLimit sets how many delay tests each proxy may get per
+// minute, counting single and group tests alike. Zero disables the limit.
+func (s *Server) SetDelayTestRateLimit(perMinute int) {
+	burst := delayTestBurst
+	if perMinute < burst {
+		burst = perMinute
+	}
+	s.delayTestLimiter = newRateLimiter(perMinute, burst)
+}
+
+// allowDelayTests takes a delay test token for each proxy. If any of them is
+// rate limited it writes a 429 with Retry-After and returns false, without
+// using up the others' tokens.
+func (s *Server) allowDelayTests(w http.ResponseWriter, names []string) bool {
+	ok, wait := s.delayTestLimiter.allowAll(names, time.Now())
+	if ok {
+		return true
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	writeJSONError(w, http.StatusTooManyRequests, ErrCodeRateLimited, "Too many delay tests, try again in "+wait.Round(time.Second).String())
+	return false
+}
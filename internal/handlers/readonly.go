@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+)
+
+// readOnlyAllowed lists API paths that accept non-GET requests but don't
+// change the config or the running service, so they stay available in
+// read-only mode
+var readOnlyAllowed = map[string]bool{
+	"/api/proxies/delay-test":       true,
+	"/api/proxies/group-delay-test": true,
+	"/api/clash/test":               true,
+	"/api/rules/preview":            true,
+	"/api/dns/rules/preview":        true,
+	"/api/config/normalize":         true,
+	"/api/ui-state":                 true,
+}
+
+// withReadOnly rejects mutating API requests with a 403 when the server runs
+// in read-only mode. Pages, lists and monitoring views keep working.
+func (s *Server) withReadOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.readOnly && strings.HasPrefix(r.URL.Path, "/api/") && !isSafeMethod(r.Method) && !readOnlyAllowed[r.URL.Path] {
+			writeJSONError(w, http.StatusForbidden, ErrCodeReadOnly, "Server is running in read-only mode")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// SetReadOnly enables or disables read-only mode
+func (s *Server) SetReadOnly(readOnly bool) {
+	s.readOnly = readOnly
+}
+
+// isSafeMethod reports whether an HTTP method is read-only by definition
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
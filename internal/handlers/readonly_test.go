@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/matinhimself/singbox-web-config/internal/config"
+	"github.com/matinhimself/singbox-web-config/webassets"
+)
+
+const testConfig = `{"outbounds":[{"type":"direct","tag":"a"},{"type":"direct","tag":"b"},{"type":"selector","tag":"select","outbounds":["a","b"]}],"route":{"rules":[{"domain":"example.com","outbound":"a"}]}}`
+
+// newTestServer returns a server over an in-memory config with its templates
+// and routes set up, without a service or a Clash API
+func newTestServer(t *testing.T, data string) (*Server, *config.MemoryStore) {
+	t.Helper()
+	store := config.NewMemoryStore([]byte(data))
+	s := &Server{
+		mux:           http.NewServeMux(),
+		configManager: config.NewManagerWithStore(store),
+		templatesFS:   webassets.TemplatesFS,
+		staticFS:      webassets.StaticFS,
+		stop:          make(chan struct{}),
+	}
+	if err := s.loadTemplates(); err != nil {
+		t.Fatal(err)
+	}
+	s.setupRoutes()
+	return s, store
+}
+
+// mutatingRoutes are the API routes that change the config, the service or
+// saved state, with a query that would let a GET act on the test config
+var mutatingRoutes = []string{
+	"/api/rules/create",
+	"/api/rules/delete?index=0",
+	"/api/rules/update?index=0",
+	"/api/rules/reorder?from=0&to=0",
+	"/api/dns/rules/create",
+	"/api/dns/rules/update?index=0",
+	"/api/dns/rules/delete?index=0",
+	"/api/outbounds/create?type=direct&tag=c",
+	"/api/outbounds/update?original_tag=a&type=direct&tag=c",
+	"/api/outbounds/delete?tag=a",
+	"/api/outbounds/reorder?fromTag=a&toTag=b",
+	"/api/outbounds/rename?old_tag=a&new_tag=c",
+	"/api/outbounds/toggle?tag=a",
+	"/api/outbounds/clone?tag=a",
+	"/api/outbounds/apply-test?tag=a",
+	"/api/outbounds/group/update?tag=select&outbounds[]=a",
+	"/api/endpoints/create",
+	"/api/endpoints/update",
+	"/api/endpoints/delete?tag=a",
+	"/api/endpoints/rename",
+	"/api/geo/update",
+	"/api/rule-actions/create",
+	"/api/rule-actions/update",
+	"/api/rule-actions/delete",
+	"/api/service/start",
+	"/api/service/stop",
+	"/api/service/restart",
+	"/api/service/enable",
+	"/api/service/disable",
+	"/api/service/apply",
+	"/api/config/restore",
+	"/api/config/create-backup",
+	"/api/config/backups/pin",
+	"/api/connections/create-rule",
+	"/api/clash/update",
+}
+
+func TestReadOnlyRejectsMutatingGETs(t *testing.T) {
+	for _, route := range mutatingRoutes {
+		t.Run(route, func(t *testing.T) {
+			s, store := newTestServer(t, testConfig)
+			s.SetReadOnly(true)
+
+			rec := httptest.NewRecorder()
+			s.withReadOnly(s.mux).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, route, nil))
+
+			if rec.Code != http.StatusForbidden && rec.Code != http.StatusMethodNotAllowed {
+				t.Errorf("GET %s = %d, want 403 or 405", route, rec.Code)
+			}
+			if data, _ := store.Read(); string(data) != testConfig {
+				t.Errorf("GET %s changed the config to %s", route, data)
+			}
+		})
+	}
+}
+
+func TestReadOnlyRejectsMutatingPOSTs(t *testing.T) {
+	// GET /api/rules/bulk-domains shows the import form, so only its POST
+	// is checked
+	for _, route := range append(mutatingRoutes, "/api/rules/bulk-domains") {
+		t.Run(route, func(t *testing.T) {
+			s, _ := newTestServer(t, testConfig)
+			s.SetReadOnly(true)
+
+			rec := httptest.NewRecorder()
+			s.withReadOnly(s.mux).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, route, nil))
+
+			if rec.Code != http.StatusForbidden {
+				t.Errorf("POST %s = %d, want 403", route, rec.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+)
+
+// withRecovery turns a panicking handler into a 500 response instead of a
+// dropped connection. It only covers the handler's own goroutine; goroutines
+// started by handlers must defer recoverGoroutine themselves.
+func withRecovery(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			// net/http uses ErrAbortHandler to abort a response on purpose
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+
+			logPanic(requestLogger(r), recovered)
+
+			// Nothing useful can be sent once the response has started
+			if rec, ok := w.(*statusRecorder); ok && rec.wroteHeader {
+				return
+			}
+			writeJSONError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal server error")
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// recoverGoroutine logs a panic in a goroutine started by a handler so it
+// doesn't take the whole server down. It must be deferred directly.
+func recoverGoroutine(logger *slog.Logger) {
+	if recovered := recover(); recovered != nil {
+		logPanic(logger, recovered)
+	}
+}
+
+// logPanic logs a recovered panic value along with the stack trace
+func logPanic(logger *slog.Logger, recovered interface{}) {
+	logger.Error("recovered from panic",
+		"panic", fmt.Sprint(recovered),
+		"stack", string(debug.Stack()),
+	)
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/matinhimself/singbox-web-config/internal/config"
+)
+
+// handleRouteSettings renders the route settings form on GET and saves it on
+// POST
+func (s *Server) handleRouteSettings(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.renderRouteSettings(w, r, false)
+	case http.MethodPost:
+		s.handleRouteSettingsUpdate(w, r)
+	default:
+		writeMethodNotAllowed(w)
+	}
+}
+
+// handleRouteSettingsUpdate saves the route settings form
+func (s *Server) handleRouteSettingsUpdate(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeBodyError(w, err, "Failed to parse form")
+		return
+	}
+
+	settings := config.RouteSettings{
+		Final:                 strings.TrimSpace(r.FormValue("final")),
+		AutoDetectInterface:   r.FormValue("auto_detect_interface") == "on",
+		OverrideAndroidVPN:    r.FormValue("override_android_vpn") == "on",
+		DefaultDomainResolver: strings.TrimSpace(r.FormValue("default_domain_resolver")),
+	}
+
+	if mark := strings.TrimSpace(r.FormValue("default_mark")); mark != "" {
+		value, err := strconv.ParseUint(mark, 0, 32)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, "Default mark must be a number between 0 and 4294967295")
+			return
+		}
+		settings.DefaultMark = uint32(value)
+	}
+
+	if settings.Final != "" {
+		tags, err := s.configManager.GetRouteTargetTags()
+		if err != nil {
+			requestLogger(r).Error("failed to get outbound tags", "error", err)
+			writeInternalError(w, err, "Failed to get outbounds")
+			return
+		}
+		if !contains(tags, settings.Final) {
+			writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, fmt.Sprintf("Final outbound %q does not exist", settings.Final))
+			return
+		}
+	}
+
+	if err := s.configManager.UpdateRouteOptions(settings); err != nil {
+		requestLogger(r).Error("failed to update route settings", "error", err)
+		writeInternalError(w, err, "Failed to save route settings")
+		return
+	}
+
+	noteChange(r, "updated route settings")
+
+	s.reloadService(r)
+
+	w.Header().Set("HX-Trigger", "routeSettingsUpdated")
+	s.renderRouteSettings(w, r, true)
+}
+
+// renderRouteSettings renders the route settings form with the current values
+func (s *Server) renderRouteSettings(w http.ResponseWriter, r *http.Request, saved bool) {
+	settings, err := s.configManager.GetRouteOptions()
+	if err != nil {
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to load route settings", err)
+		return
+	}
+
+	tags, err := s.configManager.GetRouteTargetTags()
+	if err != nil {
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to load route settings", err)
+		return
+	}
+
+	data := map[string]interface{}{
+		"Settings": settings,
+		"Tags":     tags,
+		// A final that no longer exists is still shown so it can be fixed
+		"FinalMissing": settings.Final != "" && !contains(tags, settings.Final),
+		"Saved":        saved,
+	}
+
+	if err := s.renderTemplate(w, "route-settings.html", data); err != nil {
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to render the page", err)
+	}
+}
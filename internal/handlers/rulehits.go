@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/matinhimself/singbox-web-config/internal/types"
+)
+
+// DefaultRuleHitWindow is how long rule hit counts accumulate before they
+// are reset
+const DefaultRuleHitWindow = 10 * time.Minute
+
+// ruleHitSampleInterval is how often the Clash connections are sampled
+const ruleHitSampleInterval = 5 * time.Second
+
+// ruleHits counts the distinct connections matched by each rule during the
+// current window. Rules are keyed by the rule string Clash reports for a
+// connection.
+type ruleHits struct {
+	mu          sync.Mutex
+	window      time.Duration
+	windowStart time.Time
+	// seen maps a connection ID to the rule it matched, so a connection that
+	// stays open across samples is only counted once
+	seen map[string]string
+}
+
+func newRuleHits(window time.Duration) *ruleHits {
+	return &ruleHits{
+		window:      window,
+		windowStart: time.Now(),
+		seen:        make(map[string]string),
+	}
+}
+
+// record adds a snapshot of connections, starting a new window first if the
+// current one has expired
+func (h *ruleHits) record(connections []types.ClashConnection, now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if now.Sub(h.windowStart) >= h.window {
+		h.windowStart = now
+		h.seen = make(map[string]string)
+	}
+
+	for _, conn := range connections {
+		if conn.ID == "" {
+			continue
+		}
+		h.seen[conn.ID] = ruleHitKey(conn)
+	}
+}
+
+// counts returns the number of connections per rule key in this window
+func (h *ruleHits) counts() map[string]int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	counts := make(map[string]int)
+	for _, key := range h.seen {
+		counts[key]++
+	}
+	return counts
+}
+
+// ruleHitKey identifies the rule a connection matched. sing-box puts the
+// whole rule in "rule", while Clash splits it into a type and a payload.
+func ruleHitKey(conn types.ClashConnection) string {
+	if conn.RulePayload == "" {
+		return conn.Rule
+	}
+	return fmt.Sprintf("%s(%s)", conn.Rule, conn.RulePayload)
+}
+
+// SetRuleHitWindow sets how long rule hit counts accumulate. Zero disables
+// sampling. It must be called before Start.
+func (s *Server) SetRuleHitWindow(window time.Duration) {
+	s.ruleHitWindow = window
+}
+
+// sampleRuleHits polls the Clash connections until stop is closed. Sampling
+// is skipped while the Clash API isn't configured.
+func (s *Server) sampleRuleHits(stop <-chan struct{}) {
+	defer recoverGoroutine(slog.Default())
+
+	ticker := time.NewTicker(ruleHitSampleInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		client := s.clashAPIClient()
+		if client == nil {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), ruleHitSampleInterval)
+		snapshot, err := client.GetConnections(ctx)
+		cancel()
+		if err != nil {
+			slog.Debug("failed to sample connections for rule hits", "error", err)
+			continue
+		}
+		s.ruleHits.record(snapshot.Connections, time.Now())
+	}
+}
+
+// matchRuleHits attributes hit counts to configured rules. The reported rule
+// strings are only descriptions, so a hit is credited to the first rule whose
+// values all appear in it, mirroring sing-box's first-match routing. Hits
+// that match no rule, such as "final", are returned by key.
+func matchRuleHits(rules []interface{}, hits map[string]int) ([]int, map[string]int) {
+	perRule := make([]int, len(rules))
+	unmatched := make(map[string]int)
+
+	keys := make([]string, 0, len(hits))
+	for key := range hits {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		matched := false
+		for i, rule := range rules {
+			if ruleMatchesHit(rule, key) {
+				perRule[i] += hits[key]
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			unmatched[key] += hits[key]
+		}
+	}
+
+	return perRule, unmatched
+}
+
+// ruleMatchesHit reports whether a reported rule string describes rule
+func ruleMatchesHit(rule interface{}, hit string) bool {
+	ruleMap, ok := rule.(map[string]interface{})
+	if !ok {
+		return false
+	}
+
+	// sing-box appends the action, e.g. "=> route(proxy)"
+	if outbound, ok := ruleMap["outbound"].(string); ok && outbound != "" && strings.Contains(hit, "=>") {
+		if !strings.Contains(hit, "route("+outbound+")") {
+			return false
+		}
+	}
+
+	tokens := ruleHitTokens(ruleMap)
+	if len(tokens) == 0 {
+		return false
+	}
+	for _, token := range tokens {
+		if !strings.Contains(hit, token) {
+			return false
+		}
+	}
+	return true
+}
+
+// ruleHitFieldsIgnored are rule fields that describe the action rather than
+// what the rule matches
+var ruleHitFieldsIgnored = map[string]bool{
+	"type":     true,
+	"mode":     true,
+	"rules":    true,
+	"invert":   true,
+	"action":   true,
+	"outbound": true,
+}
+
+// ruleHitTokens lists the strings a rule's description must contain: every
+// matched value, or the field name for flags such as ip_is_private. Logical
+// rules contribute the tokens of their sub-rules.
+func ruleHitTokens(rule map[string]interface{}) []string {
+	var tokens []string
+	for field, value := range rule {
+		if ruleHitFieldsIgnored[field] || strings.HasPrefix(field, "override_") {
+			continue
+		}
+		switch v := value.(type) {
+		case string:
+			tokens = append(tokens, v)
+		case float64:
+			tokens = append(tokens, fmt.Sprint(v))
+		case bool:
+			if v {
+				tokens = append(tokens, field)
+			}
+		case []interface{}:
+			for _, item := range v {
+				tokens = append(tokens, fmt.Sprint(item))
+			}
+		}
+	}
+
+	if nested, ok := rule["rules"].([]interface{}); ok {
+		for _, subRule := range nested {
+			if subRuleMap, ok := subRule.(map[string]interface{}); ok {
+				tokens = append(tokens, ruleHitTokens(subRuleMap)...)
+			}
+		}
+	}
+	return tokens
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"strings"
+)
+
+// ruleClashMode returns the clash_mode a rule is gated on, or "" if it applies
+// in every mode. A logical "and" rule is gated by any of its sub-rules' modes;
+// an "or" rule only if every branch is gated on the same mode.
+func ruleClashMode(rule interface{}) string {
+	ruleMap, ok := rule.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	if invert, _ := ruleMap["invert"].(bool); invert {
+		return ""
+	}
+	if mode, ok := ruleMap["clash_mode"].(string); ok && mode != "" {
+		return mode
+	}
+
+	if ruleType, _ := ruleMap["type"].(string); ruleType != "logical" {
+		return ""
+	}
+	subRules, _ := ruleMap["rules"].([]interface{})
+	if len(subRules) == 0 {
+		return ""
+	}
+
+	if mode, _ := ruleMap["mode"].(string); mode == "or" {
+		first := ruleClashMode(subRules[0])
+		for _, subRule := range subRules[1:] {
+			if !strings.EqualFold(ruleClashMode(subRule), first) {
+				return ""
+			}
+		}
+		return first
+	}
+	for _, subRule := range subRules {
+		if mode := ruleClashMode(subRule); mode != "" {
+			return mode
+		}
+	}
+	return ""
+}
+
+// ruleModes returns the clash_mode of each rule, or nil if no rule is gated
+// on one
+func ruleModes(rules []interface{}) []string {
+	modes := make([]string, len(rules))
+	gated := false
+	for i, rule := range rules {
+		modes[i] = ruleClashMode(rule)
+		gated = gated || modes[i] != ""
+	}
+	if !gated {
+		return nil
+	}
+	return modes
+}
+
+// inactiveRules marks the rules gated on a mode other than the live one.
+// sing-box compares modes case-insensitively.
+func inactiveRules(modes []string, liveMode string) []bool {
+	inactive := make([]bool, len(modes))
+	for i, mode := range modes {
+		inactive[i] = mode != "" && !strings.EqualFold(mode, liveMode)
+	}
+	return inactive
+}
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Port fields of route rules. sing-box takes single ports as integers and
+// ranges as "start:end", where either end may be left open.
+var (
+	rulePortFields      = []string{"port", "source_port"}
+	rulePortRangeFields = []string{"port_range", "source_port_range"}
+)
+
+// checkRulePorts corrects port ranges written with a dash and validates the
+// rule's ports. It returns a warning describing any corrections, and an
+// error listing every port that is still invalid.
+func checkRulePorts(rule map[string]interface{}) (string, error) {
+	warning := strings.Join(fixRulePortRanges(rule), "; ")
+
+	errs := validateRulePorts(rule)
+	if len(errs) == 0 {
+		return warning, nil
+	}
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Error()
+	}
+	return warning, errors.New(strings.Join(messages, "; "))
+}
+
+// fixRulePortRanges rewrites ranges written as "start-end" to "start:end" in
+// a rule and its logical sub-rules, returning a note for each one changed
+func fixRulePortRanges(rule map[string]interface{}) []string {
+	return fixPortRangesAt(rule, "")
+}
+
+func fixPortRangesAt(rule map[string]interface{}, prefix string) []string {
+	var notes []string
+	fix := func(field, value string) string {
+		fixed, ok := fixPortRange(value)
+		if !ok {
+			return value
+		}
+		notes = append(notes, fmt.Sprintf("%s%s %q was changed to %q", prefix, field, value, fixed))
+		return fixed
+	}
+
+	for _, field := range rulePortRangeFields {
+		switch value := rule[field].(type) {
+		case string:
+			rule[field] = fix(field, value)
+		case []string:
+			for i, item := range value {
+				value[i] = fix(field, item)
+			}
+		case []interface{}:
+			for i, item := range value {
+				if s, ok := item.(string); ok {
+					value[i] = fix(field, s)
+				}
+			}
+		}
+	}
+
+	subRules, _ := rule["rules"].([]interface{})
+	for i, item := range subRules {
+		if subRule, ok := item.(map[string]interface{}); ok {
+			notes = append(notes, fixPortRangesAt(subRule, fmt.Sprintf("%srules[%d].", prefix, i))...)
+		}
+	}
+	return notes
+}
+
+// fixPortRange returns the "start:end" form of a range written as
+// "start-end", and false for anything else
+func fixPortRange(value string) (string, bool) {
+	start, end, found := strings.Cut(value, "-")
+	if !found || strings.Contains(value, ":") {
+		return "", false
+	}
+	start, end = strings.TrimSpace(start), strings.TrimSpace(end)
+	if _, err := parsePort(start); err != nil {
+		return "", false
+	}
+	if _, err := parsePort(end); err != nil {
+		return "", false
+	}
+	return start + ":" + end, true
+}
+
+// validateRulePorts reports ports outside 1-65535 and malformed port ranges
+// in a rule and its logical sub-rules
+func validateRulePorts(rule map[string]interface{}) []error {
+	return validatePortsAt(rule, "")
+}
+
+func validatePortsAt(rule map[string]interface{}, prefix string) []error {
+	var errs []error
+
+	for _, field := range rulePortFields {
+		for _, value := range portListValues(rule[field]) {
+			if strings.ContainsAny(value, ":-") {
+				errs = append(errs, fmt.Errorf("%s%s %q is a range, which belongs in %s_range", prefix, field, value, field))
+			} else if _, err := parsePort(value); err != nil {
+				errs = append(errs, fmt.Errorf("%s%s %q %v", prefix, field, value, err))
+			}
+		}
+	}
+
+	for _, field := range rulePortRangeFields {
+		for _, value := range portListValues(rule[field]) {
+			if err := validatePortRange(value); err != nil {
+				errs = append(errs, fmt.Errorf("%s%s %q %v", prefix, field, value, err))
+			}
+		}
+	}
+
+	subRules, _ := rule["rules"].([]interface{})
+	for i, item := range subRules {
+		if subRule, ok := item.(map[string]interface{}); ok {
+			errs = append(errs, validatePortsAt(subRule, fmt.Sprintf("%srules[%d].", prefix, i))...)
+		}
+	}
+	return errs
+}
+
+// validatePortRange checks a "start:end" range. Either end may be left open,
+// but not both, and start must not be after end.
+func validatePortRange(value string) error {
+	startStr, endStr, found := strings.Cut(value, ":")
+	if !found {
+		return fmt.Errorf("is not a range of the form start:end")
+	}
+	if startStr == "" && endStr == "" {
+		return fmt.Errorf("needs a start or an end port")
+	}
+
+	start, end := 0, 0
+	if startStr != "" {
+		port, err := parsePort(startStr)
+		if err != nil {
+			return fmt.Errorf("start %v", err)
+		}
+		start = port
+	}
+	if endStr != "" {
+		port, err := parsePort(endStr)
+		if err != nil {
+			return fmt.Errorf("end %v", err)
+		}
+		end = port
+	}
+	if startStr != "" && endStr != "" && start > end {
+		return fmt.Errorf("starts after it ends")
+	}
+	return nil
+}
+
+// parsePort parses a port number between 1 and 65535
+func parsePort(value string) (int, error) {
+	port, err := strconv.Atoi(value)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("is not a port between 1 and 65535")
+	}
+	return port, nil
+}
+
+// portListValues returns the values of a listable port field as strings,
+// whether it holds a single value or a list, from a form or from JSON
+func portListValues(value interface{}) []string {
+	switch value := value.(type) {
+	case nil:
+		return nil
+	case string:
+		return []string{value}
+	case []string:
+		return value
+	case []interface{}:
+		values := make([]string, 0, len(value))
+		for _, item := range value {
+			values = append(values, portListValues(item)...)
+		}
+		return values
+	case float64:
+		return []string{strconv.FormatFloat(value, 'f', -1, 64)}
+	default:
+		return []string{fmt.Sprint(value)}
+	}
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/matinhimself/singbox-web-config/internal/forms"
+)
+
+// RulePreviewResponse is the rule a form would produce, with any problems
+// that would stop sing-box from accepting it
+type RulePreviewResponse struct {
+	Rule     map[string]interface{} `json:"rule"`
+	Errors   []string               `json:"errors"`
+	Warnings []string               `json:"warnings"`
+}
+
+// handleRulePreview builds a rule from the submitted form without saving it.
+// HTMX requests get a rendered preview pane, other clients get JSON.
+func (s *Server) handleRulePreview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		writeBodyError(w, err, "Failed to parse form")
+		return
+	}
+
+	rule := s.buildRuleFromForm(r)
+	response := RulePreviewResponse{
+		Rule:     rule,
+		Errors:   []string{},
+		Warnings: fixRulePortRanges(rule),
+	}
+	if response.Warnings == nil {
+		response.Warnings = []string{}
+	}
+	for _, err := range s.validateRule(rule) {
+		response.Errors = append(response.Errors, err.Error())
+	}
+
+	if r.Header.Get("HX-Request") != "true" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	if err := s.renderTemplate(w, "rule-preview.html", response); err != nil {
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to render the page", err)
+	}
+}
+
+// validateRule reports every problem with a route rule built from the rule
+// form: an unknown action, a route action without a known outbound, a
+// default rule without any condition, a logical rule without a valid mode, or
+// an invalid port or port range.
+func (s *Server) validateRule(rule map[string]interface{}) []error {
+	var errs []error
+
+	action, _ := rule["action"].(string)
+	if action != "" && !contains(s.formBuilder.GetAvailableActionTypes(), action) {
+		errs = append(errs, fmt.Errorf("unknown action %q", action))
+	}
+
+	// An empty action means route
+	if action == "" || action == "route" {
+		outbound, _ := rule["outbound"].(string)
+		if outbound == "" {
+			errs = append(errs, fmt.Errorf("outbound is required for the route action"))
+		} else if tags, err := s.configManager.GetRouteTargetTags(); err == nil && !contains(tags, outbound) {
+			errs = append(errs, fmt.Errorf("outbound %q does not exist", outbound))
+		}
+	}
+
+	// The logical rule form has no type field, so a mode marks one too
+	if ruleType, _ := rule["type"].(string); ruleType == "logical" || rule["mode"] != nil {
+		if mode, _ := rule["mode"].(string); mode != "and" && mode != "or" {
+			errs = append(errs, fmt.Errorf("logical rules need a mode of \"and\" or \"or\""))
+		}
+		if rule["rules"] == nil {
+			errs = append(errs, fmt.Errorf("logical rules need at least one sub-rule"))
+		}
+		return append(errs, validateRulePorts(rule)...)
+	}
+
+	hasCondition := false
+	for field := range rule {
+		if field != "type" && forms.GroupOf(field) == forms.GroupMatchers {
+			hasCondition = true
+			break
+		}
+	}
+	if !hasCondition {
+		errs = append(errs, fmt.Errorf("at least one matching condition is required"))
+	}
+
+	return append(errs, validateRulePorts(rule)...)
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/matinhimself/singbox-web-config/internal/forms"
+)
+
+// ruleSummaryValues caps how many values of a list matcher a summary shows
+const ruleSummaryValues = 3
+
+// ruleSummary describes a rule in one line, what it matches and what it
+// does, like "domain_suffix cn, hk ⇒ route → proxy-hk" or
+// "(port 53) or (protocol dns) ⇒ hijack DNS"
+func ruleSummary(rule map[string]interface{}) string {
+	return ruleMatchSummary(rule) + " ⇒ " + ruleActionSummary(rule)
+}
+
+// ruleMatchSummary describes what a rule matches. The sub-rules of a logical
+// rule are described in parentheses, joined by its mode.
+func ruleMatchSummary(rule map[string]interface{}) string {
+	var summary string
+	if isLogicalRule(rule) {
+		mode, _ := rule["mode"].(string)
+		if mode == "" {
+			mode = "and"
+		}
+		subRules, _ := rule["rules"].([]interface{})
+		parts := make([]string, 0, len(subRules))
+		for _, subRule := range subRules {
+			subRuleMap, ok := subRule.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			parts = append(parts, "("+ruleMatchSummary(subRuleMap)+")")
+		}
+		summary = strings.Join(parts, " "+mode+" ")
+	} else {
+		var fields []string
+		for field := range rule {
+			if field != "type" && forms.GroupOf(field) == forms.GroupMatchers {
+				fields = append(fields, field)
+			}
+		}
+		sort.Strings(fields)
+
+		parts := make([]string, 0, len(fields))
+		for _, field := range fields {
+			parts = append(parts, ruleMatcherSummary(field, rule[field]))
+		}
+		summary = strings.Join(parts, "; ")
+	}
+
+	if summary == "" {
+		summary = "everything"
+	}
+	if invert, _ := rule["invert"].(bool); invert {
+		summary = "not (" + summary + ")"
+	}
+	return summary
+}
+
+// ruleMatcherSummary describes one matcher field, naming a flag such as
+// ip_is_private alone and listing at most ruleSummaryValues values
+func ruleMatcherSummary(field string, value interface{}) string {
+	switch v := value.(type) {
+	case bool:
+		if v {
+			return field
+		}
+		return field + " false"
+	case []interface{}:
+		values := make([]string, 0, ruleSummaryValues)
+		for _, item := range v {
+			if len(values) == ruleSummaryValues {
+				break
+			}
+			values = append(values, fmt.Sprint(item))
+		}
+		summary := field + " " + strings.Join(values, ", ")
+		if len(v) > ruleSummaryValues {
+			summary += fmt.Sprintf(" +%d more", len(v)-ruleSummaryValues)
+		}
+		return summary
+	default:
+		return field + " " + fmt.Sprint(v)
+	}
+}
+
+// ruleActionSummary describes what a rule does. A rule without an action
+// routes to its outbound.
+func ruleActionSummary(rule map[string]interface{}) string {
+	action, _ := rule["action"].(string)
+	switch action {
+	case "", "route":
+		if outbound, _ := rule["outbound"].(string); outbound != "" {
+			return "route → " + outbound
+		}
+		return "route"
+	case "reject":
+		if method, _ := rule["method"].(string); method != "" && method != "default" {
+			return "reject (" + method + ")"
+		}
+		return "reject"
+	case "hijack-dns":
+		return "hijack DNS"
+	case "sniff":
+		if sniffers, _ := rule["sniffer"].([]interface{}); len(sniffers) > 0 {
+			return "sniff " + ruleListSummary(sniffers)
+		}
+		return "sniff"
+	case "resolve":
+		summary := "resolve"
+		if server, _ := rule["server"].(string); server != "" {
+			summary += " via " + server
+		}
+		if strategy, _ := rule["strategy"].(string); strategy != "" {
+			summary += " (" + strategy + ")"
+		}
+		return summary
+	default:
+		return action
+	}
+}
+
+// ruleListSummary joins a list value of a rule
+func ruleListSummary(values []interface{}) string {
+	parts := make([]string, len(values))
+	for i, value := range values {
+		parts[i] = fmt.Sprint(value)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/matinhimself/singbox-web-config/internal/forms"
+)
+
+// schemaField describes one form field for clients building their own forms
+type schemaField struct {
+	Name        string   `json:"name"`
+	Label       string   `json:"label"`
+	Type        string   `json:"type"`
+	Required    bool     `json:"required,omitempty"`
+	Array       bool     `json:"array,omitempty"`
+	ArrayType   string   `json:"array_type,omitempty"`
+	Options     []string `json:"options,omitempty"`
+	Placeholder string   `json:"placeholder,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Group       string   `json:"group,omitempty"`
+}
+
+// schemaType is a rule, action or outbound type with the fields of its form
+type schemaType struct {
+	Name        string        `json:"name"`
+	Title       string        `json:"title"`
+	Section     string        `json:"section,omitempty"`
+	Description string        `json:"description,omitempty"`
+	Groups      []string      `json:"groups,omitempty"`
+	Fields      []schemaField `json:"fields"`
+}
+
+// ruleTypesSchema is the response of /api/schema/rule-types
+type ruleTypesSchema struct {
+	RuleTypes   []schemaType `json:"rule_types"`
+	ActionTypes []schemaType `json:"action_types"`
+}
+
+// handleSchemaRuleTypes lists the rule and rule action types with the fields
+// of their forms
+func (s *Server) handleSchemaRuleTypes(w http.ResponseWriter, r *http.Request) {
+	s.writeSchema(w, r, s.ruleTypesSchema)
+}
+
+// handleSchemaOutboundTypes lists the outbound types that can be created with
+// the fields of their forms
+func (s *Server) handleSchemaOutboundTypes(w http.ResponseWriter, r *http.Request) {
+	s.writeSchema(w, r, s.outboundTypesSchema)
+}
+
+// writeSchema writes a schema built once by build, since the forms behind it
+// come from reflection and never change while the server runs
+func (s *Server) writeSchema(w http.ResponseWriter, r *http.Request, build func() ([]byte, error)) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	data, err := build()
+	if err != nil {
+		requestLogger(r).Error("failed to build schema", "error", err)
+		writeInternalError(w, err, "Failed to build schema")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// buildRuleTypesSchema builds the /api/schema/rule-types response
+func (s *Server) buildRuleTypesSchema() ([]byte, error) {
+	sections := make(map[string]string)
+	for _, name := range s.formBuilder.GetRouteRuleTypes() {
+		sections[name] = "route"
+	}
+	for _, name := range s.formBuilder.GetDNSRuleTypes() {
+		sections[name] = "dns"
+	}
+
+	schema := ruleTypesSchema{}
+	for _, name := range s.formBuilder.GetAvailableRuleTypes() {
+		formDef, err := s.formBuilder.BuildForm(name)
+		if err != nil {
+			return nil, err
+		}
+		section, ok := sections[name]
+		if !ok {
+			section = "rule_set"
+		}
+		schema.RuleTypes = append(schema.RuleTypes, formSchemaType(formDef, section))
+	}
+	for _, name := range s.formBuilder.GetAvailableActionTypes() {
+		formDef, err := s.formBuilder.BuildActionForm(name)
+		if err != nil {
+			return nil, err
+		}
+		schema.ActionTypes = append(schema.ActionTypes, formSchemaType(formDef, ""))
+	}
+
+	data, err := json.Marshal(schema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal rule types: %w", err)
+	}
+	return data, nil
+}
+
+// formSchemaType converts a form built from the generated types
+func formSchemaType(formDef *forms.FormDefinition, section string) schemaType {
+	entry := schemaType{
+		Name:    formDef.Name,
+		Title:   formDef.Title,
+		Section: section,
+		Groups:  formDef.Groups,
+		Fields:  []schemaField{},
+	}
+	for _, field := range formDef.Fields {
+		entry.Fields = append(entry.Fields, schemaField{
+			Name:        field.JSONTag,
+			Label:       field.Label,
+			Type:        string(field.Type),
+			Required:    field.Required,
+			Array:       field.IsArray,
+			ArrayType:   field.ArrayType,
+			Options:     field.Options,
+			Placeholder: field.Placeholder,
+			Description: field.Description,
+			Group:       field.Group,
+		})
+	}
+	return entry
+}
+
+// buildOutboundTypesSchema builds the /api/schema/outbound-types response.
+// Fields that pick other outbounds, like detour, come without options since
+// those depend on the config; /api/outbounds/tags lists them.
+func (s *Server) buildOutboundTypesSchema() ([]byte, error) {
+	outboundTypes := []schemaType{}
+	for _, outboundType := range getAvailableOutboundTypes() {
+		entry := schemaType{
+			Name:        outboundType["value"],
+			Title:       outboundType["label"],
+			Description: outboundType["description"],
+			Fields:      []schemaField{},
+		}
+		for _, field := range s.buildOutboundFormFields(outboundType["value"], nil) {
+			// The type is the schema type itself
+			if field.Type == "hidden" {
+				continue
+			}
+			entry.Fields = append(entry.Fields, schemaField{
+				Name:        strings.TrimSuffix(field.Name, "[]"),
+				Label:       field.Label,
+				Type:        field.Type,
+				Required:    field.Required,
+				Array:       field.IsArray,
+				Options:     field.Options,
+				Placeholder: field.Placeholder,
+				Description: field.Description,
+			})
+		}
+		outboundTypes = append(outboundTypes, entry)
+	}
+
+	data, err := json.Marshal(outboundTypes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal outbound types: %w", err)
+	}
+	return data, nil
+}
@@ -1,12 +1,16 @@
 package handlers
 
 import (
+	"bytes"
 	"embed"
 	"fmt"
 	"html/template"
 	"io/fs"
-	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"sync"
+	"time"
 
 	"github.com/matinhimself/singbox-web-config/internal/clash"
 	"github.com/matinhimself/singbox-web-config/internal/config"
@@ -18,7 +22,7 @@ import (
 // Server represents the HTTP server
 type Server struct {
 	addr              string
-	templates         *template.Template
+	templates         templateExecutor
 	mux               *http.ServeMux
 	configManager     *config.Manager
 	serviceManager    *service.Manager
@@ -26,25 +30,101 @@ type Server struct {
 	watcher           *watcher.Watcher
 	templatesFS       embed.FS
 	staticFS          embed.FS
-	clashClient       *clash.Client
-	clashURL          string
-	clashSecret       string
 	clashConfigMgr    *clash.ConfigManager
+
+	// clashClient is the Clash API client, nil until the API is configured,
+	// and clashURL and clashSecret the settings it was made with. All three
+	// are guarded by clashMu, since the API can be changed while requests
+	// and rule hit sampling use it; see clashAPIClient and setClashAPI.
+	clashMu     sync.RWMutex
+	clashClient *clash.Client
+	clashURL    string
+	clashSecret string
+
+	// proxyStats keeps each proxy's last delay test, nil if it couldn't load
+	proxyStats *clash.StatsStore
+
+	// delayTestConcurrency bounds concurrent node tests in a group delay test
+	delayTestConcurrency int
+
+	// delayTestLimiter limits delay tests per proxy, nil when disabled
+	delayTestLimiter *rateLimiter
+
+	// maxBodyBytes and maxConfigBodyBytes cap request body sizes
+	maxBodyBytes       int64
+	maxConfigBodyBytes int64
+
+	// requestTimeout bounds non-streaming requests, 0 when disabled
+	requestTimeout time.Duration
+
+	// fallbackOutbounds are the rule targets offered while the config has
+	// no outbounds
+	fallbackOutbounds []string
+
+	// ruleTypesSchema and outboundTypesSchema build the JSON of the schema
+	// endpoints on first use and return it from then on
+	ruleTypesSchema     func() ([]byte, error)
+	outboundTypesSchema func() ([]byte, error)
+
+	// readOnly disables every endpoint that changes the config or service
+	readOnly bool
+
+	// deferReload leaves reloads to an explicit apply instead of every edit
+	deferReload bool
+
+	// auditUserHeader is the request header the change log takes the user
+	// from, empty when no proxy authenticates users
+	auditUserHeader string
+
+	// appliedHash is the hash of the config file sing-box last loaded and
+	// pendingApply marks saved changes whose reload was deferred. Both are
+	// guarded by reloadMu.
+	reloadMu     sync.Mutex
+	appliedHash  string
+	lastReloaded *time.Time
+	pendingApply bool
+
+	// ruleHits counts connections per rule over ruleHitWindow, sampled in
+	// the background until stop is closed
+	ruleHits      *ruleHits
+	ruleHitWindow time.Duration
+	stop          chan struct{}
+
+	// tlsCert and tlsKey are the certificate files Start serves HTTPS
+	// with, empty for plain HTTP
+	tlsCert string
+	tlsKey  string
+
+	// uiSessions remembers each browser's last filters and sort orders, nil
+	// when disabled
+	uiSessions *uiSessions
+
+	// validation is the latest `sing-box check` result for the config file,
+	// guarded by validationMu
+	validationMu sync.Mutex
+	validation   *ConfigValidationResponse
+
+	// singBoxVersion is the installed sing-box version read at startup, and
+	// versionWarning explains how it differs from the generated types
+	singBoxVersion string
+	versionWarning string
 }
 
 // NewServer creates a new HTTP server
-func NewServer(addr string, configPath string, singboxService string, clashURL string, clashSecret string, templatesFS, staticFS embed.FS) (*Server, error) {
+func NewServer(addr string, configPath string, backupDir string, singboxService string, clashURL string, clashSecret string, templatesFS, staticFS embed.FS) (*Server, error) {
 	// Create config manager
-	configManager, err := config.NewManager(configPath)
+	configManager, err := config.NewManager(configPath, backupDir)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create config manager: %w", err)
 	}
 
 	// Create initial backup if config exists
-	if err := configManager.CreateBackupWithName("Initial backup", "Automatic backup created on server startup"); err != nil {
-		log.Printf("Warning: failed to create initial backup: %v", err)
+	if created, err := configManager.CreateBackupWithName("Initial backup", "Automatic backup created on server startup"); err != nil {
+		slog.Warn("failed to create initial backup", "error", err)
+	} else if created {
+		slog.Info("created initial backup on startup")
 	} else {
-		log.Println("Created initial backup on startup")
+		slog.Info("config unchanged since the latest backup, skipped initial backup")
 	}
 
 	// Create service manager
@@ -56,7 +136,13 @@ func NewServer(addr string, configPath string, singboxService string, clashURL s
 	// Create Clash config manager
 	clashConfigMgr, err := clash.NewConfigManager()
 	if err != nil {
-		log.Printf("Warning: failed to create Clash config manager: %v", err)
+		slog.Warn("failed to create Clash config manager", "error", err)
+	}
+
+	// Load the last delay test of each proxy
+	proxyStats, err := clash.NewStatsStore()
+	if err != nil {
+		slog.Warn("failed to load proxy stats", "error", err)
 	}
 
 	// Determine Clash API configuration
@@ -66,37 +152,40 @@ func NewServer(addr string, configPath string, singboxService string, clashURL s
 	// Priority: 1. CLI args, 2. Saved config, 3. Auto-detect
 	if clashURL != "" {
 		// Use CLI arguments
-		formattedClashURL = formatClashURL(clashURL)
+		formattedClashURL, err = formatClashURL(clashURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Clash API URL: %w", err)
+		}
 		finalClashSecret = clashSecret
-		log.Printf("Using Clash API from CLI arguments: %s", formattedClashURL)
+		slog.Info("using Clash API from CLI arguments", "url", formattedClashURL)
 	} else if clashConfigMgr != nil {
 		// Try to load saved configuration
 		savedConfig, err := clashConfigMgr.Load()
 		if err != nil {
-			log.Printf("Warning: failed to load Clash config: %v", err)
+			slog.Warn("failed to load Clash config", "error", err)
 		} else if savedConfig.URL != "" {
 			formattedClashURL = savedConfig.URL
 			finalClashSecret = savedConfig.Secret
-			log.Printf("Loaded Clash API from saved config: %s", formattedClashURL)
+			slog.Info("loaded Clash API from saved config", "url", formattedClashURL)
 		}
 	}
 
 	// If still not configured, try auto-detection
 	if formattedClashURL == "" {
-		log.Println("Attempting to auto-detect Clash API on port 9090...")
+		slog.Info("attempting to auto-detect Clash API on port 9090")
 		if detected := clash.AutoDetect(); detected != nil {
 			formattedClashURL = detected.URL
 			finalClashSecret = detected.Secret
-			log.Printf("Auto-detected Clash API: %s", formattedClashURL)
+			slog.Info("auto-detected Clash API", "url", formattedClashURL)
 
 			// Save the auto-detected configuration
 			if clashConfigMgr != nil {
 				if err := clashConfigMgr.Save(detected); err != nil {
-					log.Printf("Warning: failed to save auto-detected config: %v", err)
+					slog.Warn("failed to save auto-detected Clash config", "error", err)
 				}
 			}
 		} else {
-			log.Println("Clash API not found. You can configure it through the web interface.")
+			slog.Info("Clash API not found, it can be configured through the web interface")
 		}
 	}
 
@@ -108,15 +197,34 @@ func NewServer(addr string, configPath string, singboxService string, clashURL s
 		formBuilder:    formBuilder,
 		templatesFS:    templatesFS,
 		staticFS:       staticFS,
-		clashURL:       formattedClashURL,
-		clashSecret:    finalClashSecret,
 		clashConfigMgr: clashConfigMgr,
+		proxyStats:     proxyStats,
+
+		delayTestConcurrency: DefaultDelayTestConcurrency,
+		delayTestLimiter:     newRateLimiter(DefaultDelayTestRateLimit, delayTestBurst),
+		maxBodyBytes:         DefaultMaxBodyBytes,
+		maxConfigBodyBytes:   DefaultMaxConfigBodyBytes,
+		requestTimeout:       DefaultRequestTimeout,
+		fallbackOutbounds:    DefaultFallbackOutbounds,
+		ruleHitWindow:        DefaultRuleHitWindow,
+		uiSessions:           newUISessions(DefaultUISessions),
+		stop:                 make(chan struct{}),
 	}
 
 	// Initialize Clash client if URL is provided
 	if formattedClashURL != "" {
-		s.clashClient = clash.NewClient(formattedClashURL, finalClashSecret)
-		log.Printf("Clash API client initialized: %s", formattedClashURL)
+		s.setClashAPI(formattedClashURL, finalClashSecret)
+		slog.Info("Clash API client initialized", "url", formattedClashURL)
+	}
+
+	s.ruleTypesSchema = sync.OnceValues(s.buildRuleTypesSchema)
+	s.outboundTypesSchema = sync.OnceValues(s.buildOutboundTypesSchema)
+
+	// Assume the running instance uses the config as found at startup
+	if hash, err := configManager.ConfigHash(); err != nil {
+		slog.Warn("failed to hash config", "error", err)
+	} else {
+		s.appliedHash = hash
 	}
 
 	// Load templates
@@ -126,11 +234,11 @@ func NewServer(addr string, configPath string, singboxService string, clashURL s
 
 	// Setup file watcher
 	fileWatcher, err := watcher.NewWatcher(configPath, func() {
-		log.Println("Config file changed externally, reloading...")
+		slog.Info("config file changed externally, reloading")
 		// You could add logic here to notify connected clients via SSE or WebSockets
 	})
 	if err != nil {
-		log.Printf("Warning: failed to setup file watcher: %v", err)
+		slog.Warn("failed to set up file watcher", "error", err)
 	} else {
 		s.watcher = fileWatcher
 		s.watcher.Start()
@@ -144,27 +252,45 @@ func NewServer(addr string, configPath string, singboxService string, clashURL s
 
 // loadTemplates loads all HTML templates from embedded files
 func (s *Server) loadTemplates() error {
-	// Use ParseFS to parse templates from embedded filesystem
-	// This properly handles nested template definitions
-	tmpl, err := template.New("").Funcs(templateFuncMap()).ParseFS(
-		s.templatesFS,
-		"web/templates/*.html",
-		"web/templates/components/*.html",
-	)
+	tmpl, err := parseTemplates(s.templatesFS, s.templateFuncs())
 	if err != nil {
-		return fmt.Errorf("failed to parse templates: %w", err)
+		return err
 	}
 
 	s.templates = tmpl
 	return nil
 }
 
+// templateFuncs returns the template functions, including those that read
+// server state
+func (s *Server) templateFuncs() template.FuncMap {
+	funcs := templateFuncMap()
+	funcs["readOnly"] = func() bool { return s.readOnly }
+	funcs["pendingApply"] = s.hasPendingChanges
+	return funcs
+}
+
+// parseTemplates parses the page and component templates of fsys, laid out
+// like the embedded web/templates directory
+func parseTemplates(fsys fs.FS, funcs template.FuncMap) (*template.Template, error) {
+	// ParseFS properly handles nested template definitions
+	tmpl, err := template.New("").Funcs(funcs).ParseFS(
+		fsys,
+		"web/templates/*.html",
+		"web/templates/components/*.html",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse templates: %w", err)
+	}
+	return tmpl, nil
+}
+
 // setupRoutes configures all HTTP routes
 func (s *Server) setupRoutes() {
 	// Static files from embedded filesystem
 	staticSubFS, err := fs.Sub(s.staticFS, "web/static")
 	if err != nil {
-		log.Printf("Warning: failed to load static files: %v", err)
+		slog.Warn("failed to load static files", "error", err)
 	} else {
 		fileServer := http.FileServer(http.FS(staticSubFS))
 		s.mux.Handle("/static/", http.StripPrefix("/static/", fileServer))
@@ -173,8 +299,11 @@ func (s *Server) setupRoutes() {
 	// Page routes
 	s.mux.HandleFunc("/", s.handleIndex)
 	s.mux.HandleFunc("/rules", s.handleRulesPage)
+	s.mux.HandleFunc("/dns", s.handleDNSPage)
 	s.mux.HandleFunc("/rule-actions", s.handleRuleActionsPage)
 	s.mux.HandleFunc("/outbounds", s.handleOutboundsPage)
+	s.mux.HandleFunc("/endpoints", s.handleEndpointsPage)
+	s.mux.HandleFunc("/geo", s.handleGeoPage)
 	s.mux.HandleFunc("/connections", s.handleConnectionsPage)
 	s.mux.HandleFunc("/proxies", s.handleProxiesPage)
 	s.mux.HandleFunc("/service", s.handleServicePage)
@@ -186,6 +315,20 @@ func (s *Server) setupRoutes() {
 	s.mux.HandleFunc("/api/rules/delete", s.handleRuleDelete)
 	s.mux.HandleFunc("/api/rules/update", s.handleRuleUpdate)
 	s.mux.HandleFunc("/api/rules/reorder", s.handleRuleReorder)
+	s.mux.HandleFunc("/api/rules/move", s.handleRuleMove)
+	s.mux.HandleFunc("/api/rules/preview", s.handleRulePreview)
+	s.mux.HandleFunc("/api/rules/bulk-domains", s.handleRuleBulkDomains)
+
+	// API routes for DNS rules, kept apart from route rules
+	s.mux.HandleFunc("/api/dns/rules", s.handleDNSRulesList)
+	s.mux.HandleFunc("/api/dns/rules/form", s.handleDNSRuleForm)
+	s.mux.HandleFunc("/api/dns/rules/create", s.handleDNSRuleCreate)
+	s.mux.HandleFunc("/api/dns/rules/update", s.handleDNSRuleUpdate)
+	s.mux.HandleFunc("/api/dns/rules/delete", s.handleDNSRuleDelete)
+	s.mux.HandleFunc("/api/dns/rules/preview", s.handleDNSRulePreview)
+	s.mux.HandleFunc("/api/dns/settings", s.handleDNSSettings)
+	s.mux.HandleFunc("/api/route/settings", s.handleRouteSettings)
+	s.mux.HandleFunc("/api/inbounds/tun-wizard", s.handleTunWizard)
 
 	// API routes for outbounds (HTMX endpoints)
 	s.mux.HandleFunc("/api/outbounds", s.handleOutboundsList)
@@ -195,8 +338,28 @@ func (s *Server) setupRoutes() {
 	s.mux.HandleFunc("/api/outbounds/delete", s.handleOutboundDelete)
 	s.mux.HandleFunc("/api/outbounds/reorder", s.handleOutboundReorder)
 	s.mux.HandleFunc("/api/outbounds/rename", s.handleOutboundRename)
+	s.mux.HandleFunc("/api/outbounds/toggle", s.handleOutboundToggle)
+	s.mux.HandleFunc("/api/outbounds/clone", s.handleOutboundClone)
+	s.mux.HandleFunc("/api/outbounds/apply-test", s.handleOutboundApplyTest)
 	s.mux.HandleFunc("/api/outbounds/group/manage", s.handleGroupManage)
 	s.mux.HandleFunc("/api/outbounds/group/update", s.handleGroupUpdate)
+	s.mux.HandleFunc("/api/outbounds/tags", s.handleOutboundTags)
+
+	// Endpoint API routes
+	s.mux.HandleFunc("/api/endpoints", s.handleEndpointsList)
+	s.mux.HandleFunc("/api/endpoints/form", s.handleEndpointForm)
+	s.mux.HandleFunc("/api/endpoints/create", s.handleEndpointCreate)
+	s.mux.HandleFunc("/api/endpoints/update", s.handleEndpointUpdate)
+	s.mux.HandleFunc("/api/endpoints/delete", s.handleEndpointDelete)
+	s.mux.HandleFunc("/api/endpoints/rename", s.handleEndpointRename)
+
+	// Geo database and rule set API routes
+	s.mux.HandleFunc("/api/geo", s.handleGeoList)
+	s.mux.HandleFunc("/api/geo/update", s.handleGeoUpdate)
+
+	// Form metadata for alternative frontends
+	s.mux.HandleFunc("/api/schema/rule-types", s.handleSchemaRuleTypes)
+	s.mux.HandleFunc("/api/schema/outbound-types", s.handleSchemaOutboundTypes)
 
 	// API routes for rule actions (HTMX endpoints)
 	s.mux.HandleFunc("/api/rule-actions", s.handleRuleActionsList)
@@ -210,22 +373,39 @@ func (s *Server) setupRoutes() {
 	s.mux.HandleFunc("/api/service/start", s.handleServiceStart)
 	s.mux.HandleFunc("/api/service/stop", s.handleServiceStop)
 	s.mux.HandleFunc("/api/service/restart", s.handleServiceRestart)
+	s.mux.HandleFunc("/api/service/enable", s.handleServiceEnable)
+	s.mux.HandleFunc("/api/service/disable", s.handleServiceDisable)
 	s.mux.HandleFunc("/api/service/logs", s.handleServiceLogs)
+	s.mux.HandleFunc("/api/service/apply", s.handleServiceApply)
 
 	// API routes for config management
+	s.mux.HandleFunc("/api/config", s.handleConfigPatch)
 	s.mux.HandleFunc("/api/config/export", s.handleConfigExport)
 	s.mux.HandleFunc("/api/config/backups", s.handleConfigBackups)
 	s.mux.HandleFunc("/api/config/restore", s.handleConfigRestore)
+	s.mux.HandleFunc("/api/config/upload", s.handleConfigUpload)
+	s.mux.HandleFunc("/api/config/bundle", s.handleConfigBundle)
+	s.mux.HandleFunc("/api/config/normalize", s.handleConfigNormalize)
+	s.mux.HandleFunc("/api/config/validate", s.handleConfigValidate)
+	s.mux.HandleFunc("/api/config/drift", s.handleConfigDrift)
+	s.mux.HandleFunc("/api/config/history", s.handleConfigHistory)
 	s.mux.HandleFunc("/api/config/create-backup", s.handleConfigCreateBackup)
+	s.mux.HandleFunc("/api/config/backups/pin", s.handleConfigBackupPin)
+	s.mux.HandleFunc("/api/config/backups/download", s.handleConfigBackupDownload)
+	s.mux.HandleFunc("/api/config/backups/describe", s.handleConfigBackupDescribe)
 
 	// WebSocket and API routes for connections
 	s.mux.HandleFunc("/ws/connections", s.handleConnectionsWebSocket)
+	s.mux.HandleFunc("/api/ui-state", s.handleUIState)
 	s.mux.HandleFunc("/api/connections/create-rule", s.handleConnectionToRule)
+	s.mux.HandleFunc("/api/connections/export", s.handleConnectionsExport)
 
 	// API routes for proxies
 	s.mux.HandleFunc("/api/proxies/settings", s.handleProxiesSettings)
 	s.mux.HandleFunc("/api/proxies/groups", s.handleProxiesGroups)
 	s.mux.HandleFunc("/api/proxies/switch", s.handleProxySwitch)
+	s.mux.HandleFunc("/api/proxies/switch-multiple", s.handleProxySwitchMultiple)
+	s.mux.HandleFunc("/api/proxies/mode", s.handleProxyMode)
 	s.mux.HandleFunc("/api/proxies/delay-test", s.handleProxyDelayTest)
 	s.mux.HandleFunc("/api/proxies/group-delay-test", s.handleProxyGroupDelayTest)
 
@@ -235,21 +415,69 @@ func (s *Server) setupRoutes() {
 	s.mux.HandleFunc("/api/clash/update", s.handleClashUpdate)
 }
 
+// SetDelayTestConcurrency sets how many proxies of a group are delay-tested at
+// once. Values below 1 restore the default.
+func (s *Server) SetDelayTestConcurrency(n int) {
+	if n < 1 {
+		n = DefaultDelayTestConcurrency
+	}
+	s.delayTestConcurrency = n
+}
+
+// SetConfigOverrides sets the fragment that receives edits when the config
+// is a directory of fragments
+func (s *Server) SetConfigOverrides(name string) {
+	s.configManager.SetOverridesFragment(name)
+}
+
 // Start starts the HTTP server
 func (s *Server) Start() error {
-	log.Printf("Starting server on %s", s.addr)
-	log.Printf("Visit http://%s in your browser", s.addr)
-	return http.ListenAndServe(s.addr, s.mux)
+	listener, err := s.listen()
+	if err != nil {
+		return err
+	}
+	scheme := "http"
+	if s.tlsCert != "" {
+		scheme = "https"
+	}
+	if _, ok := unixSocketPath(s.addr); ok {
+		slog.Info("starting server", "addr", s.addr, "tls", s.tlsCert != "")
+	} else {
+		slog.Info("starting server", "addr", s.addr, "url", scheme+"://"+s.addr)
+	}
+
+	s.checkSingBoxVersion()
+	s.checkConfigOnStartup()
+	if s.ruleHitWindow > 0 {
+		s.ruleHits = newRuleHits(s.ruleHitWindow)
+		go s.sampleRuleHits(s.stop)
+	}
+	handler := withRequestLogging(withRecovery(s.withReadOnly(s.withChangeLog(s.withBodyLimit(s.withTimeout(s.mux))))))
+	if s.tlsCert != "" {
+		return http.ServeTLS(listener, handler, s.tlsCert, s.tlsKey)
+	}
+	return http.Serve(listener, handler)
 }
 
 // Stop stops the server and cleanup
 func (s *Server) Stop() {
+	close(s.stop)
 	if s.watcher != nil {
 		s.watcher.Stop()
 	}
+	if path, ok := unixSocketPath(s.addr); ok {
+		os.Remove(path)
+	}
 }
 
 // renderTemplate renders a template with the given data
 func (s *Server) renderTemplate(w http.ResponseWriter, name string, data interface{}) error {
-	return s.templates.ExecuteTemplate(w, name, data)
+	// Render into a buffer so a failing template leaves the response
+	// untouched for renderError
+	var buf bytes.Buffer
+	if err := s.templates.ExecuteTemplate(&buf, name, data); err != nil {
+		return err
+	}
+	_, err := buf.WriteTo(w)
+	return err
 }
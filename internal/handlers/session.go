@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultUISessions is how many browser sessions have their UI state
+// remembered unless overridden with SetUISessions
+const DefaultUISessions = 256
+
+// uiSessionCookie names the cookie holding the session ID
+const uiSessionCookie = "singbox_web_ui"
+
+// maxUIStateValue caps the length of a remembered value
+const maxUIStateValue = 1024
+
+// Remembered UI state. The rule filter and proxy sort follow their query
+// parameters; the connections filters are saved by the page's script.
+const (
+	uiStateRuleFilter        = "rules.filter"
+	uiStateProxySort         = "proxies.sort"
+	uiStateConnectionsFilter = "connections.filter"
+)
+
+// uiSession is the remembered UI state of one browser
+type uiSession struct {
+	values   map[string]string
+	lastUsed time.Time
+}
+
+// uiSessions remembers UI state in memory per browser, keyed by a cookie. It
+// holds at most max sessions, evicting the least recently used. A nil store
+// remembers nothing.
+type uiSessions struct {
+	mu       sync.Mutex
+	max      int
+	sessions map[string]*uiSession
+}
+
+// newUISessions returns a store for max sessions, or nil when max is not
+// positive
+func newUISessions(max int) *uiSessions {
+	if max <= 0 {
+		return nil
+	}
+	return &uiSessions{
+		max:      max,
+		sessions: make(map[string]*uiSession),
+	}
+}
+
+// SetUISessions sets how many browser sessions have their last filters and
+// sort orders remembered. Zero disables it.
+func (s *Server) SetUISessions(max int) {
+	s.uiSessions = newUISessions(max)
+}
+
+// get returns a remembered value of the request's session
+func (u *uiSessions) get(r *http.Request, key string) string {
+	if u == nil {
+		return ""
+	}
+	cookie, err := r.Cookie(uiSessionCookie)
+	if err != nil {
+		return ""
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	session, ok := u.sessions[cookie.Value]
+	if !ok {
+		return ""
+	}
+	session.lastUsed = time.Now()
+	return session.values[key]
+}
+
+// set remembers a value for the request's session, starting a session and
+// setting its cookie if needed. Values that are too long are ignored.
+func (u *uiSessions) set(w http.ResponseWriter, r *http.Request, key, value string) {
+	if u == nil || len(value) > maxUIStateValue {
+		return
+	}
+
+	id := ""
+	if cookie, err := r.Cookie(uiSessionCookie); err == nil {
+		id = cookie.Value
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	session, ok := u.sessions[id]
+	if !ok {
+		id = newSessionID()
+		if id == "" {
+			return
+		}
+		if len(u.sessions) >= u.max {
+			u.evictOldest()
+		}
+		session = &uiSession{values: make(map[string]string)}
+		u.sessions[id] = session
+		http.SetCookie(w, &http.Cookie{
+			Name:     uiSessionCookie,
+			Value:    id,
+			Path:     "/",
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+
+	session.lastUsed = time.Now()
+	if value == "" {
+		delete(session.values, key)
+	} else {
+		session.values[key] = value
+	}
+}
+
+// evictOldest drops the least recently used session
+func (u *uiSessions) evictOldest() {
+	oldestID := ""
+	var oldest time.Time
+	for id, session := range u.sessions {
+		if oldestID == "" || session.lastUsed.Before(oldest) {
+			oldestID, oldest = id, session.lastUsed
+		}
+	}
+	delete(u.sessions, oldestID)
+}
+
+// newSessionID returns a random session ID, or "" if none could be made
+func newSessionID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(buf)
+}
+
+// uiParam returns a query parameter that is part of the UI state. When the
+// request carries it, even empty, it is remembered for the session; when it
+// doesn't, the remembered value is used.
+func (s *Server) uiParam(w http.ResponseWriter, r *http.Request, param, key string) string {
+	if values, ok := r.URL.Query()[param]; ok {
+		s.uiSessions.set(w, r, key, values[0])
+		return values[0]
+	}
+	return s.uiSessions.get(r, key)
+}
+
+// uiStateKeys lists the state pages may save through /api/ui-state
+var uiStateKeys = map[string]bool{
+	uiStateConnectionsFilter: true,
+}
+
+// handleUIState saves a value of the session's UI state for pages that
+// filter on the client side
+func (s *Server) handleUIState(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		writeBodyError(w, err, "Failed to parse form")
+		return
+	}
+
+	key := r.FormValue("key")
+	if !uiStateKeys[key] {
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, "Unknown UI state key")
+		return
+	}
+	value := r.FormValue("value")
+	if len(value) > maxUIStateValue {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, ErrCodeTooLarge, "UI state value is too long")
+		return
+	}
+
+	s.uiSessions.set(w, r, key, value)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"saved": s.uiSessions != nil})
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultRequestTimeout bounds how long a request may take before it gets a
+// 503, so a stalled systemctl, journalctl or Clash API call can't hold a
+// request open forever
+const DefaultRequestTimeout = time.Minute
+
+// timeoutExemptPaths lists endpoints that bound their own work with a longer
+// limit, such as geo database downloads
+var timeoutExemptPaths = map[string]bool{
+	"/api/geo/update": true,
+}
+
+// withTimeout cancels the request context and answers with a 503 once the
+// request timeout passes. The connections WebSocket and the server-sent
+// delay tests stay open as long as the client listens, so they are exempt.
+func (s *Server) withTimeout(next http.Handler) http.Handler {
+	if s.requestTimeout <= 0 {
+		return next
+	}
+
+	body, _ := json.Marshal(APIError{Code: ErrCodeTimeout, Message: "The request took too long and was cancelled"})
+	timeout := http.TimeoutHandler(next, s.requestTimeout, string(body))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isStreamingRequest(r) || timeoutExemptPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		timeout.ServeHTTP(timeoutResponseWriter{w}, r)
+	})
+}
+
+// timeoutResponseWriter labels the timeout body written by
+// http.TimeoutHandler as JSON, which it sends without a content type
+type timeoutResponseWriter struct {
+	http.ResponseWriter
+}
+
+func (w timeoutResponseWriter) WriteHeader(status int) {
+	if status == http.StatusServiceUnavailable && w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// isStreamingRequest reports whether a request is for a WebSocket or a
+// server-sent event stream
+func isStreamingRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/ws/") ||
+		strings.EqualFold(r.Header.Get("Upgrade"), "websocket") ||
+		strings.Contains(r.Header.Get("Accept"), "text/event-stream") ||
+		r.URL.Query().Get("stream") == "true"
+}
+
+// SetRequestTimeout sets how long a request may take. Zero or less disables
+// the limit.
+func (s *Server) SetRequestTimeout(timeout time.Duration) {
+	s.requestTimeout = timeout
+}
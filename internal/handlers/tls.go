@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// autoTLSDir is where -tls-auto keeps its certificate, next to the config
+// like the backups
+const autoTLSDir = "tls"
+
+// autoTLSValidity is how long a generated certificate is valid
+const autoTLSValidity = 10 * 365 * 24 * time.Hour
+
+// autoTLSRenewBefore is how long before expiry a generated certificate is
+// replaced on start
+const autoTLSRenewBefore = 30 * 24 * time.Hour
+
+// SetTLS makes Start serve HTTPS with the given certificate and key files.
+// With auto, a self-signed certificate is generated on first run and kept
+// next to the config instead. Empty files and no auto keep plain HTTP.
+func (s *Server) SetTLS(certFile, keyFile string, auto bool) error {
+	if auto {
+		if certFile != "" || keyFile != "" {
+			return errors.New("-tls-auto can't be combined with -tls-cert or -tls-key")
+		}
+		dir := filepath.Join(filepath.Dir(s.configManager.Path()), autoTLSDir)
+		var err error
+		certFile, keyFile, err = ensureSelfSignedCert(dir, s.addr)
+		if err != nil {
+			return err
+		}
+	}
+
+	if certFile == "" && keyFile == "" {
+		return nil
+	}
+	if certFile == "" || keyFile == "" {
+		return errors.New("-tls-cert and -tls-key must be set together")
+	}
+
+	// Load the pair now so a bad file fails at start, not on the first request
+	if _, err := tls.LoadX509KeyPair(certFile, keyFile); err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+
+	s.tlsCert = certFile
+	s.tlsKey = keyFile
+	return nil
+}
+
+// ensureSelfSignedCert returns the certificate and key files in dir,
+// generating a self-signed pair when there is none or the existing one is
+// about to expire
+func ensureSelfSignedCert(dir, addr string) (certFile, keyFile string, err error) {
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+
+	if pair, err := tls.LoadX509KeyPair(certFile, keyFile); err == nil {
+		if cert, err := x509.ParseCertificate(pair.Certificate[0]); err == nil && time.Until(cert.NotAfter) > autoTLSRenewBefore {
+			return certFile, keyFile, nil
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", "", fmt.Errorf("failed to create TLS directory: %w", err)
+	}
+	certPEM, keyPEM, err := generateSelfSignedCert(certHosts(addr), time.Now())
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate TLS certificate: %w", err)
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		return "", "", fmt.Errorf("failed to write TLS key: %w", err)
+	}
+	if err := os.WriteFile(certFile, certPEM, 0644); err != nil {
+		return "", "", fmt.Errorf("failed to write TLS certificate: %w", err)
+	}
+
+	slog.Info("generated self-signed TLS certificate", "cert", certFile)
+	return certFile, keyFile, nil
+}
+
+// certHosts lists the names a generated certificate covers: localhost, the
+// loopback addresses, this machine's hostname and the listen host
+func certHosts(addr string) []string {
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		hosts = append(hosts, hostname)
+	}
+	if host, _, err := net.SplitHostPort(addr); err == nil && host != "" {
+		if ip := net.ParseIP(host); ip == nil || !ip.IsUnspecified() {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// generateSelfSignedCert returns a PEM certificate and ECDSA key for hosts,
+// which are host names or IP addresses
+func generateSelfSignedCert(hosts []string, now time.Time) (certPEM, keyPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"singbox-web-config"}, CommonName: hosts[0]},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(autoTLSValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	seen := make(map[string]bool)
+	for _, host := range hosts {
+		if seen[host] {
+			continue
+		}
+		seen[host] = true
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
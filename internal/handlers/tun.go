@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/matinhimself/singbox-web-config/internal/presets"
+	"github.com/matinhimself/singbox-web-config/internal/service"
+)
+
+// TunWizardResponse lists what the TUN wizard changed
+type TunWizardResponse struct {
+	Changes  []string `json:"changes"`
+	Warnings []string `json:"warnings"`
+}
+
+// handleTunWizard turns on TUN mode: a default TUN inbound, the route rules
+// and auto_detect_interface it needs, and a fake-ip DNS setup, checked with
+// sing-box and saved together. The stack, mtu, strict_route and fakeip form
+// fields override the defaults. HTMX requests get the route settings form
+// back, other clients get JSON.
+func (s *Server) handleTunWizard(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		writeBodyError(w, err, "Failed to parse form")
+		return
+	}
+
+	opts := presets.DefaultTunOptions()
+	if stack := strings.TrimSpace(r.FormValue("stack")); stack != "" {
+		opts.Stack = stack
+	}
+	if mtu := strings.TrimSpace(r.FormValue("mtu")); mtu != "" {
+		value, err := strconv.ParseUint(mtu, 10, 32)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, "MTU must be a number")
+			return
+		}
+		opts.MTU = uint32(value)
+	}
+	if r.FormValue("strict_route") == "false" {
+		opts.StrictRoute = false
+	}
+	if r.FormValue("fakeip") == "false" {
+		opts.FakeIP = false
+	}
+
+	config, err := s.configManager.LoadConfig()
+	if err != nil {
+		requestLogger(r).Error("failed to load config", "error", err)
+		writeInternalError(w, err, "Failed to load config")
+		return
+	}
+
+	patch, err := presets.Tun(config, opts)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, ErrCodeValidation, err.Error())
+		return
+	}
+	patch.Apply(config)
+
+	data, err := s.configManager.MarshalConfig(config)
+	if err != nil {
+		requestLogger(r).Error("failed to encode config", "error", err)
+		writeInternalError(w, err, "Failed to encode config")
+		return
+	}
+	if err := s.serviceManager.CheckConfig(r.Context(), data); err != nil {
+		if !errors.Is(err, service.ErrBinaryNotFound) {
+			writeJSONError(w, http.StatusUnprocessableEntity, ErrCodeValidation, "sing-box check failed: "+err.Error())
+			return
+		}
+		requestLogger(r).Warn("skipping sing-box check of TUN setup", "error", err)
+	}
+
+	if err := s.configManager.SaveConfig(config); err != nil {
+		requestLogger(r).Error("failed to save config", "error", err)
+		writeInternalError(w, err, "Failed to save config")
+		return
+	}
+
+	requestLogger(r).Info("TUN wizard applied", "changes", len(patch.Changes), "warnings", len(patch.Warnings))
+
+	noteChange(r, "enabled TUN mode")
+
+	// Reload service
+	s.reloadService(r)
+
+	if r.Header.Get("HX-Request") != "true" {
+		response := TunWizardResponse{Changes: patch.Changes, Warnings: patch.Warnings}
+		if response.Changes == nil {
+			response.Changes = []string{}
+		}
+		if response.Warnings == nil {
+			response.Warnings = []string{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	if len(patch.Warnings) > 0 {
+		setWarningTrigger(w, "tunModeEnabled", strings.Join(patch.Warnings, "; "))
+	} else {
+		w.Header().Set("HX-Trigger", "tunModeEnabled")
+	}
+	s.renderRouteSettings(w, r, true)
+}
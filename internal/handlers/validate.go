@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/matinhimself/singbox-web-config/internal/service"
+)
+
+// configCheckTimeout bounds a single `sing-box check` run
+const configCheckTimeout = 30 * time.Second
+
+// ConfigValidationResponse is the result of checking the config file with
+// `sing-box check`
+type ConfigValidationResponse struct {
+	Valid bool `json:"valid"`
+	// Checked is false when sing-box isn't installed, in which case Valid
+	// means nothing
+	Checked bool   `json:"checked"`
+	Error   string `json:"error,omitempty"`
+	// Warnings are what sing-box logged about a valid config, such as
+	// deprecated options it still accepts
+	Warnings  []service.ConfigWarning `json:"warnings,omitempty"`
+	CheckedAt time.Time               `json:"checked_at"`
+}
+
+// DeprecatedCount counts the warnings about deprecated options
+func (v *ConfigValidationResponse) DeprecatedCount() int {
+	count := 0
+	for _, warning := range v.Warnings {
+		if warning.Deprecated {
+			count++
+		}
+	}
+	return count
+}
+
+// validateConfigFile runs `sing-box check` on the config file and records the
+// result, warnings included, for the index page and the lists
+func (s *Server) validateConfigFile(ctx context.Context) *ConfigValidationResponse {
+	result := &ConfigValidationResponse{CheckedAt: time.Now()}
+
+	data, err := s.configManager.ReadConfig()
+	if err == nil {
+		ctx, cancel := context.WithTimeout(ctx, configCheckTimeout)
+		result.Warnings, err = s.serviceManager.CheckConfigWarnings(ctx, data)
+		cancel()
+	}
+
+	switch {
+	case errors.Is(err, service.ErrBinaryNotFound):
+		result.Error = err.Error()
+	case err != nil:
+		result.Checked = true
+		result.Error = err.Error()
+	default:
+		result.Checked = true
+		result.Valid = true
+	}
+
+	s.validationMu.Lock()
+	s.validation = result
+	s.validationMu.Unlock()
+	return result
+}
+
+// lastValidation returns the most recent config check, or nil if the config
+// hasn't been checked yet
+func (s *Server) lastValidation() *ConfigValidationResponse {
+	s.validationMu.Lock()
+	defer s.validationMu.Unlock()
+	return s.validation
+}
+
+// configWarnings returns the warnings of the most recent config check, or
+// nil if there were none or the config hasn't been checked yet
+func (s *Server) configWarnings() []service.ConfigWarning {
+	if result := s.lastValidation(); result != nil {
+		return result.Warnings
+	}
+	return nil
+}
+
+// checkConfigOnStartup validates the existing config and warns loudly if
+// sing-box would reject it. Startup carries on regardless, since fixing a
+// broken config is what the server is for.
+func (s *Server) checkConfigOnStartup() {
+	result := s.validateConfigFile(context.Background())
+	switch {
+	case !result.Checked:
+		slog.Warn("skipping config validation on startup", "error", result.Error)
+	case !result.Valid:
+		slog.Warn("!!! current config is INVALID, sing-box will fail to load it until it is fixed !!!", "error", result.Error)
+	case len(result.Warnings) > 0:
+		slog.Warn("current config passed sing-box check with warnings", "warnings", len(result.Warnings), "deprecated", result.DeprecatedCount())
+	default:
+		slog.Info("current config passed sing-box check")
+	}
+}
+
+// handleConfigValidate checks the config file with `sing-box check` and
+// returns the result
+func (s *Server) handleConfigValidate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	result := s.validateConfigFile(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
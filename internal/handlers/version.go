@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/matinhimself/singbox-web-config/internal/types"
+)
+
+// checkSingBoxVersion reads the installed sing-box version and records a
+// warning when the generated types target a different release
+func (s *Server) checkSingBoxVersion() {
+	version, err := s.serviceManager.GetSingBoxVersion()
+	if err != nil {
+		slog.Info("could not read the sing-box version", "error", err)
+		return
+	}
+
+	s.singBoxVersion = version
+	s.versionWarning = typesCompatibilityWarning(version, types.Metadata.SingBoxBranch, types.Metadata.SingBoxCommit)
+	if s.versionWarning != "" {
+		slog.Warn("sing-box version differs from the generated types", "version", version, "branch", types.Metadata.SingBoxBranch, "commit", types.Metadata.SingBoxCommit)
+	}
+}
+
+// typesCompatibilityWarning compares the installed sing-box version with the
+// branch or tag the types were generated from. Types generated from a
+// release tag warn when the minor versions differ; types from a development
+// branch warn when a stable release is installed. Other branches can't be
+// matched to a release and never warn.
+func typesCompatibilityWarning(installed, branch, commit string) string {
+	major, minor, prerelease, ok := parseSingBoxVersion(installed)
+	if !ok {
+		return ""
+	}
+
+	if typesMajor, typesMinor, _, ok := parseSingBoxVersion(branch); ok {
+		switch {
+		case major < typesMajor || major == typesMajor && minor < typesMinor:
+			return fmt.Sprintf("sing-box %s is older than %s, which the types were generated from. Options added since may fail validation.", installed, branch)
+		case major > typesMajor || minor > typesMinor:
+			return fmt.Sprintf("sing-box %s is newer than %s, which the types were generated from. Options added since are missing from the forms.", installed, branch)
+		}
+		return ""
+	}
+
+	if strings.HasPrefix(branch, "dev") && !prerelease {
+		return fmt.Sprintf("The types were generated from sing-box's %s branch (commit %s), but sing-box %s is a stable release. Options that are not released yet may fail validation.", branch, commit, installed)
+	}
+	return ""
+}
+
+// parseSingBoxVersion parses the major and minor numbers of a version such
+// as "1.12.0", "v1.12.0" or "1.13.0-alpha.5", and whether it is a
+// pre-release
+func parseSingBoxVersion(version string) (major, minor int, prerelease, ok bool) {
+	version = strings.TrimPrefix(version, "v")
+	version, suffix, _ := strings.Cut(version, "-")
+
+	parts := strings.Split(version, ".")
+	if len(parts) < 2 {
+		return 0, 0, false, false
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, false, false
+	}
+	minor, err = strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, false, false
+	}
+	return major, minor, suffix != "", true
+}
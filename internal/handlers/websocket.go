@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// wsWriteWait bounds a single write or ping to a WebSocket peer
+	wsWriteWait = 10 * time.Second
+	// wsPongWait is how long a peer may stay silent before it counts as dead
+	wsPongWait = 60 * time.Second
+	// wsPingPeriod must be shorter than wsPongWait so a healthy peer always
+	// answers before its read deadline passes
+	wsPingPeriod = wsPongWait * 9 / 10
+	// wsReconnectDelay is the pause before redialing a dropped Clash API
+	// connection
+	wsReconnectDelay = 2 * time.Second
+)
+
+// errClientWrite marks a failure writing to the browser side of the proxy
+var errClientWrite = errors.New("client write failed")
+
+// wsPeer wraps a WebSocket connection with a read deadline that is extended
+// by every message or pong, and serializes writes so the keepalive pinger can
+// share the connection with a forwarder.
+type wsPeer struct {
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+}
+
+// newWSPeer starts the read deadline of conn. Reads only see the deadline
+// extended when a pong arrives, so the peer must be pinged with keepAlive.
+func newWSPeer(conn *websocket.Conn) *wsPeer {
+	peer := &wsPeer{conn: conn}
+	peer.extendDeadline()
+	conn.SetPongHandler(func(string) error {
+		peer.extendDeadline()
+		return nil
+	})
+	return peer
+}
+
+func (p *wsPeer) extendDeadline() {
+	p.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+}
+
+// write sends a data message, giving up after wsWriteWait
+func (p *wsPeer) write(messageType int, data []byte) error {
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+	p.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+	return p.conn.WriteMessage(messageType, data)
+}
+
+func (p *wsPeer) writeJSON(v interface{}) error {
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+	p.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+	return p.conn.WriteJSON(v)
+}
+
+// keepAlive pings the peer every wsPingPeriod until done is closed. A failed
+// ping closes the connection so the peer's reader returns promptly.
+func (p *wsPeer) keepAlive(done <-chan struct{}, logger *slog.Logger) {
+	defer recoverGoroutine(logger)
+
+	ticker := time.NewTicker(wsPingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			p.writeMu.Lock()
+			err := p.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait))
+			p.writeMu.Unlock()
+			if err != nil {
+				logger.Warn("WebSocket ping failed", "error", err)
+				p.conn.Close()
+				return
+			}
+		}
+	}
+}
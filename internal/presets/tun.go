@@ -0,0 +1,289 @@
+// Package presets builds ready-made changes to a sing-box config, such as
+// everything TUN mode needs, as patches that are applied in one save
+package presets
+
+import (
+	"fmt"
+	"net/netip"
+	"strconv"
+
+	"github.com/matinhimself/singbox-web-config/internal/types"
+)
+
+// Patch is a set of additions to a sing-box config. Applying it never
+// removes or changes anything already there, except for turning on
+// AutoDetectInterface and setting a DNS final that was empty.
+type Patch struct {
+	Inbounds            []map[string]interface{}
+	DNSServers          []map[string]interface{}
+	DNSRules            []map[string]interface{} // inserted before the existing DNS rules
+	DNSFinal            string
+	RouteRules          []map[string]interface{} // inserted before the existing route rules
+	AutoDetectInterface bool
+
+	// Changes describes each addition, Warnings anything the patch left out
+	Changes  []string
+	Warnings []string
+}
+
+// Apply adds the patch to config
+func (p *Patch) Apply(config *types.Config) {
+	for _, inbound := range p.Inbounds {
+		config.Inbounds = append(config.Inbounds, inbound)
+	}
+
+	if len(p.DNSServers) > 0 || len(p.DNSRules) > 0 || p.DNSFinal != "" {
+		if config.DNS == nil {
+			config.DNS = &types.RawDNSOptions{}
+		}
+		for _, server := range p.DNSServers {
+			config.DNS.Servers = append(config.DNS.Servers, server)
+		}
+		config.DNS.Rules = prepend(config.DNS.Rules, p.DNSRules)
+		if config.DNS.Final == "" {
+			config.DNS.Final = p.DNSFinal
+		}
+	}
+
+	if len(p.RouteRules) > 0 || p.AutoDetectInterface {
+		if config.Route == nil {
+			config.Route = &types.RouteOptions{}
+		}
+		config.Route.Rules = prepend(config.Route.Rules, p.RouteRules)
+		config.Route.AutoDetectInterface = config.Route.AutoDetectInterface || p.AutoDetectInterface
+	}
+}
+
+// prepend returns items followed by list
+func prepend(list []interface{}, items []map[string]interface{}) []interface{} {
+	if len(items) == 0 {
+		return list
+	}
+	result := make([]interface{}, 0, len(items)+len(list))
+	for _, item := range items {
+		result = append(result, item)
+	}
+	return append(result, list...)
+}
+
+// TunStacks are the network stacks a TUN inbound can use
+var TunStacks = []string{"system", "gvisor", "mixed"}
+
+// TunOptions are the choices of the TUN wizard
+type TunOptions struct {
+	Tag         string
+	Address     []string // interface prefixes, IPv4 and IPv6
+	MTU         uint32
+	Stack       string
+	StrictRoute bool
+	FakeIP      bool // answer A and AAAA queries from a fake-ip range
+}
+
+// DefaultTunOptions returns the settings sing-box documents for a TUN
+// inbound that routes all traffic
+func DefaultTunOptions() TunOptions {
+	return TunOptions{
+		Tag:         "tun-in",
+		Address:     []string{"172.19.0.1/30", "fdfe:dcba:9876::1/126"},
+		MTU:         9000,
+		Stack:       "mixed",
+		StrictRoute: true,
+		FakeIP:      true,
+	}
+}
+
+// Fake-IP ranges sing-box documents for the fakeip DNS server
+const (
+	fakeIPInet4Range = "198.18.0.0/15"
+	fakeIPInet6Range = "fc00::/18"
+)
+
+// Tun returns the patch that turns on TUN mode for config: a TUN inbound
+// with auto_route, route rules that sniff its traffic and hijack DNS, the
+// route's auto_detect_interface, and with FakeIP a fakeip DNS server. Parts
+// the config already has are left out. A config that already has a TUN
+// inbound gets no second one, with a warning.
+func Tun(config *types.Config, opts TunOptions) (*Patch, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	patch := &Patch{AutoDetectInterface: true}
+	if config.Route == nil || !config.Route.AutoDetectInterface {
+		patch.Changes = append(patch.Changes, "turn on route auto_detect_interface")
+	}
+
+	tunTag := opts.Tag
+	if existing, ok := findTyped(config.Inbounds, "tun"); ok {
+		tunTag, _ = existing["tag"].(string)
+		patch.Warnings = append(patch.Warnings, fmt.Sprintf("a TUN inbound %q already exists, so no second one was added", tunTag))
+	} else {
+		if _, ok := findTagged(config.Inbounds, opts.Tag); ok {
+			return nil, fmt.Errorf("an inbound tagged %q already exists", opts.Tag)
+		}
+		address := make([]interface{}, len(opts.Address))
+		for i, prefix := range opts.Address {
+			address[i] = prefix
+		}
+		patch.Inbounds = append(patch.Inbounds, map[string]interface{}{
+			"type":         "tun",
+			"tag":          opts.Tag,
+			"address":      address,
+			"mtu":          opts.MTU,
+			"auto_route":   true,
+			"strict_route": opts.StrictRoute,
+			"stack":        opts.Stack,
+		})
+		patch.Changes = append(patch.Changes, fmt.Sprintf("add TUN inbound %q", opts.Tag))
+	}
+
+	var routeRules []interface{}
+	if config.Route != nil {
+		routeRules = config.Route.Rules
+	}
+	if _, ok := findAction(routeRules, "sniff"); !ok {
+		rule := map[string]interface{}{"action": "sniff"}
+		if tunTag != "" {
+			rule["inbound"] = []interface{}{tunTag}
+		}
+		patch.RouteRules = append(patch.RouteRules, rule)
+		patch.Changes = append(patch.Changes, "add a route rule that sniffs TUN traffic")
+	}
+	if _, ok := findAction(routeRules, "hijack-dns"); !ok {
+		patch.RouteRules = append(patch.RouteRules, map[string]interface{}{
+			"protocol": "dns",
+			"action":   "hijack-dns",
+		})
+		patch.Changes = append(patch.Changes, "add a route rule that hijacks DNS queries")
+	}
+
+	if opts.FakeIP {
+		addFakeIP(config, patch)
+	}
+
+	return patch, nil
+}
+
+// addFakeIP adds a fakeip DNS server and a rule answering A and AAAA
+// queries from it. A config without any other DNS server also gets a local
+// one as its final server, so other queries still resolve.
+func addFakeIP(config *types.Config, patch *Patch) {
+	var servers, rules []interface{}
+	final := ""
+	if config.DNS != nil {
+		servers, rules, final = config.DNS.Servers, config.DNS.Rules, config.DNS.Final
+	}
+
+	fakeIPTag := "fakeip"
+	if existing, ok := findTyped(servers, "fakeip"); ok {
+		fakeIPTag, _ = existing["tag"].(string)
+	} else {
+		fakeIPTag = uniqueTag(servers, fakeIPTag)
+		patch.DNSServers = append(patch.DNSServers, map[string]interface{}{
+			"type":        "fakeip",
+			"tag":         fakeIPTag,
+			"inet4_range": fakeIPInet4Range,
+			"inet6_range": fakeIPInet6Range,
+		})
+		patch.Changes = append(patch.Changes, fmt.Sprintf("add fakeip DNS server %q", fakeIPTag))
+	}
+
+	if !hasOtherServer(servers, fakeIPTag) {
+		localTag := uniqueTag(servers, "local")
+		patch.DNSServers = append(patch.DNSServers, map[string]interface{}{
+			"type": "local",
+			"tag":  localTag,
+		})
+		if final == "" {
+			patch.DNSFinal = localTag
+		}
+		patch.Changes = append(patch.Changes, fmt.Sprintf("add local DNS server %q for other queries", localTag))
+	}
+
+	for _, rule := range rules {
+		if ruleMap, ok := rule.(map[string]interface{}); ok && ruleMap["server"] == fakeIPTag {
+			return
+		}
+	}
+	patch.DNSRules = append(patch.DNSRules, map[string]interface{}{
+		"query_type": []interface{}{"A", "AAAA"},
+		"server":     fakeIPTag,
+	})
+	patch.Changes = append(patch.Changes, "add a DNS rule that answers A and AAAA queries with fake IPs")
+}
+
+// validate checks the options against what sing-box accepts
+func (o TunOptions) validate() error {
+	if o.Tag == "" {
+		return fmt.Errorf("the TUN inbound needs a tag")
+	}
+	if len(o.Address) == 0 {
+		return fmt.Errorf("the TUN inbound needs at least one address")
+	}
+	for _, address := range o.Address {
+		if _, err := netip.ParsePrefix(address); err != nil {
+			return fmt.Errorf("address %q is not a prefix such as 172.19.0.1/30", address)
+		}
+	}
+	if o.MTU < 1280 || o.MTU > 65535 {
+		return fmt.Errorf("MTU must be between 1280 and 65535")
+	}
+	for _, stack := range TunStacks {
+		if o.Stack == stack {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown stack %q (expected system, gvisor or mixed)", o.Stack)
+}
+
+// findTyped returns the first item of a config list with the given type
+func findTyped(items []interface{}, itemType string) (map[string]interface{}, bool) {
+	for _, item := range items {
+		if itemMap, ok := item.(map[string]interface{}); ok && itemMap["type"] == itemType {
+			return itemMap, true
+		}
+	}
+	return nil, false
+}
+
+// findTagged returns the item of a config list with the given tag
+func findTagged(items []interface{}, tag string) (map[string]interface{}, bool) {
+	for _, item := range items {
+		if itemMap, ok := item.(map[string]interface{}); ok && itemMap["tag"] == tag {
+			return itemMap, true
+		}
+	}
+	return nil, false
+}
+
+// findAction returns the first rule with the given action
+func findAction(rules []interface{}, action string) (map[string]interface{}, bool) {
+	for _, rule := range rules {
+		if ruleMap, ok := rule.(map[string]interface{}); ok && ruleMap["action"] == action {
+			return ruleMap, true
+		}
+	}
+	return nil, false
+}
+
+// hasOtherServer reports whether a DNS server other than the given one exists
+func hasOtherServer(servers []interface{}, tag string) bool {
+	for _, server := range servers {
+		if serverMap, ok := server.(map[string]interface{}); ok && serverMap["tag"] != tag {
+			return true
+		}
+	}
+	return false
+}
+
+// uniqueTag returns tag, or tag with a number appended if an item of the
+// list already uses it
+func uniqueTag(items []interface{}, tag string) string {
+	candidate := tag
+	for i := 2; ; i++ {
+		if _, ok := findTagged(items, candidate); !ok {
+			return candidate
+		}
+		candidate = tag + "-" + strconv.Itoa(i)
+	}
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+)
+
+// singBoxLocations are where sing-box is commonly installed when it isn't
+// on PATH, as for services started with a minimal environment
+var singBoxLocations = []string{
+	"/usr/local/bin/sing-box",
+	"/usr/bin/sing-box",
+	"/opt/sing-box/sing-box",
+	"/usr/local/sing-box/sing-box",
+	"/snap/bin/sing-box",
+}
+
+// singBoxHomeLocations are install locations relative to the home directory
+var singBoxHomeLocations = []string{
+	"go/bin/sing-box",
+	".local/bin/sing-box",
+}
+
+var (
+	binaryMu sync.Mutex
+	// binaryPath is the path set with SetBinaryPath, used instead of a search
+	binaryPath string
+	// foundPath caches the binary FindSingBox found
+	foundPath string
+)
+
+// SetBinaryPath makes FindSingBox use path instead of searching for
+// sing-box. An empty path restores the search.
+func SetBinaryPath(path string) {
+	binaryMu.Lock()
+	defer binaryMu.Unlock()
+
+	binaryPath = path
+	foundPath = ""
+}
+
+// FindSingBox returns the path of the sing-box binary: the one set with
+// SetBinaryPath, or the first found on PATH or in a common install location.
+// A found binary is cached; a failed search is retried on the next call so a
+// later install is picked up.
+func FindSingBox() (string, error) {
+	binaryMu.Lock()
+	defer binaryMu.Unlock()
+
+	if foundPath != "" {
+		return foundPath, nil
+	}
+
+	if binaryPath != "" {
+		if !isExecutable(binaryPath) {
+			return "", fmt.Errorf("%w (no executable at %s)", ErrBinaryNotFound, binaryPath)
+		}
+		foundPath = binaryPath
+		return foundPath, nil
+	}
+
+	if path, err := exec.LookPath("sing-box"); err == nil {
+		foundPath = path
+		return foundPath, nil
+	}
+
+	candidates := singBoxLocations
+	if home, err := os.UserHomeDir(); err == nil {
+		for _, location := range singBoxHomeLocations {
+			candidates = append(candidates, filepath.Join(home, location))
+		}
+	}
+	for _, candidate := range candidates {
+		if isExecutable(candidate) {
+			foundPath = candidate
+			return foundPath, nil
+		}
+	}
+
+	return "", ErrBinaryNotFound
+}
+
+// isExecutable reports whether path is a regular file anyone may execute
+func isExecutable(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular() && info.Mode().Perm()&0111 != 0
+}
+
+// singBoxCommand prepares a sing-box command with the binary FindSingBox
+// finds
+func singBoxCommand(ctx context.Context, args ...string) (*exec.Cmd, error) {
+	path, err := FindSingBox()
+	if err != nil {
+		return nil, err
+	}
+	return exec.CommandContext(ctx, path, args...), nil
+}
+
+// binaryMissing reports whether a sing-box command failed because the binary
+// is gone, such as after an uninstall, and drops the cached path so the next
+// command searches again
+func binaryMissing(err error) bool {
+	if !errors.Is(err, exec.ErrNotFound) && !errors.Is(err, fs.ErrNotExist) {
+		return false
+	}
+
+	binaryMu.Lock()
+	foundPath = ""
+	binaryMu.Unlock()
+	return true
+}
@@ -1,14 +1,39 @@
 package service
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"os/exec"
 	"strings"
+	"text/template"
+	"time"
 )
 
+// ErrBinaryNotFound is returned when FindSingBox finds no sing-box binary
+var ErrBinaryNotFound = errors.New("sing-box binary not found; set -binary-path")
+
+// ErrInsufficientPermissions is returned when systemd refuses to control the
+// unit because this process lacks the privileges, typically when not run as
+// root
+var ErrInsufficientPermissions = errors.New("insufficient permissions to control the service")
+
+// permissionDeniedMarkers are what systemctl prints when it refuses an
+// unprivileged caller
+var permissionDeniedMarkers = []string{
+	"Access denied",
+	"Interactive authentication required",
+	"Permission denied",
+	"AUTHENTICATING FOR",
+}
+
 // Manager manages the sing-box systemd service
 type Manager struct {
 	serviceName string
+
+	// reloadCmd replaces the systemd reload when set, see SetReloadCommand
+	reloadCmd string
 }
 
 // NewManager creates a new service manager
@@ -26,20 +51,25 @@ type Status struct {
 	Message   string
 }
 
-// GetStatus returns the current status of the service
-func (m *Manager) GetStatus() (*Status, error) {
-	cmd := exec.Command("systemctl", "is-active", m.serviceName)
+// GetStatus returns the current status of the service. Commands still
+// running when ctx ends are killed; the error is then ctx's.
+func (m *Manager) GetStatus(ctx context.Context) (*Status, error) {
+	cmd := exec.CommandContext(ctx, "systemctl", "is-active", m.serviceName)
 	output, _ := cmd.Output()
 	isActive := strings.TrimSpace(string(output)) == "active"
 
-	cmd = exec.Command("systemctl", "is-enabled", m.serviceName)
+	cmd = exec.CommandContext(ctx, "systemctl", "is-enabled", m.serviceName)
 	output, _ = cmd.Output()
 	isEnabled := strings.TrimSpace(string(output)) == "enabled"
 
 	// Get detailed status
-	cmd = exec.Command("systemctl", "status", m.serviceName)
+	cmd = exec.CommandContext(ctx, "systemctl", "status", m.serviceName)
 	statusOutput, _ := cmd.CombinedOutput()
 
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get service status: %w", err)
+	}
+
 	return &Status{
 		Active:  isActive,
 		Running: isActive,
@@ -49,65 +79,223 @@ func (m *Manager) GetStatus() (*Status, error) {
 }
 
 // Start starts the service
-func (m *Manager) Start() error {
-	cmd := exec.Command("systemctl", "start", m.serviceName)
+func (m *Manager) Start(ctx context.Context) error {
+	cmd := exec.CommandContext(ctx, "systemctl", "start", m.serviceName)
 	if output, err := cmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("failed to start service: %w, output: %s", err, output)
+		return systemctlError("start", err, output)
 	}
 	return nil
 }
 
 // Stop stops the service
-func (m *Manager) Stop() error {
-	cmd := exec.Command("systemctl", "stop", m.serviceName)
+func (m *Manager) Stop(ctx context.Context) error {
+	cmd := exec.CommandContext(ctx, "systemctl", "stop", m.serviceName)
 	if output, err := cmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("failed to stop service: %w, output: %s", err, output)
+		return systemctlError("stop", err, output)
 	}
 	return nil
 }
 
 // Restart restarts the service
-func (m *Manager) Restart() error {
-	cmd := exec.Command("systemctl", "restart", m.serviceName)
+func (m *Manager) Restart(ctx context.Context) error {
+	cmd := exec.CommandContext(ctx, "systemctl", "restart", m.serviceName)
 	if output, err := cmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("failed to restart service: %w, output: %s", err, output)
+		return systemctlError("restart", err, output)
+	}
+	return nil
+}
+
+// reloadCommandTimeout bounds how long a custom reload command may run
+const reloadCommandTimeout = 30 * time.Second
+
+// ReloadCommandData is what a reload command template can refer to
+type ReloadCommandData struct {
+	ConfigPath string
+}
+
+// SetReloadCommand makes Reload run command with sh instead of reloading the
+// systemd unit, for setups that apply the config through a wrapper script or
+// a signal. The command is a text/template that can refer to the config
+// file or directory as {{.ConfigPath}}. An empty command restores the
+// systemd reload.
+func (m *Manager) SetReloadCommand(command, configPath string) error {
+	if command == "" {
+		m.reloadCmd = ""
+		return nil
+	}
+
+	tmpl, err := template.New("reload-cmd").Parse(command)
+	if err != nil {
+		return fmt.Errorf("invalid reload command: %w", err)
 	}
+	var expanded strings.Builder
+	if err := tmpl.Execute(&expanded, ReloadCommandData{ConfigPath: configPath}); err != nil {
+		return fmt.Errorf("invalid reload command: %w", err)
+	}
+
+	m.reloadCmd = expanded.String()
 	return nil
 }
 
-// Reload reloads the service configuration
-func (m *Manager) Reload() error {
-	cmd := exec.Command("systemctl", "reload-or-restart", m.serviceName)
+// Reload reloads the service configuration, with the custom reload command
+// when one is set
+func (m *Manager) Reload(ctx context.Context) error {
+	if m.reloadCmd != "" {
+		ctx, cancel := context.WithTimeout(ctx, reloadCommandTimeout)
+		defer cancel()
+
+		cmd := exec.CommandContext(ctx, "sh", "-c", m.reloadCmd)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to run reload command: %w, output: %s", err, output)
+		}
+		return nil
+	}
+
+	cmd := exec.CommandContext(ctx, "systemctl", "reload-or-restart", m.serviceName)
 	if output, err := cmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("failed to reload service: %w, output: %s", err, output)
+		return systemctlError("reload", err, output)
 	}
 	return nil
 }
 
 // Enable enables the service to start on boot
-func (m *Manager) Enable() error {
-	cmd := exec.Command("systemctl", "enable", m.serviceName)
+func (m *Manager) Enable(ctx context.Context) error {
+	cmd := exec.CommandContext(ctx, "systemctl", "enable", m.serviceName)
 	if output, err := cmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("failed to enable service: %w, output: %s", err, output)
+		return systemctlError("enable", err, output)
 	}
 	return nil
 }
 
 // Disable disables the service from starting on boot
-func (m *Manager) Disable() error {
-	cmd := exec.Command("systemctl", "disable", m.serviceName)
+func (m *Manager) Disable(ctx context.Context) error {
+	cmd := exec.CommandContext(ctx, "systemctl", "disable", m.serviceName)
 	if output, err := cmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("failed to disable service: %w, output: %s", err, output)
+		return systemctlError("disable", err, output)
 	}
 	return nil
 }
 
-// GetLogs returns recent service logs
-func (m *Manager) GetLogs(lines int) (string, error) {
-	cmd := exec.Command("journalctl", "-u", m.serviceName, "-n", fmt.Sprintf("%d", lines), "--no-pager")
+// systemctlError describes a failed systemctl command, wrapping
+// ErrInsufficientPermissions when systemd refused the caller
+func systemctlError(action string, err error, output []byte) error {
+	if permissionDenied(output) {
+		return fmt.Errorf("failed to %s service: %w", action, ErrInsufficientPermissions)
+	}
+	return fmt.Errorf("failed to %s service: %w, output: %s", action, err, output)
+}
+
+// permissionDenied reports whether systemctl output says the caller lacks
+// the privileges for the command
+func permissionDenied(output []byte) bool {
+	for _, marker := range permissionDeniedMarkers {
+		if bytes.Contains(output, []byte(marker)) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetLogs returns recent service logs. journalctl is killed when ctx ends,
+// which bounds reading a large number of lines.
+func (m *Manager) GetLogs(ctx context.Context, lines int) (string, error) {
+	cmd := exec.CommandContext(ctx, "journalctl", "-u", m.serviceName, "-n", fmt.Sprintf("%d", lines), "--no-pager")
 	output, err := cmd.CombinedOutput()
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return "", fmt.Errorf("failed to get logs: %w", ctxErr)
+	}
 	if err != nil {
 		return "", fmt.Errorf("failed to get logs: %w", err)
 	}
 	return string(output), nil
 }
+
+// FormatConfig runs the config through `sing-box format`, which returns it
+// in sing-box's canonical field order and indentation. sing-box reads the
+// config from standard input when the config path is "stdin".
+func (m *Manager) FormatConfig(ctx context.Context, config []byte) ([]byte, error) {
+	output, _, err := m.NormalizeConfig(ctx, config)
+	return output, err
+}
+
+// NormalizeConfig formats the config like FormatConfig and also returns the
+// warnings sing-box logged while parsing it, such as deprecated fields
+func (m *Manager) NormalizeConfig(ctx context.Context, config []byte) ([]byte, []ConfigWarning, error) {
+	cmd, err := singBoxCommand(ctx, "format", "-c", "stdin")
+	if err != nil {
+		return nil, nil, err
+	}
+	cmd.Stdin = bytes.NewReader(config)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		if binaryMissing(err) {
+			return nil, nil, ErrBinaryNotFound
+		}
+		return nil, nil, fmt.Errorf("failed to format config: %w, output: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return output, ParseWarnings(stderr.String()), nil
+}
+
+// CheckConfig validates a config with `sing-box check`. The error carries
+// sing-box's explanation when the config is rejected.
+func (m *Manager) CheckConfig(ctx context.Context, config []byte) error {
+	_, err := m.CheckConfigWarnings(ctx, config)
+	return err
+}
+
+// CheckConfigWarnings validates a config like CheckConfig and also returns
+// the warnings sing-box logged about a config it accepted, such as
+// deprecated options
+func (m *Manager) CheckConfigWarnings(ctx context.Context, config []byte) ([]ConfigWarning, error) {
+	cmd, err := singBoxCommand(ctx, "check", "-c", "stdin")
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stdin = bytes.NewReader(config)
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		if binaryMissing(err) {
+			return nil, ErrBinaryNotFound
+		}
+		if msg := strings.TrimSpace(string(output)); msg != "" {
+			return nil, errors.New(msg)
+		}
+		return nil, fmt.Errorf("config check failed: %w", err)
+	}
+	return ParseWarnings(string(output)), nil
+}
+
+// versionTimeout bounds how long `sing-box version` may take
+const versionTimeout = 5 * time.Second
+
+// GetSingBoxVersion returns the version of the installed sing-box binary as
+// `sing-box version` reports it, such as "1.12.0" or "1.13.0-alpha.5"
+func (m *Manager) GetSingBoxVersion() (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), versionTimeout)
+	defer cancel()
+
+	cmd, err := singBoxCommand(ctx, "version")
+	if err != nil {
+		return "", err
+	}
+	output, err := cmd.Output()
+	if err != nil {
+		if binaryMissing(err) {
+			return "", ErrBinaryNotFound
+		}
+		return "", fmt.Errorf("failed to get sing-box version: %w", err)
+	}
+
+	// The first line reads "sing-box version 1.12.0"
+	firstLine, _, _ := strings.Cut(string(output), "\n")
+	fields := strings.Fields(firstLine)
+	if len(fields) < 3 || fields[1] != "version" {
+		return "", fmt.Errorf("unexpected sing-box version output: %q", strings.TrimSpace(firstLine))
+	}
+	return fields[2], nil
+}
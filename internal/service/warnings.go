@@ -0,0 +1,57 @@
+package service
+
+import (
+	"regexp"
+	"strings"
+)
+
+// ConfigWarning is a warning sing-box logged about a config
+type ConfigWarning struct {
+	Level      string `json:"level"`
+	Message    string `json:"message"`
+	Deprecated bool   `json:"deprecated"`
+	// URL points at the migration guide sing-box links for deprecations
+	URL string `json:"url,omitempty"`
+}
+
+var (
+	ansiEscape = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+	// logLevel matches the level of a sing-box log line in either the
+	// logrus style "WARN[0000] msg" or the timestamped "+0000 2024-01-01
+	// 00:00:00 WARN msg" style
+	logLevel = regexp.MustCompile(`(?:^|\s)(TRACE|DEBUG|INFO|WARN|WARNING|ERROR|FATAL|PANIC)(?:\[\d+\])?\s+`)
+	warnURL  = regexp.MustCompile(`https?://\S+`)
+)
+
+// ParseWarnings extracts warning and error lines from sing-box's stderr.
+// Lines that don't look like log records are kept as warnings so nothing
+// sing-box says is lost.
+func ParseWarnings(stderr string) []ConfigWarning {
+	var warnings []ConfigWarning
+	for _, line := range strings.Split(stderr, "\n") {
+		line = strings.TrimSpace(ansiEscape.ReplaceAllString(line, ""))
+		if line == "" {
+			continue
+		}
+
+		warning := ConfigWarning{Level: "warn", Message: line}
+		if match := logLevel.FindStringSubmatchIndex(line); match != nil {
+			level := strings.ToLower(line[match[2]:match[3]])
+			if level == "trace" || level == "debug" || level == "info" {
+				continue
+			}
+			if level == "warning" {
+				level = "warn"
+			}
+			warning.Level = level
+			warning.Message = strings.TrimSpace(line[match[1]:])
+		}
+
+		warning.Deprecated = strings.Contains(strings.ToLower(warning.Message), "deprecated")
+		if url := warnURL.FindString(warning.Message); url != "" {
+			warning.URL = strings.TrimRight(url, ".,;)")
+		}
+		warnings = append(warnings, warning)
+	}
+	return warnings
+}
@@ -0,0 +1,9 @@
+package types
+
+// RejectActionOptions holds the options of the "reject" rule action. It is
+// written by hand so the action forms don't depend on what the generator
+// extracts; the generator skips types declared outside generated files.
+type RejectActionOptions struct {
+	Method string `json:"method,omitempty"`
+	NoDrop bool   `json:"no_drop,omitempty"`
+}
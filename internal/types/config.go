@@ -13,6 +13,7 @@ type Config struct {
 	NTP          *NTPOptions          `json:"ntp,omitempty"`
 	Inbounds     []interface{}        `json:"inbounds,omitempty"`
 	Outbounds    []interface{}        `json:"outbounds,omitempty"`
+	Endpoints    []interface{}        `json:"endpoints,omitempty"`
 	Route        *RouteOptions        `json:"route,omitempty"`
 	Experimental *ExperimentalOptions `json:"experimental,omitempty"`
 }
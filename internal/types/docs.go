@@ -0,0 +1,37 @@
+package types
+
+// fieldDocs holds the upstream doc comment of each generated struct field,
+// keyed by type name and then field name
+var fieldDocs = map[string]map[string]string{}
+
+// registerFieldDocs records doc comments for the fields of a generated type
+func registerFieldDocs(typeName string, docs map[string]string) {
+	fieldDocs[typeName] = docs
+}
+
+// FieldDoc returns the upstream doc comment for a field of a generated type
+func FieldDoc(typeName, fieldName string) string {
+	return fieldDocs[typeName][fieldName]
+}
+
+// FieldDescription is the upstream documentation of a config field
+type FieldDescription struct {
+	Doc      string
+	Type     string // Go type in the sing-box source
+	Required bool   // the field has no omitempty
+}
+
+// fieldDescriptions maps a JSON tag to its upstream documentation. It is
+// filled by the generated descriptions.go.
+var fieldDescriptions = map[string]FieldDescription{}
+
+// registerFieldDescriptions records the documentation of every JSON tag
+func registerFieldDescriptions(descriptions map[string]FieldDescription) {
+	fieldDescriptions = descriptions
+}
+
+// DescribeField returns the upstream documentation of a JSON tag
+func DescribeField(jsonTag string) (FieldDescription, bool) {
+	description, ok := fieldDescriptions[jsonTag]
+	return description, ok
+}
@@ -53,3 +53,13 @@ type V2RayStatsServiceOptions struct {
 	Outbounds []string `json:"outbounds,omitempty"`
 	Users     []string `json:"users,omitempty"`
 }
+
+func init() {
+	registerFieldDocs("ClashAPIOptions", map[string]string{
+		"CacheFile":     "Deprecated: migrated to global cache file",
+		"CacheID":       "Deprecated: migrated to global cache file",
+		"StoreMode":     "Deprecated: migrated to global cache file",
+		"StoreSelected": "Deprecated: migrated to global cache file",
+		"StoreFakeIP":   "Deprecated: migrated to global cache file",
+	})
+}
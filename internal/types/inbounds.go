@@ -39,3 +39,10 @@ type ListenOptions struct {
 
 type ListenOptionsWrapper struct {
 }
+
+func init() {
+	registerFieldDocs("ListenOptions", map[string]string{
+		"ProxyProtocol":               "Deprecated: removed",
+		"ProxyProtocolAcceptNoHeader": "Deprecated: removed",
+	})
+}
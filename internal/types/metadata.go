@@ -11,10 +11,23 @@ var Metadata = struct {
 	SingBoxBranch    string
 	GeneratorVersion string
 	TypesGenerated   int
+	CategoryHashes   map[string]string
+	CategoryTypes    map[string]int
 }{
 	Timestamp:        time.Unix(1763930699, 0),
 	SingBoxCommit:    "877e7a8",
 	SingBoxBranch:    "dev-next",
-	GeneratorVersion: "0.1.0",
-	TypesGenerated:   55,
+	GeneratorVersion: "0.2.0",
+	TypesGenerated:   88,
+	CategoryHashes:   map[string]string{},
+	CategoryTypes: map[string]int{
+		"DNS":          16,
+		"Experimental": 5,
+		"Inbounds":     4,
+		"Main":         3,
+		"NTP":          1,
+		"Outbounds":    37,
+		"Route":        3,
+		"Rules":        19,
+	},
 }
@@ -405,3 +405,9 @@ type URLTestOutbound struct {
 	IdleTimeout               uint32   `json:"idle_timeout,omitempty"`
 	InterruptExistConnections bool     `json:"interrupt_exist_connections,omitempty"`
 }
+
+func init() {
+	registerFieldDocs("DialerOptions", map[string]string{
+		"DomainStrategy": "Deprecated: migrated to domain resolver",
+	})
+}
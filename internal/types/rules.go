@@ -6,19 +6,14 @@
 package types
 
 type RawDefaultDNSRule struct {
-	// Action field (required in sing-box 1.11.0+)
-	// Manually added for web interface compatibility
 	Action string `json:"action,omitempty"`
 
-	// Action-specific fields
-	// For "route" action (DNS server routing)
 	Server       string  `json:"server,omitempty"`
 	DNSStrategy  string  `json:"strategy,omitempty"`
 	DisableCache bool    `json:"disable_cache,omitempty"`
 	RewriteTTL   *uint32 `json:"rewrite_ttl,omitempty"`
 	ClientSubnet *string `json:"client_subnet,omitempty"`
 
-	// Rule matching fields
 	Inbound                  []string                `json:"inbound,omitempty"`
 	IPVersion                int                     `json:"ip_version,omitempty"`
 	QueryType                []string                `json:"query_type,omitempty"`
@@ -125,30 +120,22 @@ type PlainRuleSet struct {
 }
 
 type RawDefaultRule struct {
-	// Action field (required in sing-box 1.11.0+)
-	// Manually added for web interface compatibility
 	Action string `json:"action,omitempty"`
 
-	// Action-specific fields
-	// For "route" action
 	Outbound string `json:"outbound,omitempty"`
 
-	// For "sniff" action
 	Sniffer      []string `json:"sniffer,omitempty"`
 	SniffTimeout uint32   `json:"timeout,omitempty"`
 
-	// For "resolve" action
 	Server       string  `json:"server,omitempty"`
 	Strategy     string  `json:"strategy,omitempty"`
 	DisableCache bool    `json:"disable_cache,omitempty"`
 	RewriteTTL   *uint32 `json:"rewrite_ttl,omitempty"`
 	ClientSubnet *string `json:"client_subnet,omitempty"`
 
-	// For "reject" action
 	Method string `json:"method,omitempty"`
 	NoDrop bool   `json:"no_drop,omitempty"`
 
-	// For "route-options" action
 	OverrideAddress           string  `json:"override_address,omitempty"`
 	OverridePort              uint16  `json:"override_port,omitempty"`
 	NetworkStrategy           *string `json:"network_strategy,omitempty"`
@@ -160,7 +147,6 @@ type RawDefaultRule struct {
 	TLSFragmentFallbackDelay  uint32  `json:"tls_fragment_fallback_delay,omitempty"`
 	TLSRecordFragment         bool    `json:"tls_record_fragment,omitempty"`
 
-	// Rule matching fields
 	Inbound                  []string                `json:"inbound,omitempty"`
 	IPVersion                int                     `json:"ip_version,omitempty"`
 	Network                  []string                `json:"network,omitempty"`
@@ -261,3 +247,12 @@ type DNSRouteActionPredefined struct {
 	Ns     []interface{} `json:"ns,omitempty"`
 	Extra  []interface{} `json:"extra,omitempty"`
 }
+
+func init() {
+	registerFieldDocs("RawDefaultDNSRule", map[string]string{
+		"Deprecated_RulesetIPCIDRMatchSource": "Deprecated: renamed to rule_set_ip_cidr_match_source",
+	})
+	registerFieldDocs("RawDefaultRule", map[string]string{
+		"Deprecated_RulesetIPCIDRMatchSource": "Deprecated: renamed to rule_set_ip_cidr_match_source",
+	})
+}
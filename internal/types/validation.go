@@ -0,0 +1,290 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Validator is implemented by generated types with required fields. Validate
+// reports every required field left at its zero value.
+type Validator interface {
+	Validate() error
+}
+
+// FieldError is a problem with one field, identified by its JSON path such
+// as tls.server_name or peers[0].public_key
+type FieldError struct {
+	Path    string
+	Message string
+}
+
+func (e *FieldError) Error() string {
+	return e.Path + " " + e.Message
+}
+
+// ValidationErrors collects the field errors of a value
+type ValidationErrors []*FieldError
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// err returns the errors as an error, or nil if there are none
+func (e ValidationErrors) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// required adds an error for path if value is its type's zero value
+func (e ValidationErrors) required(path string, value interface{}) ValidationErrors {
+	if value == nil || reflect.ValueOf(value).IsZero() {
+		return append(e, &FieldError{Path: path, Message: "is required"})
+	}
+	return e
+}
+
+// nested validates a nested value, prefixing its errors with path. Nil
+// pointers are skipped, since a missing optional block has nothing to check.
+func (e ValidationErrors) nested(path string, value Validator) ValidationErrors {
+	if v := reflect.ValueOf(value); !v.IsValid() || v.Kind() == reflect.Ptr && v.IsNil() {
+		return e
+	}
+
+	var nestedErrs ValidationErrors
+	if !errors.As(value.Validate(), &nestedErrs) {
+		return e
+	}
+	for _, err := range nestedErrs {
+		e = append(e, &FieldError{Path: path + "." + err.Path, Message: err.Message})
+	}
+	return e
+}
+
+// nestedIndex validates an element of a nested list
+func (e ValidationErrors) nestedIndex(path string, index int, value Validator) ValidationErrors {
+	return e.nested(fmt.Sprintf("%s[%d]", path, index), value)
+}
+
+// outboundTypes maps an outbound type name to a constructor of its generated
+// type. It is filled by the generated validators.go.
+var outboundTypes = map[string]func() interface{}{}
+
+// registerOutboundTypes records the generated type of each outbound type
+func registerOutboundTypes(constructors map[string]func() interface{}) {
+	outboundTypes = constructors
+}
+
+// OutboundNumberFields returns the JSON names of an outbound type's numeric
+// fields, read from its generated type. Types without one get the numeric
+// fields of every generated outbound type.
+func OutboundNumberFields(outboundType string) map[string]bool {
+	return outboundFields(outboundType, isNumberField)
+}
+
+// OutboundJSONFields returns the JSON names of an outbound type's fields that
+// hold an object or a list, such as tls or transport, read from its generated
+// type the same way as OutboundNumberFields
+func OutboundJSONFields(outboundType string) map[string]bool {
+	return outboundFields(outboundType, isJSONField)
+}
+
+// outboundFields returns the JSON names of the fields of an outbound type's
+// generated type that match, or of every generated outbound type if it has
+// none
+func outboundFields(outboundType string, match func(name string, t reflect.Type) bool) map[string]bool {
+	fields := make(map[string]bool)
+	if newType, ok := outboundTypes[outboundType]; ok {
+		addFields(fields, reflect.TypeOf(newType()).Elem(), match)
+		return fields
+	}
+	for _, newType := range outboundTypes {
+		addFields(fields, reflect.TypeOf(newType()).Elem(), match)
+	}
+	return fields
+}
+
+// OutboundHasDialer reports whether an outbound type's generated type embeds
+// DialerOptions, that is whether it dials connections itself rather than
+// picking another outbound. Types without a generated type are assumed to.
+func OutboundHasDialer(outboundType string) bool {
+	newType, ok := outboundTypes[outboundType]
+	if !ok {
+		return true
+	}
+	_, ok = reflect.TypeOf(newType()).Elem().FieldByName("DialerOptions")
+	return ok
+}
+
+// durationFields are the JSON names of fields the generator types as uint32
+// but sing-box reads as duration strings such as 5s, with a sample value of
+// each
+var durationFields = map[string]string{
+	"connect_timeout": "5s",
+	"fallback_delay":  "300ms",
+	"update_interval": "1d",
+}
+
+// DurationField reports whether sing-box reads the field with the given JSON
+// name as a duration string, and returns a sample value for it
+func DurationField(jsonTag string) (string, bool) {
+	sample, ok := durationFields[jsonTag]
+	return sample, ok
+}
+
+// addFields records the JSON names of t's fields that match, including
+// those of embedded structs, which JSON flattens into t. Pointer fields are
+// matched by the type they point to.
+func addFields(fields map[string]bool, t reflect.Type, match func(name string, t reflect.Type) bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			addFields(fields, field.Type, match)
+			continue
+		}
+		if name == "" || name == "-" {
+			continue
+		}
+
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		if match(name, fieldType) {
+			fields[name] = true
+		}
+	}
+}
+
+// isNumberField matches numeric fields. Duration fields are left out since
+// they are strings.
+func isNumberField(name string, t reflect.Type) bool {
+	if _, ok := durationFields[name]; ok {
+		return false
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// isJSONField matches fields holding an object or a list. Fields typed
+// interface{} may hold either.
+func isJSONField(_ string, t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array, reflect.Interface:
+		return true
+	}
+	return false
+}
+
+// ValidateOutbound checks an outbound's required fields against the
+// generated type for its type. Outbound types without one pass.
+func ValidateOutbound(outbound map[string]interface{}) error {
+	outboundType, _ := outbound["type"].(string)
+	if outboundType == "" {
+		return ValidationErrors{{Path: "type", Message: "is required"}}
+	}
+
+	newType, ok := outboundTypes[outboundType]
+	if !ok {
+		return nil
+	}
+	return validateMap(outbound, newType())
+}
+
+// ValidateRule checks a route rule's required fields, as a logical rule when
+// its type is logical and as a default rule otherwise
+func ValidateRule(rule map[string]interface{}) error {
+	if ruleType, _ := rule["type"].(string); ruleType == "logical" {
+		return validateMap(rule, &RawLogicalRule{})
+	}
+	return validateMap(rule, &RawDefaultRule{})
+}
+
+// ValidateDNSRule checks a DNS rule's required fields, as a logical DNS rule
+// when its type is logical and as a default DNS rule otherwise
+func ValidateDNSRule(rule map[string]interface{}) error {
+	if ruleType, _ := rule["type"].(string); ruleType == "logical" {
+		return validateMap(rule, &RawLogicalDNSRule{})
+	}
+	return validateMap(rule, &RawDefaultDNSRule{})
+}
+
+// inboundUserKeys maps the inbound types with a users list to the field
+// that tells their users apart. Trojan authenticates by password alone, so
+// two trojan users can't share one.
+var inboundUserKeys = map[string]string{
+	"socks":  "username",
+	"http":   "username",
+	"mixed":  "username",
+	"vmess":  "uuid",
+	"vless":  "uuid",
+	"trojan": "password",
+}
+
+// ValidateInboundUsers checks the users list of an inbound: every user needs
+// the field that identifies it for the inbound's type, and no two users may
+// share it. Inbound types without users pass.
+func ValidateInboundUsers(inbound map[string]interface{}) error {
+	inboundType, _ := inbound["type"].(string)
+	key, ok := inboundUserKeys[inboundType]
+	if !ok {
+		return nil
+	}
+	users, _ := inbound["users"].([]interface{})
+
+	var errs ValidationErrors
+	seen := make(map[string]int)
+	for i, user := range users {
+		path := fmt.Sprintf("users[%d]", i)
+		userMap, ok := user.(map[string]interface{})
+		if !ok {
+			errs = append(errs, &FieldError{Path: path, Message: "must be an object"})
+			continue
+		}
+		id, _ := userMap[key].(string)
+		if id == "" {
+			errs = append(errs, &FieldError{Path: path + "." + key, Message: "is required"})
+			continue
+		}
+		if first, ok := seen[id]; ok {
+			errs = append(errs, &FieldError{Path: path + "." + key, Message: fmt.Sprintf("duplicates users[%d]", first)})
+			continue
+		}
+		seen[id] = i
+	}
+	return errs.err()
+}
+
+// validateMap decodes value into target, a pointer to a generated type, and
+// validates it if the type has required fields. Values of the wrong type are
+// left for sing-box to report; only missing required fields are checked here.
+func validateMap(value map[string]interface{}, target interface{}) error {
+	validator, ok := target.(Validator)
+	if !ok {
+		return nil
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to encode value: %w", err)
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if err := json.Unmarshal(data, target); err != nil && !errors.As(err, &typeErr) {
+		return fmt.Errorf("failed to decode value: %w", err)
+	}
+	return validator.Validate()
+}
@@ -2,19 +2,28 @@ package watcher
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
+	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
 )
 
+// rewatchInterval is how often a removed watch directory is checked for
+// having been recreated
+const rewatchInterval = 500 * time.Millisecond
+
 // Watcher watches for configuration file changes
 type Watcher struct {
 	configPath string
+	dirMode    bool   // configPath is a directory of *.json fragments
+	dir        string // the watched directory
 	watcher    *fsnotify.Watcher
 	onChange   func()
 	stopCh     chan struct{}
+	rewatchCh  chan struct{} // signalled once the directory is watched again
 }
 
 // NewWatcher creates a new file watcher
@@ -29,11 +38,17 @@ func NewWatcher(configPath string, onChange func()) (*Watcher, error) {
 		watcher:    fw,
 		onChange:   onChange,
 		stopCh:     make(chan struct{}),
+		rewatchCh:  make(chan struct{}, 1),
 	}
 
 	// Watch the directory containing the config file
 	// (watching the file directly doesn't work well with editors that replace files)
 	dir := filepath.Dir(configPath)
+	if info, err := os.Stat(configPath); err == nil && info.IsDir() {
+		w.dirMode = true
+		dir = configPath
+	}
+	w.dir = filepath.Clean(dir)
 	if err := fw.Add(dir); err != nil {
 		fw.Close()
 		return nil, fmt.Errorf("failed to watch directory: %w", err)
@@ -57,6 +72,17 @@ func (w *Watcher) Stop() {
 func (w *Watcher) watch() {
 	// Debounce rapid fire events
 	var timer *time.Timer
+	changed := func() {
+		if timer != nil {
+			timer.Stop()
+		}
+		timer = time.AfterFunc(500*time.Millisecond, func() {
+			slog.Info("config file changed", "path", w.configPath)
+			if w.onChange != nil {
+				w.onChange()
+			}
+		})
+	}
 
 	for {
 		select {
@@ -65,32 +91,75 @@ func (w *Watcher) watch() {
 				return
 			}
 
-			// Only trigger on events for our config file
-			if filepath.Clean(event.Name) == filepath.Clean(w.configPath) {
-				// Check if it's a write or create event
-				if event.Op&fsnotify.Write == fsnotify.Write ||
-				   event.Op&fsnotify.Create == fsnotify.Create {
-					// Debounce: reset timer on each event
-					if timer != nil {
-						timer.Stop()
-					}
-					timer = time.AfterFunc(500*time.Millisecond, func() {
-						log.Printf("Config file changed: %s", w.configPath)
-						if w.onChange != nil {
-							w.onChange()
-						}
-					})
-				}
+			// The watch ends when its directory is removed or moved away,
+			// as deploy tools that replace the whole directory do
+			if filepath.Clean(event.Name) == w.dir && event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+				slog.Warn("watched config directory went away, waiting for it to return", "path", w.dir)
+				changed()
+				go w.rewatch()
+				continue
+			}
+
+			// Only trigger on events for our config file, including its
+			// removal by an atomic replace
+			if w.matches(event.Name) && event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Remove|fsnotify.Rename) != 0 {
+				changed()
 			}
 
+		case <-w.rewatchCh:
+			// Whatever replaced the directory may hold a different config
+			changed()
+
 		case err, ok := <-w.watcher.Errors:
 			if !ok {
 				return
 			}
-			log.Printf("Watcher error: %v", err)
+			slog.Warn("watcher error", "error", err)
 
 		case <-w.stopCh:
+			if timer != nil {
+				timer.Stop()
+			}
 			return
 		}
 	}
 }
+
+// rewatch polls until the watched directory exists again and watches it
+// anew, since fsnotify drops the watch of a removed directory for good
+func (w *Watcher) rewatch() {
+	ticker := time.NewTicker(rewatchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stopCh:
+			return
+		case <-ticker.C:
+		}
+
+		if info, err := os.Stat(w.dir); err != nil || !info.IsDir() {
+			continue
+		}
+		if err := w.watcher.Add(w.dir); err != nil {
+			slog.Warn("failed to watch config directory again", "path", w.dir, "error", err)
+			continue
+		}
+		slog.Info("watching config directory again", "path", w.dir)
+
+		select {
+		case w.rewatchCh <- struct{}{}:
+		default:
+		}
+		return
+	}
+}
+
+// matches reports whether path is the config file, or one of its fragments
+// in directory mode
+func (w *Watcher) matches(path string) bool {
+	if w.dirMode {
+		return filepath.Dir(filepath.Clean(path)) == filepath.Clean(w.configPath) && strings.HasSuffix(path, ".json")
+	}
+	return filepath.Clean(path) == filepath.Clean(w.configPath)
+}
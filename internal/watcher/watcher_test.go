@@ -0,0 +1,46 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatcherFollowsRecreatedDirectory(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "conf.d")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	changes := make(chan struct{}, 16)
+	w, err := NewWatcher(dir, func() { changes <- struct{}{} })
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Start()
+	defer w.Stop()
+
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// Give the watcher time to watch the new directory and report the
+	// replacement, then forget those changes
+	time.Sleep(4 * rewatchInterval)
+	for len(changes) > 0 {
+		<-changes
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "outbounds.json"), []byte(`{"outbounds":[]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changes:
+	case <-time.After(3 * time.Second):
+		t.Fatal("onChange was not called for a fragment written after the directory was recreated")
+	}
+}
@@ -0,0 +1,29 @@
+// API error helpers
+(function() {
+    'use strict';
+
+    /**
+     * Extract a human-readable message from a failed API response body.
+     * API handlers return {code, message, details}; anything else is
+     * returned as-is so older plain-text errors still display.
+     */
+    function apiErrorMessage(body) {
+        if (body && typeof body === 'object' && 'responseText' in body) {
+            body = body.responseText;
+        }
+        if (!body) {
+            return 'Request failed';
+        }
+        try {
+            const data = JSON.parse(body);
+            if (data && data.message) {
+                return data.message;
+            }
+        } catch (e) {
+            // Not JSON, fall through to the raw text
+        }
+        return String(body).trim();
+    }
+
+    window.apiErrorMessage = apiErrorMessage;
+})();
@@ -12,15 +12,19 @@ class ConnectionsManager {
             status: 'all' // all, open, closed
         };
         this.sortBy = 'start-desc';
+        this.groupBy = '';
+        this.groups = [];
         this.selectedConnection = null;
         this.outbounds = [];
         this.reconnectAttempts = 0;
         this.maxReconnectAttempts = 5;
+        this.saveTimer = null;
 
         this.init();
     }
 
     init() {
+        this.restoreFilters();
         this.setupEventListeners();
         this.connectWebSocket();
         this.loadOutbounds();
@@ -31,33 +35,48 @@ class ConnectionsManager {
         document.getElementById('search-input').addEventListener('input', (e) => {
             this.filters.search = e.target.value.toLowerCase();
             this.applyFiltersAndSort();
+            this.saveFilters();
         });
 
         // Filter selects
         document.getElementById('filter-network').addEventListener('change', (e) => {
             this.filters.network = e.target.value;
             this.applyFiltersAndSort();
+            this.saveFilters();
         });
 
         document.getElementById('filter-source').addEventListener('change', (e) => {
             this.filters.source = e.target.value;
             this.applyFiltersAndSort();
+            this.saveFilters();
         });
 
         document.getElementById('filter-chain').addEventListener('change', (e) => {
             this.filters.chain = e.target.value;
             this.applyFiltersAndSort();
+            this.saveFilters();
         });
 
         document.getElementById('filter-status').addEventListener('change', (e) => {
             this.filters.status = e.target.value;
             this.applyFiltersAndSort();
+            this.saveFilters();
         });
 
         // Sort select
         document.getElementById('sort-by').addEventListener('change', (e) => {
             this.sortBy = e.target.value;
             this.applyFiltersAndSort();
+            this.saveFilters();
+        });
+
+        // Group select - the server rolls the connections up, so reconnect
+        document.getElementById('group-by').addEventListener('change', (e) => {
+            this.groupBy = e.target.value;
+            this.connections = [];
+            this.groups = [];
+            this.saveFilters();
+            this.reconnectWebSocket();
         });
 
         // Clear filters button
@@ -79,7 +98,10 @@ class ConnectionsManager {
 
     connectWebSocket() {
         const wsProtocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
-        const wsUrl = `${wsProtocol}//${window.location.host}/ws/connections`;
+        let wsUrl = `${wsProtocol}//${window.location.host}/ws/connections?rates=true`;
+        if (this.groupBy) {
+            wsUrl += `&group=${encodeURIComponent(this.groupBy)}`;
+        }
 
         this.updateStatus('Connecting...', 'connecting');
 
@@ -95,6 +117,24 @@ class ConnectionsManager {
             this.ws.onmessage = (event) => {
                 try {
                     const data = JSON.parse(event.data);
+                    if (data.type === 'reconnecting') {
+                        // The server lost Clash and is redialing it
+                        this.updateStatus('Reconnecting to Clash...', 'connecting');
+                        return;
+                    }
+                    if (data.type === 'reconnected') {
+                        this.updateStatus('Connected', 'connected');
+                        return;
+                    }
+                    if (data.error) {
+                        console.error('Connections proxy error:', data.error);
+                        this.updateStatus(data.error, 'error');
+                        return;
+                    }
+                    if (data.groups) {
+                        this.handleGroupsUpdate(data);
+                        return;
+                    }
                     this.handleConnectionsUpdate(data);
                 } catch (error) {
                     console.error('Failed to parse WebSocket message:', error);
@@ -117,6 +157,17 @@ class ConnectionsManager {
         }
     }
 
+    // reconnectWebSocket opens a new stream after the grouping changed,
+    // closing the old one without counting it as a lost connection
+    reconnectWebSocket() {
+        if (this.ws) {
+            this.ws.onclose = null;
+            this.ws.close();
+        }
+        this.reconnectAttempts = 0;
+        this.connectWebSocket();
+    }
+
     attemptReconnect() {
         if (this.reconnectAttempts < this.maxReconnectAttempts) {
             this.reconnectAttempts++;
@@ -166,10 +217,19 @@ class ConnectionsManager {
         this.applyFiltersAndSort();
     }
 
+    handleGroupsUpdate(data) {
+        this.groups = data.groups;
+        this.updateStats(data);
+        this.renderGroups();
+    }
+
     updateStats(data) {
-        document.getElementById('stat-count').textContent = (data.connections || []).length;
+        const count = data.groups ? data.connectionCount : (data.connections || []).length;
+        document.getElementById('stat-count').textContent = count || 0;
         document.getElementById('stat-upload').textContent = this.formatBytes(data.uploadTotal || 0);
         document.getElementById('stat-download').textContent = this.formatBytes(data.downloadTotal || 0);
+        document.getElementById('stat-up-rate').textContent = this.formatBytes(data.upRate || 0) + '/s';
+        document.getElementById('stat-down-rate').textContent = this.formatBytes(data.downRate || 0) + '/s';
         document.getElementById('stat-memory').textContent = this.formatBytes(data.memory || 0);
     }
 
@@ -189,7 +249,7 @@ class ConnectionsManager {
 
         // Update source filter
         const sourceSelect = document.getElementById('filter-source');
-        const currentSource = sourceSelect.value;
+        const currentSource = this.filters.source;
         sourceSelect.innerHTML = '<option value="">All Sources</option>';
         Array.from(sources).sort().forEach(source => {
             const option = document.createElement('option');
@@ -201,7 +261,7 @@ class ConnectionsManager {
 
         // Update chain filter
         const chainSelect = document.getElementById('filter-chain');
-        const currentChain = chainSelect.value;
+        const currentChain = this.filters.chain;
         chainSelect.innerHTML = '<option value="">All Chains</option>';
         Array.from(chains).sort().forEach(chain => {
             const option = document.createElement('option');
@@ -213,6 +273,13 @@ class ConnectionsManager {
     }
 
     applyFiltersAndSort() {
+        // Grouped snapshots carry no connections to filter, only the search
+        // applies to them
+        if (this.groupBy) {
+            this.renderGroups();
+            return;
+        }
+
         // Apply filters
         this.filteredConnections = this.connections.filter(conn => {
             // Status filter
@@ -336,6 +403,39 @@ class ConnectionsManager {
         tbody.innerHTML = html;
     }
 
+    renderGroups() {
+        const tbody = document.getElementById('connections-tbody');
+        const groups = this.groups.filter(group =>
+            !this.filters.search || JSON.stringify(group).toLowerCase().includes(this.filters.search)
+        );
+
+        if (groups.length === 0) {
+            tbody.innerHTML = `
+                <tr class="empty-state-row">
+                    <td colspan="11">
+                        <div class="empty-state">
+                            <p>No connections found</p>
+                        </div>
+                    </td>
+                </tr>
+            `;
+            return;
+        }
+
+        tbody.innerHTML = groups.map(group => `
+            <tr class="chain-group-header">
+                <td colspan="11">
+                    <div class="chain-group-label">
+                        <span class="chain-name" title="${this.escapeHtml(group.key)}">${this.escapeHtml(this.truncate(group.key, 60))}</span>
+                        <span class="chain-count">${group.count} connection${group.count !== 1 ? 's' : ''}</span>
+                        <span class="traffic-cell">↑ ${this.formatBytes(group.upload)} ↓ ${this.formatBytes(group.download)}</span>
+                        <span class="connection-address">${this.escapeHtml(group.destinations.join(', '))}${group.count > group.destinations.length ? ', ...' : ''}</span>
+                    </div>
+                </td>
+            </tr>
+        `).join('');
+    }
+
     groupConnectionsByChain(connections) {
         const groups = new Map();
 
@@ -531,6 +631,45 @@ class ConnectionsManager {
         document.getElementById('filter-status').value = 'all';
 
         this.applyFiltersAndSort();
+        this.saveFilters();
+    }
+
+    // restoreFilters applies the filters the server remembered for this
+    // browser. Source and chain options only exist once connections arrive,
+    // so those selects are set when their options are rebuilt.
+    restoreFilters() {
+        const saved = document.getElementById('connection-filters').dataset.saved;
+        if (!saved) return;
+
+        try {
+            const state = JSON.parse(saved);
+            this.filters = { ...this.filters, ...state.filters };
+            if (state.sortBy) this.sortBy = state.sortBy;
+            if (state.groupBy) this.groupBy = state.groupBy;
+        } catch (error) {
+            console.error('Ignoring saved connection filters:', error);
+            return;
+        }
+
+        document.getElementById('search-input').value = this.filters.search;
+        document.getElementById('filter-network').value = this.filters.network;
+        document.getElementById('filter-status').value = this.filters.status;
+        document.getElementById('sort-by').value = this.sortBy;
+        document.getElementById('group-by').value = this.groupBy;
+    }
+
+    // saveFilters remembers the filters on the server, debounced so typing
+    // in the search box sends one request
+    saveFilters() {
+        clearTimeout(this.saveTimer);
+        this.saveTimer = setTimeout(() => {
+            const body = new URLSearchParams({
+                key: 'connections.filter',
+                value: JSON.stringify({ filters: this.filters, sortBy: this.sortBy, groupBy: this.groupBy })
+            });
+            fetch('/api/ui-state', { method: 'POST', body })
+                .catch(error => console.error('Error saving connection filters:', error));
+        }, 500);
     }
 
     formatBytes(bytes) {
@@ -623,7 +762,7 @@ async function createRuleFromConnection() {
             alert('Rule created successfully!');
             closeRuleModal();
         } else {
-            const error = await response.text();
+            const error = apiErrorMessage(await response.text());
             alert('Failed to create rule: ' + error);
         }
     } catch (error) {